@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"log"
 	"os"
 
@@ -10,10 +11,22 @@ import (
 	swaggerFiles "github.com/swaggo/files"
 	ginSwagger "github.com/swaggo/gin-swagger"
 
+	"github.com/Candoo/vehicles-api/internal/apperr"
 	"github.com/Candoo/vehicles-api/internal/config"
 	"github.com/Candoo/vehicles-api/internal/database"
+	"github.com/Candoo/vehicles-api/internal/events"
+	"github.com/Candoo/vehicles-api/internal/finance"
+	"github.com/Candoo/vehicles-api/internal/geo"
 	"github.com/Candoo/vehicles-api/internal/handlers"
+	"github.com/Candoo/vehicles-api/internal/ingest"
+	"github.com/Candoo/vehicles-api/internal/middleware"
+	"github.com/Candoo/vehicles-api/internal/models"
+	"github.com/Candoo/vehicles-api/internal/payment"
 	"github.com/Candoo/vehicles-api/internal/repository"
+	"github.com/Candoo/vehicles-api/internal/reservation"
+	"github.com/Candoo/vehicles-api/internal/testdrive"
+	"github.com/Candoo/vehicles-api/internal/valuation"
+	"github.com/Candoo/vehicles-api/internal/webhook"
 	_ "github.com/Candoo/vehicles-api/docs"
 )
 
@@ -32,6 +45,11 @@ import (
 // @BasePath /
 // @schemes http https
 
+// @securityDefinitions.apikey BearerAuth
+// @in header
+// @name Authorization
+// @description API key or JWT as "Bearer <token>". API keys may also be sent in X-API-Key.
+
 func main() {
 	// Load environment variables
 	if err := godotenv.Load(); err != nil {
@@ -57,9 +75,84 @@ func main() {
 		log.Printf("Warning: Failed to seed database: %v", err)
 	}
 
-	// Initialize repository and handlers
+	// Load the postcode table for near searches; without it only coordinates are accepted
+	postcodes, err := geo.LoadPostcodes(cfg.PostcodesFile)
+	if err != nil {
+		log.Printf("Warning: Failed to load postcodes from %s: %v", cfg.PostcodesFile, err)
+	} else {
+		log.Printf("Loaded %d postcodes from %s", postcodes.Len(), cfg.PostcodesFile)
+	}
+
+	// Load the finance rates; a broken rates file must not quote wrong APRs
+	financeRates := finance.DefaultTable()
+	if cfg.FinanceRatesFile != "" {
+		if financeRates, err = finance.LoadTable(cfg.FinanceRatesFile); err != nil {
+			log.Fatalf("Failed to load finance rates: %v", err)
+		}
+	}
+
+	// Payment provider for reservation deposits. Without one, online reservations are
+	// turned off rather than taken without money; the rest of the API still serves.
+	var payments payment.Provider
+	switch cfg.PaymentProvider {
+	case "":
+		log.Printf("Warning: PAYMENT_PROVIDER is not set; online reservations are disabled")
+	case "fake":
+		if cfg.GinMode == "release" {
+			log.Printf("Warning: The fake payment provider cannot be used with GIN_MODE=release; online reservations are disabled")
+			break
+		}
+		payments = payment.NewFake()
+		log.Printf("Reservation deposits use the fake payment provider; no money is taken")
+	default:
+		log.Printf("Warning: Unknown payment provider %q; online reservations are disabled", cfg.PaymentProvider)
+	}
+
+	// Vehicle changes record events in the outbox, which are relayed to the bus,
+	// queued for delivery to webhooks and streamed live to clients of
+	// GET /vehicles/stream. Webhooks subscribe first so an event that cannot be
+	// queued is retried before it reaches the stream.
+	bus := events.NewBus()
+	webhookRepo := repository.NewWebhookRepository(db)
+	bus.Subscribe(webhook.NewDispatcher(webhookRepo).Handle)
+	stream := events.NewStream(events.DefaultStreamSize)
+	bus.Subscribe(func(event models.VehicleEvent) error {
+		stream.Publish(event)
+		return nil
+	})
+
+	// Initialize repositories
 	vehicleRepo := repository.NewVehicleRepository(db)
-	vehicleHandler := handlers.NewVehicleHandler(vehicleRepo)
+	reservationRepo := repository.NewReservationRepository(db)
+	apiKeyRepo := repository.NewAPIKeyRepository(db)
+
+	// Start the scheduled stock feed sync
+	var feedSource ingest.Source
+	switch {
+	case cfg.FeedURL != "":
+		feedSource = ingest.NewHTTPSource(cfg.FeedURL)
+	case cfg.FeedFile != "":
+		feedSource = ingest.NewFileSource(cfg.FeedFile)
+	}
+	if feedSource != nil {
+		syncer := ingest.NewSyncer(feedSource, vehicleRepo)
+		go syncer.Start(context.Background(), cfg.FeedSyncInterval)
+		log.Printf("Feed sync from %s scheduled every %s", feedSource.Name(), cfg.FeedSyncInterval)
+	}
+
+	// Serve online reservations when deposits can be taken, expiring those that run
+	// out and releasing their deposits
+	var reservationHandler *handlers.ReservationHandler
+	if payments != nil {
+		reservationHandler = handlers.NewReservationHandler(vehicleRepo, reservationRepo, payments, cfg.ReservationDeposit, cfg.ReservationHold)
+		go reservation.NewExpirer(reservationRepo, payments).Start(context.Background(), cfg.ReservationExpiryInterval)
+	}
+
+	// Publish the events recorded in the outbox
+	go events.NewRelay(vehicleRepo, bus).Start(context.Background(), cfg.EventRelayInterval)
+
+	// Send queued webhook deliveries, retrying failures with backoff
+	go webhook.NewWorker(webhookRepo, cfg.WebhookMaxAttempts, cfg.WebhookTimeout).Start(context.Background(), cfg.WebhookInterval)
 
 	// Set Gin mode
 	if os.Getenv("GIN_MODE") == "release" {
@@ -72,26 +165,42 @@ func main() {
 	// CORS middleware
 	r.Use(cors.New(cors.Config{
 		AllowOrigins:     []string{"*"},
-		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization"},
-		ExposeHeaders:    []string{"Content-Length"},
+		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization", "X-API-Key", "X-Request-ID"},
+		ExposeHeaders:    []string{"Content-Length", "X-Request-ID"},
 		AllowCredentials: true,
 	}))
 
+	// Request IDs and RFC 7807 error responses for every handler
+	r.Use(middleware.RequestID(), middleware.Errors())
+	r.NoRoute(func(c *gin.Context) {
+		c.Error(apperr.NotFound("route not found"))
+	})
+
+	// Authentication middleware: resolves the caller identity, anonymous callers get the public role
+	r.Use(middleware.Authenticate(apiKeyRepo, middleware.AuthConfig{
+		JWTSecret:         []byte(cfg.JWTSecret),
+		BootstrapAdminKey: cfg.BootstrapAdminKey,
+	}))
+
 	// Health check endpoint
 	r.GET("/health", func(c *gin.Context) {
 		c.JSON(200, gin.H{"status": "healthy"})
 	})
 
 	// API routes
-	api := r.Group("/")
-	{
-		api.GET("/vehicles", vehicleHandler.GetVehicles)
-		api.GET("/vehicles/makes", vehicleHandler.GetAvailableMakes)
-		api.GET("/vehicles/models", vehicleHandler.GetAvailableModels)
-		api.GET("/vehicles/vrm/:vrm", vehicleHandler.GetVehicleByVRM)
-		api.GET("/vehicles/:id", vehicleHandler.GetVehicleByID)
-	}
+	handlers.RegisterRoutes(r, handlers.Handlers{
+		Vehicles:      handlers.NewVehicleHandler(vehicleRepo, postcodes),
+		Sites:         handlers.NewSiteHandler(vehicleRepo, vehicleRepo, postcodes),
+		Finance:       handlers.NewFinanceHandler(vehicleRepo, financeRates),
+		PartExchanges: handlers.NewPartExchangeHandler(vehicleRepo, vehicleRepo, valuation.NewEstimator(vehicleRepo)),
+		Leads:         handlers.NewLeadHandler(vehicleRepo, repository.NewLeadRepository(db)),
+		TestDrives:    handlers.NewTestDriveHandler(vehicleRepo, vehicleRepo, repository.NewTestDriveRepository(db), testdrive.DefaultSchedule()),
+		Reservations:  reservationHandler,
+		Webhooks:      handlers.NewWebhookHandler(webhookRepo),
+		Stream:        handlers.NewStreamHandler(vehicleRepo, postcodes, stream),
+		APIKeys:       handlers.NewAPIKeyHandler(apiKeyRepo, []byte(cfg.JWTSecret), cfg.JWTTTL),
+	})
 
 	// Swagger documentation
 	r.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
@@ -0,0 +1,145 @@
+// Package apperr defines the typed errors shared by the repository, handlers and
+// middleware. Callers test an error's kind with errors.Is against the sentinels,
+// e.g. errors.Is(err, apperr.ErrNotFound), instead of comparing messages.
+package apperr
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Error kinds
+var (
+	ErrNotFound     = errors.New("not found")
+	ErrConflict     = errors.New("conflict")
+	ErrValidation   = errors.New("validation failed")
+	ErrUnavailable  = errors.New("service unavailable")
+	ErrBadGateway   = errors.New("bad gateway")
+	ErrUnauthorized = errors.New("unauthorized")
+	ErrForbidden    = errors.New("forbidden")
+	ErrPayment      = errors.New("payment required")
+)
+
+// Error is a typed error with a message that is safe to show to API clients
+type Error struct {
+	// Kind is one of the sentinel errors above
+	Kind error
+	// Message describes the problem to the client
+	Message string
+	// Err is the underlying cause, logged but never shown to clients
+	Err error
+	// Fields lists the individual problems of a validation error
+	Fields []FieldError
+}
+
+// FieldError is one problem with one input field
+type FieldError struct {
+	Field  string `json:"field" example:"min_price"`
+	Reason string `json:"reason" example:"must be a non-negative amount"`
+}
+
+// Error returns the message, followed by the field problems or the cause
+func (e *Error) Error() string {
+	message := e.Message
+	for i, field := range e.Fields {
+		separator := ", "
+		if i == 0 {
+			separator = ": "
+		}
+		message += separator + field.Field + " " + field.Reason
+	}
+	if e.Err != nil {
+		message += ": " + e.Err.Error()
+	}
+	return message
+}
+
+// Is matches the error's kind
+func (e *Error) Is(target error) bool {
+	return target == e.Kind
+}
+
+// Unwrap returns the underlying cause
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Problem is an RFC 7807 problem details body
+type Problem struct {
+	Type      string `json:"type" example:"about:blank"`
+	Title     string `json:"title" example:"Not Found"`
+	Status    int    `json:"status" example:"404"`
+	Detail    string `json:"detail" example:"vehicle not found"`
+	Instance  string `json:"instance" example:"/vehicles/42"`
+	RequestID string `json:"request_id" example:"3f2b8c1d9e4a4b6f8a7c5d2e1f0a9b8c"`
+	// Errors lists each invalid field of a validation problem
+	Errors []FieldError `json:"errors,omitempty"`
+}
+
+// NotFound reports a missing resource
+func NotFound(format string, args ...interface{}) error {
+	return &Error{Kind: ErrNotFound, Message: fmt.Sprintf(format, args...)}
+}
+
+// Conflict reports a request that clashes with the current state of a resource
+func Conflict(format string, args ...interface{}) error {
+	return &Error{Kind: ErrConflict, Message: fmt.Sprintf(format, args...)}
+}
+
+// Validation reports invalid input
+func Validation(format string, args ...interface{}) error {
+	return &Error{Kind: ErrValidation, Message: fmt.Sprintf(format, args...)}
+}
+
+// Unauthorized reports missing or invalid credentials
+func Unauthorized(format string, args ...interface{}) error {
+	return &Error{Kind: ErrUnauthorized, Message: fmt.Sprintf(format, args...)}
+}
+
+// Forbidden reports a caller without permission for the request
+func Forbidden(format string, args ...interface{}) error {
+	return &Error{Kind: ErrForbidden, Message: fmt.Sprintf(format, args...)}
+}
+
+// Payment reports a payment that was declined, with a message safe to show the customer
+func Payment(format string, args ...interface{}) error {
+	return &Error{Kind: ErrPayment, Message: fmt.Sprintf(format, args...)}
+}
+
+// Unavailable reports that a dependency such as the database could not be reached
+func Unavailable(err error, format string, args ...interface{}) error {
+	return &Error{Kind: ErrUnavailable, Message: fmt.Sprintf(format, args...), Err: err}
+}
+
+// BadGateway reports that a service such as the payment provider failed a request
+func BadGateway(err error, format string, args ...interface{}) error {
+	return &Error{Kind: ErrBadGateway, Message: fmt.Sprintf(format, args...), Err: err}
+}
+
+// Message returns the client-facing message of a typed error, or "" for other errors
+func Message(err error) string {
+	var typed *Error
+	if errors.As(err, &typed) {
+		return typed.Message
+	}
+	return ""
+}
+
+// Fields returns the field problems of a validation error
+func Fields(err error) []FieldError {
+	var typed *Error
+	if errors.As(err, &typed) {
+		return typed.Fields
+	}
+	return nil
+}
+
+// InvalidFields reports every problem found in a set of input fields at once
+func InvalidFields(message string, fields []FieldError) error {
+	return &Error{Kind: ErrValidation, Message: message, Fields: fields}
+}
+
+// Invalid marks err as a validation error, using its text as the client-facing message
+func Invalid(err error) error {
+	return &Error{Kind: ErrValidation, Message: err.Error()}
+}
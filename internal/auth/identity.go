@@ -0,0 +1,49 @@
+package auth
+
+import (
+	"context"
+
+	"github.com/Candoo/vehicles-api/internal/models"
+)
+
+// Authentication methods
+const (
+	MethodAnonymous = "anonymous"
+	MethodAPIKey    = "api_key"
+	MethodJWT       = "jwt"
+)
+
+// Identity describes the caller of a request
+type Identity struct {
+	Subject string
+	Role    models.Role
+	Method  string
+	KeyID   uint
+}
+
+// Anonymous is the identity of callers without credentials
+var Anonymous = Identity{
+	Subject: "anonymous",
+	Role:    models.RolePublic,
+	Method:  MethodAnonymous,
+}
+
+// Authenticated reports whether the caller presented valid credentials
+func (i Identity) Authenticated() bool {
+	return i.Method != MethodAnonymous
+}
+
+type identityKey struct{}
+
+// WithIdentity returns a copy of ctx carrying the caller identity
+func WithIdentity(ctx context.Context, identity Identity) context.Context {
+	return context.WithValue(ctx, identityKey{}, identity)
+}
+
+// FromContext returns the caller identity, or Anonymous when none is attached
+func FromContext(ctx context.Context) Identity {
+	if identity, ok := ctx.Value(identityKey{}).(Identity); ok {
+		return identity
+	}
+	return Anonymous
+}
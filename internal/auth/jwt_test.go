@@ -0,0 +1,92 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Candoo/vehicles-api/internal/models"
+)
+
+var testSecret = []byte("test-secret")
+
+func testClaims(now time.Time) Claims {
+	return Claims{
+		Subject:   "jane.smith",
+		Role:      models.RoleStaff,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(time.Hour).Unix(),
+	}
+}
+
+func TestJWTRoundTrip(t *testing.T) {
+	now := time.Now()
+	token, err := SignJWT(testClaims(now), testSecret)
+	if err != nil {
+		t.Fatalf("SignJWT: %v", err)
+	}
+
+	claims, err := VerifyJWT(token, testSecret, now)
+	if err != nil {
+		t.Fatalf("VerifyJWT: %v", err)
+	}
+	if claims.Subject != "jane.smith" || claims.Role != models.RoleStaff {
+		t.Errorf("claims = %+v", claims)
+	}
+}
+
+func TestVerifyJWTRejectsBadTokens(t *testing.T) {
+	now := time.Now()
+	token, err := SignJWT(testClaims(now), testSecret)
+	if err != nil {
+		t.Fatalf("SignJWT: %v", err)
+	}
+	parts := strings.Split(token, ".")
+
+	escalated, _ := SignJWT(Claims{Subject: "jane.smith", Role: models.RoleAdmin, ExpiresAt: now.Add(time.Hour).Unix()}, []byte("other-secret"))
+	noneHeader := "eyJhbGciOiJub25lIiwidHlwIjoiSldUIn0"
+
+	tests := map[string]string{
+		"wrong secret":     escalated,
+		"tampered payload": parts[0] + "." + strings.Split(escalated, ".")[1] + "." + parts[2],
+		"alg none":         noneHeader + "." + parts[1] + ".",
+		"not a jwt":        "vk_abc",
+	}
+	for name, token := range tests {
+		if _, err := VerifyJWT(token, testSecret, now); err != ErrInvalidToken {
+			t.Errorf("%s: err = %v, want ErrInvalidToken", name, err)
+		}
+	}
+}
+
+func TestVerifyJWTRejectsExpiredToken(t *testing.T) {
+	now := time.Now()
+	token, err := SignJWT(testClaims(now), testSecret)
+	if err != nil {
+		t.Fatalf("SignJWT: %v", err)
+	}
+
+	if _, err := VerifyJWT(token, testSecret, now.Add(2*time.Hour)); err != ErrExpiredToken {
+		t.Errorf("err = %v, want ErrExpiredToken", err)
+	}
+}
+
+func TestAPIKeyRoundTrip(t *testing.T) {
+	key, prefix, err := GenerateAPIKey()
+	if err != nil {
+		t.Fatalf("GenerateAPIKey: %v", err)
+	}
+
+	parsed, err := ParseAPIKey(key)
+	if err != nil || parsed != prefix {
+		t.Fatalf("ParseAPIKey = %q, %v; want %q", parsed, err, prefix)
+	}
+
+	hash := HashAPIKey(key)
+	if !MatchAPIKey(key, hash) {
+		t.Error("key does not match its own hash")
+	}
+	if MatchAPIKey(key+"x", hash) {
+		t.Error("altered key matched")
+	}
+}
@@ -0,0 +1,57 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"strings"
+)
+
+// APIKeyPrefix starts every API key so keys can be told apart from JWTs
+const APIKeyPrefix = "vk_"
+
+// ErrMalformedAPIKey is returned for strings that are not API keys
+var ErrMalformedAPIKey = errors.New("malformed API key")
+
+// GenerateAPIKey returns a new key of the form vk_<prefix>_<secret> and its lookup prefix
+func GenerateAPIKey() (key, prefix string, err error) {
+	prefixBytes := make([]byte, 4)
+	secretBytes := make([]byte, 32)
+	if _, err := rand.Read(prefixBytes); err != nil {
+		return "", "", err
+	}
+	if _, err := rand.Read(secretBytes); err != nil {
+		return "", "", err
+	}
+
+	prefix = hex.EncodeToString(prefixBytes)
+	key = APIKeyPrefix + prefix + "_" + hex.EncodeToString(secretBytes)
+	return key, prefix, nil
+}
+
+// ParseAPIKey extracts the lookup prefix from an API key
+func ParseAPIKey(key string) (prefix string, err error) {
+	if !strings.HasPrefix(key, APIKeyPrefix) {
+		return "", ErrMalformedAPIKey
+	}
+
+	prefix, secret, ok := strings.Cut(strings.TrimPrefix(key, APIKeyPrefix), "_")
+	if !ok || prefix == "" || secret == "" {
+		return "", ErrMalformedAPIKey
+	}
+	return prefix, nil
+}
+
+// HashAPIKey hashes a key for storage. Keys carry 256 bits of randomness so a plain
+// SHA-256 is enough; a slow password hash would only add latency to every request.
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// MatchAPIKey compares a presented key against a stored hash in constant time
+func MatchAPIKey(key, hash string) bool {
+	return subtle.ConstantTimeCompare([]byte(HashAPIKey(key)), []byte(hash)) == 1
+}
@@ -1,7 +1,12 @@
 package config
 
 import (
+	"log"
 	"os"
+	"strconv"
+	"time"
+
+	"github.com/Candoo/vehicles-api/internal/models"
 )
 
 // Config holds the application configuration
@@ -14,6 +19,39 @@ type Config struct {
 	DBSSLMode  string
 	APIPort    string
 	GinMode    string
+
+	// Stock feed sync; disabled when neither FeedURL nor FeedFile is set
+	FeedURL          string
+	FeedFile         string
+	FeedSyncInterval time.Duration
+
+	// Offline postcode to coordinate table used by near searches
+	PostcodesFile string
+
+	// Finance APR table; the built-in rates are used when empty
+	FinanceRatesFile string
+
+	// Online reservations: the deposit held, how long a vehicle is held for, how
+	// often held reservations are checked for expiry, and who takes the deposit
+	ReservationDeposit        models.Money
+	ReservationHold           time.Duration
+	ReservationExpiryInterval time.Duration
+	PaymentProvider           string
+
+	// How often vehicle events recorded in the outbox are published to webhooks
+	// and the live stream
+	EventRelayInterval time.Duration
+
+	// Webhooks: how often due deliveries are sent, how many attempts a delivery
+	// gets before it is dead-lettered and how long a receiver has to respond
+	WebhookInterval    time.Duration
+	WebhookMaxAttempts int
+	WebhookTimeout     time.Duration
+
+	// Authentication
+	JWTSecret         string
+	JWTTTL            time.Duration
+	BootstrapAdminKey string
 }
 
 // LoadConfig loads configuration from environment variables
@@ -27,6 +65,28 @@ func LoadConfig() *Config {
 		DBSSLMode:  getEnv("DB_SSLMODE", "disable"),
 		APIPort:    getEnv("API_PORT", "8080"),
 		GinMode:    getEnv("GIN_MODE", "debug"),
+
+		FeedURL:          getEnv("FEED_URL", ""),
+		FeedFile:         getEnv("FEED_FILE", ""),
+		FeedSyncInterval: getDurationEnv("FEED_SYNC_INTERVAL", time.Hour),
+
+		PostcodesFile:    getEnv("POSTCODES_FILE", "scripts/postcodes.csv"),
+		FinanceRatesFile: getEnv("FINANCE_RATES_FILE", ""),
+
+		ReservationDeposit:        getMoneyEnv("RESERVATION_DEPOSIT", models.MoneyFromPounds(99)),
+		ReservationHold:           getDurationEnv("RESERVATION_HOLD", 48*time.Hour),
+		ReservationExpiryInterval: getDurationEnv("RESERVATION_EXPIRY_INTERVAL", time.Minute),
+		PaymentProvider:           getEnv("PAYMENT_PROVIDER", ""),
+
+		EventRelayInterval: getDurationEnv("EVENT_RELAY_INTERVAL", time.Second),
+
+		WebhookInterval:    getDurationEnv("WEBHOOK_INTERVAL", 5*time.Second),
+		WebhookMaxAttempts: getIntEnv("WEBHOOK_MAX_ATTEMPTS", 8),
+		WebhookTimeout:     getDurationEnv("WEBHOOK_TIMEOUT", 10*time.Second),
+
+		JWTSecret:         getEnv("JWT_SECRET", ""),
+		JWTTTL:            getDurationEnv("JWT_TTL", time.Hour),
+		BootstrapAdminKey: getEnv("BOOTSTRAP_ADMIN_KEY", ""),
 	}
 }
 
@@ -38,3 +98,48 @@ func getEnv(key, defaultValue string) string {
 	}
 	return value
 }
+
+// getDurationEnv gets a duration such as "15m" from an environment variable or returns a default value
+func getDurationEnv(key string, defaultValue time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration <= 0 {
+		log.Printf("Invalid %s %q, using %s", key, value, defaultValue)
+		return defaultValue
+	}
+	return duration
+}
+
+// getIntEnv gets a positive whole number from an environment variable or returns a default value
+func getIntEnv(key string, defaultValue int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+
+	number, err := strconv.Atoi(value)
+	if err != nil || number <= 0 {
+		log.Printf("Invalid %s %q, using %d", key, value, defaultValue)
+		return defaultValue
+	}
+	return number
+}
+
+// getMoneyEnv gets an amount such as "99.00" from an environment variable or returns a default value
+func getMoneyEnv(key string, defaultValue models.Money) models.Money {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+
+	amount, err := models.ParseMoney(value)
+	if err != nil || amount <= 0 {
+		log.Printf("Invalid %s %q, using %s", key, value, defaultValue)
+		return defaultValue
+	}
+	return amount
+}
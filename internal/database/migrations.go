@@ -0,0 +1,202 @@
+package database
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/Candoo/vehicles-api/internal/models"
+	"gorm.io/gorm"
+)
+
+// moneyColumns lists the vehicle columns that hold amounts in pence
+var moneyColumns = []string{
+	"price",
+	"original_price",
+	"price_ex_vat",
+	"price_when_new",
+	"vat",
+	"vat_when_new",
+	"monthly_payment",
+}
+
+// migrateMoneyColumns converts legacy varchar price columns holding "4799.00" style
+// values into bigint columns holding pence. It runs before AutoMigrate, which cannot
+// change a column type without a USING clause.
+func migrateMoneyColumns(db *gorm.DB) error {
+	if !db.Migrator().HasTable("vehicles") {
+		return nil
+	}
+
+	for _, column := range moneyColumns {
+		var dataType string
+		if err := db.Raw(
+			"SELECT data_type FROM information_schema.columns WHERE table_schema = CURRENT_SCHEMA() AND table_name = ? AND column_name = ?",
+			"vehicles", column,
+		).Scan(&dataType).Error; err != nil {
+			return fmt.Errorf("failed to inspect column %s: %w", column, err)
+		}
+
+		if dataType != "character varying" && dataType != "text" {
+			continue
+		}
+
+		log.Printf("Converting vehicles.%s to pence", column)
+		statement := fmt.Sprintf(
+			"ALTER TABLE vehicles ALTER COLUMN %[1]s TYPE bigint USING ROUND(NULLIF(TRIM(%[1]s), '')::numeric * 100)::bigint",
+			column,
+		)
+		if err := db.Exec(statement).Error; err != nil {
+			return fmt.Errorf("failed to convert column %s: %w", column, err)
+		}
+	}
+
+	return nil
+}
+
+// addSearchVector adds the generated full-text search column and its GIN index.
+// Name and derivative weigh most, then key features, then the free-text descriptions.
+func addSearchVector(db *gorm.DB) error {
+	statements := []string{
+		`ALTER TABLE vehicles ADD COLUMN IF NOT EXISTS search_vector tsvector GENERATED ALWAYS AS (
+			setweight(to_tsvector('english', coalesce(name, '') || ' ' || coalesce(derivative, '')), 'A') ||
+			setweight(jsonb_to_tsvector('english', coalesce(key_features, '[]'::jsonb), '["string"]'), 'B') ||
+			setweight(to_tsvector('english', coalesce(description, '') || ' ' || coalesce(extra_description, '')), 'C')
+		) STORED`,
+		`CREATE INDEX IF NOT EXISTS idx_vehicles_search_vector ON vehicles USING GIN (search_vector)`,
+	}
+
+	for _, statement := range statements {
+		if err := db.Exec(statement).Error; err != nil {
+			return fmt.Errorf("failed to add search vector: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// backfillStockStatus derives the lifecycle status of existing vehicles when the
+// stock_status column is first added. Earlier feed syncs withdrew vehicles by
+// setting the feed status to WITHDRAWN; those become withdrawn and get their
+// feed status back.
+func backfillStockStatus(db *gorm.DB) error {
+	if err := db.Exec(
+		"UPDATE vehicles SET stock_status = 'withdrawn', status = 'FOR_SALE_RETAIL' WHERE status = 'WITHDRAWN'",
+	).Error; err != nil {
+		return fmt.Errorf("failed to backfill stock status: %w", err)
+	}
+	return nil
+}
+
+// prepareUniqueSlugs readies existing vehicles for the unique slug index created by
+// AutoMigrate. Missing slugs are generated, repeated slugs get the vehicle ID appended
+// on every vehicle but the first, and the old non-unique index is dropped. It runs
+// before AutoMigrate and only until the unique index exists.
+func prepareUniqueSlugs(db *gorm.DB) error {
+	if !db.Migrator().HasTable("vehicles") || db.Migrator().HasIndex(&models.Vehicle{}, "idx_vehicles_slug_unique") {
+		return nil
+	}
+
+	var missing []models.Vehicle
+	if err := db.Select("vehicle_id", "make", "model", "derivative", "stock_id").
+		Where("slug IS NULL OR slug = ''").
+		Find(&missing).Error; err != nil {
+		return fmt.Errorf("failed to find vehicles without a slug: %w", err)
+	}
+
+	for _, vehicle := range missing {
+		vehicle.FillSlugs()
+		if err := db.Model(&models.Vehicle{}).
+			Where("vehicle_id = ?", vehicle.VehicleID).
+			UpdateColumn("slug", vehicle.Slug).Error; err != nil {
+			return fmt.Errorf("failed to set slug of vehicle %d: %w", vehicle.VehicleID, err)
+		}
+	}
+
+	if len(missing) > 0 {
+		log.Printf("Generated slugs for %d vehicles", len(missing))
+	}
+
+	statements := []string{
+		`UPDATE vehicles SET slug = vehicles.slug || '-' || vehicles.vehicle_id
+		FROM (SELECT vehicle_id, ROW_NUMBER() OVER (PARTITION BY slug ORDER BY vehicle_id) AS position FROM vehicles) ranked
+		WHERE ranked.vehicle_id = vehicles.vehicle_id AND ranked.position > 1`,
+		`DROP INDEX IF EXISTS idx_vehicles_slug`,
+	}
+
+	for _, statement := range statements {
+		if err := db.Exec(statement).Error; err != nil {
+			return fmt.Errorf("failed to make slugs unique: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// createSitesFromVehicles adds a site for every site_slug the vehicles carry that has
+// no site yet, named after the vehicles' site, and links the vehicles to their sites.
+// Addresses, coordinates and opening hours are left for an admin to fill in.
+func createSitesFromVehicles(db *gorm.DB) error {
+	statements := []string{
+		`INSERT INTO sites (slug, name, opening_hours, created_at, updated_at)
+		SELECT site_slug, MIN(COALESCE(NULLIF(site, ''), site_slug)), '[]', NOW(), NOW()
+		FROM vehicles WHERE site_slug <> '' GROUP BY site_slug
+		ON CONFLICT (slug) DO NOTHING`,
+		`UPDATE vehicles SET site_id = sites.id FROM sites
+		WHERE sites.slug = vehicles.site_slug AND vehicles.site_id IS NULL`,
+	}
+
+	for _, statement := range statements {
+		if err := db.Exec(statement).Error; err != nil {
+			return fmt.Errorf("failed to create sites from vehicles: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// dropHeldReservationIndex drops the index allowing one held reservation per vehicle.
+// AutoMigrate replaces it with one that also counts reservations completing.
+func dropHeldReservationIndex(db *gorm.DB) error {
+	if err := db.Exec(`DROP INDEX IF EXISTS idx_reservations_held_vehicle`).Error; err != nil {
+		return fmt.Errorf("failed to drop held reservation index: %w", err)
+	}
+	return nil
+}
+
+// addVehicleUniqueIndexes adds the unique indexes on VRM, ignoring case, and stock ID
+// that stop two concurrent writes both creating the same vehicle. Vehicles without
+// either are left out. An index is skipped with a warning while stored vehicles
+// still share a value, until staff resolve the clash.
+func addVehicleUniqueIndexes(db *gorm.DB) error {
+	indexes := []struct {
+		name   string
+		column string
+	}{
+		{"idx_vehicles_vrm_unique", "LOWER(vrm)"},
+		{"idx_vehicles_stock_id_unique", "stock_id"},
+	}
+
+	for _, index := range indexes {
+		var clashes int64
+		if err := db.Raw(fmt.Sprintf(
+			"SELECT COUNT(*) FROM (SELECT %[1]s FROM vehicles WHERE %[1]s <> '' GROUP BY %[1]s HAVING COUNT(*) > 1) repeated",
+			index.column,
+		)).Scan(&clashes).Error; err != nil {
+			return fmt.Errorf("failed to check %s for repeated values: %w", index.column, err)
+		}
+		if clashes > 0 {
+			log.Printf("Warning: %d values of vehicles.%s are repeated; not adding %s", clashes, index.column, index.name)
+			continue
+		}
+
+		statement := fmt.Sprintf(
+			"CREATE UNIQUE INDEX IF NOT EXISTS %s ON vehicles (%s) WHERE %s <> ''",
+			index.name, index.column, index.column,
+		)
+		if err := db.Exec(statement).Error; err != nil {
+			return fmt.Errorf("failed to add %s: %w", index.name, err)
+		}
+	}
+
+	return nil
+}
@@ -25,7 +25,8 @@ func InitDB(cfg *config.Config) (*gorm.DB, error) {
 
 	// Configure GORM logger
 	gormConfig := &gorm.Config{
-		Logger: logger.Default.LogMode(logger.Info),
+		Logger:         logger.Default.LogMode(logger.Info),
+		TranslateError: true,
 	}
 
 	db, err := gorm.Open(postgres.Open(dsn), gormConfig)
@@ -41,7 +42,59 @@ func InitDB(cfg *config.Config) (*gorm.DB, error) {
 func RunMigrations(db *gorm.DB) error {
 	log.Println("Running database migrations...")
 
-	if err := db.AutoMigrate(&models.Vehicle{}); err != nil {
+	if err := migrateMoneyColumns(db); err != nil {
+		return fmt.Errorf("failed to run migrations: %w", err)
+	}
+
+	if err := prepareUniqueSlugs(db); err != nil {
+		return fmt.Errorf("failed to run migrations: %w", err)
+	}
+
+	if err := dropHeldReservationIndex(db); err != nil {
+		return fmt.Errorf("failed to run migrations: %w", err)
+	}
+
+	hadStockStatus := db.Migrator().HasColumn(&models.Vehicle{}, "stock_status")
+	hadSites := db.Migrator().HasTable(&models.Site{})
+
+	if err := db.AutoMigrate(
+		&models.Vehicle{},
+		&models.FeedSyncRun{},
+		&models.VehicleStatusChange{},
+		&models.VehiclePriceChange{},
+		&models.APIKey{},
+		&models.Site{},
+		&models.VehicleTransfer{},
+		&models.PartExchange{},
+		&models.Lead{},
+		&models.LeadEnquiry{},
+		&models.TestDrive{},
+		&models.Reservation{},
+		&models.OutboxEvent{},
+		&models.WebhookEndpoint{},
+		&models.WebhookDelivery{},
+		&models.WebhookDeadLetter{},
+	); err != nil {
+		return fmt.Errorf("failed to run migrations: %w", err)
+	}
+
+	if !hadStockStatus {
+		if err := backfillStockStatus(db); err != nil {
+			return fmt.Errorf("failed to run migrations: %w", err)
+		}
+	}
+
+	if !hadSites {
+		if err := createSitesFromVehicles(db); err != nil {
+			return fmt.Errorf("failed to run migrations: %w", err)
+		}
+	}
+
+	if err := addSearchVector(db); err != nil {
+		return fmt.Errorf("failed to run migrations: %w", err)
+	}
+
+	if err := addVehicleUniqueIndexes(db); err != nil {
 		return fmt.Errorf("failed to run migrations: %w", err)
 	}
 
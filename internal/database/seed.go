@@ -34,7 +34,15 @@ func SeedDatabase(db *gorm.DB) error {
 
 	// Insert vehicles with explicit primary key values
 	// Disable auto-increment behavior for primary key by using Omit with empty list
+	slugs := make(map[string]bool, len(vehicles))
 	for i, vehicle := range vehicles {
+		// The sample feed repeats vehicles, so repeated slugs get the vehicle ID appended
+		vehicle.FillSlugs()
+		if slugs[vehicle.Slug] {
+			vehicle.Slug = fmt.Sprintf("%s-%d", vehicle.Slug, vehicle.VehicleID)
+		}
+		slugs[vehicle.Slug] = true
+
 		// Use Omit("") to force GORM to include the primary key in INSERT
 		if err := db.Omit("").Create(&vehicle).Error; err != nil {
 			return fmt.Errorf("failed to insert vehicle %d: %w", vehicle.VehicleID, err)
@@ -45,10 +53,62 @@ func SeedDatabase(db *gorm.DB) error {
 		}
 	}
 
+	if err := createSitesFromVehicles(db); err != nil {
+		return err
+	}
+	if err := locateSampleSites(db); err != nil {
+		return err
+	}
+
 	log.Printf("Successfully seeded database with %d vehicles", len(vehicles))
 	return nil
 }
 
+// sampleSiteLocations places the sites of the sample feed so near searches work out
+// of the box. The coordinates are the centres of the sites' postcode districts.
+var sampleSiteLocations = []models.Site{
+	{Slug: "winsford", Town: "Winsford", County: "Cheshire", Latitude: floatPtr(53.1905), Longitude: floatPtr(-2.5196)},
+	{Slug: "trafford", Town: "Manchester", County: "Greater Manchester", Latitude: floatPtr(53.4650), Longitude: floatPtr(-2.3180)},
+}
+
+// sampleOpeningHours gives the sample sites opening hours so test drives can be booked
+var sampleOpeningHours = models.OpeningHoursList{
+	{Day: "monday", Opens: "09:00", Closes: "18:00"},
+	{Day: "tuesday", Opens: "09:00", Closes: "18:00"},
+	{Day: "wednesday", Opens: "09:00", Closes: "18:00"},
+	{Day: "thursday", Opens: "09:00", Closes: "18:00"},
+	{Day: "friday", Opens: "09:00", Closes: "18:00"},
+	{Day: "saturday", Opens: "09:00", Closes: "17:00"},
+	{Day: "sunday", Opens: "10:00", Closes: "16:00"},
+}
+
+// locateSampleSites fills in the town, coordinates and opening hours of the sample sites
+func locateSampleSites(db *gorm.DB) error {
+	for _, site := range sampleSiteLocations {
+		if err := db.Model(&models.Site{}).
+			Where("slug = ? AND latitude IS NULL", site.Slug).
+			Updates(map[string]interface{}{
+				"town":      site.Town,
+				"county":    site.County,
+				"latitude":  site.Latitude,
+				"longitude": site.Longitude,
+			}).Error; err != nil {
+			return fmt.Errorf("failed to locate site %s: %w", site.Slug, err)
+		}
+
+		if err := db.Model(&models.Site{}).
+			Where("slug = ? AND (opening_hours IS NULL OR opening_hours = '[]'::jsonb)", site.Slug).
+			Update("opening_hours", sampleOpeningHours).Error; err != nil {
+			return fmt.Errorf("failed to set opening hours of site %s: %w", site.Slug, err)
+		}
+	}
+	return nil
+}
+
+func floatPtr(value float64) *float64 {
+	return &value
+}
+
 // loadVehicleData loads vehicle data from the JSON file
 func loadVehicleData() ([]models.Vehicle, error) {
 	// Try multiple possible paths for the JSON file
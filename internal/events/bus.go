@@ -0,0 +1,49 @@
+// Package events publishes changes to our stock. Every change to a vehicle, whichever
+// path made it (the API, the feed sync or a reservation), stores an event in the
+// outbox in the same transaction. The Relay publishes those events on a Bus, to
+// which webhooks and the live stream subscribe.
+package events
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/Candoo/vehicles-api/internal/models"
+)
+
+// Bus delivers published events to its subscribers, in order, on the publishing
+// goroutine. Subscribers must not block; slow work belongs on a queue.
+type Bus struct {
+	mu          sync.RWMutex
+	subscribers []func(models.VehicleEvent) error
+}
+
+// NewBus creates a bus with no subscribers
+func NewBus() *Bus {
+	return &Bus{}
+}
+
+// Subscribe calls handle with every event published from now on. An error from
+// handle fails the publish, and the event is published again later.
+func (b *Bus) Subscribe(handle func(models.VehicleEvent) error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.subscribers = append(b.subscribers, handle)
+}
+
+// Publish hands an event to each subscriber in the order they subscribed, stopping
+// at the first that fails. An event that failed is published again in full, so
+// subscribers must tolerate seeing an event more than once.
+func (b *Bus) Publish(event models.VehicleEvent) error {
+	b.mu.RLock()
+	subscribers := b.subscribers
+	b.mu.RUnlock()
+
+	for _, handle := range subscribers {
+		if err := handle(event); err != nil {
+			return fmt.Errorf("failed to publish event %s: %w", event.ID, err)
+		}
+	}
+	return nil
+}
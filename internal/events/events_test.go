@@ -0,0 +1,163 @@
+package events
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/Candoo/vehicles-api/internal/models"
+	"github.com/Candoo/vehicles-api/internal/repository"
+)
+
+func testVehicle(id int, pounds int64) models.Vehicle {
+	return models.Vehicle{
+		VehicleID:            id,
+		Name:                 "Skoda Fabia",
+		Make:                 "Skoda",
+		Model:                "Fabia",
+		AdvertClassification: "Used",
+		FuelType:             "Petrol",
+		Transmission:         "Manual",
+		BodyType:             "Hatchback",
+		Year:                 "2018",
+		VRM:                  "AB18CDE",
+		StockID:              "STK1",
+		Price:                models.MoneyFromPounds(pounds),
+		Source:               models.VehicleSourceAPI,
+	}
+}
+
+func TestBusStopsAtFailingSubscriber(t *testing.T) {
+	bus := NewBus()
+
+	var first, second []models.VehicleEvent
+	fail := errors.New("queue unavailable")
+	bus.Subscribe(func(event models.VehicleEvent) error {
+		first = append(first, event)
+		if event.VehicleID == 2 {
+			return fail
+		}
+		return nil
+	})
+	bus.Subscribe(func(event models.VehicleEvent) error {
+		second = append(second, event)
+		return nil
+	})
+
+	if err := bus.Publish(models.VehicleEvent{ID: "evt_1", Type: models.EventVehicleDeleted, VehicleID: 1}); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+	if err := bus.Publish(models.VehicleEvent{ID: "evt_2", Type: models.EventVehicleDeleted, VehicleID: 2}); !errors.Is(err, fail) {
+		t.Fatalf("Publish = %v, want %v", err, fail)
+	}
+
+	if len(first) != 2 || len(second) != 1 || !reflect.DeepEqual(first[0], second[0]) {
+		t.Errorf("subscribers saw %v and %v, want both events then only the first", first, second)
+	}
+}
+
+func TestRelayPublishesOutboxInOrder(t *testing.T) {
+	store := repository.NewMemoryVehicleStore()
+	bus := NewBus()
+	relay := NewRelay(store, bus)
+
+	var published []models.VehicleEvent
+	var fail error
+	bus.Subscribe(func(event models.VehicleEvent) error {
+		if fail != nil {
+			return fail
+		}
+		published = append(published, event)
+		return nil
+	})
+
+	vehicle := testVehicle(1, 5000)
+	if err := store.CreateVehicle(&vehicle); err != nil {
+		t.Fatalf("CreateVehicle: %v", err)
+	}
+	vehicle.Price = models.MoneyFromPounds(4800)
+	if err := store.UpdateVehicle(1, &vehicle); err != nil {
+		t.Fatalf("UpdateVehicle: %v", err)
+	}
+
+	// Nothing is lost while a subscriber is failing: the events wait in the outbox
+	fail = errors.New("queue unavailable")
+	if n, err := relay.Run(); !errors.Is(err, fail) || n != 0 {
+		t.Fatalf("Run = %d, %v, want 0 and %v", n, err, fail)
+	}
+
+	fail = nil
+	if n, err := relay.Run(); err != nil || n != 3 {
+		t.Fatalf("Run = %d, %v, want 3 events", n, err)
+	}
+	var types []models.EventType
+	for _, event := range published {
+		types = append(types, event.Type)
+	}
+	want := []models.EventType{models.EventVehicleCreated, models.EventVehicleUpdated, models.EventVehiclePriceChanged}
+	if !reflect.DeepEqual(types, want) {
+		t.Errorf("published %v, want %v", types, want)
+	}
+	if published[0].ID == "" || published[0].OccurredAt.IsZero() || published[2].OldPrice.Pounds() != 5000 {
+		t.Errorf("published = %+v", published)
+	}
+
+	if n, err := relay.Run(); err != nil || n != 0 {
+		t.Errorf("second Run = %d, %v, want nothing left to publish", n, err)
+	}
+}
+
+func TestStreamResumes(t *testing.T) {
+	stream := NewStream(3)
+	live, _, _ := stream.Subscribe("")
+	defer live.Close()
+
+	var ids []string
+	for id := 1; id <= 5; id++ {
+		stream.Publish(models.VehicleEvent{Type: models.EventVehicleUpdated, VehicleID: id})
+		event := <-live.Events
+		if event.Event.VehicleID != id {
+			t.Fatalf("live event = %+v, want vehicle %d", event, id)
+		}
+		ids = append(ids, event.ID)
+	}
+
+	resumed, missed, complete := stream.Subscribe(ids[2])
+	resumed.Close()
+	if !complete || len(missed) != 2 || missed[0].ID != ids[3] || missed[1].ID != ids[4] {
+		t.Errorf("resume after %s = %+v, complete %v", ids[2], missed, complete)
+	}
+
+	upToDate, missed, complete := stream.Subscribe(ids[4])
+	upToDate.Close()
+	if !complete || len(missed) != 0 {
+		t.Errorf("resume after latest = %+v, complete %v", missed, complete)
+	}
+
+	// The second event has left the buffer of three, and the others never existed
+	for _, id := range []string{ids[0], "0-1", "nonsense", ids[4][:len(ids[4])-1] + "9"} {
+		sub, missed, complete := stream.Subscribe(id)
+		sub.Close()
+		if complete || len(missed) != 0 {
+			t.Errorf("resume after %q = %+v, complete %v, want incomplete", id, missed, complete)
+		}
+	}
+}
+
+func TestStreamDropsSlowSubscribers(t *testing.T) {
+	stream := NewStream(DefaultStreamSize)
+	slow, _, _ := stream.Subscribe("")
+
+	for i := 0; i <= subscriptionBuffer; i++ {
+		stream.Publish(models.VehicleEvent{Type: models.EventVehicleCreated, VehicleID: i})
+	}
+
+	received := 0
+	for range slow.Events {
+		received++
+	}
+	if received != subscriptionBuffer {
+		t.Errorf("received %d events before being dropped, want %d", received, subscriptionBuffer)
+	}
+	slow.Close()
+}
@@ -0,0 +1,80 @@
+package events
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/Candoo/vehicles-api/internal/models"
+)
+
+// Outbox is the persistence the relay needs
+type Outbox interface {
+	// PendingEvents returns up to limit events not yet published, oldest first
+	PendingEvents(limit int) ([]models.VehicleEvent, error)
+	// MarkEventPublished records that an event was published at at
+	MarkEventPublished(id string, at time.Time) error
+}
+
+// relayBatch is the most events published in one run
+const relayBatch = 100
+
+// Relay publishes the events stored in the outbox on the bus, oldest first. An
+// event stays in the outbox until every subscriber has taken it, so events are
+// published at least once: a failed event and the events after it are retried on
+// the next run, in order.
+type Relay struct {
+	outbox Outbox
+	bus    *Bus
+	// Now returns the current time; tests replace it
+	Now func() time.Time
+}
+
+// NewRelay creates a relay publishing the events in outbox on bus
+func NewRelay(outbox Outbox, bus *Bus) *Relay {
+	return &Relay{outbox: outbox, bus: bus, Now: time.Now}
+}
+
+// Run publishes the pending events until none are left, returning how many it
+// published
+func (r *Relay) Run() (int, error) {
+	published := 0
+	for {
+		events, err := r.outbox.PendingEvents(relayBatch)
+		if err != nil {
+			return published, err
+		}
+
+		for _, event := range events {
+			if err := r.bus.Publish(event); err != nil {
+				return published, err
+			}
+			if err := r.outbox.MarkEventPublished(event.ID, r.Now()); err != nil {
+				return published, err
+			}
+			published++
+		}
+
+		if len(events) < relayBatch {
+			return published, nil
+		}
+	}
+}
+
+// Start runs the relay immediately and then on every interval until the context is cancelled
+func (r *Relay) Start(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := r.Run(); err != nil {
+			log.Printf("Event relay failed: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
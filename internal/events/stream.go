@@ -0,0 +1,129 @@
+package events
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Candoo/vehicles-api/internal/models"
+)
+
+// DefaultStreamSize is how many recent events a stream keeps for clients to catch up on
+const DefaultStreamSize = 1000
+
+// subscriptionBuffer is how many events a subscriber may fall behind by before it
+// is dropped
+const subscriptionBuffer = 64
+
+// StreamEvent is an event with its ID in the stream. IDs are "<epoch>-<sequence>":
+// the sequence numbers events in the order they were published and the epoch tells
+// apart the streams of different runs of the server, whose sequences both start at 1.
+type StreamEvent struct {
+	ID    string
+	Event models.VehicleEvent
+	seq   uint64
+}
+
+// Stream keeps the most recent events in a ring buffer and fans them out to live
+// subscribers, so clients that reconnect can resume from the last event they saw.
+// A subscriber that falls behind is dropped rather than holding up the bus; it
+// resumes from the buffer when it reconnects.
+type Stream struct {
+	mu          sync.Mutex
+	epoch       string
+	ring        []StreamEvent
+	seq         uint64
+	subscribers map[*Subscription]struct{}
+}
+
+// NewStream creates a stream keeping the last size events
+func NewStream(size int) *Stream {
+	return &Stream{
+		epoch:       strconv.FormatInt(time.Now().UnixMilli(), 36),
+		ring:        make([]StreamEvent, size),
+		subscribers: make(map[*Subscription]struct{}),
+	}
+}
+
+// Subscription receives the events published on a stream after it was made
+type Subscription struct {
+	// Events delivers the events in order. It is closed when the subscriber falls
+	// too far behind, and by Close.
+	Events <-chan StreamEvent
+	events chan StreamEvent
+	stream *Stream
+}
+
+// Publish numbers an event, keeps it in the buffer and hands it to every subscriber
+func (s *Stream) Publish(event models.VehicleEvent) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.seq++
+	published := StreamEvent{ID: s.epoch + "-" + strconv.FormatUint(s.seq, 10), Event: event, seq: s.seq}
+	s.ring[s.seq%uint64(len(s.ring))] = published
+
+	for sub := range s.subscribers {
+		select {
+		case sub.events <- published:
+		default:
+			delete(s.subscribers, sub)
+			close(sub.events)
+		}
+	}
+}
+
+// Subscribe subscribes to the events published from now on. With the ID of the last
+// event a client saw, missed returns the buffered events published since. complete
+// is false when those cannot all be replayed, because the ID is unknown, from an
+// earlier run of the server or older than the buffer; the client must then reload
+// rather than resume.
+func (s *Stream) Subscribe(lastEventID string) (sub *Subscription, missed []StreamEvent, complete bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	events := make(chan StreamEvent, subscriptionBuffer)
+	sub = &Subscription{Events: events, events: events, stream: s}
+	s.subscribers[sub] = struct{}{}
+
+	if lastEventID == "" {
+		return sub, nil, true
+	}
+
+	last, ok := s.parseID(lastEventID)
+	oldest := uint64(1)
+	if s.seq > uint64(len(s.ring)) {
+		oldest = s.seq - uint64(len(s.ring)) + 1
+	}
+	if !ok || last > s.seq || last+1 < oldest {
+		return sub, nil, false
+	}
+
+	for seq := last + 1; seq <= s.seq; seq++ {
+		missed = append(missed, s.ring[seq%uint64(len(s.ring))])
+	}
+	return sub, missed, true
+}
+
+// Close unsubscribes, closing Events if the subscription was not already dropped
+func (sub *Subscription) Close() {
+	s := sub.stream
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.subscribers[sub]; ok {
+		delete(s.subscribers, sub)
+		close(sub.events)
+	}
+}
+
+// parseID returns the sequence of an event ID from this stream
+func (s *Stream) parseID(id string) (uint64, bool) {
+	epoch, seq, ok := strings.Cut(id, "-")
+	if !ok || epoch != s.epoch {
+		return 0, false
+	}
+	n, err := strconv.ParseUint(seq, 10, 64)
+	return n, err == nil
+}
@@ -0,0 +1,206 @@
+package finance
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/Candoo/vehicles-api/internal/apperr"
+	"github.com/Candoo/vehicles-api/internal/models"
+)
+
+// Annual mileage bounds accepted for PCP quotes
+const (
+	MinAnnualMileage = 1000
+	MaxAnnualMileage = 50000
+)
+
+// Request is the body of POST /vehicles/:id/finance-quote. AnnualMileage only
+// applies to PCP and defaults to the table's standard mileage.
+type Request struct {
+	Product       Product      `json:"product" example:"pcp"`
+	Deposit       models.Money `json:"deposit" swaggertype:"string" example:"1000.00"`
+	TermMonths    int          `json:"term_months" example:"48"`
+	AnnualMileage int          `json:"annual_mileage" example:"12000"`
+}
+
+// Quote is a priced finance agreement laid out as a representative example.
+// TotalChargeForCredit is the interest plus the option to purchase fee, and
+// TotalAmountPayable the deposit, every payment and that fee.
+type Quote struct {
+	Product              Product      `json:"product" example:"pcp"`
+	CashPrice            models.Money `json:"cash_price" swaggertype:"string" example:"12995.00"`
+	Deposit              models.Money `json:"deposit" swaggertype:"string" example:"1000.00"`
+	AmountOfCredit       models.Money `json:"total_amount_of_credit" swaggertype:"string" example:"11995.00"`
+	TermMonths           int          `json:"term_months" example:"48"`
+	NumberOfPayments     int          `json:"number_of_monthly_payments" example:"47"`
+	MonthlyPayment       models.Money `json:"monthly_payment" swaggertype:"string" example:"197.54"`
+	FinalPayment         models.Money `json:"optional_final_payment,omitempty" swaggertype:"string" example:"6647.00"`
+	OptionToPurchaseFee  models.Money `json:"option_to_purchase_fee" swaggertype:"string" example:"10.00"`
+	Interest             models.Money `json:"interest" swaggertype:"string" example:"3936.38"`
+	TotalChargeForCredit models.Money `json:"total_charge_for_credit" swaggertype:"string" example:"3946.38"`
+	TotalAmountPayable   models.Money `json:"total_amount_payable" swaggertype:"string" example:"16941.38"`
+	APR                  float64      `json:"representative_apr" example:"10.9"`
+	FixedRate            float64      `json:"fixed_rate" example:"8.2"`
+	AnnualMileage        int          `json:"annual_mileage,omitempty" example:"12000"`
+	ExcessMileageCharge  models.Money `json:"excess_mileage_charge,omitempty" swaggertype:"string" example:"0.08"`
+	Example              string       `json:"representative_example"`
+}
+
+// Quote prices an agreement for a vehicle at cashPrice, reporting every problem
+// with the request at once
+func (t *Table) Quote(cashPrice models.Money, request Request) (*Quote, error) {
+	var problems []apperr.FieldError
+	fail := func(field, format string, args ...interface{}) {
+		problems = append(problems, apperr.FieldError{Field: field, Reason: fmt.Sprintf(format, args...)})
+	}
+
+	rate, hasRate := Rate{}, false
+	if minTerm, maxTerm, ok := t.terms(request.Product); !ok {
+		fail("product", "must be one of %s", strings.Join(t.products(), ", "))
+	} else if rate, hasRate = t.rate(request.Product, request.TermMonths); !hasRate {
+		fail("term_months", "must be between %d and %d months for %s", minTerm, maxTerm, request.Product)
+	}
+
+	if request.Deposit < 0 || request.Deposit >= cashPrice {
+		fail("deposit", "must be at least 0 and less than the cash price of %s", pounds(cashPrice))
+	}
+
+	mileage := 0
+	if request.Product == ProductPCP {
+		mileage = request.AnnualMileage
+		if mileage == 0 {
+			mileage = t.StandardMileage
+		}
+		if mileage < MinAnnualMileage || mileage > MaxAnnualMileage {
+			fail("annual_mileage", "must be between %d and %d", MinAnnualMileage, MaxAnnualMileage)
+		}
+	}
+
+	if len(problems) > 0 {
+		return nil, apperr.InvalidFields("invalid finance quote request", problems)
+	}
+
+	quote := &Quote{
+		Product:             request.Product,
+		CashPrice:           cashPrice,
+		Deposit:             request.Deposit,
+		AmountOfCredit:      cashPrice - request.Deposit,
+		TermMonths:          request.TermMonths,
+		NumberOfPayments:    request.TermMonths,
+		OptionToPurchaseFee: t.OptionToPurchaseFee,
+		APR:                 rate.APR,
+	}
+
+	if request.Product == ProductPCP {
+		quote.FinalPayment = t.finalPayment(cashPrice, request.TermMonths, mileage)
+		// The last month is taken up by the optional final payment
+		quote.NumberOfPayments = request.TermMonths - 1
+		quote.AnnualMileage = mileage
+		quote.ExcessMileageCharge = t.ExcessMileageCharge
+		if quote.FinalPayment >= quote.AmountOfCredit {
+			return nil, apperr.InvalidFields("invalid finance quote request", []apperr.FieldError{{
+				Field:  "deposit",
+				Reason: fmt.Sprintf("must leave more to borrow than the optional final payment of %s", pounds(quote.FinalPayment)),
+			}})
+		}
+	}
+
+	quote.MonthlyPayment = monthlyPayment(quote.AmountOfCredit, quote.FinalPayment, rate.APR, request.TermMonths, quote.NumberOfPayments)
+	quote.TotalAmountPayable = quote.Deposit + quote.MonthlyPayment*models.Money(quote.NumberOfPayments) + quote.FinalPayment + quote.OptionToPurchaseFee
+	quote.TotalChargeForCredit = quote.TotalAmountPayable - cashPrice
+	quote.Interest = quote.TotalChargeForCredit - quote.OptionToPurchaseFee
+	quote.FixedRate = round2(float64(quote.Interest) / float64(quote.AmountOfCredit) / (float64(request.TermMonths) / 12) * 100)
+	quote.Example = quote.representativeExample()
+
+	return quote, nil
+}
+
+// finalPayment is the guaranteed future value of a vehicle at the end of a PCP
+// term, in whole pounds
+func (t *Table) finalPayment(cashPrice models.Money, term, annualMileage int) models.Money {
+	years := float64(term) / 12
+	value := cashPrice.Pounds() * math.Pow(1-t.AnnualDepreciation, years)
+
+	adjustment := 1 - t.MileageAdjustment*float64(annualMileage-t.StandardMileage)/1000
+	value *= math.Max(0, adjustment)
+
+	return models.MoneyFromPounds(int64(math.Floor(value)))
+}
+
+// monthlyPayment is the level payment, rounded to the penny, that repays credit
+// over payments months at apr with finalPayment due at the end of the term. APR is
+// the effective annual rate, so interest compounds monthly at (1+APR)^(1/12)-1.
+func monthlyPayment(credit, finalPayment models.Money, apr float64, term, payments int) models.Money {
+	r := math.Pow(1+apr/100, 1.0/12) - 1
+	if r == 0 {
+		return models.Money(math.Round(float64(credit-finalPayment) / float64(payments)))
+	}
+
+	// Payments fall at the end of months 1..payments and the final payment at the end of the term
+	discountedFinal := float64(finalPayment) / math.Pow(1+r, float64(term))
+	annuity := (1 - math.Pow(1+r, -float64(payments))) / r
+	return models.Money(math.Round((float64(credit) - discountedFinal) / annuity))
+}
+
+// representativeExample words the quote the way finance adverts show it
+func (q *Quote) representativeExample() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Representative example: cash price %s, deposit %s, total amount of credit %s. ",
+		pounds(q.CashPrice), pounds(q.Deposit), pounds(q.AmountOfCredit))
+	fmt.Fprintf(&b, "%d monthly payments of %s", q.NumberOfPayments, pounds(q.MonthlyPayment))
+	if q.FinalPayment > 0 {
+		fmt.Fprintf(&b, " followed by an optional final payment of %s", pounds(q.FinalPayment))
+	}
+	fmt.Fprintf(&b, ". Option to purchase fee of %s payable with the last payment. ", pounds(q.OptionToPurchaseFee))
+	fmt.Fprintf(&b, "Total charge for credit %s. Total amount payable %s over %d months. ",
+		pounds(q.TotalChargeForCredit), pounds(q.TotalAmountPayable), q.TermMonths)
+	fmt.Fprintf(&b, "Fixed rate of interest %.2f%% p.a. Representative %.1f%% APR.", q.FixedRate, q.APR)
+	if q.AnnualMileage > 0 {
+		fmt.Fprintf(&b, " Based on %s miles a year; excess mileage charged at %s per mile.",
+			thousands(int64(q.AnnualMileage)), perMile(q.ExcessMileageCharge))
+	}
+	return b.String()
+}
+
+// products lists the products the table has rates for
+func (t *Table) products() []string {
+	var names []string
+	for _, product := range Products {
+		if _, _, ok := t.terms(product); ok {
+			names = append(names, string(product))
+		}
+	}
+	return names
+}
+
+// pounds formats an amount for customers, e.g. "£12,995.00"
+func pounds(amount models.Money) string {
+	sign, value := "", amount.Pence()
+	if value < 0 {
+		sign, value = "-", -value
+	}
+	return fmt.Sprintf("%s£%s.%02d", sign, thousands(value/100), value%100)
+}
+
+// perMile formats a per-mile charge, in pence when under a pound, e.g. "8p"
+func perMile(amount models.Money) string {
+	if amount >= 0 && amount < 100 {
+		return fmt.Sprintf("%dp", amount.Pence())
+	}
+	return pounds(amount)
+}
+
+// thousands formats a whole number with comma separators
+func thousands(value int64) string {
+	digits := fmt.Sprint(value)
+	for i := len(digits) - 3; i > 0; i -= 3 {
+		digits = digits[:i] + "," + digits[i:]
+	}
+	return digits
+}
+
+// round2 rounds to two decimal places
+func round2(value float64) float64 {
+	return math.Round(value*100) / 100
+}
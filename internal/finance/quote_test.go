@@ -0,0 +1,182 @@
+package finance
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/Candoo/vehicles-api/internal/apperr"
+	"github.com/Candoo/vehicles-api/internal/models"
+)
+
+func TestQuoteHP(t *testing.T) {
+	quote, err := DefaultTable().Quote(models.MoneyFromPounds(10000), Request{
+		Product:    ProductHP,
+		Deposit:    models.MoneyFromPounds(1000),
+		TermMonths: 36,
+	})
+	if err != nil {
+		t.Fatalf("Quote: %v", err)
+	}
+
+	want := &Quote{
+		Product:              ProductHP,
+		CashPrice:            models.MoneyFromPounds(10000),
+		Deposit:              models.MoneyFromPounds(1000),
+		AmountOfCredit:       models.MoneyFromPounds(9000),
+		TermMonths:           36,
+		NumberOfPayments:     36,
+		MonthlyPayment:       28820,
+		OptionToPurchaseFee:  models.MoneyFromPounds(10),
+		Interest:             137520,
+		TotalChargeForCredit: 138520,
+		TotalAmountPayable:   1138520,
+		APR:                  9.9,
+		FixedRate:            5.09,
+	}
+	want.Example = quote.Example
+	if !reflect.DeepEqual(quote, want) {
+		t.Errorf("quote = %+v\nwant %+v", quote, want)
+	}
+	if !strings.Contains(quote.Example, "36 monthly payments of £288.20. ") || !strings.Contains(quote.Example, "Representative 9.9% APR.") {
+		t.Errorf("example = %q", quote.Example)
+	}
+}
+
+func TestQuotePCP(t *testing.T) {
+	quote, err := DefaultTable().Quote(models.MoneyFromPounds(12995), Request{
+		Product:       ProductPCP,
+		Deposit:       models.MoneyFromPounds(1000),
+		TermMonths:    48,
+		AnnualMileage: 12000,
+	})
+	if err != nil {
+		t.Fatalf("Quote: %v", err)
+	}
+
+	// 12995 x 0.85^4 less 2% for 2,000 miles a year over the standard mileage
+	if quote.FinalPayment != models.MoneyFromPounds(6647) {
+		t.Errorf("final payment = %s, want 6647.00", quote.FinalPayment)
+	}
+	if quote.NumberOfPayments != 47 || quote.MonthlyPayment != 19754 || quote.APR != 10.9 {
+		t.Errorf("%d payments of %s at %v%%", quote.NumberOfPayments, quote.MonthlyPayment, quote.APR)
+	}
+	total := quote.Deposit + quote.MonthlyPayment*47 + quote.FinalPayment + quote.OptionToPurchaseFee
+	if quote.TotalAmountPayable != total || quote.TotalChargeForCredit != total-quote.CashPrice {
+		t.Errorf("total payable %s, charge for credit %s, want %s", quote.TotalAmountPayable, quote.TotalChargeForCredit, total)
+	}
+	if !strings.Contains(quote.Example, "optional final payment of £6,647.00") || !strings.Contains(quote.Example, "8p per mile") {
+		t.Errorf("example = %q", quote.Example)
+	}
+
+	// Lower mileage raises the final payment and lowers the monthly payment
+	lower, err := DefaultTable().Quote(models.MoneyFromPounds(12995), Request{
+		Product:       ProductPCP,
+		Deposit:       models.MoneyFromPounds(1000),
+		TermMonths:    48,
+		AnnualMileage: 6000,
+	})
+	if err != nil {
+		t.Fatalf("Quote: %v", err)
+	}
+	if lower.FinalPayment <= quote.FinalPayment || lower.MonthlyPayment >= quote.MonthlyPayment {
+		t.Errorf("6,000 miles: final %s, monthly %s", lower.FinalPayment, lower.MonthlyPayment)
+	}
+
+	// The standard mileage applies when none is given
+	standard, err := DefaultTable().Quote(models.MoneyFromPounds(12995), Request{Product: ProductPCP, TermMonths: 36})
+	if err != nil {
+		t.Fatalf("Quote: %v", err)
+	}
+	if standard.AnnualMileage != 10000 {
+		t.Errorf("annual mileage = %d, want 10000", standard.AnnualMileage)
+	}
+}
+
+func TestQuoteInterestFree(t *testing.T) {
+	table := DefaultTable()
+	table.Rates = []Rate{{Product: ProductHP, MinTerm: 12, MaxTerm: 24, APR: 0}}
+	table.OptionToPurchaseFee = 0
+
+	quote, err := table.Quote(models.MoneyFromPounds(2400), Request{Product: ProductHP, TermMonths: 24})
+	if err != nil {
+		t.Fatalf("Quote: %v", err)
+	}
+	if quote.MonthlyPayment != models.MoneyFromPounds(100) || quote.TotalChargeForCredit != 0 || quote.FixedRate != 0 {
+		t.Errorf("quote = %+v", quote)
+	}
+}
+
+func TestQuoteRejectsBadRequest(t *testing.T) {
+	price := models.MoneyFromPounds(12995)
+	tests := []struct {
+		name    string
+		request Request
+		fields  []string
+	}{
+		{"unknown product", Request{Product: "lease", Deposit: -1, TermMonths: 48}, []string{"product", "deposit"}},
+		{"term out of range", Request{Product: ProductPCP, TermMonths: 60, AnnualMileage: 500}, []string{"term_months", "annual_mileage"}},
+		{"deposit over price", Request{Product: ProductHP, Deposit: price, TermMonths: 36}, []string{"deposit"}},
+		{"deposit over final payment", Request{Product: ProductPCP, Deposit: models.MoneyFromPounds(8000), TermMonths: 24}, []string{"deposit"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := DefaultTable().Quote(price, tt.request)
+			if !errors.Is(err, apperr.ErrValidation) {
+				t.Fatalf("err = %v, want a validation error", err)
+			}
+			var fields []string
+			for _, problem := range apperr.Fields(err) {
+				fields = append(fields, problem.Field)
+			}
+			if !reflect.DeepEqual(fields, tt.fields) {
+				t.Errorf("fields = %v, want %v", fields, tt.fields)
+			}
+		})
+	}
+}
+
+func TestLoadTable(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	table, err := LoadTable(write("rates.json", `{
+		"rates": [{"product": "hp", "min_term": 12, "max_term": 48, "apr": 7.9}],
+		"option_to_purchase_fee": "0.00",
+		"annual_depreciation": 0.2,
+		"standard_mileage": 8000,
+		"mileage_adjustment": 0.005,
+		"excess_mileage_charge": "0.10"
+	}`))
+	if err != nil {
+		t.Fatalf("LoadTable: %v", err)
+	}
+	if rate, ok := table.rate(ProductHP, 48); !ok || rate.APR != 7.9 {
+		t.Errorf("rate = %+v, %v", rate, ok)
+	}
+	if _, err := table.Quote(models.MoneyFromPounds(5000), Request{Product: ProductPCP, TermMonths: 36}); !errors.Is(err, apperr.ErrValidation) {
+		t.Errorf("PCP without PCP rates: err = %v", err)
+	}
+
+	for name, content := range map[string]string{
+		"empty.json":     `{"rates": [], "standard_mileage": 10000}`,
+		"product.json":   `{"rates": [{"product": "lease", "min_term": 12, "max_term": 24, "apr": 5}], "standard_mileage": 10000}`,
+		"terms.json":     `{"rates": [{"product": "hp", "min_term": 24, "max_term": 12, "apr": 5}], "standard_mileage": 10000}`,
+		"mileage.json":   `{"rates": [{"product": "hp", "min_term": 12, "max_term": 24, "apr": 5}]}`,
+		"malformed.json": `{"rates": `,
+	} {
+		if _, err := LoadTable(write(name, content)); err == nil {
+			t.Errorf("LoadTable(%s) succeeded", name)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+// Package finance works out hire purchase (HP) and personal contract purchase (PCP)
+// quotes, with the representative example UK consumer-credit rules require
+// alongside an advertised monthly payment.
+package finance
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/Candoo/vehicles-api/internal/models"
+)
+
+// Product is a kind of car finance agreement
+type Product string
+
+// Finance products
+const (
+	// ProductHP repays the whole amount of credit in equal monthly payments
+	ProductHP Product = "hp"
+	// ProductPCP defers part of the credit to an optional final payment
+	ProductPCP Product = "pcp"
+)
+
+// Products lists the finance products that can be quoted
+var Products = []Product{ProductHP, ProductPCP}
+
+// Rate is the APR charged for a product over a band of terms in months
+type Rate struct {
+	Product Product `json:"product"`
+	MinTerm int     `json:"min_term"`
+	MaxTerm int     `json:"max_term"`
+	APR     float64 `json:"apr"`
+}
+
+// Table holds the rates on offer and the assumptions behind PCP final payments.
+// The optional final payment is the cash price depreciated by AnnualDepreciation
+// for each year of the term, then lowered (or raised) by MileageAdjustment for
+// every 1,000 miles a year above (or below) StandardMileage.
+type Table struct {
+	Rates               []Rate       `json:"rates"`
+	OptionToPurchaseFee models.Money `json:"option_to_purchase_fee"`
+	AnnualDepreciation  float64      `json:"annual_depreciation"`
+	StandardMileage     int          `json:"standard_mileage"`
+	MileageAdjustment   float64      `json:"mileage_adjustment"`
+	ExcessMileageCharge models.Money `json:"excess_mileage_charge"`
+}
+
+// DefaultTable returns the rates used when no rates file is configured
+func DefaultTable() *Table {
+	return &Table{
+		Rates: []Rate{
+			{Product: ProductHP, MinTerm: 12, MaxTerm: 36, APR: 9.9},
+			{Product: ProductHP, MinTerm: 37, MaxTerm: 60, APR: 10.9},
+			{Product: ProductPCP, MinTerm: 24, MaxTerm: 36, APR: 9.9},
+			{Product: ProductPCP, MinTerm: 37, MaxTerm: 48, APR: 10.9},
+		},
+		OptionToPurchaseFee: models.MoneyFromPounds(10),
+		AnnualDepreciation:  0.15,
+		StandardMileage:     10000,
+		MileageAdjustment:   0.01,
+		ExcessMileageCharge: models.Money(8),
+	}
+}
+
+// LoadTable reads a rates table from a JSON file
+func LoadTable(path string) (*Table, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var table Table
+	if err := json.Unmarshal(data, &table); err != nil {
+		return nil, fmt.Errorf("invalid finance rates file: %w", err)
+	}
+	if err := table.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid finance rates file: %w", err)
+	}
+	return &table, nil
+}
+
+// Validate checks that every rate is usable and the PCP assumptions are in range
+func (t *Table) Validate() error {
+	if len(t.Rates) == 0 {
+		return errors.New("at least one rate is required")
+	}
+	for i, rate := range t.Rates {
+		if !isProduct(rate.Product) {
+			return fmt.Errorf("rate %d: product must be hp or pcp", i+1)
+		}
+		if rate.MinTerm < 1 || rate.MaxTerm < rate.MinTerm {
+			return fmt.Errorf("rate %d: terms must run from at least 1 month to no less than min_term", i+1)
+		}
+		if rate.APR < 0 || rate.APR >= 100 {
+			return fmt.Errorf("rate %d: apr must be between 0 and 100", i+1)
+		}
+	}
+
+	if t.OptionToPurchaseFee < 0 || t.ExcessMileageCharge < 0 {
+		return errors.New("fees must not be negative")
+	}
+	if t.AnnualDepreciation < 0 || t.AnnualDepreciation >= 1 {
+		return errors.New("annual_depreciation must be at least 0 and below 1")
+	}
+	if t.StandardMileage < 1 {
+		return errors.New("standard_mileage must be positive")
+	}
+	if t.MileageAdjustment < 0 || t.MileageAdjustment >= 1 {
+		return errors.New("mileage_adjustment must be at least 0 and below 1")
+	}
+	return nil
+}
+
+// rate returns the rate for a product and term
+func (t *Table) rate(product Product, term int) (Rate, bool) {
+	for _, rate := range t.Rates {
+		if rate.Product == product && term >= rate.MinTerm && term <= rate.MaxTerm {
+			return rate, true
+		}
+	}
+	return Rate{}, false
+}
+
+// terms returns the shortest and longest terms offered for a product
+func (t *Table) terms(product Product) (min, max int, ok bool) {
+	for _, rate := range t.Rates {
+		if rate.Product != product {
+			continue
+		}
+		if !ok || rate.MinTerm < min {
+			min = rate.MinTerm
+		}
+		if !ok || rate.MaxTerm > max {
+			max = rate.MaxTerm
+		}
+		ok = true
+	}
+	return min, max, ok
+}
+
+// isProduct reports whether product is one of Products
+func isProduct(product Product) bool {
+	for _, candidate := range Products {
+		if candidate == product {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,67 @@
+// Package geo provides the distance maths and postcode lookups behind the
+// "vehicles near me" search.
+package geo
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// EarthRadiusMiles is the mean radius of the Earth used for great-circle distances
+const EarthRadiusMiles = 3958.8
+
+// Point is a position in decimal degrees
+type Point struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+}
+
+// Valid reports whether the point lies within the latitude and longitude ranges
+func (p Point) Valid() bool {
+	return p.Latitude >= -90 && p.Latitude <= 90 && p.Longitude >= -180 && p.Longitude <= 180
+}
+
+// ParsePoint parses a "latitude,longitude" pair such as "53.19,-2.52"
+func ParsePoint(s string) (Point, error) {
+	latitude, longitude, ok := strings.Cut(s, ",")
+	if !ok {
+		return Point{}, errors.New("expected latitude,longitude")
+	}
+
+	lat, err := strconv.ParseFloat(strings.TrimSpace(latitude), 64)
+	if err != nil {
+		return Point{}, errors.New("latitude must be a number")
+	}
+	lng, err := strconv.ParseFloat(strings.TrimSpace(longitude), 64)
+	if err != nil {
+		return Point{}, errors.New("longitude must be a number")
+	}
+
+	point := Point{Latitude: lat, Longitude: lng}
+	if !point.Valid() {
+		return Point{}, errors.New("latitude must be between -90 and 90 and longitude between -180 and 180")
+	}
+	return point, nil
+}
+
+// DistanceMiles returns the great-circle distance between two points using the
+// haversine formula. The repository computes the same formula in SQL.
+func DistanceMiles(a, b Point) float64 {
+	lat1, lat2 := radians(a.Latitude), radians(b.Latitude)
+	dLat := lat2 - lat1
+	dLng := radians(b.Longitude - a.Longitude)
+
+	h := math.Pow(math.Sin(dLat/2), 2) + math.Cos(lat1)*math.Cos(lat2)*math.Pow(math.Sin(dLng/2), 2)
+	return 2 * EarthRadiusMiles * math.Asin(math.Min(1, math.Sqrt(h)))
+}
+
+// RoundMiles rounds a distance to the hundredth of a mile shown to clients
+func RoundMiles(miles float64) float64 {
+	return math.Round(miles*100) / 100
+}
+
+func radians(degrees float64) float64 {
+	return degrees * math.Pi / 180
+}
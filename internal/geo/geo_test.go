@@ -0,0 +1,84 @@
+package geo
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestDistanceMiles(t *testing.T) {
+	winsford := Point{Latitude: 53.1905, Longitude: -2.5196}
+	trafford := Point{Latitude: 53.4650, Longitude: -2.3180}
+
+	if got := DistanceMiles(winsford, winsford); got != 0 {
+		t.Errorf("distance to itself = %v", got)
+	}
+	got := DistanceMiles(winsford, trafford)
+	if math.Abs(got-20.7) > 0.05 {
+		t.Errorf("Winsford to Trafford = %v miles, want about 20.7", got)
+	}
+	if back := DistanceMiles(trafford, winsford); math.Abs(back-got) > 1e-9 {
+		t.Errorf("distance is not symmetric: %v and %v", got, back)
+	}
+	if rounded := RoundMiles(got); rounded != math.Round(got*100)/100 {
+		t.Errorf("RoundMiles(%v) = %v", got, rounded)
+	}
+}
+
+func TestParsePoint(t *testing.T) {
+	point, err := ParsePoint(" 53.19, -2.52 ")
+	if err != nil || point != (Point{Latitude: 53.19, Longitude: -2.52}) {
+		t.Errorf("ParsePoint = %v, %v", point, err)
+	}
+
+	for _, bad := range []string{"53.19", "north,-2.52", "53.19,west", "91,0", "0,181"} {
+		if _, err := ParsePoint(bad); err == nil {
+			t.Errorf("ParsePoint(%q) succeeded", bad)
+		}
+	}
+}
+
+func TestPostcodes(t *testing.T) {
+	table, err := ReadPostcodes(strings.NewReader(`# sample
+postcode,latitude,longitude
+CW7,53.1905,-2.5196
+cw7 3qp,53.1950,-2.5300
+M17,53.4650,-2.3180
+`))
+	if err != nil {
+		t.Fatalf("ReadPostcodes: %v", err)
+	}
+	if table.Len() != 3 {
+		t.Errorf("Len = %d, want 3", table.Len())
+	}
+
+	tests := []struct {
+		postcode string
+		want     Point
+		ok       bool
+	}{
+		{"CW7 3QP", Point{53.1950, -2.5300}, true},
+		{"cw73qp", Point{53.1950, -2.5300}, true},
+		{"CW7 1AB", Point{53.1905, -2.5196}, true},
+		{"m17", Point{53.4650, -2.3180}, true},
+		{"M1 1AE", Point{}, false},
+		{"", Point{}, false},
+	}
+	for _, tt := range tests {
+		got, ok := table.Lookup(tt.postcode)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("Lookup(%q) = %v, %v, want %v, %v", tt.postcode, got, ok, tt.want, tt.ok)
+		}
+	}
+
+	var missing *Postcodes
+	if _, ok := missing.Lookup("CW7"); ok {
+		t.Error("nil table found a postcode")
+	}
+
+	for _, bad := range []string{"", "code,lat,lng\nCW7,1,2\n", "postcode,latitude,longitude\nCW7,north,2\n"} {
+		if _, err := ReadPostcodes(strings.NewReader(bad)); err == nil {
+			t.Errorf("ReadPostcodes(%q) succeeded", bad)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package geo
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Postcodes is an offline lookup table from UK postcodes to coordinates. It may hold
+// full postcodes, outward codes (the part before the space, e.g. "CW7") or both;
+// lookups of a full postcode fall back to its outward code.
+type Postcodes struct {
+	points map[string]Point
+}
+
+// NewPostcodes builds a table from postcode to coordinate pairs
+func NewPostcodes(points map[string]Point) *Postcodes {
+	table := &Postcodes{points: make(map[string]Point, len(points))}
+	for postcode, point := range points {
+		table.points[NormalisePostcode(postcode)] = point
+	}
+	return table
+}
+
+// LoadPostcodes reads a postcode table from a CSV file
+func LoadPostcodes(path string) (*Postcodes, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return ReadPostcodes(file)
+}
+
+// ReadPostcodes reads a postcode table from CSV with a postcode,latitude,longitude
+// header. Lines starting with # are comments.
+func ReadPostcodes(r io.Reader) (*Postcodes, error) {
+	reader := csv.NewReader(r)
+	reader.Comment = '#'
+	reader.FieldsPerRecord = 3
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read postcode header: %w", err)
+	}
+	if !strings.EqualFold(strings.Join(header, ","), "postcode,latitude,longitude") {
+		return nil, errors.New("postcode file must start with a postcode,latitude,longitude header")
+	}
+
+	table := &Postcodes{points: make(map[string]Point)}
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read postcodes: %w", err)
+		}
+
+		line, _ := reader.FieldPos(0)
+		point, err := ParsePoint(record[1] + "," + record[2])
+		if err != nil {
+			return nil, fmt.Errorf("postcode file line %d: %w", line, err)
+		}
+		table.points[NormalisePostcode(record[0])] = point
+	}
+
+	return table, nil
+}
+
+// Len returns the number of postcodes in the table
+func (p *Postcodes) Len() int {
+	if p == nil {
+		return 0
+	}
+	return len(p.points)
+}
+
+// Lookup returns the coordinates of a full postcode or outward code. A full postcode
+// missing from the table resolves to the centre of its outward code when that is known.
+func (p *Postcodes) Lookup(postcode string) (Point, bool) {
+	if p == nil {
+		return Point{}, false
+	}
+
+	key := NormalisePostcode(postcode)
+	if key == "" {
+		return Point{}, false
+	}
+	if point, ok := p.points[key]; ok {
+		return point, true
+	}
+
+	// The inward code is always a digit followed by two letters
+	if len(key) > 4 {
+		if point, ok := p.points[strings.TrimSpace(key[:len(key)-3])]; ok {
+			return point, true
+		}
+	}
+	return Point{}, false
+}
+
+// NormalisePostcode upper-cases a postcode and puts a single space before the
+// inward code, so "cw73qp" and "CW7  3QP" both become "CW7 3QP"
+func NormalisePostcode(postcode string) string {
+	compact := strings.ToUpper(strings.Join(strings.Fields(postcode), ""))
+	if len(compact) < 5 || !isInwardCode(compact[len(compact)-3:]) {
+		return compact
+	}
+	return compact[:len(compact)-3] + " " + compact[len(compact)-3:]
+}
+
+// isInwardCode reports whether s looks like the inward half of a postcode, e.g. "3QP"
+func isInwardCode(s string) bool {
+	if _, err := strconv.Atoi(s[:1]); err != nil {
+		return false
+	}
+	for _, r := range s[1:] {
+		if r < 'A' || r > 'Z' {
+			return false
+		}
+	}
+	return true
+}
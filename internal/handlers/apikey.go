@@ -0,0 +1,172 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Candoo/vehicles-api/internal/apperr"
+	"github.com/Candoo/vehicles-api/internal/auth"
+	"github.com/Candoo/vehicles-api/internal/models"
+	"github.com/Candoo/vehicles-api/internal/repository"
+	"github.com/gin-gonic/gin"
+)
+
+// APIKeyHandler handles HTTP requests for API keys and tokens
+type APIKeyHandler struct {
+	repo      *repository.APIKeyRepository
+	jwtSecret []byte
+	tokenTTL  time.Duration
+}
+
+// NewAPIKeyHandler creates a new API key handler. Tokens are not issued when jwtSecret is empty.
+func NewAPIKeyHandler(repo *repository.APIKeyRepository, jwtSecret []byte, tokenTTL time.Duration) *APIKeyHandler {
+	return &APIKeyHandler{repo: repo, jwtSecret: jwtSecret, tokenTTL: tokenTTL}
+}
+
+// CreateAPIKey godoc
+// @Summary Issue API key
+// @Description Issue a new API key. The plaintext key is returned once and cannot be retrieved later.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param key body models.CreateAPIKeyRequest true "Key details"
+// @Success 201 {object} models.CreateAPIKeyResponse
+// @Failure 400 {object} apperr.Problem "Bad request"
+// @Failure 401 {object} apperr.Problem "Authentication required"
+// @Failure 403 {object} apperr.Problem "Insufficient permissions"
+// @Failure 500 {object} apperr.Problem "Internal server error"
+// @Router /admin/api-keys [post]
+func (h *APIKeyHandler) CreateAPIKey(c *gin.Context) {
+	var req models.CreateAPIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(apperr.Validation("name and role are required"))
+		return
+	}
+
+	if req.Role != models.RoleStaff && req.Role != models.RoleAdmin {
+		c.Error(apperr.Validation("role must be staff or admin"))
+		return
+	}
+
+	plaintext, prefix, err := auth.GenerateAPIKey()
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	key := models.APIKey{
+		Name:       strings.TrimSpace(req.Name),
+		Prefix:     prefix,
+		SecretHash: auth.HashAPIKey(plaintext),
+		Role:       req.Role,
+		CreatedBy:  auth.FromContext(c.Request.Context()).Subject,
+	}
+	if err := h.repo.CreateAPIKey(&key); err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, models.CreateAPIKeyResponse{
+		APIKey: key,
+		Key:    plaintext,
+	})
+}
+
+// ListAPIKeys godoc
+// @Summary List API keys
+// @Description List every issued API key, including revoked ones. Secrets are never returned.
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} map[string]interface{} "API keys"
+// @Failure 401 {object} apperr.Problem "Authentication required"
+// @Failure 403 {object} apperr.Problem "Insufficient permissions"
+// @Failure 500 {object} apperr.Problem "Internal server error"
+// @Router /admin/api-keys [get]
+func (h *APIKeyHandler) ListAPIKeys(c *gin.Context) {
+	keys, err := h.repo.ListAPIKeys()
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"api_keys": keys,
+	})
+}
+
+// RevokeAPIKey godoc
+// @Summary Revoke API key
+// @Description Revoke an API key so it can no longer authenticate. Tokens issued for the key are rejected from the next request.
+// @Tags admin
+// @Security BearerAuth
+// @Param id path int true "API key ID"
+// @Success 204 "API key revoked"
+// @Failure 400 {object} apperr.Problem "Bad request"
+// @Failure 401 {object} apperr.Problem "Authentication required"
+// @Failure 403 {object} apperr.Problem "Insufficient permissions"
+// @Failure 404 {object} apperr.Problem "API key not found"
+// @Failure 500 {object} apperr.Problem "Internal server error"
+// @Router /admin/api-keys/{id} [delete]
+func (h *APIKeyHandler) RevokeAPIKey(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.Error(apperr.Validation("invalid API key ID"))
+		return
+	}
+
+	if _, err := h.repo.RevokeAPIKey(uint(id)); err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// IssueToken godoc
+// @Summary Exchange API key for a token
+// @Description Exchange an API key for a short-lived HS256 JWT carrying the same role. The token stops working when the key is revoked.
+// @Tags auth
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} models.TokenResponse
+// @Failure 401 {object} apperr.Problem "Authentication required"
+// @Failure 403 {object} apperr.Problem "Insufficient permissions"
+// @Failure 503 {object} apperr.Problem "Token issuing not configured"
+// @Router /auth/token [post]
+func (h *APIKeyHandler) IssueToken(c *gin.Context) {
+	if len(h.jwtSecret) == 0 {
+		c.Error(apperr.Unavailable(nil, "token issuing is not configured"))
+		return
+	}
+
+	identity := auth.FromContext(c.Request.Context())
+	if identity.Method != auth.MethodAPIKey {
+		c.Error(apperr.Forbidden("tokens can only be issued for API keys"))
+		return
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(h.tokenTTL)
+
+	token, err := auth.SignJWT(auth.Claims{
+		Subject:   identity.Subject,
+		Role:      identity.Role,
+		KeyID:     identity.KeyID,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: expiresAt.Unix(),
+	}, h.jwtSecret)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.TokenResponse{
+		Token:     token,
+		TokenType: "Bearer",
+		ExpiresAt: time.Unix(expiresAt.Unix(), 0).UTC(),
+	})
+}
@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"github.com/gin-gonic/gin"
+)
+
+// GetMakeVehicles godoc
+// @Summary Browse vehicles by make
+// @Description Get a paginated list of vehicles of one make, addressed by its slug. Accepts the same query parameters as GET /vehicles.
+// @Tags vehicles
+// @Accept json
+// @Produce json
+// @Param make_slug path string true "Make slug, e.g. skoda"
+// @Param page query int false "Page number" default(1)
+// @Param results_per_page query int false "Results per page" default(10)
+// @Param sort query string false "Comma separated sort keys with optional direction, e.g. price:asc,year:desc"
+// @Success 200 {object} models.VehicleResponse
+// @Failure 400 {object} apperr.Problem "Bad request"
+// @Failure 500 {object} apperr.Problem "Internal server error"
+// @Router /makes/{make_slug}/vehicles [get]
+func (h *VehicleHandler) GetMakeVehicles(c *gin.Context) {
+	filters, withFacets, err := parseVehicleFilters(c.Request.URL.Query(), h.postcodes)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	filters.MakeSlugs = []string{c.Param("make_slug")}
+	listVehicles(c, h.repo, filters, withFacets)
+}
+
+// GetRangeVehicles godoc
+// @Summary Browse vehicles by make and range
+// @Description Get a paginated list of vehicles of one range, addressed by make and range slugs. Accepts the same query parameters as GET /vehicles.
+// @Tags vehicles
+// @Accept json
+// @Produce json
+// @Param make_slug path string true "Make slug, e.g. skoda"
+// @Param range_slug path string true "Range slug, e.g. fabia"
+// @Param page query int false "Page number" default(1)
+// @Param results_per_page query int false "Results per page" default(10)
+// @Param sort query string false "Comma separated sort keys with optional direction, e.g. price:asc,year:desc"
+// @Success 200 {object} models.VehicleResponse
+// @Failure 400 {object} apperr.Problem "Bad request"
+// @Failure 500 {object} apperr.Problem "Internal server error"
+// @Router /makes/{make_slug}/ranges/{range_slug}/vehicles [get]
+func (h *VehicleHandler) GetRangeVehicles(c *gin.Context) {
+	filters, withFacets, err := parseVehicleFilters(c.Request.URL.Query(), h.postcodes)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	filters.MakeSlugs = []string{c.Param("make_slug")}
+	filters.RangeSlugs = []string{c.Param("range_slug")}
+	listVehicles(c, h.repo, filters, withFacets)
+}
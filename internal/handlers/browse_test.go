@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/Candoo/vehicles-api/internal/models"
+)
+
+func TestGetMakeVehicles(t *testing.T) {
+	fiesta := testVehicle(1, 6000)
+	fiesta.Make, fiesta.Model = "Ford", "Fiesta"
+	api := newTestAPI(t, fiesta, testVehicle(2, 5000), testVehicle(3, 7000))
+
+	tests := []struct {
+		path string
+		want []int
+	}{
+		{"/makes/skoda/vehicles?sort=price:asc", []int{2, 3}},
+		{"/makes/skoda/ranges/fabia/vehicles?sort=price:asc&max_price=6000", []int{2}},
+		{"/makes/skoda/ranges/fiesta/vehicles", nil},
+	}
+
+	for _, tt := range tests {
+		rec := api.serve(http.MethodGet, tt.path, nil)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: status = %d, body %s", tt.path, rec.Code, rec.Body)
+		}
+
+		var response models.VehicleResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		var got []int
+		for _, vehicle := range response.Data {
+			got = append(got, vehicle.VehicleID)
+		}
+		if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+			t.Errorf("%s: vehicle IDs = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+}
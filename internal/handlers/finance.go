@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/Candoo/vehicles-api/internal/apperr"
+	"github.com/Candoo/vehicles-api/internal/finance"
+	"github.com/Candoo/vehicles-api/internal/repository"
+	"github.com/gin-gonic/gin"
+)
+
+// FinanceHandler handles finance quote requests
+type FinanceHandler struct {
+	repo  repository.VehicleStore
+	rates *finance.Table
+}
+
+// NewFinanceHandler creates a new finance handler quoting from the given rates
+func NewFinanceHandler(repo repository.VehicleStore, rates *finance.Table) *FinanceHandler {
+	return &FinanceHandler{repo: repo, rates: rates}
+}
+
+// GetFinanceQuote godoc
+// @Summary Get finance quote
+// @Description Work out HP or PCP monthly payments for a vehicle from a deposit, term and, for PCP, annual mileage, with a representative example
+// @Tags finance
+// @Accept json
+// @Produce json
+// @Param id path int true "Vehicle ID"
+// @Param request body finance.Request true "Product, deposit, term and annual mileage"
+// @Success 200 {object} finance.Quote
+// @Failure 400 {object} apperr.Problem "Bad request"
+// @Failure 404 {object} apperr.Problem "Vehicle not found"
+// @Failure 409 {object} apperr.Problem "Vehicle not for sale"
+// @Failure 500 {object} apperr.Problem "Internal server error"
+// @Router /vehicles/{id}/finance-quote [post]
+func (h *FinanceHandler) GetFinanceQuote(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.Error(apperr.Validation("invalid vehicle ID"))
+		return
+	}
+
+	var request finance.Request
+	if err := decodeStrictJSON(c, &request); err != nil {
+		c.Error(apperr.Invalid(err))
+		return
+	}
+
+	vehicle, err := h.repo.GetVehicleByID(id)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	if !vehicle.StockStatus.Listed() {
+		c.Error(apperr.Conflict("vehicle is not for sale"))
+		return
+	}
+
+	quote, err := h.rates.Quote(vehicle.Price, request)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, quote)
+}
@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/Candoo/vehicles-api/internal/apperr"
+	"github.com/Candoo/vehicles-api/internal/models"
+)
+
+func TestGetFinanceQuote(t *testing.T) {
+	api := newTestAPI(t, testVehicle(1, 10000))
+
+	rec := api.serve(http.MethodPost, "/vehicles/1/finance-quote", map[string]interface{}{
+		"product":     "hp",
+		"deposit":     "1000.00",
+		"term_months": 36,
+	})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", rec.Code, rec.Body)
+	}
+	var quote map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &quote); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if quote["monthly_payment"] != "288.20" || quote["total_amount_payable"] != "11385.20" || quote["representative_apr"] != 9.9 {
+		t.Errorf("quote = %v", quote)
+	}
+	if _, ok := quote["optional_final_payment"]; ok {
+		t.Errorf("HP quote has an optional final payment: %v", quote)
+	}
+}
+
+func TestGetFinanceQuoteRejectsInvalidRequests(t *testing.T) {
+	api := newTestAPI(t, testVehicle(1, 10000))
+
+	rec := api.serve(http.MethodPost, "/vehicles/1/finance-quote", map[string]interface{}{
+		"product":     "pcp",
+		"deposit":     "12000.00",
+		"term_months": 72,
+	})
+	var problem apperr.Problem
+	if err := json.Unmarshal(rec.Body.Bytes(), &problem); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if rec.Code != http.StatusBadRequest || len(problem.Errors) != 2 {
+		t.Errorf("invalid request: status = %d, errors %+v", rec.Code, problem.Errors)
+	}
+	if rec := api.serve(http.MethodPost, "/vehicles/1/finance-quote", map[string]interface{}{"product": "pcp", "apr": 0}); rec.Code != http.StatusBadRequest {
+		t.Errorf("unknown field: status = %d, want 400", rec.Code)
+	}
+}
+
+func TestGetFinanceQuoteForUnavailableVehicle(t *testing.T) {
+	sold := testVehicle(2, 8000)
+	sold.StockStatus = models.StockStatusSold
+	api := newTestAPI(t, sold)
+
+	valid := map[string]interface{}{"product": "pcp", "term_months": 36}
+	if rec := api.serve(http.MethodPost, "/vehicles/2/finance-quote", valid); rec.Code != http.StatusConflict {
+		t.Errorf("sold vehicle: status = %d, want 409", rec.Code)
+	}
+	if rec := api.serve(http.MethodPost, "/vehicles/3/finance-quote", valid); rec.Code != http.StatusNotFound {
+		t.Errorf("missing vehicle: status = %d, want 404", rec.Code)
+	}
+}
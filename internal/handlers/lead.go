@@ -0,0 +1,405 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Candoo/vehicles-api/internal/apperr"
+	"github.com/Candoo/vehicles-api/internal/auth"
+	"github.com/Candoo/vehicles-api/internal/models"
+	"github.com/Candoo/vehicles-api/internal/repository"
+	"github.com/gin-gonic/gin"
+)
+
+// leadQueryKeys lists the query parameters accepted by GET /leads
+var leadQueryKeys = []string{"page", "results_per_page", "status", "assigned_to", "site_slug", "vehicle_id", "since"}
+
+// leadExportColumns is the header of the CSV lead export
+var leadExportColumns = []string{
+	"lead_id", "status", "created_at", "last_enquiry_at", "name", "email", "phone",
+	"preferred_contact_method", "vehicle_id", "site_slug", "assigned_to", "enquiry_count",
+	"contacted_at", "closed_at", "messages",
+}
+
+// LeadHandler handles customer enquiries and the leads they create
+type LeadHandler struct {
+	repo  repository.VehicleStore
+	leads repository.LeadStore
+}
+
+// NewLeadHandler creates a new lead handler recording enquiries about the vehicles
+// in repo as leads
+func NewLeadHandler(repo repository.VehicleStore, leads repository.LeadStore) *LeadHandler {
+	return &LeadHandler{repo: repo, leads: leads}
+}
+
+// CreateEnquiry godoc
+// @Summary Enquire about a vehicle
+// @Description Record a customer's interest in a vehicle. A repeat enquiry from the same email or phone about the same vehicle is added to its open lead.
+// @Tags leads
+// @Accept json
+// @Produce json
+// @Param id path int true "Vehicle ID"
+// @Param enquiry body models.EnquiryRequest true "Name, contact details and message"
+// @Success 201 {object} models.EnquiryReceipt
+// @Failure 400 {object} apperr.Problem "Bad request"
+// @Failure 404 {object} apperr.Problem "Vehicle not found"
+// @Failure 409 {object} apperr.Problem "Vehicle not for sale"
+// @Failure 500 {object} apperr.Problem "Internal server error"
+// @Router /vehicles/{id}/enquiries [post]
+func (h *LeadHandler) CreateEnquiry(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.Error(apperr.Validation("invalid vehicle ID"))
+		return
+	}
+
+	var req models.EnquiryRequest
+	if err := decodeStrictJSON(c, &req); err != nil {
+		c.Error(apperr.Invalid(err))
+		return
+	}
+	if err := req.Validate(); err != nil {
+		c.Error(apperr.Invalid(err))
+		return
+	}
+
+	vehicle, err := h.repo.GetVehicleByID(id)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	if !vehicle.StockStatus.Listed() {
+		c.Error(apperr.Conflict("vehicle is not for sale"))
+		return
+	}
+
+	lead, repeat, err := h.leads.CreateEnquiry(id, req)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, models.EnquiryReceipt{
+		LeadID:     lead.ID,
+		VehicleID:  lead.VehicleID,
+		Repeat:     repeat,
+		ReceivedAt: lead.LastEnquiryAt,
+	})
+}
+
+// ListLeads godoc
+// @Summary List leads
+// @Description Get leads, most recent enquiry first
+// @Tags leads
+// @Produce json
+// @Security BearerAuth
+// @Param page query int false "Page number" default(1)
+// @Param results_per_page query int false "Results per page (1-100)" default(20)
+// @Param status query string false "Comma separated lead statuses (new, contacted, closed)"
+// @Param assigned_to query string false "Assignee, or none for unassigned leads"
+// @Param site_slug query string false "Comma separated site slugs"
+// @Param vehicle_id query int false "Vehicle ID"
+// @Param since query string false "Only leads with an enquiry since this date (YYYY-MM-DD) or time (RFC 3339)"
+// @Success 200 {object} models.LeadResponse
+// @Failure 400 {object} apperr.Problem "Bad request"
+// @Failure 401 {object} apperr.Problem "Authentication required"
+// @Failure 403 {object} apperr.Problem "Insufficient permissions"
+// @Failure 500 {object} apperr.Problem "Internal server error"
+// @Router /leads [get]
+func (h *LeadHandler) ListLeads(c *gin.Context) {
+	filters, err := parseLeadFilters(c.Request.URL.Query())
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	leads, metadata, err := h.leads.ListLeads(filters)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.LeadResponse{
+		Data: leads,
+		Meta: *metadata,
+	})
+}
+
+// ExportLeads godoc
+// @Summary Export leads
+// @Description Download every lead matching the filters as CSV for the CRM, oldest first, with its enquiry messages
+// @Tags leads
+// @Produce text/csv
+// @Security BearerAuth
+// @Param status query string false "Comma separated lead statuses (new, contacted, closed)"
+// @Param assigned_to query string false "Assignee, or none for unassigned leads"
+// @Param site_slug query string false "Comma separated site slugs"
+// @Param vehicle_id query int false "Vehicle ID"
+// @Param since query string false "Only leads with an enquiry since this date (YYYY-MM-DD) or time (RFC 3339)"
+// @Success 200 {string} string "CSV export"
+// @Failure 400 {object} apperr.Problem "Bad request"
+// @Failure 401 {object} apperr.Problem "Authentication required"
+// @Failure 403 {object} apperr.Problem "Insufficient permissions"
+// @Failure 500 {object} apperr.Problem "Internal server error"
+// @Router /leads/export [get]
+func (h *LeadHandler) ExportLeads(c *gin.Context) {
+	filters, err := parseLeadFilters(c.Request.URL.Query())
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	leads, err := h.leads.ExportLeads(filters)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	// The file is built before anything is sent so a failure is reported as an
+	// error rather than served as a truncated export
+	var body bytes.Buffer
+	writer := csv.NewWriter(&body)
+	writer.Write(leadExportColumns)
+	for _, lead := range leads {
+		writer.Write(leadExportRow(&lead))
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		c.Error(fmt.Errorf("failed to write leads export: %w", err))
+		return
+	}
+
+	filename := fmt.Sprintf("leads-%s.csv", time.Now().UTC().Format("20060102"))
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	c.Data(http.StatusOK, "text/csv; charset=utf-8", body.Bytes())
+}
+
+// GetLead godoc
+// @Summary Get lead
+// @Description Get a lead with every enquiry received on it, oldest first
+// @Tags leads
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Lead ID"
+// @Success 200 {object} models.Lead
+// @Failure 400 {object} apperr.Problem "Bad request"
+// @Failure 401 {object} apperr.Problem "Authentication required"
+// @Failure 403 {object} apperr.Problem "Insufficient permissions"
+// @Failure 404 {object} apperr.Problem "Lead not found"
+// @Failure 500 {object} apperr.Problem "Internal server error"
+// @Router /leads/{id} [get]
+func (h *LeadHandler) GetLead(c *gin.Context) {
+	id, err := parseLeadID(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	lead, err := h.leads.GetLead(id)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, lead)
+}
+
+// TransitionLeadStatus godoc
+// @Summary Change lead status
+// @Description Move a lead from new to contacted or closed, or from contacted to closed. A lead marked contacted while unassigned is assigned to the caller.
+// @Tags leads
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Lead ID"
+// @Param transition body models.LeadStatusRequest true "New status"
+// @Success 200 {object} models.Lead
+// @Failure 400 {object} apperr.Problem "Bad request"
+// @Failure 401 {object} apperr.Problem "Authentication required"
+// @Failure 403 {object} apperr.Problem "Insufficient permissions"
+// @Failure 404 {object} apperr.Problem "Lead not found"
+// @Failure 409 {object} apperr.Problem "Illegal status transition"
+// @Failure 500 {object} apperr.Problem "Internal server error"
+// @Router /leads/{id}/status [post]
+func (h *LeadHandler) TransitionLeadStatus(c *gin.Context) {
+	id, err := parseLeadID(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	var req models.LeadStatusRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(apperr.Validation("status is required"))
+		return
+	}
+
+	status, err := models.ParseLeadStatus(req.Status)
+	if err != nil {
+		c.Error(apperr.Invalid(err))
+		return
+	}
+
+	changedBy := auth.FromContext(c.Request.Context()).Subject
+
+	lead, err := h.leads.TransitionLeadStatus(id, status, changedBy)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, lead)
+}
+
+// AssignLead godoc
+// @Summary Assign lead
+// @Description Assign an open lead to a member of staff, or unassign it with an empty assigned_to
+// @Tags leads
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Lead ID"
+// @Param assignment body models.LeadAssignmentRequest true "Assignee"
+// @Success 200 {object} models.Lead
+// @Failure 400 {object} apperr.Problem "Bad request"
+// @Failure 401 {object} apperr.Problem "Authentication required"
+// @Failure 403 {object} apperr.Problem "Insufficient permissions"
+// @Failure 404 {object} apperr.Problem "Lead not found"
+// @Failure 409 {object} apperr.Problem "Lead closed"
+// @Failure 500 {object} apperr.Problem "Internal server error"
+// @Router /leads/{id}/assign [post]
+func (h *LeadHandler) AssignLead(c *gin.Context) {
+	id, err := parseLeadID(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	var req models.LeadAssignmentRequest
+	if err := decodeStrictJSON(c, &req); err != nil {
+		c.Error(apperr.Invalid(err))
+		return
+	}
+	assignee := strings.TrimSpace(req.AssignedTo)
+	if len(assignee) > 100 {
+		c.Error(apperr.Validation("assigned_to must be at most 100 characters"))
+		return
+	}
+
+	lead, err := h.leads.AssignLead(id, assignee)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, lead)
+}
+
+// parseLeadID reads the lead ID path parameter
+func parseLeadID(c *gin.Context) (uint, error) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil || id == 0 {
+		return 0, apperr.Validation("invalid lead ID")
+	}
+	return uint(id), nil
+}
+
+// parseLeadFilters validates the GET /leads query string and builds the filters
+func parseLeadFilters(values url.Values) (models.LeadFilters, error) {
+	p := newQueryParser(values, leadQueryKeys)
+
+	filters := models.LeadFilters{
+		Page:           p.integer("page", 1, 1, math.MaxInt32),
+		ResultsPerPage: p.integer("results_per_page", 20, 1, 100),
+		SiteSlugs:      p.list("site_slug"),
+		VehicleID:      p.integer("vehicle_id", 0, 1, math.MaxInt32),
+	}
+
+	for _, value := range p.list("status") {
+		status, err := models.ParseLeadStatus(value)
+		if err != nil {
+			p.fail("status", "%s", err.Error())
+			continue
+		}
+		filters.Statuses = append(filters.Statuses, status)
+	}
+
+	if assignee := p.text("assigned_to"); strings.EqualFold(assignee, "none") {
+		filters.Unassigned = true
+	} else {
+		filters.AssignedTo = assignee
+	}
+
+	if p.has("since") {
+		since, err := parseSince(p.text("since"))
+		if err != nil {
+			p.fail("since", "must be a date (YYYY-MM-DD) or an RFC 3339 time")
+		} else {
+			filters.Since = &since
+		}
+	}
+
+	return filters, p.err()
+}
+
+// parseSince parses a date, taken as midnight UTC, or an RFC 3339 time
+func parseSince(value string) (time.Time, error) {
+	if since, err := time.Parse("2006-01-02", value); err == nil {
+		return since, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+// leadExportRow formats a lead as a row of the CSV export. Enquiry messages are
+// joined by blank lines.
+func leadExportRow(lead *models.Lead) []string {
+	messages := make([]string, 0, len(lead.Enquiries))
+	for _, enquiry := range lead.Enquiries {
+		if enquiry.Message != "" {
+			messages = append(messages, enquiry.Message)
+		}
+	}
+
+	return []string{
+		strconv.FormatUint(uint64(lead.ID), 10),
+		string(lead.Status),
+		lead.CreatedAt.UTC().Format(time.RFC3339),
+		lead.LastEnquiryAt.UTC().Format(time.RFC3339),
+		spreadsheetSafe(lead.Name),
+		spreadsheetSafe(lead.Email),
+		lead.Phone,
+		string(lead.PreferredContactMethod),
+		strconv.Itoa(lead.VehicleID),
+		lead.SiteSlug,
+		spreadsheetSafe(lead.AssignedTo),
+		strconv.Itoa(lead.EnquiryCount),
+		formatOptionalTime(lead.ContactedAt),
+		formatOptionalTime(lead.ClosedAt),
+		spreadsheetSafe(strings.Join(messages, "\n\n")),
+	}
+}
+
+// spreadsheetSafe stops customer text starting with a formula character being run
+// as a formula when the export is opened in a spreadsheet
+func spreadsheetSafe(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+// formatOptionalTime formats a time for the CSV export, leaving it blank when unset
+func formatOptionalTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,145 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/Candoo/vehicles-api/internal/models"
+)
+
+// testEnquiry is an enquiry from Sam with a message a spreadsheet would run as a formula
+func testEnquiry() map[string]interface{} {
+	return map[string]interface{}{
+		"name":    "Sam Taylor",
+		"email":   "Sam@Example.com",
+		"phone":   "+44 7700 900123",
+		"message": "=HYPERLINK(\"http://example.com\")",
+	}
+}
+
+// newLeadAPI serves a vehicle in stock with one lead, from two enquiries by Sam
+func newLeadAPI(t *testing.T) *testAPI {
+	t.Helper()
+	api := newTestAPI(t, testVehicle(1, 10000))
+	for i := 0; i < 2; i++ {
+		if rec := api.serve(http.MethodPost, "/vehicles/1/enquiries", testEnquiry()); rec.Code != http.StatusCreated {
+			t.Fatalf("enquiry %d: status = %d, body %s", i, rec.Code, rec.Body)
+		}
+	}
+	return api
+}
+
+func TestCreateEnquiry(t *testing.T) {
+	api := newTestAPI(t, testVehicle(1, 10000))
+
+	for i, wantRepeat := range []bool{false, true} {
+		rec := api.serve(http.MethodPost, "/vehicles/1/enquiries", testEnquiry())
+		if rec.Code != http.StatusCreated {
+			t.Fatalf("enquiry %d: status = %d, body %s", i, rec.Code, rec.Body)
+		}
+		var receipt models.EnquiryReceipt
+		if err := json.Unmarshal(rec.Body.Bytes(), &receipt); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		if receipt.LeadID != 1 || receipt.Repeat != wantRepeat {
+			t.Errorf("enquiry %d: receipt = %+v", i, receipt)
+		}
+	}
+}
+
+func TestCreateEnquiryRejectsInvalidRequests(t *testing.T) {
+	sold := testVehicle(2, 8000)
+	sold.StockStatus = models.StockStatusSold
+	api := newTestAPI(t, testVehicle(1, 10000), sold)
+
+	for name, body := range map[string]map[string]interface{}{
+		"no contact":           {"name": "Sam"},
+		"bad email":            {"name": "Sam", "email": "not-an-email"},
+		"phone without number": {"name": "Sam", "email": "sam@example.com", "preferred_contact_method": "phone"},
+		"unknown method":       {"name": "Sam", "email": "sam@example.com", "preferred_contact_method": "pigeon"},
+	} {
+		if rec := api.serve(http.MethodPost, "/vehicles/1/enquiries", body); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want 400", name, rec.Code)
+		}
+	}
+	if rec := api.serve(http.MethodPost, "/vehicles/2/enquiries", testEnquiry()); rec.Code != http.StatusConflict {
+		t.Errorf("sold vehicle: status = %d, want 409", rec.Code)
+	}
+}
+
+func TestListLeads(t *testing.T) {
+	api := newLeadAPI(t)
+
+	rec := api.serveAs(models.RoleStaff, http.MethodGet, "/leads?status=new&assigned_to=none", nil)
+	var list models.LeadResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &list); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if rec.Code != http.StatusOK || len(list.Data) != 1 || list.Data[0].EnquiryCount != 2 || list.Data[0].Phone != "07700900123" || list.Data[0].Email != "sam@example.com" {
+		t.Errorf("leads: status = %d, body %s", rec.Code, rec.Body)
+	}
+	if rec := api.serveAs(models.RoleStaff, http.MethodGet, "/leads?status=lost&since=yesterday", nil); rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "since") {
+		t.Errorf("bad filters: status = %d, body %s", rec.Code, rec.Body)
+	}
+	if rec := api.serveAs(models.RoleStaff, http.MethodGet, "/leads/2", nil); rec.Code != http.StatusNotFound {
+		t.Errorf("missing lead: status = %d, want 404", rec.Code)
+	}
+}
+
+func TestAssignLead(t *testing.T) {
+	api := newLeadAPI(t)
+
+	rec := api.serveAs(models.RoleStaff, http.MethodPost, "/leads/1/assign", map[string]interface{}{"assigned_to": "sales-winsford"})
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"assigned_to":"sales-winsford"`) {
+		t.Errorf("assign: status = %d, body %s", rec.Code, rec.Body)
+	}
+
+	rec = api.serveAs(models.RoleStaff, http.MethodGet, "/leads?assigned_to=sales-winsford", nil)
+	var list models.LeadResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &list); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if rec.Code != http.StatusOK || len(list.Data) != 1 {
+		t.Errorf("leads assigned to sales-winsford: status = %d, body %s", rec.Code, rec.Body)
+	}
+}
+
+func TestTransitionLeadStatus(t *testing.T) {
+	api := newLeadAPI(t)
+
+	if rec := api.serveAs(models.RoleStaff, http.MethodPost, "/leads/1/status", map[string]interface{}{"status": "closed"}); rec.Code != http.StatusOK {
+		t.Errorf("close: status = %d, body %s", rec.Code, rec.Body)
+	}
+	if rec := api.serveAs(models.RoleStaff, http.MethodPost, "/leads/1/status", map[string]interface{}{"status": "contacted"}); rec.Code != http.StatusConflict {
+		t.Errorf("reopen: status = %d, want 409", rec.Code)
+	}
+}
+
+func TestExportLeads(t *testing.T) {
+	api := newLeadAPI(t)
+	if rec := api.serveAs(models.RoleStaff, http.MethodPost, "/leads/1/assign", map[string]interface{}{"assigned_to": "sales-winsford"}); rec.Code != http.StatusOK {
+		t.Fatalf("assign: status = %d, body %s", rec.Code, rec.Body)
+	}
+
+	rec := api.serveAs(models.RoleStaff, http.MethodGet, "/leads/export?status=new", nil)
+	if rec.Code != http.StatusOK || !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/csv") {
+		t.Fatalf("export: status = %d, Content-Type %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	rows, err := csv.NewReader(rec.Body).ReadAll()
+	if err != nil {
+		t.Fatalf("read CSV: %v", err)
+	}
+	if len(rows) != 2 || rows[0][0] != "lead_id" || rows[1][1] != "new" || rows[1][10] != "sales-winsford" {
+		t.Fatalf("export rows = %q", rows)
+	}
+	// Messages are escaped so a spreadsheet does not run them as formulas
+	if messages := rows[1][len(rows[1])-1]; !strings.HasPrefix(messages, "'=HYPERLINK") || strings.Count(messages, "=HYPERLINK") != 2 {
+		t.Errorf("exported messages = %q", messages)
+	}
+	if rec := api.serveAs(models.RoleStaff, http.MethodGet, "/leads/export?status=closed", nil); strings.Count(rec.Body.String(), "\n") != 1 {
+		t.Errorf("export of closed leads = %q, want only the header", rec.Body)
+	}
+}
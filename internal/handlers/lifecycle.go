@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/Candoo/vehicles-api/internal/apperr"
+	"github.com/Candoo/vehicles-api/internal/auth"
+	"github.com/Candoo/vehicles-api/internal/models"
+	"github.com/gin-gonic/gin"
+)
+
+// TransitionVehicleStatus godoc
+// @Summary Change vehicle stock status
+// @Description Move a vehicle through its lifecycle (in_prep, in_stock, reserved, sold, withdrawn). Illegal transitions are rejected, as are moves out of reserved while an online reservation holds the vehicle; complete or cancel the reservation instead.
+// @Tags vehicles
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Vehicle ID"
+// @Param transition body models.StatusTransitionRequest true "New status"
+// @Success 200 {object} models.Vehicle
+// @Failure 400 {object} apperr.Problem "Bad request"
+// @Failure 401 {object} apperr.Problem "Authentication required"
+// @Failure 403 {object} apperr.Problem "Insufficient permissions"
+// @Failure 404 {object} apperr.Problem "Vehicle not found"
+// @Failure 409 {object} apperr.Problem "Illegal status transition or vehicle held by a reservation"
+// @Failure 500 {object} apperr.Problem "Internal server error"
+// @Router /vehicles/{id}/status [post]
+func (h *VehicleHandler) TransitionVehicleStatus(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.Error(apperr.Validation("invalid vehicle ID"))
+		return
+	}
+
+	var req models.StatusTransitionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(apperr.Validation("status is required"))
+		return
+	}
+
+	status, err := models.ParseStockStatus(req.Status)
+	if err != nil {
+		c.Error(apperr.Invalid(err))
+		return
+	}
+
+	changedBy := auth.FromContext(c.Request.Context()).Subject
+
+	vehicle, err := h.repo.TransitionVehicleStatus(id, status, changedBy, req.Reason)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, vehicle)
+}
+
+// GetVehicleStatusHistory godoc
+// @Summary Get vehicle status history
+// @Description Get every stock status change of a vehicle, oldest first
+// @Tags vehicles
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Vehicle ID"
+// @Success 200 {object} map[string]interface{} "Status history"
+// @Failure 400 {object} apperr.Problem "Bad request"
+// @Failure 401 {object} apperr.Problem "Authentication required"
+// @Failure 403 {object} apperr.Problem "Insufficient permissions"
+// @Failure 404 {object} apperr.Problem "Vehicle not found"
+// @Failure 500 {object} apperr.Problem "Internal server error"
+// @Router /vehicles/{id}/status-history [get]
+func (h *VehicleHandler) GetVehicleStatusHistory(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.Error(apperr.Validation("invalid vehicle ID"))
+		return
+	}
+
+	history, err := h.repo.GetStatusHistory(id)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"history": history,
+	})
+}
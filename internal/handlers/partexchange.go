@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/Candoo/vehicles-api/internal/apperr"
+	"github.com/Candoo/vehicles-api/internal/models"
+	"github.com/Candoo/vehicles-api/internal/repository"
+	"github.com/Candoo/vehicles-api/internal/valuation"
+	"github.com/gin-gonic/gin"
+)
+
+// PartExchangeHandler handles part-exchange valuation requests
+type PartExchangeHandler struct {
+	repo          repository.VehicleStore
+	partExchanges repository.PartExchangeStore
+	provider      valuation.Provider
+}
+
+// NewPartExchangeHandler creates a new part-exchange handler recording requests
+// against the vehicles in repo in partExchanges, and valuing cars with the given
+// provider
+func NewPartExchangeHandler(repo repository.VehicleStore, partExchanges repository.PartExchangeStore, provider valuation.Provider) *PartExchangeHandler {
+	return &PartExchangeHandler{repo: repo, partExchanges: partExchanges, provider: provider}
+}
+
+// CreatePartExchange godoc
+// @Summary Request part-exchange valuation
+// @Description Record a customer's car as a part-exchange against a vehicle and return an indicative value. The value is null when the car cannot be valued; the request is kept either way.
+// @Tags part-exchange
+// @Accept json
+// @Produce json
+// @Param id path int true "Vehicle ID"
+// @Param request body models.PartExchangeRequest true "VRM, mileage and condition of the customer's car"
+// @Success 201 {object} models.PartExchange
+// @Failure 400 {object} apperr.Problem "Bad request"
+// @Failure 404 {object} apperr.Problem "Vehicle not found"
+// @Failure 409 {object} apperr.Problem "Vehicle not for sale"
+// @Failure 500 {object} apperr.Problem "Internal server error"
+// @Router /vehicles/{id}/part-exchange [post]
+func (h *PartExchangeHandler) CreatePartExchange(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.Error(apperr.Validation("invalid vehicle ID"))
+		return
+	}
+
+	var req models.PartExchangeRequest
+	if err := decodeStrictJSON(c, &req); err != nil {
+		c.Error(apperr.Invalid(err))
+		return
+	}
+	if err := req.Validate(); err != nil {
+		c.Error(apperr.Invalid(err))
+		return
+	}
+
+	vehicle, err := h.repo.GetVehicleByID(id)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	if !vehicle.StockStatus.Listed() {
+		c.Error(apperr.Conflict("vehicle is not for sale"))
+		return
+	}
+
+	request := models.PartExchange{
+		VehicleID: id,
+		VRM:       req.VRM,
+		Make:      req.Make,
+		Model:     req.Model,
+		Year:      req.Year,
+		Mileage:   *req.Mileage,
+		Condition: req.Condition,
+		Provider:  h.provider.Name(),
+	}
+	if request.Year == 0 {
+		request.Year, _ = valuation.YearFromVRM(req.VRM)
+	}
+
+	// A failed valuation still leaves a lead for the sales team to follow up
+	value, err := h.provider.Value(c.Request.Context(), valuation.Request{
+		VRM:       request.VRM,
+		Make:      request.Make,
+		Model:     request.Model,
+		Year:      request.Year,
+		Mileage:   request.Mileage,
+		Condition: request.Condition,
+	})
+	switch {
+	case err == nil:
+		request.Value = &value
+	case !errors.Is(err, valuation.ErrNoValuation):
+		log.Printf("Warning: part-exchange valuation by %s failed: %v", h.provider.Name(), err)
+	}
+
+	if err := h.partExchanges.CreatePartExchange(&request); err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, request)
+}
+
+// GetPartExchanges godoc
+// @Summary Get part-exchange requests
+// @Description Get every part-exchange request made against a vehicle, newest first
+// @Tags part-exchange
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Vehicle ID"
+// @Success 200 {object} map[string]interface{} "Part-exchange requests"
+// @Failure 400 {object} apperr.Problem "Bad request"
+// @Failure 401 {object} apperr.Problem "Authentication required"
+// @Failure 403 {object} apperr.Problem "Insufficient permissions"
+// @Failure 404 {object} apperr.Problem "Vehicle not found"
+// @Failure 500 {object} apperr.Problem "Internal server error"
+// @Router /vehicles/{id}/part-exchanges [get]
+func (h *PartExchangeHandler) GetPartExchanges(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.Error(apperr.Validation("invalid vehicle ID"))
+		return
+	}
+
+	requests, err := h.partExchanges.GetPartExchanges(id)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"part_exchanges": requests,
+	})
+}
@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/Candoo/vehicles-api/internal/models"
+)
+
+func TestCreatePartExchange(t *testing.T) {
+	priced := testVehicle(1, 10000)
+	priced.PriceWhenNew = models.MoneyFromPounds(16000)
+	api := newTestAPI(t, priced)
+
+	rec := api.serve(http.MethodPost, "/vehicles/1/part-exchange", map[string]interface{}{
+		"vrm":       "bx63 nsj",
+		"mileage":   48000,
+		"condition": "Good",
+		"make":      "Skoda",
+		"model":     "Fabia",
+	})
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("status = %d, body %s", rec.Code, rec.Body)
+	}
+	var valued models.PartExchange
+	if err := json.Unmarshal(rec.Body.Bytes(), &valued); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if valued.VRM != "BX63NSJ" || valued.Year != 2013 || valued.Condition != models.ConditionGood || valued.Value == nil || *valued.Value <= 0 {
+		t.Errorf("part exchange = %+v", valued)
+	}
+
+	// A make we have never stocked cannot be valued but the request is kept
+	rec = api.serve(http.MethodPost, "/vehicles/1/part-exchange", map[string]interface{}{
+		"vrm":       "AB12CDE",
+		"mileage":   90000,
+		"condition": "poor",
+		"make":      "Lada",
+	})
+	if rec.Code != http.StatusCreated || !strings.Contains(rec.Body.String(), `"value":null`) {
+		t.Errorf("unvalued: status = %d, body %s", rec.Code, rec.Body)
+	}
+
+	rec = api.serveAs(models.RoleStaff, http.MethodGet, "/vehicles/1/part-exchanges", nil)
+	var list struct {
+		PartExchanges []models.PartExchange `json:"part_exchanges"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &list); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if rec.Code != http.StatusOK || len(list.PartExchanges) != 2 {
+		t.Errorf("part exchanges: status = %d, body %s", rec.Code, rec.Body)
+	}
+}
+
+func TestCreatePartExchangeRejectsInvalidRequests(t *testing.T) {
+	sold := testVehicle(2, 8000)
+	sold.StockStatus = models.StockStatusSold
+	api := newTestAPI(t, testVehicle(1, 10000), sold)
+
+	for name, body := range map[string]map[string]interface{}{
+		"missing mileage":   {"vrm": "AB12CDE", "condition": "good"},
+		"unknown condition": {"vrm": "AB12CDE", "mileage": 1000, "condition": "mint"},
+		"bad vrm":           {"vrm": "AB-12", "mileage": 1000, "condition": "good"},
+	} {
+		if rec := api.serve(http.MethodPost, "/vehicles/1/part-exchange", body); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want 400", name, rec.Code)
+		}
+	}
+
+	valid := map[string]interface{}{"vrm": "AB12CDE", "mileage": 1000, "condition": "good"}
+	if rec := api.serve(http.MethodPost, "/vehicles/2/part-exchange", valid); rec.Code != http.StatusConflict {
+		t.Errorf("sold vehicle: status = %d, want 409", rec.Code)
+	}
+	if rec := api.serve(http.MethodPost, "/vehicles/3/part-exchange", valid); rec.Code != http.StatusNotFound {
+		t.Errorf("missing vehicle: status = %d, want 404", rec.Code)
+	}
+}
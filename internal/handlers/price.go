@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Candoo/vehicles-api/internal/apperr"
+	"github.com/gin-gonic/gin"
+)
+
+// GetVehiclePriceHistory godoc
+// @Summary Get vehicle price history
+// @Description Get every price change of a vehicle, oldest first
+// @Tags vehicles
+// @Produce json
+// @Param id path int true "Vehicle ID"
+// @Success 200 {object} map[string]interface{} "Price history"
+// @Failure 400 {object} apperr.Problem "Bad request"
+// @Failure 404 {object} apperr.Problem "Vehicle not found"
+// @Failure 500 {object} apperr.Problem "Internal server error"
+// @Router /vehicles/{id}/price-history [get]
+func (h *VehicleHandler) GetVehiclePriceHistory(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.Error(apperr.Validation("invalid vehicle ID"))
+		return
+	}
+
+	history, err := h.repo.GetPriceHistory(id)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"history": history,
+	})
+}
+
+// GetPriceDrops godoc
+// @Summary Get recently reduced vehicles
+// @Description Get vehicles whose price has dropped in the last N days, biggest percentage reduction first
+// @Tags vehicles
+// @Produce json
+// @Param days query int false "Look-back period in days (1-365)" default(7)
+// @Success 200 {object} map[string]interface{} "Price drops"
+// @Failure 400 {object} apperr.Problem "Bad request"
+// @Failure 500 {object} apperr.Problem "Internal server error"
+// @Router /vehicles/price-drops [get]
+func (h *VehicleHandler) GetPriceDrops(c *gin.Context) {
+	p := newQueryParser(c.Request.URL.Query(), []string{"days"})
+	days := p.integer("days", 7, 1, 365)
+	if err := p.err(); err != nil {
+		c.Error(err)
+		return
+	}
+
+	since := time.Now().AddDate(0, 0, -days)
+
+	drops, err := h.repo.GetPriceDrops(since)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"days":        days,
+		"price_drops": drops,
+	})
+}
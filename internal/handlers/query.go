@@ -0,0 +1,360 @@
+package handlers
+
+import (
+	"fmt"
+	"math"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/Candoo/vehicles-api/internal/apperr"
+	"github.com/Candoo/vehicles-api/internal/geo"
+	"github.com/Candoo/vehicles-api/internal/models"
+)
+
+// vehicleQueryKeys lists the query parameters accepted by GET /vehicles
+var vehicleQueryKeys = []string{
+	"page", "results_per_page", "cursor", "sort", "q", "facets",
+	"advert_classification", "make", "model", "fuel_type", "transmission", "body_type",
+	"make_slug", "range_slug",
+	"colour", "drivetrain", "doors", "seats", "insurance_group", "site_slug", "location",
+	"min_price", "max_price", "min_year", "max_year", "min_mileage", "max_mileage",
+	"max_previous_keepers", "has_offer", "stock_status", "near", "radius",
+}
+
+// advertClassifications lists the accepted advert_classification values
+var advertClassifications = []string{"New", "Used", "All"}
+
+// Year bounds accepted by min_year and max_year
+const (
+	minVehicleYear = 1900
+	maxVehicleYear = 2100
+)
+
+// Upper bounds for the doors, seats, mileage and radius filters
+const (
+	maxVehicleDoors   = 99
+	maxVehicleSeats   = 99
+	maxVehicleMileage = 10000000
+	maxRadiusMiles    = 1000
+)
+
+// queryParser reads typed query parameters and collects every problem instead of
+// stopping at the first, so a client can fix a request in one go
+type queryParser struct {
+	values   url.Values
+	problems []apperr.FieldError
+}
+
+// newQueryParser creates a parser for a query string, reporting any key not in allowed
+func newQueryParser(values url.Values, allowed []string) *queryParser {
+	p := &queryParser{values: values}
+
+	var unknown []string
+	for key := range values {
+		if !containsString(allowed, key) {
+			unknown = append(unknown, key)
+		}
+	}
+	sort.Strings(unknown)
+	for _, key := range unknown {
+		p.fail(key, "is not a recognised query parameter")
+	}
+
+	return p
+}
+
+// fail records a problem with a field
+func (p *queryParser) fail(field, format string, args ...interface{}) {
+	p.problems = append(p.problems, apperr.FieldError{Field: field, Reason: fmt.Sprintf(format, args...)})
+}
+
+// failed reports whether a problem was recorded for the field
+func (p *queryParser) failed(field string) bool {
+	for _, problem := range p.problems {
+		if problem.Field == field {
+			return true
+		}
+	}
+	return false
+}
+
+// err returns a validation error listing every problem, or nil
+func (p *queryParser) err() error {
+	if len(p.problems) == 0 {
+		return nil
+	}
+	return apperr.InvalidFields("invalid query parameters", p.problems)
+}
+
+// text returns a trimmed parameter
+func (p *queryParser) text(key string) string {
+	return strings.TrimSpace(p.values.Get(key))
+}
+
+// has reports whether a parameter was given with a non-empty value
+func (p *queryParser) has(key string) bool {
+	return p.text(key) != ""
+}
+
+// integer parses an integer parameter within [min, max], returning def when it is absent
+func (p *queryParser) integer(key string, def, min, max int) int {
+	raw := p.text(key)
+	if raw == "" {
+		return def
+	}
+
+	value, err := strconv.Atoi(raw)
+	if err != nil {
+		p.fail(key, "must be an integer")
+		return def
+	}
+	if value < min || value > max {
+		p.fail(key, "must be between %d and %d", min, max)
+		return def
+	}
+
+	return value
+}
+
+// optionalInteger parses an integer parameter within [min, max], returning nil when it is absent
+func (p *queryParser) optionalInteger(key string, min, max int) *int {
+	if !p.has(key) {
+		return nil
+	}
+
+	value := p.integer(key, 0, min, max)
+	if p.failed(key) {
+		return nil
+	}
+	return &value
+}
+
+// list returns the values of a repeatable parameter, splitting comma separated values
+// and dropping blanks and duplicates, so make=Ford&make=Skoda equals make=Ford,Skoda
+func (p *queryParser) list(key string) []string {
+	var values []string
+	for _, raw := range p.values[key] {
+		for _, value := range strings.Split(raw, ",") {
+			value = strings.TrimSpace(value)
+			if value != "" && !containsFold(values, value) {
+				values = append(values, value)
+			}
+		}
+	}
+	return values
+}
+
+// integerList parses a repeatable parameter whose values are integers within [min, max]
+func (p *queryParser) integerList(key string, min, max int) []int {
+	var values []int
+	for _, raw := range p.list(key) {
+		value, err := strconv.Atoi(raw)
+		if err != nil || value < min || value > max {
+			p.fail(key, "must be integers between %d and %d", min, max)
+			return nil
+		}
+		values = append(values, value)
+	}
+	return values
+}
+
+// money parses an optional non-negative amount in pounds
+func (p *queryParser) money(key string) models.Money {
+	raw := p.text(key)
+	if raw == "" {
+		return 0
+	}
+
+	value, err := models.ParseMoney(raw)
+	if err != nil || value < 0 {
+		p.fail(key, "must be a non-negative amount with at most two decimal places")
+		return 0
+	}
+
+	return value
+}
+
+// boolean parses an optional true/false parameter, treating absence as false
+func (p *queryParser) boolean(key string) bool {
+	value := p.flag(key)
+	return value != nil && *value
+}
+
+// flag parses an optional true/false parameter, returning nil when it is absent
+func (p *queryParser) flag(key string) *bool {
+	var value bool
+	switch strings.ToLower(p.text(key)) {
+	case "":
+		return nil
+	case "true", "1":
+		value = true
+	case "false", "0":
+		value = false
+	default:
+		p.fail(key, "must be true or false")
+		return nil
+	}
+	return &value
+}
+
+// enum returns a parameter matching one of allowed, ignoring case, in its canonical spelling
+func (p *queryParser) enum(key string, allowed []string) string {
+	raw := p.text(key)
+	if raw == "" {
+		return ""
+	}
+
+	for _, value := range allowed {
+		if strings.EqualFold(raw, value) {
+			return value
+		}
+	}
+
+	p.fail(key, "must be one of %s", strings.Join(allowed, ", "))
+	return ""
+}
+
+// place parses a "latitude,longitude" pair or a postcode found in the postcode table,
+// returning nil when the parameter is absent
+func (p *queryParser) place(key string, postcodes *geo.Postcodes) *geo.Point {
+	raw := p.text(key)
+	if raw == "" {
+		return nil
+	}
+
+	if strings.Contains(raw, ",") {
+		point, err := geo.ParsePoint(raw)
+		if err != nil {
+			p.fail(key, "%s", err.Error())
+			return nil
+		}
+		return &point
+	}
+
+	point, ok := postcodes.Lookup(raw)
+	if !ok {
+		p.fail(key, "must be latitude,longitude or a known postcode")
+		return nil
+	}
+	return &point
+}
+
+// parseVehicleFilters validates the GET /vehicles query string and builds the filters.
+// near is resolved against postcodes. withFacets reports whether facet counts were requested.
+func parseVehicleFilters(values url.Values, postcodes *geo.Postcodes) (filters models.VehicleFilters, withFacets bool, err error) {
+	p := newQueryParser(values, vehicleQueryKeys)
+	filters, withFacets = readVehicleFilters(p, postcodes)
+	return filters, withFacets, p.err()
+}
+
+// readVehicleFilters reads the GET /vehicles filters from a query, recording any
+// problems on the parser
+func readVehicleFilters(p *queryParser, postcodes *geo.Postcodes) (filters models.VehicleFilters, withFacets bool) {
+	var err error
+	filters = models.VehicleFilters{
+		Page:                 p.integer("page", 1, 1, math.MaxInt32),
+		ResultsPerPage:       p.integer("results_per_page", 10, 1, 100),
+		AdvertClassification: p.enum("advert_classification", advertClassifications),
+		Makes:                p.list("make"),
+		MakeSlugs:            p.list("make_slug"),
+		Model:                p.text("model"),
+		RangeSlugs:           p.list("range_slug"),
+		FuelTypes:            p.list("fuel_type"),
+		Transmissions:        p.list("transmission"),
+		BodyTypes:            p.list("body_type"),
+		Colours:              p.list("colour"),
+		Drivetrains:          p.list("drivetrain"),
+		Doors:                p.integerList("doors", 0, maxVehicleDoors),
+		Seats:                p.integerList("seats", 0, maxVehicleSeats),
+		InsuranceGroups:      p.list("insurance_group"),
+		SiteSlugs:            p.list("site_slug"),
+		Locations:            p.list("location"),
+		MinPrice:             p.money("min_price"),
+		MaxPrice:             p.money("max_price"),
+		MinYear:              p.integer("min_year", 0, minVehicleYear, maxVehicleYear),
+		MaxYear:              p.integer("max_year", 0, minVehicleYear, maxVehicleYear),
+		MinMileage:           p.optionalInteger("min_mileage", 0, maxVehicleMileage),
+		MaxMileage:           p.optionalInteger("max_mileage", 0, maxVehicleMileage),
+		MaxPreviousKeepers:   p.optionalInteger("max_previous_keepers", 0, 99),
+		HasOffer:             p.flag("has_offer"),
+		Query:                p.text("q"),
+		Near:                 p.place("near", postcodes),
+		RadiusMiles:          p.integer("radius", 0, 1, maxRadiusMiles),
+	}
+	withFacets = p.boolean("facets")
+
+	if filters.MinPrice > 0 && filters.MaxPrice > 0 && filters.MinPrice > filters.MaxPrice {
+		p.fail("min_price", "must not be greater than max_price")
+	}
+	if filters.MinYear > 0 && filters.MaxYear > 0 && filters.MinYear > filters.MaxYear {
+		p.fail("min_year", "must not be greater than max_year")
+	}
+	if filters.MinMileage != nil && filters.MaxMileage != nil && *filters.MinMileage > *filters.MaxMileage {
+		p.fail("min_mileage", "must not be greater than max_mileage")
+	}
+
+	if filters.StockStatuses, err = parseStockStatusQuery(p.text("stock_status")); err != nil {
+		p.fail("stock_status", "%s", err.Error())
+	}
+
+	if filters.Sort, err = models.ParseSort(p.text("sort")); err != nil {
+		p.fail("sort", "%s", err.Error())
+	}
+
+	if p.has("radius") && !p.has("near") {
+		p.fail("radius", "requires near")
+	}
+
+	// Searches near a place list the closest first, and free-text searches are ranked
+	// by relevance, unless the client picks another order
+	switch {
+	case len(filters.Sort) > 0:
+	case filters.Near != nil:
+		filters.Sort = []models.SortField{{Field: "distance"}}
+	case filters.Query != "":
+		filters.Sort = []models.SortField{{Field: "relevance", Descending: true}}
+	}
+	if filters.Query == "" && hasSortField(filters.Sort, "relevance") {
+		p.fail("sort", "sorting by relevance requires q")
+	}
+	if filters.Near == nil && !p.failed("near") && hasSortField(filters.Sort, "distance") {
+		p.fail("sort", "sorting by distance requires near")
+	}
+
+	if p.has("cursor") {
+		switch {
+		case p.has("page"):
+			p.fail("cursor", "cannot be combined with page")
+		case p.failed("sort"):
+			// The cursor can only be checked against a valid sort
+		default:
+			if filters.Cursor, err = models.DecodeCursor(p.text("cursor"), filters.Sort); err != nil {
+				p.fail("cursor", "%s", err.Error())
+			}
+		}
+	}
+
+	return filters, withFacets
+}
+
+// containsFold reports whether value is one of values, ignoring case
+func containsFold(values []string, value string) bool {
+	for _, candidate := range values {
+		if strings.EqualFold(candidate, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// containsString reports whether value is one of values
+func containsString(values []string, value string) bool {
+	for _, candidate := range values {
+		if candidate == value {
+			return true
+		}
+	}
+	return false
+}
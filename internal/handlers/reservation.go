@@ -0,0 +1,244 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Candoo/vehicles-api/internal/apperr"
+	"github.com/Candoo/vehicles-api/internal/auth"
+	"github.com/Candoo/vehicles-api/internal/models"
+	"github.com/Candoo/vehicles-api/internal/payment"
+	"github.com/Candoo/vehicles-api/internal/repository"
+	"github.com/Candoo/vehicles-api/internal/reservation"
+	"github.com/gin-gonic/gin"
+)
+
+// ReservationHandler handles online reservations and their deposits
+type ReservationHandler struct {
+	repo         repository.VehicleStore
+	reservations repository.ReservationStore
+	payments     payment.Provider
+	deposit      models.Money
+	holdFor      time.Duration
+	now          func() time.Time
+}
+
+// NewReservationHandler creates a new reservation handler reserving the vehicles in
+// repo, taking deposit through payments and holding vehicles for holdFor
+func NewReservationHandler(repo repository.VehicleStore, reservations repository.ReservationStore, payments payment.Provider, deposit models.Money, holdFor time.Duration) *ReservationHandler {
+	return &ReservationHandler{repo: repo, reservations: reservations, payments: payments, deposit: deposit, holdFor: holdFor, now: time.Now}
+}
+
+// CreateReservation godoc
+// @Summary Reserve vehicle
+// @Description Reserve a vehicle in stock for a limited time, holding a deposit on the customer's card. The reservation expires, returning the vehicle to stock and releasing the deposit, unless the sale completes first.
+// @Tags reservations
+// @Accept json
+// @Produce json
+// @Param id path int true "Vehicle ID"
+// @Param reservation body models.ReservationRequest true "Contact details and payment token"
+// @Success 201 {object} models.Reservation
+// @Failure 400 {object} apperr.Problem "Bad request"
+// @Failure 402 {object} apperr.Problem "Payment declined"
+// @Failure 404 {object} apperr.Problem "Vehicle not found"
+// @Failure 409 {object} apperr.Problem "Vehicle already reserved or not available"
+// @Failure 500 {object} apperr.Problem "Internal server error"
+// @Failure 503 {object} apperr.Problem "Payment provider unavailable"
+// @Router /vehicles/{id}/reservations [post]
+func (h *ReservationHandler) CreateReservation(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.Error(apperr.Validation("invalid vehicle ID"))
+		return
+	}
+
+	var req models.ReservationRequest
+	if err := decodeStrictJSON(c, &req); err != nil {
+		c.Error(apperr.Invalid(err))
+		return
+	}
+	if err := req.Validate(); err != nil {
+		c.Error(apperr.Invalid(err))
+		return
+	}
+
+	vehicle, err := h.repo.GetVehicleByID(id)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	// Checked again under the vehicle's row lock; this saves holding a deposit for
+	// a vehicle that is plainly unavailable
+	if !vehicle.StockStatus.Reservable() {
+		c.Error(apperr.Conflict("vehicle is not available to reserve"))
+		return
+	}
+
+	reference, err := reservation.NewReference()
+	if err != nil {
+		c.Error(fmt.Errorf("failed to generate reservation reference: %w", err))
+		return
+	}
+
+	holdID, err := h.payments.Hold(c.Request.Context(), payment.HoldRequest{
+		Amount:      h.deposit,
+		Token:       req.PaymentToken,
+		Reference:   reference,
+		Description: "Deposit to reserve " + vehicle.Name,
+	})
+	if errors.Is(err, payment.ErrDeclined) {
+		c.Error(apperr.Payment("payment declined"))
+		return
+	}
+	if err != nil {
+		c.Error(apperr.Unavailable(err, "payment provider unavailable"))
+		return
+	}
+
+	res := models.Reservation{
+		Reference:       reference,
+		VehicleID:       id,
+		Name:            req.Name,
+		Email:           req.Email,
+		Phone:           req.Phone,
+		Deposit:         h.deposit,
+		PaymentProvider: h.payments.Name(),
+		PaymentHoldID:   holdID,
+		ExpiresAt:       h.now().Add(h.holdFor),
+	}
+	if err := h.reservations.CreateReservation(&res); err != nil {
+		h.release(c, &res)
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, res)
+}
+
+// GetReservation godoc
+// @Summary Get reservation
+// @Description Get a reservation by its reference
+// @Tags reservations
+// @Produce json
+// @Param reference path string true "Reservation reference"
+// @Success 200 {object} models.Reservation
+// @Failure 404 {object} apperr.Problem "Reservation not found"
+// @Failure 500 {object} apperr.Problem "Internal server error"
+// @Router /reservations/{reference} [get]
+func (h *ReservationHandler) GetReservation(c *gin.Context) {
+	res, err := h.reservations.GetReservation(c.Param("reference"))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+// CancelReservation godoc
+// @Summary Cancel reservation
+// @Description Cancel a held reservation, returning the vehicle to stock and releasing the deposit
+// @Tags reservations
+// @Produce json
+// @Param reference path string true "Reservation reference"
+// @Success 200 {object} models.Reservation
+// @Failure 404 {object} apperr.Problem "Reservation not found"
+// @Failure 409 {object} apperr.Problem "Reservation already ended"
+// @Failure 500 {object} apperr.Problem "Internal server error"
+// @Router /reservations/{reference}/cancel [post]
+func (h *ReservationHandler) CancelReservation(c *gin.Context) {
+	res, err := h.reservations.CancelReservation(c.Param("reference"))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	h.release(c, res)
+	c.JSON(http.StatusOK, res)
+}
+
+// CompleteReservation godoc
+// @Summary Complete reservation
+// @Description Complete the sale of a reserved vehicle, taking the held deposit and marking it sold. The reservation is marked completing before the deposit is taken, which stops it being cancelled or expiring; if the deposit cannot be taken or the sale fails to save, the reservation stays completing and the request can be retried without taking the deposit twice.
+// @Tags reservations
+// @Produce json
+// @Security BearerAuth
+// @Param reference path string true "Reservation reference"
+// @Success 200 {object} models.Reservation
+// @Failure 401 {object} apperr.Problem "Authentication required"
+// @Failure 403 {object} apperr.Problem "Insufficient permissions"
+// @Failure 404 {object} apperr.Problem "Reservation not found"
+// @Failure 409 {object} apperr.Problem "Reservation already ended or vehicle cannot be sold"
+// @Failure 500 {object} apperr.Problem "Internal server error"
+// @Failure 502 {object} apperr.Problem "Deposit could not be taken"
+// @Router /reservations/{reference}/complete [post]
+func (h *ReservationHandler) CompleteReservation(c *gin.Context) {
+	reference := c.Param("reference")
+	changedBy := auth.FromContext(c.Request.Context()).Subject
+
+	// The reservation is committed as completing before the deposit is taken, so the
+	// payment call is made outside any transaction and the hold cannot be released
+	// underneath it. The reference is the idempotency key, so a retry after a failed
+	// capture or a failed commit never takes the deposit twice.
+	res, err := h.reservations.MarkReservationCompleting(reference)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	if err := h.payments.Capture(c.Request.Context(), res.PaymentHoldID, res.Reference); err != nil {
+		c.Error(apperr.BadGateway(err, "failed to take the deposit; the sale is still completing, try again"))
+		return
+	}
+
+	res, err = h.reservations.CompleteReservation(reference, changedBy)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+// GetVehicleReservations godoc
+// @Summary Get vehicle reservations
+// @Description Get the reservations made on a vehicle, newest first
+// @Tags reservations
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Vehicle ID"
+// @Success 200 {object} map[string]interface{} "Reservations"
+// @Failure 400 {object} apperr.Problem "Invalid vehicle ID"
+// @Failure 401 {object} apperr.Problem "Authentication required"
+// @Failure 403 {object} apperr.Problem "Insufficient permissions"
+// @Failure 404 {object} apperr.Problem "Vehicle not found"
+// @Failure 500 {object} apperr.Problem "Internal server error"
+// @Router /vehicles/{id}/reservations [get]
+func (h *ReservationHandler) GetVehicleReservations(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.Error(apperr.Validation("invalid vehicle ID"))
+		return
+	}
+
+	reservations, err := h.reservations.GetReservations(id)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"reservations": reservations,
+	})
+}
+
+// release releases a reservation's deposit hold. A failure is only logged: the
+// reservation has ended either way and the provider lets the hold lapse.
+func (h *ReservationHandler) release(c *gin.Context, res *models.Reservation) {
+	if err := h.payments.Release(c.Request.Context(), res.PaymentHoldID); err != nil {
+		log.Printf("Warning: Failed to release deposit of reservation %s: %v", res.Reference, err)
+	}
+}
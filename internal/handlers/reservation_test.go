@@ -0,0 +1,233 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Candoo/vehicles-api/internal/middleware"
+	"github.com/Candoo/vehicles-api/internal/models"
+	"github.com/Candoo/vehicles-api/internal/payment"
+	"github.com/Candoo/vehicles-api/internal/repository"
+	"github.com/gin-gonic/gin"
+)
+
+// reservationRequest is a reservation of a vehicle paid for with paymentToken
+func reservationRequest(paymentToken string) map[string]string {
+	return map[string]string{"name": "Sam Taylor", "email": "sam@example.com", "payment_token": paymentToken}
+}
+
+// reserve reserves vehicle 1 with a card the fake provider accepts
+func reserve(t *testing.T, api *testAPI) models.Reservation {
+	t.Helper()
+	rec := api.serve(http.MethodPost, "/vehicles/1/reservations", reservationRequest("tok_visa"))
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("reserve: status = %d, body %s", rec.Code, rec.Body)
+	}
+	var held models.Reservation
+	if err := json.Unmarshal(rec.Body.Bytes(), &held); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	return held
+}
+
+// expectStockStatus checks the stock status of vehicle 1
+func expectStockStatus(t *testing.T, api *testAPI, want models.StockStatus) {
+	t.Helper()
+	vehicle, err := api.vehicles.GetVehicleByID(1)
+	if err != nil {
+		t.Fatalf("GetVehicleByID: %v", err)
+	}
+	if vehicle.StockStatus != want {
+		t.Errorf("stock_status = %q, want %q", vehicle.StockStatus, want)
+	}
+}
+
+func TestCreateReservation(t *testing.T) {
+	api := newTestAPI(t, testVehicle(1, 10000))
+
+	rec := api.serve(http.MethodPost, "/vehicles/1/reservations", reservationRequest("tok_visa"))
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("reserve: status = %d, body %s", rec.Code, rec.Body)
+	}
+	var held models.Reservation
+	if err := json.Unmarshal(rec.Body.Bytes(), &held); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if !strings.HasPrefix(held.Reference, "rs_") || held.Status != models.ReservationStatusHeld || held.Deposit != models.MoneyFromPounds(99) ||
+		held.ExpiresAt.Before(time.Now().Add(47*time.Hour)) || strings.Contains(rec.Body.String(), "hold_") {
+		t.Errorf("reservation = %s", rec.Body)
+	}
+	expectStockStatus(t, api, models.StockStatusReserved)
+
+	if rec := api.serve(http.MethodGet, "/reservations/"+held.Reference, nil); rec.Code != http.StatusOK {
+		t.Errorf("get: status = %d, body %s", rec.Code, rec.Body)
+	}
+	if rec := api.serve(http.MethodGet, "/reservations/rs_unknown", nil); rec.Code != http.StatusNotFound {
+		t.Errorf("unknown reservation: status = %d, want 404", rec.Code)
+	}
+}
+
+func TestCreateReservationRejectsUnavailableVehicle(t *testing.T) {
+	sold := testVehicle(2, 8000)
+	sold.StockStatus = models.StockStatusSold
+	api := newTestAPI(t, testVehicle(1, 10000), sold)
+	reserve(t, api)
+
+	if rec := api.serve(http.MethodPost, "/vehicles/1/reservations", reservationRequest("tok_visa")); rec.Code != http.StatusConflict {
+		t.Errorf("reserve twice: status = %d, want 409", rec.Code)
+	}
+	if rec := api.serve(http.MethodPost, "/vehicles/2/reservations", reservationRequest("tok_visa")); rec.Code != http.StatusConflict {
+		t.Errorf("sold vehicle: status = %d, want 409", rec.Code)
+	}
+}
+
+func TestCreateReservationRequiresPayment(t *testing.T) {
+	api := newTestAPI(t, testVehicle(1, 10000))
+
+	if rec := api.serve(http.MethodPost, "/vehicles/1/reservations", reservationRequest(payment.DeclinedToken)); rec.Code != http.StatusPaymentRequired {
+		t.Errorf("declined: status = %d, body %s", rec.Code, rec.Body)
+	}
+	if rec := api.serve(http.MethodPost, "/vehicles/1/reservations", reservationRequest("")); rec.Code != http.StatusBadRequest {
+		t.Errorf("no payment token: status = %d, want 400", rec.Code)
+	}
+	expectStockStatus(t, api, models.StockStatusInStock)
+}
+
+func TestCancelReservation(t *testing.T) {
+	api := newTestAPI(t, testVehicle(1, 10000))
+	path := "/reservations/" + reserve(t, api).Reference
+
+	if rec := api.serve(http.MethodPost, path+"/cancel", nil); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"status":"cancelled"`) {
+		t.Errorf("cancel: status = %d, body %s", rec.Code, rec.Body)
+	}
+	expectStockStatus(t, api, models.StockStatusInStock)
+	if rec := api.serveAs(models.RoleStaff, http.MethodPost, path+"/complete", nil); rec.Code != http.StatusConflict {
+		t.Errorf("complete cancelled: status = %d, want 409", rec.Code)
+	}
+}
+
+func TestCompleteReservation(t *testing.T) {
+	api := newTestAPI(t, testVehicle(1, 10000))
+	path := "/reservations/" + reserve(t, api).Reference
+
+	if rec := api.serve(http.MethodPost, path+"/complete", nil); rec.Code != http.StatusUnauthorized {
+		t.Errorf("complete anonymously: status = %d, want 401", rec.Code)
+	}
+	if rec := api.serveAs(models.RoleStaff, http.MethodPost, path+"/complete", nil); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"status":"completed"`) {
+		t.Errorf("complete: status = %d, body %s", rec.Code, rec.Body)
+	}
+	expectStockStatus(t, api, models.StockStatusSold)
+}
+
+func TestCompleteReservationTakesDepositFirst(t *testing.T) {
+	api := newTestAPI(t, testVehicle(1, 10000))
+	held := reserve(t, api)
+	stored, err := api.reservations.GetReservation(held.Reference)
+	if err != nil {
+		t.Fatalf("GetReservation: %v", err)
+	}
+
+	// The provider let the hold go, so the deposit cannot be taken and nothing is sold
+	if err := api.payments.Release(context.Background(), stored.PaymentHoldID); err != nil {
+		t.Fatalf("Release: %v", err)
+	}
+	if rec := api.serveAs(models.RoleStaff, http.MethodPost, "/reservations/"+held.Reference+"/complete", nil); rec.Code != http.StatusBadGateway {
+		t.Errorf("complete: status = %d, want 502", rec.Code)
+	}
+	expectStockStatus(t, api, models.StockStatusReserved)
+	if res, err := api.reservations.GetReservation(held.Reference); err != nil || res.Status != models.ReservationStatusCompleting {
+		t.Errorf("reservation after failed capture = %+v, %v", res, err)
+	}
+
+	// Nor can it be cancelled while the sale is completing
+	if rec := api.serve(http.MethodPost, "/reservations/"+held.Reference+"/cancel", nil); rec.Code != http.StatusConflict {
+		t.Errorf("cancel completing: status = %d, want 409", rec.Code)
+	}
+}
+
+// failingCompletion fails the first attempt to record a completed sale, as when the
+// commit fails after the deposit is taken
+type failingCompletion struct {
+	repository.ReservationStore
+	failed bool
+}
+
+func (s *failingCompletion) CompleteReservation(reference, changedBy string) (*models.Reservation, error) {
+	if !s.failed {
+		s.failed = true
+		return nil, errors.New("commit failed")
+	}
+	return s.ReservationStore.CompleteReservation(reference, changedBy)
+}
+
+func TestCompleteReservationRetriesAfterFailedCommit(t *testing.T) {
+	api := newTestAPI(t, testVehicle(1, 10000))
+	held := reserve(t, api)
+
+	h := NewReservationHandler(api.vehicles, &failingCompletion{ReservationStore: api.reservations}, api.payments, models.MoneyFromPounds(99), 48*time.Hour)
+	r := gin.New()
+	r.Use(middleware.RequestID(), middleware.Errors())
+	r.Use(middleware.Authenticate(nil, middleware.AuthConfig{JWTSecret: testJWTSecret}))
+	r.POST("/reservations/:reference/complete", middleware.RequireRole(models.RoleStaff), h.CompleteReservation)
+	complete := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/reservations/"+held.Reference+"/complete", nil)
+		req.Header.Set("Authorization", "Bearer "+api.tokens[models.RoleStaff])
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// The deposit is taken but the sale is not recorded, so the reservation stays completing
+	if rec := complete(); rec.Code != http.StatusInternalServerError {
+		t.Fatalf("complete: status = %d, want 500", rec.Code)
+	}
+	expectStockStatus(t, api, models.StockStatusReserved)
+	if res, err := api.reservations.GetReservation(held.Reference); err != nil || res.Status != models.ReservationStatusCompleting {
+		t.Errorf("reservation after failed commit = %+v, %v", res, err)
+	}
+	if expired, err := api.reservations.ExpireReservations(time.Now().Add(72 * time.Hour)); err != nil || len(expired) != 0 {
+		t.Errorf("expired = %+v, %v", expired, err)
+	}
+
+	// Retrying records the sale without taking the deposit again
+	if rec := complete(); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"status":"completed"`) {
+		t.Fatalf("retry: status = %d, body %s", rec.Code, rec.Body)
+	}
+	expectStockStatus(t, api, models.StockStatusSold)
+	stored, err := api.reservations.GetReservation(held.Reference)
+	if err != nil {
+		t.Fatalf("GetReservation: %v", err)
+	}
+	if hold, ok := api.payments.Get(stored.PaymentHoldID); !ok || hold.State != payment.HoldStateCaptured || hold.Captures != 1 {
+		t.Errorf("hold = %+v", hold)
+	}
+}
+
+func TestGetVehicleReservations(t *testing.T) {
+	api := newTestAPI(t, testVehicle(1, 10000))
+	first := reserve(t, api)
+	if rec := api.serve(http.MethodPost, "/reservations/"+first.Reference+"/cancel", nil); rec.Code != http.StatusOK {
+		t.Fatalf("cancel: status = %d, body %s", rec.Code, rec.Body)
+	}
+	held := reserve(t, api)
+
+	rec := api.serveAs(models.RoleStaff, http.MethodGet, "/vehicles/1/reservations", nil)
+	var list struct {
+		Reservations []models.Reservation `json:"reservations"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &list); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if rec.Code != http.StatusOK || len(list.Reservations) != 2 || list.Reservations[0].Reference != held.Reference {
+		t.Errorf("reservations: status = %d, body %s", rec.Code, rec.Body)
+	}
+	if rec := api.serveAs(models.RoleStaff, http.MethodGet, "/vehicles/2/reservations", nil); rec.Code != http.StatusNotFound {
+		t.Errorf("missing vehicle: status = %d, want 404", rec.Code)
+	}
+}
@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"github.com/Candoo/vehicles-api/internal/middleware"
+	"github.com/Candoo/vehicles-api/internal/models"
+	"github.com/gin-gonic/gin"
+)
+
+// Handlers are the handlers served by the API. Reservations is nil when no payment
+// provider is configured, which leaves the reservation routes out.
+type Handlers struct {
+	Vehicles      *VehicleHandler
+	Sites         *SiteHandler
+	Finance       *FinanceHandler
+	PartExchanges *PartExchangeHandler
+	Leads         *LeadHandler
+	TestDrives    *TestDriveHandler
+	Reservations  *ReservationHandler
+	Webhooks      *WebhookHandler
+	Stream        *StreamHandler
+	APIKeys       *APIKeyHandler
+}
+
+// RegisterRoutes registers the API routes on r. Staff and admin routes require the
+// caller's role, so r must resolve callers with middleware.Authenticate first.
+func RegisterRoutes(r gin.IRouter, h Handlers) {
+	// Public routes
+	api := r.Group("/")
+	{
+		api.GET("/vehicles", h.Vehicles.GetVehicles)
+		api.GET("/vehicles/makes", h.Vehicles.GetAvailableMakes)
+		api.GET("/vehicles/models", h.Vehicles.GetAvailableModels)
+		api.GET("/vehicles/price-drops", h.Vehicles.GetPriceDrops)
+		api.GET("/vehicles/stream", h.Stream.GetVehicleStream)
+		api.GET("/vehicles/vrm/:vrm", h.Vehicles.GetVehicleByVRM)
+		api.GET("/vehicles/slug/:slug", h.Vehicles.GetVehicleBySlug)
+		api.GET("/vehicles/:id", h.Vehicles.GetVehicleByID)
+		api.GET("/vehicles/:id/price-history", h.Vehicles.GetVehiclePriceHistory)
+		api.POST("/vehicles/:id/finance-quote", h.Finance.GetFinanceQuote)
+		api.POST("/vehicles/:id/part-exchange", h.PartExchanges.CreatePartExchange)
+		api.POST("/vehicles/:id/enquiries", h.Leads.CreateEnquiry)
+		api.GET("/vehicles/:id/test-drive-slots", h.TestDrives.GetTestDriveSlots)
+		api.POST("/vehicles/:id/test-drives", h.TestDrives.BookTestDrive)
+		api.GET("/test-drives/:reference", h.TestDrives.GetTestDrive)
+		api.GET("/test-drives/:reference/calendar.ics", h.TestDrives.GetTestDriveCalendar)
+		api.POST("/test-drives/:reference/reschedule", h.TestDrives.RescheduleTestDrive)
+		api.POST("/test-drives/:reference/cancel", h.TestDrives.CancelTestDrive)
+		api.GET("/taxonomy", h.Vehicles.GetTaxonomy)
+		api.GET("/makes/:make_slug/vehicles", h.Vehicles.GetMakeVehicles)
+		api.GET("/makes/:make_slug/ranges/:range_slug/vehicles", h.Vehicles.GetRangeVehicles)
+		api.GET("/sites", h.Sites.ListSites)
+		api.GET("/sites/:slug", h.Sites.GetSite)
+		api.GET("/sites/:slug/vehicles", h.Sites.GetSiteVehicles)
+	}
+
+	// Dealer staff routes
+	staff := r.Group("/", middleware.RequireRole(models.RoleStaff))
+	{
+		staff.GET("/vehicles/:id/status-history", h.Vehicles.GetVehicleStatusHistory)
+		staff.POST("/vehicles/:id/status", h.Vehicles.TransitionVehicleStatus)
+		staff.POST("/vehicles/:id/transfer", h.Vehicles.TransferVehicle)
+		staff.GET("/vehicles/:id/transfers", h.Vehicles.GetVehicleTransfers)
+		staff.GET("/vehicles/:id/part-exchanges", h.PartExchanges.GetPartExchanges)
+		staff.GET("/vehicles/:id/test-drives", h.TestDrives.GetVehicleTestDrives)
+		staff.GET("/leads", h.Leads.ListLeads)
+		staff.GET("/leads/export", h.Leads.ExportLeads)
+		staff.GET("/leads/:id", h.Leads.GetLead)
+		staff.POST("/leads/:id/status", h.Leads.TransitionLeadStatus)
+		staff.POST("/leads/:id/assign", h.Leads.AssignLead)
+		staff.POST("/vehicles", h.Vehicles.CreateVehicle)
+		staff.PUT("/vehicles/:id", h.Vehicles.UpdateVehicle)
+		staff.PATCH("/vehicles/:id", h.Vehicles.PatchVehicle)
+		staff.DELETE("/vehicles/:id", h.Vehicles.DeleteVehicle)
+		staff.POST("/auth/token", h.APIKeys.IssueToken)
+	}
+
+	// Online reservations
+	if h.Reservations != nil {
+		api.POST("/vehicles/:id/reservations", h.Reservations.CreateReservation)
+		api.GET("/reservations/:reference", h.Reservations.GetReservation)
+		api.POST("/reservations/:reference/cancel", h.Reservations.CancelReservation)
+		staff.GET("/vehicles/:id/reservations", h.Reservations.GetVehicleReservations)
+		staff.POST("/reservations/:reference/complete", h.Reservations.CompleteReservation)
+	}
+
+	// Admin routes
+	admin := r.Group("/admin", middleware.RequireRole(models.RoleAdmin))
+	{
+		admin.POST("/api-keys", h.APIKeys.CreateAPIKey)
+		admin.GET("/api-keys", h.APIKeys.ListAPIKeys)
+		admin.DELETE("/api-keys/:id", h.APIKeys.RevokeAPIKey)
+		admin.POST("/sites", h.Sites.CreateSite)
+		admin.PUT("/sites/:slug", h.Sites.UpdateSite)
+		admin.POST("/webhooks", h.Webhooks.CreateWebhookEndpoint)
+		admin.GET("/webhooks", h.Webhooks.ListWebhookEndpoints)
+		admin.GET("/webhooks/:id", h.Webhooks.GetWebhookEndpoint)
+		admin.DELETE("/webhooks/:id", h.Webhooks.DeleteWebhookEndpoint)
+		admin.GET("/webhooks/:id/deliveries", h.Webhooks.GetWebhookDeliveries)
+		admin.GET("/webhooks/:id/dead-letters", h.Webhooks.GetWebhookDeadLetters)
+		admin.POST("/webhook-dead-letters/:id/retry", h.Webhooks.RetryWebhookDeadLetter)
+	}
+}
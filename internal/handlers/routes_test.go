@@ -0,0 +1,220 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Candoo/vehicles-api/internal/auth"
+	"github.com/Candoo/vehicles-api/internal/events"
+	"github.com/Candoo/vehicles-api/internal/finance"
+	"github.com/Candoo/vehicles-api/internal/geo"
+	"github.com/Candoo/vehicles-api/internal/middleware"
+	"github.com/Candoo/vehicles-api/internal/models"
+	"github.com/Candoo/vehicles-api/internal/payment"
+	"github.com/Candoo/vehicles-api/internal/repository"
+	"github.com/Candoo/vehicles-api/internal/testdrive"
+	"github.com/Candoo/vehicles-api/internal/valuation"
+	"github.com/Candoo/vehicles-api/internal/webhook"
+	"github.com/gin-gonic/gin"
+)
+
+var testJWTSecret = []byte("test-secret")
+
+// testAPI serves the API routes from in-memory stores, behind the same authentication
+// as main
+type testAPI struct {
+	*gin.Engine
+	t            *testing.T
+	vehicles     *repository.MemoryVehicleStore
+	reservations *repository.MemoryReservationStore
+	webhooks     *repository.MemoryWebhookStore
+	payments     *payment.Fake
+	relay        *events.Relay
+	tokens       map[models.Role]string
+}
+
+// newTestAPI wires the API routes to in-memory stores holding the given vehicles
+func newTestAPI(t *testing.T, vehicles ...models.Vehicle) *testAPI {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	store := repository.NewMemoryVehicleStore()
+	for i := range vehicles {
+		if err := store.CreateVehicle(&vehicles[i]); err != nil {
+			t.Fatalf("CreateVehicle: %v", err)
+		}
+	}
+
+	postcodes := geo.NewPostcodes(map[string]geo.Point{
+		"CW7":     {Latitude: 53.1905, Longitude: -2.5196},
+		"M17 1AA": {Latitude: 53.4650, Longitude: -2.3180},
+	})
+
+	// Vehicle changes are relayed from the outbox to webhooks and the stream, as in main
+	webhooks := repository.NewMemoryWebhookStore()
+	stream := events.NewStream(events.DefaultStreamSize)
+	bus := events.NewBus()
+	bus.Subscribe(webhook.NewDispatcher(webhooks).Handle)
+	bus.Subscribe(func(event models.VehicleEvent) error {
+		stream.Publish(event)
+		return nil
+	})
+
+	api := &testAPI{
+		Engine:       gin.New(),
+		t:            t,
+		vehicles:     store,
+		reservations: repository.NewMemoryReservationStore(store),
+		webhooks:     webhooks,
+		payments:     payment.NewFake(),
+		relay:        events.NewRelay(store, bus),
+		tokens:       map[models.Role]string{},
+	}
+	for _, role := range []models.Role{models.RoleStaff, models.RoleAdmin} {
+		token, err := auth.SignJWT(auth.Claims{Subject: "test-" + string(role), Role: role, ExpiresAt: time.Now().Add(time.Hour).Unix()}, testJWTSecret)
+		if err != nil {
+			t.Fatalf("SignJWT: %v", err)
+		}
+		api.tokens[role] = token
+	}
+
+	api.Use(middleware.RequestID(), middleware.Errors())
+	api.Use(middleware.Authenticate(nil, middleware.AuthConfig{JWTSecret: testJWTSecret}))
+	RegisterRoutes(api, Handlers{
+		Vehicles:      NewVehicleHandler(store, postcodes),
+		Sites:         NewSiteHandler(store, store, postcodes),
+		Finance:       NewFinanceHandler(store, finance.DefaultTable()),
+		PartExchanges: NewPartExchangeHandler(store, store, valuation.NewEstimator(store)),
+		Leads:         NewLeadHandler(store, repository.NewMemoryLeadStore(store)),
+		TestDrives:    NewTestDriveHandler(store, store, repository.NewMemoryTestDriveStore(store), testdrive.DefaultSchedule()),
+		Reservations:  NewReservationHandler(store, api.reservations, api.payments, models.MoneyFromPounds(99), 48*time.Hour),
+		Webhooks:      NewWebhookHandler(webhooks),
+		Stream:        NewStreamHandler(store, postcodes, stream),
+		APIKeys:       NewAPIKeyHandler(nil, testJWTSecret, time.Hour),
+	})
+	return api
+}
+
+// serve performs an anonymous request, encoding body as JSON when given
+func (api *testAPI) serve(method, path string, body interface{}) *httptest.ResponseRecorder {
+	return api.serveAs("", method, path, body)
+}
+
+// serveAs performs a request with a token for role, or anonymously when role is empty
+func (api *testAPI) serveAs(role models.Role, method, path string, body interface{}) *httptest.ResponseRecorder {
+	var reader *bytes.Reader
+	if body != nil {
+		data, _ := json.Marshal(body)
+		reader = bytes.NewReader(data)
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+
+	req := httptest.NewRequest(method, path, reader)
+	req.Header.Set("Content-Type", "application/json")
+	if role != "" {
+		req.Header.Set("Authorization", "Bearer "+api.tokens[role])
+	}
+	rec := httptest.NewRecorder()
+	api.ServeHTTP(rec, req)
+	return rec
+}
+
+// publish relays the events recorded since the last call to webhooks and the stream
+func (api *testAPI) publish() {
+	api.t.Helper()
+	if _, err := api.relay.Run(); err != nil {
+		api.t.Fatalf("relay: %v", err)
+	}
+}
+
+// testVehicle builds a valid vehicle priced in whole pounds
+func testVehicle(id int, pounds int64) models.Vehicle {
+	return models.Vehicle{
+		VehicleID:            id,
+		Name:                 "Skoda Fabia",
+		Make:                 "Skoda",
+		Model:                "Fabia",
+		AdvertClassification: "Used",
+		Year:                 "2018",
+		VRM:                  fmt.Sprintf("AB%02dCDE", id),
+		StockID:              fmt.Sprintf("STK%d", id),
+		Price:                models.MoneyFromPounds(pounds),
+	}
+}
+
+func TestRoleChecks(t *testing.T) {
+	api := newTestAPI(t, testVehicle(1, 5000))
+
+	tests := []struct {
+		role   models.Role
+		method string
+		path   string
+		want   int
+	}{
+		{"", http.MethodGet, "/vehicles/1", http.StatusOK},
+		{"", http.MethodPost, "/vehicles/1/enquiries", http.StatusBadRequest},
+		{"", http.MethodPatch, "/vehicles/1", http.StatusUnauthorized},
+
+		{"", http.MethodGet, "/leads", http.StatusUnauthorized},
+		{"", http.MethodGet, "/leads/export", http.StatusUnauthorized},
+		{"", http.MethodPost, "/leads/1/assign", http.StatusUnauthorized},
+		{models.RoleStaff, http.MethodGet, "/leads", http.StatusOK},
+		{models.RoleAdmin, http.MethodGet, "/leads", http.StatusOK},
+
+		{"", http.MethodGet, "/vehicles/1/reservations", http.StatusUnauthorized},
+		{models.RoleStaff, http.MethodGet, "/vehicles/1/reservations", http.StatusOK},
+		{"", http.MethodPost, "/reservations/rs_unknown/complete", http.StatusUnauthorized},
+		{models.RoleStaff, http.MethodPost, "/reservations/rs_unknown/complete", http.StatusNotFound},
+		{"", http.MethodPost, "/reservations/rs_unknown/cancel", http.StatusNotFound},
+
+		{"", http.MethodGet, "/vehicles/1/test-drives", http.StatusUnauthorized},
+		{models.RoleStaff, http.MethodGet, "/vehicles/1/test-drives", http.StatusOK},
+
+		{"", http.MethodGet, "/admin/webhooks", http.StatusUnauthorized},
+		{models.RoleStaff, http.MethodGet, "/admin/webhooks", http.StatusForbidden},
+		{models.RoleStaff, http.MethodPost, "/admin/webhooks", http.StatusForbidden},
+		{models.RoleStaff, http.MethodPost, "/admin/webhook-dead-letters/1/retry", http.StatusForbidden},
+		{models.RoleAdmin, http.MethodGet, "/admin/webhooks", http.StatusOK},
+
+		{models.RoleStaff, http.MethodPost, "/admin/sites", http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		if rec := api.serveAs(tt.role, tt.method, tt.path, nil); rec.Code != tt.want {
+			t.Errorf("%s %s as %q: status = %d, want %d", tt.method, tt.path, tt.role, rec.Code, tt.want)
+		}
+	}
+}
+
+func TestRoleChecksRejectBadTokens(t *testing.T) {
+	api := newTestAPI(t)
+
+	for _, path := range []string{"/vehicles", "/leads"} {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Authorization", "Bearer "+api.tokens[models.RoleStaff]+"0")
+		rec := httptest.NewRecorder()
+		api.ServeHTTP(rec, req)
+		if rec.Code != http.StatusUnauthorized || rec.Header().Get("WWW-Authenticate") == "" {
+			t.Errorf("%s with a bad token: status = %d, headers %v", path, rec.Code, rec.Header())
+		}
+	}
+}
+
+func TestReservationRoutesNeedPaymentProvider(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	RegisterRoutes(r, Handlers{})
+
+	for _, route := range r.Routes() {
+		if strings.Contains(route.Path, "reservations") {
+			t.Errorf("%s %s registered without a payment provider", route.Method, route.Path)
+		}
+	}
+}
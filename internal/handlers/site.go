@@ -0,0 +1,183 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/Candoo/vehicles-api/internal/apperr"
+	"github.com/Candoo/vehicles-api/internal/geo"
+	"github.com/Candoo/vehicles-api/internal/models"
+	"github.com/Candoo/vehicles-api/internal/repository"
+	"github.com/gin-gonic/gin"
+)
+
+// SiteHandler handles HTTP requests for dealership sites
+type SiteHandler struct {
+	repo      repository.VehicleStore
+	sites     repository.SiteStore
+	postcodes *geo.Postcodes
+}
+
+// NewSiteHandler creates a new site handler listing the vehicles in repo at the sites
+// in sites. postcodes fills in the coordinates of sites saved without them and may
+// be nil.
+func NewSiteHandler(repo repository.VehicleStore, sites repository.SiteStore, postcodes *geo.Postcodes) *SiteHandler {
+	return &SiteHandler{repo: repo, sites: sites, postcodes: postcodes}
+}
+
+// ListSites godoc
+// @Summary List sites
+// @Description Get every dealership site with its address, coordinates, opening hours and contact details
+// @Tags sites
+// @Produce json
+// @Success 200 {object} map[string]interface{} "Sites"
+// @Failure 500 {object} apperr.Problem "Internal server error"
+// @Router /sites [get]
+func (h *SiteHandler) ListSites(c *gin.Context) {
+	sites, err := h.sites.ListSites()
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"sites": sites,
+	})
+}
+
+// GetSite godoc
+// @Summary Get site by slug
+// @Description Get a single dealership site by its slug
+// @Tags sites
+// @Produce json
+// @Param slug path string true "Site slug"
+// @Success 200 {object} models.Site
+// @Failure 404 {object} apperr.Problem "Site not found"
+// @Failure 500 {object} apperr.Problem "Internal server error"
+// @Router /sites/{slug} [get]
+func (h *SiteHandler) GetSite(c *gin.Context) {
+	site, err := h.sites.GetSiteBySlug(c.Param("slug"))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, site)
+}
+
+// GetSiteVehicles godoc
+// @Summary Browse vehicles at a site
+// @Description Get a paginated list of the vehicles at one site. Accepts the same query parameters as GET /vehicles.
+// @Tags sites
+// @Produce json
+// @Param slug path string true "Site slug"
+// @Param page query int false "Page number" default(1)
+// @Param results_per_page query int false "Results per page" default(10)
+// @Param sort query string false "Comma separated sort keys with optional direction, e.g. price:asc,year:desc"
+// @Success 200 {object} models.VehicleResponse
+// @Failure 400 {object} apperr.Problem "Bad request"
+// @Failure 404 {object} apperr.Problem "Site not found"
+// @Failure 500 {object} apperr.Problem "Internal server error"
+// @Router /sites/{slug}/vehicles [get]
+func (h *SiteHandler) GetSiteVehicles(c *gin.Context) {
+	filters, withFacets, err := parseVehicleFilters(c.Request.URL.Query(), h.postcodes)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	site, err := h.sites.GetSiteBySlug(c.Param("slug"))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	filters.SiteSlugs = []string{site.Slug}
+	listVehicles(c, h.repo, filters, withFacets)
+}
+
+// CreateSite godoc
+// @Summary Create site
+// @Description Add a dealership site. Vehicles whose site_slug matches are linked to it. Coordinates are looked up from the postcode when not given.
+// @Tags sites
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param site body models.Site true "Site"
+// @Success 201 {object} models.Site
+// @Failure 400 {object} apperr.Problem "Bad request"
+// @Failure 401 {object} apperr.Problem "Authentication required"
+// @Failure 403 {object} apperr.Problem "Insufficient permissions"
+// @Failure 409 {object} apperr.Problem "Site already exists"
+// @Failure 500 {object} apperr.Problem "Internal server error"
+// @Router /admin/sites [post]
+func (h *SiteHandler) CreateSite(c *gin.Context) {
+	var site models.Site
+	if err := decodeStrictJSON(c, &site); err != nil {
+		c.Error(apperr.Invalid(err))
+		return
+	}
+
+	h.locate(&site)
+	if err := site.Validate(); err != nil {
+		c.Error(apperr.Invalid(err))
+		return
+	}
+
+	site.ID = 0
+	if err := h.sites.CreateSite(&site); err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, site)
+}
+
+// UpdateSite godoc
+// @Summary Replace site
+// @Description Replace every field of a site except its slug. A new name is copied to the site's vehicles. Coordinates are looked up from the postcode when not given.
+// @Tags sites
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param slug path string true "Site slug"
+// @Param site body models.Site true "Site"
+// @Success 200 {object} models.Site
+// @Failure 400 {object} apperr.Problem "Bad request"
+// @Failure 401 {object} apperr.Problem "Authentication required"
+// @Failure 403 {object} apperr.Problem "Insufficient permissions"
+// @Failure 404 {object} apperr.Problem "Site not found"
+// @Failure 500 {object} apperr.Problem "Internal server error"
+// @Router /admin/sites/{slug} [put]
+func (h *SiteHandler) UpdateSite(c *gin.Context) {
+	var site models.Site
+	if err := decodeStrictJSON(c, &site); err != nil {
+		c.Error(apperr.Invalid(err))
+		return
+	}
+
+	// The slug cannot change, so validate against the one in the path
+	site.Slug = c.Param("slug")
+	h.locate(&site)
+	if err := site.Validate(); err != nil {
+		c.Error(apperr.Invalid(err))
+		return
+	}
+
+	if err := h.sites.UpdateSite(c.Param("slug"), &site); err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, site)
+}
+
+// locate fills in the coordinates of a site given without them from its postcode,
+// when the postcode is in the lookup table
+func (h *SiteHandler) locate(site *models.Site) {
+	if site.Latitude != nil || site.Longitude != nil {
+		return
+	}
+	if point, ok := h.postcodes.Lookup(site.Postcode); ok {
+		site.Latitude, site.Longitude = &point.Latitude, &point.Longitude
+	}
+}
@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/Candoo/vehicles-api/internal/models"
+)
+
+// winsfordSite is a site in the test postcode table
+func winsfordSite() map[string]interface{} {
+	return map[string]interface{}{
+		"slug":          "winsford",
+		"name":          "Winsford",
+		"postcode":      "CW7 3QP",
+		"latitude":      53.1905,
+		"longitude":     -2.5196,
+		"opening_hours": []map[string]string{{"day": "Monday", "opens": "09:00", "closes": "18:00"}},
+	}
+}
+
+// expectSiteVehicles checks how many vehicles GET path lists
+func expectSiteVehicles(t *testing.T, api *testAPI, path string, want int) {
+	t.Helper()
+	rec := api.serve(http.MethodGet, path, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("%s: status = %d, body %s", path, rec.Code, rec.Body)
+	}
+	var response models.VehicleResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(response.Data) != want {
+		t.Errorf("%s: %d vehicles, want %d", path, len(response.Data), want)
+	}
+}
+
+func TestCreateSite(t *testing.T) {
+	api := newTestAPI(t)
+
+	site := winsfordSite()
+	if rec := api.serveAs(models.RoleAdmin, http.MethodPost, "/admin/sites", site); rec.Code != http.StatusCreated {
+		t.Fatalf("create: status = %d, body %s", rec.Code, rec.Body)
+	}
+	if rec := api.serveAs(models.RoleAdmin, http.MethodPost, "/admin/sites", site); rec.Code != http.StatusConflict {
+		t.Errorf("duplicate: status = %d, want 409", rec.Code)
+	}
+
+	site["slug"], site["name"] = "trafford", "Trafford"
+	site["opening_hours"] = []map[string]string{{"day": "monday", "opens": "18:00", "closes": "09:00"}}
+	if rec := api.serveAs(models.RoleAdmin, http.MethodPost, "/admin/sites", site); rec.Code != http.StatusBadRequest {
+		t.Errorf("closing before opening: status = %d, want 400", rec.Code)
+	}
+	delete(site, "opening_hours")
+	if rec := api.serveAs(models.RoleAdmin, http.MethodPost, "/admin/sites", site); rec.Code != http.StatusCreated {
+		t.Errorf("without opening hours: status = %d, body %s", rec.Code, rec.Body)
+	}
+}
+
+func TestGetSite(t *testing.T) {
+	api := newTestAPI(t)
+	if rec := api.serveAs(models.RoleAdmin, http.MethodPost, "/admin/sites", winsfordSite()); rec.Code != http.StatusCreated {
+		t.Fatalf("create: status = %d, body %s", rec.Code, rec.Body)
+	}
+
+	rec := api.serve(http.MethodGet, "/sites/winsford", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("get: status = %d, body %s", rec.Code, rec.Body)
+	}
+	var got models.Site
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(got.OpeningHours) != 1 || got.OpeningHours[0].Day != "monday" || got.Latitude == nil {
+		t.Errorf("site = %+v", got)
+	}
+	if rec := api.serve(http.MethodGet, "/sites/stockport", nil); rec.Code != http.StatusNotFound {
+		t.Errorf("unknown site: status = %d, want 404", rec.Code)
+	}
+}
+
+func TestGetSiteVehicles(t *testing.T) {
+	winsford := testVehicle(1, 5000)
+	winsford.Site = "Winsford"
+	api := newTestAPI(t, winsford, testVehicle(2, 6000))
+	if rec := api.serveAs(models.RoleAdmin, http.MethodPost, "/admin/sites", winsfordSite()); rec.Code != http.StatusCreated {
+		t.Fatalf("create: status = %d, body %s", rec.Code, rec.Body)
+	}
+
+	expectSiteVehicles(t, api, "/sites/winsford/vehicles", 1)
+	if rec := api.serve(http.MethodGet, "/sites/stockport/vehicles", nil); rec.Code != http.StatusNotFound {
+		t.Errorf("unknown site: status = %d, want 404", rec.Code)
+	}
+}
@@ -0,0 +1,181 @@
+package handlers
+
+import (
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gin-contrib/sse"
+	"github.com/gin-gonic/gin"
+
+	"github.com/Candoo/vehicles-api/internal/events"
+	"github.com/Candoo/vehicles-api/internal/geo"
+	"github.com/Candoo/vehicles-api/internal/models"
+	"github.com/Candoo/vehicles-api/internal/repository"
+)
+
+// streamQueryKeys lists the query parameters accepted by GET /vehicles/stream: the
+// GET /vehicles filters, without paging, ordering and free-text search, and the event
+// to resume after. Vehicles are matched in memory as they change, and q is only
+// searchable in Postgres.
+var streamQueryKeys = []string{
+	"advert_classification", "make", "model", "fuel_type", "transmission", "body_type",
+	"make_slug", "range_slug",
+	"colour", "drivetrain", "doors", "seats", "insurance_group", "site_slug", "location",
+	"min_price", "max_price", "min_year", "max_year", "min_mileage", "max_mileage",
+	"max_previous_keepers", "has_offer", "stock_status", "near", "radius",
+	"last_event_id",
+}
+
+const (
+	// streamHeartbeat is how often an idle stream sends a comment, so proxies keep it open
+	streamHeartbeat = 15 * time.Second
+	// streamRetry is how long clients wait before reconnecting, in milliseconds
+	streamRetry = 3000
+	// resyncEvent tells a client that events were missed and it should reload the vehicles
+	resyncEvent = "resync"
+)
+
+// StreamHandler streams changes to stock as server-sent events
+type StreamHandler struct {
+	sites     repository.SiteStore
+	postcodes *geo.Postcodes
+	stream    *events.Stream
+	heartbeat time.Duration
+}
+
+// NewStreamHandler creates a new stream handler, measuring distances from the
+// sites in sites
+func NewStreamHandler(sites repository.SiteStore, postcodes *geo.Postcodes, stream *events.Stream) *StreamHandler {
+	return &StreamHandler{sites: sites, postcodes: postcodes, stream: stream, heartbeat: streamHeartbeat}
+}
+
+// GetVehicleStream godoc
+// @Summary Stream vehicle changes
+// @Description Stream changes to vehicles matching the GET /vehicles filters, except q, as server-sent events, named after the event type, with the event as JSON data. A change is sent when the vehicle matches before or after it, so clients see vehicles leave the results too; deletions are always sent. Reconnecting with Last-Event-ID replays the events missed since, or sends a resync event when they are no longer available and the vehicles should be reloaded.
+// @Tags vehicles
+// @Produce text/event-stream
+// @Param Last-Event-ID header string false "ID of the last event received, to resume after"
+// @Param last_event_id query string false "Same as Last-Event-ID, for clients that cannot set headers"
+// @Param advert_classification query string false "Advert classification (New, Used, All)"
+// @Param make query []string false "Vehicle makes, repeated or comma separated" collectionFormat(csv)
+// @Param model query string false "Vehicle model"
+// @Param fuel_type query []string false "Fuel types, repeated or comma separated" collectionFormat(csv)
+// @Param transmission query []string false "Transmissions, repeated or comma separated" collectionFormat(csv)
+// @Param body_type query []string false "Body types, repeated or comma separated" collectionFormat(csv)
+// @Param colour query []string false "Colours, repeated or comma separated" collectionFormat(csv)
+// @Param drivetrain query []string false "Drivetrains, repeated or comma separated" collectionFormat(csv)
+// @Param doors query []int false "Numbers of doors, repeated or comma separated" collectionFormat(csv)
+// @Param seats query []int false "Numbers of seats, repeated or comma separated" collectionFormat(csv)
+// @Param insurance_group query []string false "Insurance groups, repeated or comma separated" collectionFormat(csv)
+// @Param site_slug query []string false "Site slugs, repeated or comma separated" collectionFormat(csv)
+// @Param location query []string false "Locations, repeated or comma separated" collectionFormat(csv)
+// @Param make_slug query []string false "Make slugs, repeated or comma separated" collectionFormat(csv)
+// @Param range_slug query []string false "Range slugs, repeated or comma separated" collectionFormat(csv)
+// @Param min_price query string false "Minimum price in pounds, e.g. 5000 or 4999.99"
+// @Param max_price query string false "Maximum price in pounds, e.g. 15000 or 14999.99"
+// @Param min_year query int false "Minimum year (1900-2100)"
+// @Param max_year query int false "Maximum year (1900-2100)"
+// @Param min_mileage query int false "Minimum odometer reading"
+// @Param max_mileage query int false "Maximum odometer reading"
+// @Param max_previous_keepers query int false "Maximum number of previous keepers"
+// @Param has_offer query bool false "Only vehicles with (true) or without (false) an offer"
+// @Param stock_status query string false "Comma separated stock statuses, or all. Defaults to in_prep,in_stock,reserved"
+// @Param near query string false "Postcode or latitude,longitude to search around"
+// @Param radius query int false "Only vehicles within this many miles of near (1-1000)"
+// @Success 200 {object} models.VehicleEvent "Stream of events"
+// @Failure 400 {object} apperr.Problem "Bad request"
+// @Failure 500 {object} apperr.Problem "Internal server error"
+// @Router /vehicles/stream [get]
+func (h *StreamHandler) GetVehicleStream(c *gin.Context) {
+	filters, err := parseStreamFilters(c.Request.URL.Query(), h.postcodes)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	var sites []models.Site
+	if filters.Near != nil {
+		if sites, err = h.sites.ListSites(); err != nil {
+			c.Error(err)
+			return
+		}
+	}
+	matcher := repository.NewVehicleMatcher(filters, sites)
+
+	lastEventID := c.GetHeader("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = c.Query("last_event_id")
+	}
+	sub, missed, complete := h.stream.Subscribe(lastEventID)
+	defer sub.Close()
+
+	c.Header("Content-Type", sse.ContentType)
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+
+	c.Render(-1, sse.Event{Event: "ready", Retry: streamRetry, Data: gin.H{"resumed": lastEventID != "" && complete}})
+	if !complete {
+		c.Render(-1, sse.Event{Event: resyncEvent, Data: gin.H{"reason": "missed events are no longer available"}})
+	}
+	for _, event := range missed {
+		sendStreamEvent(c, matcher, event)
+	}
+	c.Writer.Flush()
+
+	heartbeat := time.NewTicker(h.heartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case event, ok := <-sub.Events:
+			if !ok {
+				// Too far behind: the client reconnects and resumes from the buffer
+				return
+			}
+			sendStreamEvent(c, matcher, event)
+		case <-heartbeat.C:
+			c.Writer.WriteString(": heartbeat\n\n")
+		}
+		c.Writer.Flush()
+	}
+}
+
+// sendStreamEvent writes an event if the vehicle matches the stream's filters before
+// or after the change, so clients see vehicles leave their results as well as join
+// them. Deletions carry no vehicle and are always sent.
+func sendStreamEvent(c *gin.Context, matcher *repository.VehicleMatcher, event events.StreamEvent) {
+	vehicle := event.Event.Vehicle
+	if vehicle != nil && !matcher.Match(*vehicle) && !matcher.Match(vehicleBefore(event.Event)) {
+		return
+	}
+
+	c.Render(-1, sse.Event{Id: event.ID, Event: string(event.Event.Type), Data: event.Event})
+}
+
+// vehicleBefore returns the vehicle as it was before an event: the previous vehicle
+// an update carries, or else the vehicle with the old status and price put back
+func vehicleBefore(event models.VehicleEvent) models.Vehicle {
+	if event.Previous != nil {
+		return *event.Previous
+	}
+
+	vehicle := *event.Vehicle
+	if event.FromStatus != "" {
+		vehicle.StockStatus = event.FromStatus
+	}
+	if event.OldPrice != nil {
+		vehicle.Price = *event.OldPrice
+	}
+	return vehicle
+}
+
+// parseStreamFilters parses the query of GET /vehicles/stream
+func parseStreamFilters(values url.Values, postcodes *geo.Postcodes) (models.VehicleFilters, error) {
+	p := newQueryParser(values, streamQueryKeys)
+	filters, _ := readVehicleFilters(p, postcodes)
+	return filters, p.err()
+}
@@ -0,0 +1,212 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Candoo/vehicles-api/internal/models"
+)
+
+// sseEvent is an event read from a server-sent event stream
+type sseEvent struct {
+	id, name, data string
+}
+
+// readSSE reads the next event from a stream, skipping comments
+func readSSE(t *testing.T, stream *bufio.Reader) sseEvent {
+	t.Helper()
+	var event sseEvent
+	for {
+		line, err := stream.ReadString('\n')
+		if err != nil {
+			t.Fatalf("read stream: %v", err)
+		}
+		line = strings.TrimRight(line, "\n")
+		switch {
+		case line == "":
+			if event.name != "" {
+				return event
+			}
+		case strings.HasPrefix(line, "id:"):
+			event.id = strings.TrimPrefix(line, "id:")
+		case strings.HasPrefix(line, "event:"):
+			event.name = strings.TrimPrefix(line, "event:")
+		case strings.HasPrefix(line, "data:"):
+			event.data = strings.TrimPrefix(line, "data:")
+		}
+	}
+}
+
+// connectStream opens the stream of Skoda changes from server, resuming after
+// lastEventID when given
+func connectStream(t *testing.T, server *httptest.Server, lastEventID string) (*bufio.Reader, context.CancelFunc) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/vehicles/stream?make=Skoda", nil)
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		cancel()
+		t.Fatalf("connect: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK || !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream") {
+		cancel()
+		t.Fatalf("connect: status = %d, content type %q", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	return bufio.NewReader(resp.Body), func() {
+		cancel()
+		resp.Body.Close()
+	}
+}
+
+// sellAndDelete sells vehicles 2 and 1 and deletes vehicle 1
+func sellAndDelete(t *testing.T, api *testAPI) {
+	t.Helper()
+	for _, id := range []int{2, 1} {
+		if _, err := api.vehicles.TransitionVehicleStatus(id, models.StockStatusSold, "staff", ""); err != nil {
+			t.Fatalf("TransitionVehicleStatus: %v", err)
+		}
+	}
+	if err := api.vehicles.DeleteVehicle(1); err != nil {
+		t.Fatalf("DeleteVehicle: %v", err)
+	}
+}
+
+// createSkodaAndFord adds a Skoda as vehicle 1 and a Ford as vehicle 2
+func createSkodaAndFord(t *testing.T, api *testAPI) {
+	t.Helper()
+	skoda := testVehicle(1, 5000)
+	ford := testVehicle(2, 7000)
+	ford.Make, ford.Model = "Ford", "Focus"
+	for _, vehicle := range []*models.Vehicle{&skoda, &ford} {
+		if err := api.vehicles.CreateVehicle(vehicle); err != nil {
+			t.Fatalf("CreateVehicle: %v", err)
+		}
+	}
+}
+
+func TestGetVehicleStreamRejectsBadQuery(t *testing.T) {
+	api := newTestAPI(t)
+
+	for _, query := range []string{"?page=2", "?q=octavia", "?stock_status=lost", "?min_price=9000&max_price=5000"} {
+		if rec := api.serve(http.MethodGet, "/vehicles/stream"+query, nil); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want 400", query, rec.Code)
+		}
+	}
+}
+
+func TestGetVehicleStream(t *testing.T) {
+	api := newTestAPI(t)
+	server := httptest.NewServer(api)
+	defer server.Close()
+
+	feed, disconnect := connectStream(t, server, "")
+	defer disconnect()
+	if ready := readSSE(t, feed); ready.name != "ready" || ready.data != `{"resumed":false}` {
+		t.Errorf("first event = %+v, want ready", ready)
+	}
+
+	createSkodaAndFord(t, api)
+	api.publish()
+	created := readSSE(t, feed)
+	var event models.VehicleEvent
+	if err := json.Unmarshal([]byte(created.data), &event); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if created.name != "vehicle.created" || created.id == "" || event.VehicleID != 1 || event.Vehicle == nil || event.Vehicle.Make != "Skoda" {
+		t.Errorf("created = %+v", created)
+	}
+
+	// The sold Skoda no longer matches the default stock statuses but did before, so
+	// it is sent; the Ford never matched
+	sellAndDelete(t, api)
+	api.publish()
+	sold := readSSE(t, feed)
+	deleted := readSSE(t, feed)
+	if sold.name != "vehicle.sold" || deleted.name != "vehicle.deleted" || !strings.Contains(deleted.data, `"vehicle_id":1`) {
+		t.Errorf("events = %+v, %+v, want sold and deleted", sold, deleted)
+	}
+}
+
+func TestGetVehicleStreamSendsVehiclesLeavingResults(t *testing.T) {
+	api := newTestAPI(t)
+	server := httptest.NewServer(api)
+	defer server.Close()
+	createSkodaAndFord(t, api)
+	api.publish()
+
+	feed, disconnect := connectStream(t, server, "")
+	defer disconnect()
+	readSSE(t, feed)
+
+	// The Skoda is rebadged out of the results and the Ford changed without ever
+	// being in them, so only the Skoda's update is sent
+	for id, badge := range map[int]string{1: "Seat", 2: "Ford"} {
+		vehicle, err := api.vehicles.GetVehicleByID(id)
+		if err != nil {
+			t.Fatalf("GetVehicleByID: %v", err)
+		}
+		vehicle.Make, vehicle.OdometerValue = badge, 60000
+		if err := api.vehicles.UpdateVehicle(id, vehicle); err != nil {
+			t.Fatalf("UpdateVehicle: %v", err)
+		}
+	}
+	if err := api.vehicles.DeleteVehicle(2); err != nil {
+		t.Fatalf("DeleteVehicle: %v", err)
+	}
+	api.publish()
+
+	updated := readSSE(t, feed)
+	var event models.VehicleEvent
+	if err := json.Unmarshal([]byte(updated.data), &event); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if updated.name != "vehicle.updated" || event.VehicleID != 1 || event.Vehicle.Make != "Seat" || event.Previous == nil || event.Previous.Make != "Skoda" {
+		t.Errorf("updated = %+v", updated)
+	}
+	if deleted := readSSE(t, feed); deleted.name != "vehicle.deleted" || !strings.Contains(deleted.data, `"vehicle_id":2`) {
+		t.Errorf("next event = %+v, want vehicle 2 deleted", deleted)
+	}
+}
+
+func TestGetVehicleStreamResumes(t *testing.T) {
+	api := newTestAPI(t)
+	server := httptest.NewServer(api)
+	defer server.Close()
+
+	feed, disconnect := connectStream(t, server, "")
+	readSSE(t, feed)
+	createSkodaAndFord(t, api)
+	api.publish()
+	created := readSSE(t, feed)
+	disconnect()
+
+	// Reconnecting replays the events missed since the last one seen
+	sellAndDelete(t, api)
+	api.publish()
+	feed, disconnect = connectStream(t, server, created.id)
+	defer disconnect()
+	if ready := readSSE(t, feed); ready.name != "ready" || ready.data != `{"resumed":true}` {
+		t.Errorf("resumed first event = %+v, want ready", ready)
+	}
+	for _, want := range []string{"vehicle.sold", "vehicle.deleted"} {
+		if got := readSSE(t, feed); got.name != want {
+			t.Errorf("replayed %+v, want %s", got, want)
+		}
+	}
+
+	unknown, disconnectUnknown := connectStream(t, server, "0-1")
+	defer disconnectUnknown()
+	readSSE(t, unknown)
+	if resync := readSSE(t, unknown); resync.name != "resync" {
+		t.Errorf("unknown last event = %+v, want resync", resync)
+	}
+}
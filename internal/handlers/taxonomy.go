@@ -0,0 +1,27 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/Candoo/vehicles-api/internal/models"
+	"github.com/gin-gonic/gin"
+)
+
+// GetTaxonomy godoc
+// @Summary Get vehicle taxonomy
+// @Description Get the makes, ranges, models and derivatives in stock as one tree, with the number of listed vehicles and their lowest and highest price at every level
+// @Tags vehicles
+// @Accept json
+// @Produce json
+// @Success 200 {object} models.TaxonomyResponse
+// @Failure 500 {object} apperr.Problem "Internal server error"
+// @Router /taxonomy [get]
+func (h *VehicleHandler) GetTaxonomy(c *gin.Context) {
+	makes, err := h.repo.GetTaxonomy()
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.TaxonomyResponse{Makes: makes})
+}
@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func TestGetTaxonomy(t *testing.T) {
+	api := newTestAPI(t, testVehicle(1, 5000), testVehicle(2, 6500))
+
+	rec := api.serve(http.MethodGet, "/taxonomy", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", rec.Code, rec.Body)
+	}
+
+	var response struct {
+		Makes []struct {
+			Slug     string `json:"slug"`
+			Count    int64  `json:"count"`
+			MinPrice string `json:"min_price"`
+			MaxPrice string `json:"max_price"`
+			Ranges   []struct {
+				Slug   string            `json:"slug"`
+				Models []json.RawMessage `json:"models"`
+			} `json:"ranges"`
+		} `json:"makes"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(response.Makes) != 1 {
+		t.Fatalf("makes = %+v", response.Makes)
+	}
+	skoda := response.Makes[0]
+	if skoda.Slug != "skoda" || skoda.Count != 2 || skoda.MinPrice != "5000.00" || skoda.MaxPrice != "6500.00" {
+		t.Errorf("make = %+v", skoda)
+	}
+	if len(skoda.Ranges) != 1 || skoda.Ranges[0].Slug != "fabia" || len(skoda.Ranges[0].Models) != 1 {
+		t.Errorf("ranges = %+v", skoda.Ranges)
+	}
+}
@@ -0,0 +1,412 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/Candoo/vehicles-api/internal/apperr"
+	"github.com/Candoo/vehicles-api/internal/models"
+	"github.com/Candoo/vehicles-api/internal/repository"
+	"github.com/Candoo/vehicles-api/internal/testdrive"
+	"github.com/gin-gonic/gin"
+)
+
+// TestDriveHandler handles test drive slots and bookings
+type TestDriveHandler struct {
+	repo     repository.VehicleStore
+	sites    repository.SiteStore
+	drives   repository.TestDriveStore
+	schedule testdrive.Schedule
+	now      func() time.Time
+}
+
+// NewTestDriveHandler creates a new test drive handler booking the vehicles in repo
+// into drives on the given schedule, within the opening hours of their sites
+func NewTestDriveHandler(repo repository.VehicleStore, sites repository.SiteStore, drives repository.TestDriveStore, schedule testdrive.Schedule) *TestDriveHandler {
+	return &TestDriveHandler{repo: repo, sites: sites, drives: drives, schedule: schedule, now: time.Now}
+}
+
+// GetTestDriveSlots godoc
+// @Summary Get test drive slots
+// @Description List a vehicle's test drive slots from the opening hours of its site, marking those already booked unavailable. Vehicles not at a site with opening hours have no slots.
+// @Tags test-drives
+// @Produce json
+// @Param id path int true "Vehicle ID"
+// @Param from query string false "First day (YYYY-MM-DD), default today"
+// @Param days query int false "Number of days" default(7)
+// @Success 200 {object} models.TestDriveSlotsResponse
+// @Failure 400 {object} apperr.Problem "Bad request"
+// @Failure 404 {object} apperr.Problem "Vehicle not found"
+// @Failure 409 {object} apperr.Problem "Vehicle not for sale"
+// @Failure 500 {object} apperr.Problem "Internal server error"
+// @Router /vehicles/{id}/test-drive-slots [get]
+func (h *TestDriveHandler) GetTestDriveSlots(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.Error(apperr.Validation("invalid vehicle ID"))
+		return
+	}
+
+	from, days, err := h.parseDays(c.Request.URL.Query())
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	vehicle, err := h.repo.GetVehicleByID(id)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	if !vehicle.StockStatus.Listed() {
+		c.Error(apperr.Conflict("vehicle is not for sale"))
+		return
+	}
+
+	response := models.TestDriveSlotsResponse{
+		VehicleID: vehicle.VehicleID,
+		SiteSlug:  vehicle.SiteSlug,
+		TimeZone:  h.schedule.Location.String(),
+		Slots:     []models.TestDriveSlot{},
+	}
+
+	site, err := h.site(vehicleSiteSlug(vehicle))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	if site != nil {
+		booked, err := h.drives.GetTestDrives(id, from, from.AddDate(0, 0, days))
+		if err != nil {
+			c.Error(err)
+			return
+		}
+		response.Slots = h.schedule.Slots(site.OpeningHours, from, days, booked, h.now())
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// BookTestDrive godoc
+// @Summary Book test drive
+// @Description Book one of a vehicle's free test drive slots. The response carries the booking reference used to view, reschedule and cancel the booking.
+// @Tags test-drives
+// @Accept json
+// @Produce json
+// @Param id path int true "Vehicle ID"
+// @Param booking body models.TestDriveRequest true "Slot start and contact details"
+// @Success 201 {object} models.TestDrive
+// @Failure 400 {object} apperr.Problem "Bad request"
+// @Failure 404 {object} apperr.Problem "Vehicle not found"
+// @Failure 409 {object} apperr.Problem "Vehicle not for sale, not at a site or already booked"
+// @Failure 500 {object} apperr.Problem "Internal server error"
+// @Router /vehicles/{id}/test-drives [post]
+func (h *TestDriveHandler) BookTestDrive(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.Error(apperr.Validation("invalid vehicle ID"))
+		return
+	}
+
+	var req models.TestDriveRequest
+	if err := decodeStrictJSON(c, &req); err != nil {
+		c.Error(apperr.Invalid(err))
+		return
+	}
+	if err := req.Validate(); err != nil {
+		c.Error(apperr.Invalid(err))
+		return
+	}
+
+	vehicle, err := h.repo.GetVehicleByID(id)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	if !vehicle.StockStatus.Listed() {
+		c.Error(apperr.Conflict("vehicle is not for sale"))
+		return
+	}
+
+	endsAt, err := h.checkSlot(vehicleSiteSlug(vehicle), req.StartsAt)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	reference, err := testdrive.NewReference()
+	if err != nil {
+		c.Error(fmt.Errorf("failed to generate booking reference: %w", err))
+		return
+	}
+
+	drive := models.TestDrive{
+		Reference: reference,
+		VehicleID: id,
+		StartsAt:  req.StartsAt,
+		EndsAt:    endsAt,
+		Name:      req.Name,
+		Email:     req.Email,
+		Phone:     req.Phone,
+	}
+	if err := h.drives.CreateTestDrive(&drive); err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, drive)
+}
+
+// GetTestDrive godoc
+// @Summary Get test drive
+// @Description Get a test drive booking by its reference
+// @Tags test-drives
+// @Produce json
+// @Param reference path string true "Booking reference"
+// @Success 200 {object} models.TestDrive
+// @Failure 404 {object} apperr.Problem "Test drive not found"
+// @Failure 500 {object} apperr.Problem "Internal server error"
+// @Router /test-drives/{reference} [get]
+func (h *TestDriveHandler) GetTestDrive(c *gin.Context) {
+	drive, err := h.drives.GetTestDrive(c.Param("reference"))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, drive)
+}
+
+// RescheduleTestDrive godoc
+// @Summary Reschedule test drive
+// @Description Move a booking that has not started to another free slot of the vehicle, at the site it was booked at
+// @Tags test-drives
+// @Accept json
+// @Produce json
+// @Param reference path string true "Booking reference"
+// @Param reschedule body models.RescheduleTestDriveRequest true "New slot start"
+// @Success 200 {object} models.TestDrive
+// @Failure 400 {object} apperr.Problem "Bad request"
+// @Failure 404 {object} apperr.Problem "Test drive not found"
+// @Failure 409 {object} apperr.Problem "Booking cancelled or started, or slot already booked"
+// @Failure 500 {object} apperr.Problem "Internal server error"
+// @Router /test-drives/{reference}/reschedule [post]
+func (h *TestDriveHandler) RescheduleTestDrive(c *gin.Context) {
+	var req models.RescheduleTestDriveRequest
+	if err := decodeStrictJSON(c, &req); err != nil {
+		c.Error(apperr.Invalid(err))
+		return
+	}
+	if err := req.Validate(); err != nil {
+		c.Error(apperr.Invalid(err))
+		return
+	}
+
+	drive, err := h.startedCheck(c.Param("reference"))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	// The booking stays at the site it was made for, even if the vehicle has moved since
+	endsAt, err := h.checkSlot(drive.SiteSlug, req.StartsAt)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	drive, err = h.drives.RescheduleTestDrive(drive.Reference, req.StartsAt, endsAt)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, drive)
+}
+
+// CancelTestDrive godoc
+// @Summary Cancel test drive
+// @Description Cancel a booking that has not started, freeing its slot
+// @Tags test-drives
+// @Accept json
+// @Produce json
+// @Param reference path string true "Booking reference"
+// @Param cancellation body models.CancelTestDriveRequest false "Reason for cancelling"
+// @Success 200 {object} models.TestDrive
+// @Failure 400 {object} apperr.Problem "Bad request"
+// @Failure 404 {object} apperr.Problem "Test drive not found"
+// @Failure 409 {object} apperr.Problem "Booking already cancelled or started"
+// @Failure 500 {object} apperr.Problem "Internal server error"
+// @Router /test-drives/{reference}/cancel [post]
+func (h *TestDriveHandler) CancelTestDrive(c *gin.Context) {
+	var req models.CancelTestDriveRequest
+	if c.Request.ContentLength > 0 {
+		if err := decodeStrictJSON(c, &req); err != nil {
+			c.Error(apperr.Invalid(err))
+			return
+		}
+	}
+
+	drive, err := h.startedCheck(c.Param("reference"))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	drive, err = h.drives.CancelTestDrive(drive.Reference, req.Reason)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, drive)
+}
+
+// GetTestDriveCalendar godoc
+// @Summary Get test drive calendar file
+// @Description Download a booking as an iCalendar (.ics) event at the site it was booked at. Cancelled and rescheduled bookings update an event already imported.
+// @Tags test-drives
+// @Produce text/calendar
+// @Param reference path string true "Booking reference"
+// @Success 200 {string} string "iCalendar file"
+// @Failure 404 {object} apperr.Problem "Test drive not found"
+// @Failure 500 {object} apperr.Problem "Internal server error"
+// @Router /test-drives/{reference}/calendar.ics [get]
+func (h *TestDriveHandler) GetTestDriveCalendar(c *gin.Context) {
+	drive, err := h.drives.GetTestDrive(c.Param("reference"))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	vehicle, err := h.repo.GetVehicleByID(drive.VehicleID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	site, err := h.site(drive.SiteSlug)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="test-drive-%s.ics"`, drive.Reference))
+	c.Data(http.StatusOK, "text/calendar; charset=utf-8", testdrive.Calendar(drive, vehicle, site, h.now()))
+}
+
+// GetVehicleTestDrives godoc
+// @Summary Get vehicle test drives
+// @Description Get the booked test drives of a vehicle on a run of days, earliest first
+// @Tags test-drives
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Vehicle ID"
+// @Param from query string false "First day (YYYY-MM-DD), default today"
+// @Param days query int false "Number of days" default(7)
+// @Success 200 {object} map[string]interface{} "Test drives"
+// @Failure 400 {object} apperr.Problem "Bad request"
+// @Failure 401 {object} apperr.Problem "Authentication required"
+// @Failure 403 {object} apperr.Problem "Insufficient permissions"
+// @Failure 404 {object} apperr.Problem "Vehicle not found"
+// @Failure 500 {object} apperr.Problem "Internal server error"
+// @Router /vehicles/{id}/test-drives [get]
+func (h *TestDriveHandler) GetVehicleTestDrives(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.Error(apperr.Validation("invalid vehicle ID"))
+		return
+	}
+
+	from, days, err := h.parseDays(c.Request.URL.Query())
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	drives, err := h.drives.GetTestDrives(id, from, from.AddDate(0, 0, days))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"test_drives": drives,
+	})
+}
+
+// parseDays reads the from and days query parameters, returning local midnight of
+// the first day
+func (h *TestDriveHandler) parseDays(values url.Values) (time.Time, int, error) {
+	p := newQueryParser(values, []string{"from", "days"})
+	days := p.integer("days", 7, 1, h.schedule.MaxDaysAhead)
+
+	now := h.now().In(h.schedule.Location)
+	from := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, h.schedule.Location)
+	if p.has("from") {
+		day, err := time.ParseInLocation("2006-01-02", p.text("from"), h.schedule.Location)
+		if err != nil {
+			p.fail("from", "must be a date (YYYY-MM-DD)")
+		} else {
+			from = day
+		}
+	}
+
+	return from, days, p.err()
+}
+
+// site returns the site with the given slug, or nil when there is no such site
+func (h *TestDriveHandler) site(slug string) (*models.Site, error) {
+	if slug == "" {
+		return nil, nil
+	}
+
+	site, err := h.sites.GetSiteBySlug(slug)
+	if errors.Is(err, apperr.ErrNotFound) {
+		return nil, nil
+	}
+	return site, err
+}
+
+// vehicleSiteSlug returns the slug of the site a vehicle is at, or "" when it is not
+// linked to a site
+func vehicleSiteSlug(vehicle *models.Vehicle) string {
+	if vehicle.SiteID == nil {
+		return ""
+	}
+	return vehicle.SiteSlug
+}
+
+// checkSlot checks that start is a bookable slot at the site with the given slug,
+// returning the slot's end
+func (h *TestDriveHandler) checkSlot(siteSlug string, start time.Time) (time.Time, error) {
+	site, err := h.site(siteSlug)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if site == nil || len(site.OpeningHours) == 0 {
+		return time.Time{}, apperr.Conflict("site is not taking test drive bookings")
+	}
+
+	end, err := h.schedule.Check(site.OpeningHours, start, h.now())
+	if err != nil {
+		return time.Time{}, apperr.Invalid(err)
+	}
+	return end, nil
+}
+
+// startedCheck fetches a booking, rejecting one whose test drive has started
+func (h *TestDriveHandler) startedCheck(reference string) (*models.TestDrive, error) {
+	drive, err := h.drives.GetTestDrive(reference)
+	if err != nil {
+		return nil, err
+	}
+	if !h.now().Before(drive.StartsAt) {
+		return nil, apperr.Conflict("test drive has already started")
+	}
+	return drive, nil
+}
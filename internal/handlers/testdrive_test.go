@@ -0,0 +1,179 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Candoo/vehicles-api/internal/models"
+)
+
+// newTestDriveAPI serves vehicle 1 at the Winsford site, open every day, and vehicle 2
+// at no site
+func newTestDriveAPI(t *testing.T) *testAPI {
+	t.Helper()
+	atSite := testVehicle(1, 10000)
+	atSite.Site = "Winsford"
+	api := newTestAPI(t, atSite, testVehicle(2, 8000))
+
+	var hours models.OpeningHoursList
+	for _, day := range []string{"monday", "tuesday", "wednesday", "thursday", "friday", "saturday", "sunday"} {
+		hours = append(hours, models.OpeningHours{Day: day, Opens: "09:00", Closes: "17:00"})
+	}
+	if err := api.vehicles.CreateSite(&models.Site{Slug: "winsford", Name: "Winsford", Postcode: "CW7 3QP", OpeningHours: hours}); err != nil {
+		t.Fatalf("CreateSite: %v", err)
+	}
+	return api
+}
+
+// testDriveSlots fetches the slots listed at path
+func testDriveSlots(t *testing.T, api *testAPI, path string) []models.TestDriveSlot {
+	t.Helper()
+	rec := api.serve(http.MethodGet, path, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("%s: status = %d, body %s", path, rec.Code, rec.Body)
+	}
+	var response models.TestDriveSlotsResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	return response.Slots
+}
+
+// bookTestDrive books a test drive of vehicle 1 starting at startsAt
+func bookTestDrive(t *testing.T, api *testAPI, startsAt time.Time) models.TestDrive {
+	t.Helper()
+	booking := map[string]interface{}{"starts_at": startsAt, "name": "Sam Taylor", "email": "sam@example.com"}
+	rec := api.serve(http.MethodPost, "/vehicles/1/test-drives", booking)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("book: status = %d, body %s", rec.Code, rec.Body)
+	}
+	var drive models.TestDrive
+	if err := json.Unmarshal(rec.Body.Bytes(), &drive); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	return drive
+}
+
+func TestGetTestDriveSlots(t *testing.T) {
+	api := newTestDriveAPI(t)
+
+	if offered := testDriveSlots(t, api, "/vehicles/1/test-drive-slots?days=3"); len(offered) < 3 {
+		t.Errorf("slots = %+v", offered)
+	}
+	if offSite := testDriveSlots(t, api, "/vehicles/2/test-drive-slots"); len(offSite) != 0 {
+		t.Errorf("vehicle without a site: slots = %+v", offSite)
+	}
+	if rec := api.serve(http.MethodGet, "/vehicles/1/test-drive-slots?days=90", nil); rec.Code != http.StatusBadRequest {
+		t.Errorf("too many days: status = %d, want 400", rec.Code)
+	}
+}
+
+func TestBookTestDrive(t *testing.T) {
+	api := newTestDriveAPI(t)
+	offered := testDriveSlots(t, api, "/vehicles/1/test-drive-slots?days=3")
+
+	drive := bookTestDrive(t, api, offered[0].StartsAt)
+	if !strings.HasPrefix(drive.Reference, "td_") || len(drive.Reference) != 27 || drive.SiteSlug != "winsford" || !drive.EndsAt.Equal(offered[0].EndsAt) {
+		t.Errorf("booking = %+v", drive)
+	}
+	if got := testDriveSlots(t, api, "/vehicles/1/test-drive-slots?days=3"); got[0].Available {
+		t.Errorf("booked slot still available: %+v", got[0])
+	}
+
+	booking := map[string]interface{}{"starts_at": offered[0].StartsAt, "name": "Sam Taylor", "email": "sam@example.com"}
+	if rec := api.serve(http.MethodPost, "/vehicles/1/test-drives", booking); rec.Code != http.StatusConflict {
+		t.Errorf("double booking: status = %d, want 409", rec.Code)
+	}
+	if rec := api.serve(http.MethodPost, "/vehicles/2/test-drives", booking); rec.Code != http.StatusConflict {
+		t.Errorf("vehicle without a site: status = %d, want 409", rec.Code)
+	}
+	booking["starts_at"] = offered[1].StartsAt.Add(30 * time.Minute)
+	if rec := api.serve(http.MethodPost, "/vehicles/1/test-drives", booking); rec.Code != http.StatusBadRequest {
+		t.Errorf("between slots: status = %d, want 400", rec.Code)
+	}
+}
+
+func TestRescheduleTestDrive(t *testing.T) {
+	api := newTestDriveAPI(t)
+	offered := testDriveSlots(t, api, "/vehicles/1/test-drive-slots?days=3")
+	path := "/test-drives/" + bookTestDrive(t, api, offered[0].StartsAt).Reference
+
+	rec := api.serve(http.MethodPost, path+"/reschedule", map[string]interface{}{"starts_at": offered[1].StartsAt})
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"sequence":1`) {
+		t.Errorf("reschedule: status = %d, body %s", rec.Code, rec.Body)
+	}
+	if got := testDriveSlots(t, api, "/vehicles/1/test-drive-slots?days=3"); !got[0].Available || got[1].Available {
+		t.Errorf("slots after reschedule = %+v", got[:2])
+	}
+
+	for name, body := range map[string]interface{}{
+		"no time":       map[string]interface{}{},
+		"unknown field": map[string]interface{}{"starts_at": offered[2].StartsAt, "site_slug": "northwich"},
+	} {
+		if rec := api.serve(http.MethodPost, path+"/reschedule", body); rec.Code != http.StatusBadRequest {
+			t.Errorf("reschedule with %s: status = %d, want 400", name, rec.Code)
+		}
+	}
+}
+
+func TestRescheduleTestDriveKeepsSite(t *testing.T) {
+	api := newTestDriveAPI(t)
+	offered := testDriveSlots(t, api, "/vehicles/1/test-drive-slots?days=3")
+	path := "/test-drives/" + bookTestDrive(t, api, offered[0].StartsAt).Reference
+
+	// The booking stays at its site when the vehicle moves to one without opening hours
+	if err := api.vehicles.CreateSite(&models.Site{Slug: "northwich", Name: "Northwich", Postcode: "CW9 5AA"}); err != nil {
+		t.Fatalf("CreateSite: %v", err)
+	}
+	if _, err := api.vehicles.TransferVehicle(1, models.TransferRequest{SiteSlug: "northwich"}, "staff"); err != nil {
+		t.Fatalf("TransferVehicle: %v", err)
+	}
+	rec := api.serve(http.MethodPost, path+"/reschedule", map[string]interface{}{"starts_at": offered[2].StartsAt})
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"site_slug":"winsford"`) {
+		t.Errorf("reschedule after transfer: status = %d, body %s", rec.Code, rec.Body)
+	}
+}
+
+func TestGetTestDriveCalendar(t *testing.T) {
+	api := newTestDriveAPI(t)
+	offered := testDriveSlots(t, api, "/vehicles/1/test-drive-slots?days=3")
+	drive := bookTestDrive(t, api, offered[0].StartsAt)
+
+	rec := api.serve(http.MethodGet, "/test-drives/"+drive.Reference+"/calendar.ics", nil)
+	if rec.Code != http.StatusOK || !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/calendar") ||
+		!strings.Contains(rec.Header().Get("Content-Disposition"), "attachment") {
+		t.Fatalf("calendar: status = %d, headers %v", rec.Code, rec.Header())
+	}
+	if body := rec.Body.String(); !strings.Contains(body, "UID:"+drive.Reference+"@vehicles-api\r\n") || !strings.Contains(body, "STATUS:CONFIRMED") ||
+		!strings.Contains(body, "CW7 3QP") {
+		t.Errorf("calendar = %s", body)
+	}
+	if rec := api.serve(http.MethodGet, "/test-drives/td_unknown", nil); rec.Code != http.StatusNotFound {
+		t.Errorf("unknown booking: status = %d, want 404", rec.Code)
+	}
+}
+
+func TestCancelTestDrive(t *testing.T) {
+	api := newTestDriveAPI(t)
+	offered := testDriveSlots(t, api, "/vehicles/1/test-drive-slots?days=3")
+	drive := bookTestDrive(t, api, offered[0].StartsAt)
+
+	if rec := api.serveAs(models.RoleStaff, http.MethodGet, "/vehicles/1/test-drives?days=3", nil); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), drive.Reference) {
+		t.Errorf("vehicle test drives: status = %d, body %s", rec.Code, rec.Body)
+	}
+
+	path := "/test-drives/" + drive.Reference
+	rec := api.serve(http.MethodPost, path+"/cancel", map[string]string{"reason": "Bought elsewhere"})
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"status":"cancelled"`) {
+		t.Errorf("cancel: status = %d, body %s", rec.Code, rec.Body)
+	}
+	if rec := api.serve(http.MethodPost, path+"/cancel", nil); rec.Code != http.StatusConflict {
+		t.Errorf("cancel twice: status = %d, want 409", rec.Code)
+	}
+	if rec := api.serveAs(models.RoleStaff, http.MethodGet, "/vehicles/1/test-drives?days=3", nil); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"test_drives":[]`) {
+		t.Errorf("vehicle test drives after cancelling: status = %d, body %s", rec.Code, rec.Body)
+	}
+}
@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/Candoo/vehicles-api/internal/apperr"
+	"github.com/Candoo/vehicles-api/internal/auth"
+	"github.com/Candoo/vehicles-api/internal/models"
+	"github.com/gin-gonic/gin"
+)
+
+// TransferVehicle godoc
+// @Summary Transfer vehicle to another site
+// @Description Move a vehicle to another site and record the transfer. Sold vehicles cannot be moved.
+// @Tags vehicles
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Vehicle ID"
+// @Param transfer body models.TransferRequest true "Destination site"
+// @Success 200 {object} models.Vehicle
+// @Failure 400 {object} apperr.Problem "Bad request"
+// @Failure 401 {object} apperr.Problem "Authentication required"
+// @Failure 403 {object} apperr.Problem "Insufficient permissions"
+// @Failure 404 {object} apperr.Problem "Vehicle not found"
+// @Failure 409 {object} apperr.Problem "Vehicle sold or already at the site"
+// @Failure 500 {object} apperr.Problem "Internal server error"
+// @Router /vehicles/{id}/transfer [post]
+func (h *VehicleHandler) TransferVehicle(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.Error(apperr.Validation("invalid vehicle ID"))
+		return
+	}
+
+	var req models.TransferRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(apperr.Validation("site_slug is required"))
+		return
+	}
+
+	transferredBy := auth.FromContext(c.Request.Context()).Subject
+
+	vehicle, err := h.repo.TransferVehicle(id, req, transferredBy)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, vehicle)
+}
+
+// GetVehicleTransfers godoc
+// @Summary Get vehicle transfer history
+// @Description Get every site transfer of a vehicle, oldest first
+// @Tags vehicles
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Vehicle ID"
+// @Success 200 {object} map[string]interface{} "Transfer history"
+// @Failure 400 {object} apperr.Problem "Bad request"
+// @Failure 401 {object} apperr.Problem "Authentication required"
+// @Failure 403 {object} apperr.Problem "Insufficient permissions"
+// @Failure 404 {object} apperr.Problem "Vehicle not found"
+// @Failure 500 {object} apperr.Problem "Internal server error"
+// @Router /vehicles/{id}/transfers [get]
+func (h *VehicleHandler) GetVehicleTransfers(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.Error(apperr.Validation("invalid vehicle ID"))
+		return
+	}
+
+	history, err := h.repo.GetTransferHistory(id)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"history": history,
+	})
+}
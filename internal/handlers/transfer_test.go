@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/Candoo/vehicles-api/internal/models"
+)
+
+func TestTransferVehicle(t *testing.T) {
+	winsford := testVehicle(1, 5000)
+	winsford.Site = "Winsford"
+	api := newTestAPI(t, winsford)
+	trafford := map[string]string{"slug": "trafford", "name": "Trafford", "postcode": "M17 1AA"}
+	for _, site := range []interface{}{winsfordSite(), trafford} {
+		if rec := api.serveAs(models.RoleAdmin, http.MethodPost, "/admin/sites", site); rec.Code != http.StatusCreated {
+			t.Fatalf("create site: status = %d, body %s", rec.Code, rec.Body)
+		}
+	}
+
+	rec := api.serveAs(models.RoleStaff, http.MethodPost, "/vehicles/1/transfer", map[string]string{"site_slug": "trafford", "reason": "Viewing"})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("transfer: status = %d, body %s", rec.Code, rec.Body)
+	}
+	if rec := api.serveAs(models.RoleStaff, http.MethodPost, "/vehicles/1/transfer", map[string]string{"site_slug": "trafford"}); rec.Code != http.StatusConflict {
+		t.Errorf("same site: status = %d, want 409", rec.Code)
+	}
+	if rec := api.serveAs(models.RoleStaff, http.MethodPost, "/vehicles/1/transfer", map[string]string{}); rec.Code != http.StatusBadRequest {
+		t.Errorf("missing site: status = %d, want 400", rec.Code)
+	}
+	expectSiteVehicles(t, api, "/sites/winsford/vehicles", 0)
+	expectSiteVehicles(t, api, "/sites/trafford/vehicles", 1)
+}
+
+func TestGetVehicleTransfers(t *testing.T) {
+	winsford := testVehicle(1, 5000)
+	winsford.Site = "Winsford"
+	api := newTestAPI(t, winsford)
+	for _, site := range []*models.Site{{Slug: "winsford", Name: "Winsford"}, {Slug: "trafford", Name: "Trafford"}} {
+		if err := api.vehicles.CreateSite(site); err != nil {
+			t.Fatalf("CreateSite: %v", err)
+		}
+	}
+	if _, err := api.vehicles.TransferVehicle(1, models.TransferRequest{SiteSlug: "trafford"}, "staff"); err != nil {
+		t.Fatalf("TransferVehicle: %v", err)
+	}
+
+	rec := api.serveAs(models.RoleStaff, http.MethodGet, "/vehicles/1/transfers", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("transfers: status = %d, body %s", rec.Code, rec.Body)
+	}
+	var history struct {
+		History []models.VehicleTransfer `json:"history"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &history); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(history.History) != 1 || history.History[0].FromSiteSlug != "winsford" || history.History[0].ToSiteSlug != "trafford" {
+		t.Errorf("history = %+v", history.History)
+	}
+}
@@ -1,9 +1,14 @@
 package handlers
 
 import (
+	"encoding/json"
+	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
 
+	"github.com/Candoo/vehicles-api/internal/apperr"
+	"github.com/Candoo/vehicles-api/internal/geo"
 	"github.com/Candoo/vehicles-api/internal/models"
 	"github.com/Candoo/vehicles-api/internal/repository"
 	"github.com/gin-gonic/gin"
@@ -11,12 +16,14 @@ import (
 
 // VehicleHandler handles HTTP requests for vehicles
 type VehicleHandler struct {
-	repo *repository.VehicleRepository
+	repo      repository.VehicleStore
+	postcodes *geo.Postcodes
 }
 
-// NewVehicleHandler creates a new vehicle handler
-func NewVehicleHandler(repo *repository.VehicleRepository) *VehicleHandler {
-	return &VehicleHandler{repo: repo}
+// NewVehicleHandler creates a new vehicle handler. postcodes resolves the near
+// parameter and may be nil, in which case only coordinates are accepted.
+func NewVehicleHandler(repo repository.VehicleStore, postcodes *geo.Postcodes) *VehicleHandler {
+	return &VehicleHandler{repo: repo, postcodes: postcodes}
 }
 
 // GetVehicles godoc
@@ -28,65 +35,75 @@ func NewVehicleHandler(repo *repository.VehicleRepository) *VehicleHandler {
 // @Param page query int false "Page number" default(1)
 // @Param results_per_page query int false "Results per page" default(10)
 // @Param advert_classification query string false "Advertisement classification (New, Used, All)" Enums(New, Used, All)
-// @Param make query string false "Vehicle make"
+// @Param make query []string false "Vehicle makes, repeated or comma separated" collectionFormat(csv)
 // @Param model query string false "Vehicle model"
-// @Param fuel_type query string false "Fuel type"
-// @Param transmission query string false "Transmission type"
-// @Param body_type query string false "Body type"
-// @Param min_price query string false "Minimum price"
-// @Param max_price query string false "Maximum price"
-// @Param min_year query string false "Minimum year"
-// @Param max_year query string false "Maximum year"
+// @Param fuel_type query []string false "Fuel types, repeated or comma separated" collectionFormat(csv)
+// @Param transmission query []string false "Transmission types, repeated or comma separated" collectionFormat(csv)
+// @Param body_type query []string false "Body types, repeated or comma separated" collectionFormat(csv)
+// @Param colour query []string false "Colours, repeated or comma separated" collectionFormat(csv)
+// @Param drivetrain query []string false "Drivetrains, repeated or comma separated" collectionFormat(csv)
+// @Param doors query []int false "Numbers of doors, repeated or comma separated" collectionFormat(csv)
+// @Param seats query []int false "Numbers of seats, repeated or comma separated" collectionFormat(csv)
+// @Param insurance_group query []string false "Insurance groups, repeated or comma separated" collectionFormat(csv)
+// @Param site_slug query []string false "Site slugs, repeated or comma separated" collectionFormat(csv)
+// @Param location query []string false "Locations, repeated or comma separated" collectionFormat(csv)
+// @Param make_slug query []string false "Make slugs, repeated or comma separated" collectionFormat(csv)
+// @Param range_slug query []string false "Range slugs, repeated or comma separated" collectionFormat(csv)
+// @Param min_price query string false "Minimum price in pounds, e.g. 5000 or 4999.99"
+// @Param max_price query string false "Maximum price in pounds, e.g. 15000 or 14999.99"
+// @Param min_year query int false "Minimum year (1900-2100)"
+// @Param max_year query int false "Maximum year (1900-2100)"
+// @Param min_mileage query int false "Minimum odometer reading"
+// @Param max_mileage query int false "Maximum odometer reading"
+// @Param max_previous_keepers query int false "Maximum number of previous keepers"
+// @Param has_offer query bool false "Only vehicles with (true) or without (false) an offer"
+// @Param cursor query string false "Opaque cursor from meta.next_cursor or meta.prev_cursor; replaces page"
+// @Param stock_status query string false "Comma separated stock statuses, or all. Defaults to in_prep,in_stock,reserved"
+// @Param q query string false "Free-text search across name, derivative, description and key features"
+// @Param facets query bool false "Include facet counts computed under the active filters"
+// @Param near query string false "Postcode or latitude,longitude to search around; results show distance_miles and are nearest first by default"
+// @Param radius query int false "Only vehicles within this many miles of near (1-1000)"
+// @Param sort query string false "Comma separated sort keys with optional direction, e.g. price:asc,year:desc. Allowed fields: price, year, odometer_value, created_at, make, model, relevance, distance"
 // @Success 200 {object} models.VehicleResponse
-// @Failure 400 {object} map[string]interface{} "Bad request"
-// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Failure 400 {object} apperr.Problem "Bad request"
+// @Failure 500 {object} apperr.Problem "Internal server error"
 // @Router /vehicles [get]
 func (h *VehicleHandler) GetVehicles(c *gin.Context) {
-	// Parse query parameters
-	filters := models.VehicleFilters{
-		Page:                   parseIntQuery(c, "page", 1),
-		ResultsPerPage:         parseIntQuery(c, "results_per_page", 10),
-		AdvertClassification:   c.Query("advert_classification"),
-		Make:                   c.Query("make"),
-		Model:                  c.Query("model"),
-		FuelType:               c.Query("fuel_type"),
-		Transmission:           c.Query("transmission"),
-		BodyType:               c.Query("body_type"),
-		MinPrice:               c.Query("min_price"),
-		MaxPrice:               c.Query("max_price"),
-		MinYear:                c.Query("min_year"),
-		MaxYear:                c.Query("max_year"),
-	}
-
-	// Validate page and results_per_page
-	if filters.Page < 1 {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "page must be greater than 0",
-		})
+	filters, withFacets, err := parseVehicleFilters(c.Request.URL.Query(), h.postcodes)
+	if err != nil {
+		c.Error(err)
 		return
 	}
 
-	if filters.ResultsPerPage < 1 || filters.ResultsPerPage > 100 {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "results_per_page must be between 1 and 100",
-		})
-		return
-	}
+	listVehicles(c, h.repo, filters, withFacets)
+}
 
+// listVehicles responds with a page of vehicles matching the filters, with facet
+// counts when requested
+func listVehicles(c *gin.Context, repo repository.VehicleStore, filters models.VehicleFilters, withFacets bool) {
 	// Fetch vehicles from repository
-	vehicles, metadata, err := h.repo.GetVehicles(filters)
+	vehicles, metadata, err := repo.GetVehicles(filters)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "failed to fetch vehicles",
-		})
+		c.Error(err)
 		return
 	}
 
-	// Return response
-	c.JSON(http.StatusOK, models.VehicleResponse{
+	response := models.VehicleResponse{
 		Data: vehicles,
 		Meta: *metadata,
-	})
+	}
+
+	if withFacets {
+		facets, err := repo.GetFacets(filters)
+		if err != nil {
+			c.Error(err)
+			return
+		}
+		response.Facets = facets
+	}
+
+	// Return response
+	c.JSON(http.StatusOK, response)
 }
 
 // GetVehicleByID godoc
@@ -97,34 +114,23 @@ func (h *VehicleHandler) GetVehicles(c *gin.Context) {
 // @Produce json
 // @Param id path int true "Vehicle ID"
 // @Success 200 {object} models.Vehicle
-// @Failure 400 {object} map[string]interface{} "Bad request"
-// @Failure 404 {object} map[string]interface{} "Vehicle not found"
-// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Failure 400 {object} apperr.Problem "Bad request"
+// @Failure 404 {object} apperr.Problem "Vehicle not found"
+// @Failure 500 {object} apperr.Problem "Internal server error"
 // @Router /vehicles/{id} [get]
 func (h *VehicleHandler) GetVehicleByID(c *gin.Context) {
 	// Parse ID from path parameter
 	idStr := c.Param("id")
 	id, err := strconv.Atoi(idStr)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "invalid vehicle ID",
-		})
+		c.Error(apperr.Validation("invalid vehicle ID"))
 		return
 	}
 
 	// Fetch vehicle from repository
 	vehicle, err := h.repo.GetVehicleByID(id)
 	if err != nil {
-		if err.Error() == "vehicle not found" {
-			c.JSON(http.StatusNotFound, gin.H{
-				"error": "vehicle not found",
-			})
-			return
-		}
-
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "failed to fetch vehicle",
-		})
+		c.Error(err)
 		return
 	}
 
@@ -140,8 +146,8 @@ func (h *VehicleHandler) GetVehicleByID(c *gin.Context) {
 // @Produce json
 // @Param vrm path string true "Vehicle Registration Mark"
 // @Success 200 {object} models.Vehicle
-// @Failure 404 {object} map[string]interface{} "Vehicle not found"
-// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Failure 404 {object} apperr.Problem "Vehicle not found"
+// @Failure 500 {object} apperr.Problem "Internal server error"
 // @Router /vehicles/vrm/{vrm} [get]
 func (h *VehicleHandler) GetVehicleByVRM(c *gin.Context) {
 	vrm := c.Param("vrm")
@@ -149,16 +155,7 @@ func (h *VehicleHandler) GetVehicleByVRM(c *gin.Context) {
 	// Fetch vehicle from repository
 	vehicle, err := h.repo.GetVehicleByVRM(vrm)
 	if err != nil {
-		if err.Error() == "vehicle not found" {
-			c.JSON(http.StatusNotFound, gin.H{
-				"error": "vehicle not found",
-			})
-			return
-		}
-
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "failed to fetch vehicle",
-		})
+		c.Error(err)
 		return
 	}
 
@@ -166,6 +163,27 @@ func (h *VehicleHandler) GetVehicleByVRM(c *gin.Context) {
 	c.JSON(http.StatusOK, vehicle)
 }
 
+// GetVehicleBySlug godoc
+// @Summary Get vehicle by slug
+// @Description Get a single vehicle by its listing slug, e.g. skoda-fabia-se-12v-12-12v-se-5dr-00319540
+// @Tags vehicles
+// @Accept json
+// @Produce json
+// @Param slug path string true "Vehicle slug"
+// @Success 200 {object} models.Vehicle
+// @Failure 404 {object} apperr.Problem "Vehicle not found"
+// @Failure 500 {object} apperr.Problem "Internal server error"
+// @Router /vehicles/slug/{slug} [get]
+func (h *VehicleHandler) GetVehicleBySlug(c *gin.Context) {
+	vehicle, err := h.repo.GetVehicleBySlug(c.Param("slug"))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, vehicle)
+}
+
 // GetAvailableMakes godoc
 // @Summary Get available makes
 // @Description Get a list of all available vehicle makes
@@ -173,14 +191,12 @@ func (h *VehicleHandler) GetVehicleByVRM(c *gin.Context) {
 // @Accept json
 // @Produce json
 // @Success 200 {object} map[string]interface{} "List of makes"
-// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Failure 500 {object} apperr.Problem "Internal server error"
 // @Router /vehicles/makes [get]
 func (h *VehicleHandler) GetAvailableMakes(c *gin.Context) {
 	makes, err := h.repo.GetAvailableMakes()
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "failed to fetch makes",
-		})
+		c.Error(err)
 		return
 	}
 
@@ -197,16 +213,14 @@ func (h *VehicleHandler) GetAvailableMakes(c *gin.Context) {
 // @Produce json
 // @Param make query string false "Filter by vehicle make"
 // @Success 200 {object} map[string]interface{} "List of models"
-// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Failure 500 {object} apperr.Problem "Internal server error"
 // @Router /vehicles/models [get]
 func (h *VehicleHandler) GetAvailableModels(c *gin.Context) {
 	make := c.Query("make")
 
 	models, err := h.repo.GetAvailableModels(make)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "failed to fetch models",
-		})
+		c.Error(err)
 		return
 	}
 
@@ -215,17 +229,295 @@ func (h *VehicleHandler) GetAvailableModels(c *gin.Context) {
 	})
 }
 
-// parseIntQuery parses an integer query parameter with a default value
-func parseIntQuery(c *gin.Context, key string, defaultValue int) int {
-	valueStr := c.Query(key)
-	if valueStr == "" {
-		return defaultValue
+// CreateVehicle godoc
+// @Summary Create vehicle
+// @Description Create a new vehicle listing
+// @Tags vehicles
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param vehicle body models.Vehicle true "Vehicle"
+// @Success 201 {object} models.Vehicle
+// @Failure 400 {object} apperr.Problem "Bad request"
+// @Failure 401 {object} apperr.Problem "Authentication required"
+// @Failure 403 {object} apperr.Problem "Insufficient permissions"
+// @Failure 409 {object} apperr.Problem "Vehicle already exists"
+// @Failure 500 {object} apperr.Problem "Internal server error"
+// @Router /vehicles [post]
+func (h *VehicleHandler) CreateVehicle(c *gin.Context) {
+	var vehicle models.Vehicle
+	if err := decodeStrictJSON(c, &vehicle); err != nil {
+		c.Error(apperr.Invalid(err))
+		return
+	}
+
+	if err := vehicle.Validate(); err != nil {
+		c.Error(apperr.Invalid(err))
+		return
+	}
+
+	vehicle.Source = models.VehicleSourceAPI
+
+	switch vehicle.StockStatus {
+	case "":
+		vehicle.StockStatus = models.StockStatusInStock
+	case models.StockStatusInStock, models.StockStatusInPrep:
+	default:
+		c.Error(apperr.Validation("new vehicles must start as in_stock or in_prep"))
+		return
+	}
+
+	if err := h.repo.CreateVehicle(&vehicle); err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, vehicle)
+}
+
+// UpdateVehicle godoc
+// @Summary Replace vehicle
+// @Description Replace every field of an existing vehicle listing. The site, stock status and source are kept: a different site_id, site or site_slug is rejected, as vehicles move site through POST /vehicles/{id}/transfer.
+// @Tags vehicles
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Vehicle ID"
+// @Param vehicle body models.Vehicle true "Vehicle"
+// @Success 200 {object} models.Vehicle
+// @Failure 400 {object} apperr.Problem "Bad request"
+// @Failure 401 {object} apperr.Problem "Authentication required"
+// @Failure 403 {object} apperr.Problem "Insufficient permissions"
+// @Failure 404 {object} apperr.Problem "Vehicle not found"
+// @Failure 409 {object} apperr.Problem "Vehicle already exists"
+// @Failure 500 {object} apperr.Problem "Internal server error"
+// @Router /vehicles/{id} [put]
+func (h *VehicleHandler) UpdateVehicle(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.Error(apperr.Validation("invalid vehicle ID"))
+		return
+	}
+
+	var vehicle models.Vehicle
+	if err := decodeStrictJSON(c, &vehicle); err != nil {
+		c.Error(apperr.Invalid(err))
+		return
+	}
+
+	if vehicle.VehicleID != 0 && vehicle.VehicleID != id {
+		c.Error(apperr.Validation("vehicle_id in body does not match path"))
+		return
+	}
+	vehicle.VehicleID = id
+
+	if err := vehicle.Validate(); err != nil {
+		c.Error(apperr.Invalid(err))
+		return
+	}
+
+	existing, err := h.repo.GetVehicleByID(id)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	if err := checkSiteUnchanged(existing, &vehicle); err != nil {
+		c.Error(err)
+		return
+	}
+
+	if err := h.repo.UpdateVehicle(id, &vehicle); err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, vehicle)
+}
+
+// PatchVehicle godoc
+// @Summary Update vehicle fields
+// @Description Update selected fields of an existing vehicle listing
+// @Tags vehicles
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Vehicle ID"
+// @Param vehicle body map[string]interface{} true "Fields to update"
+// @Success 200 {object} models.Vehicle
+// @Failure 400 {object} apperr.Problem "Bad request"
+// @Failure 401 {object} apperr.Problem "Authentication required"
+// @Failure 403 {object} apperr.Problem "Insufficient permissions"
+// @Failure 404 {object} apperr.Problem "Vehicle not found"
+// @Failure 409 {object} apperr.Problem "Vehicle already exists"
+// @Failure 500 {object} apperr.Problem "Internal server error"
+// @Router /vehicles/{id} [patch]
+func (h *VehicleHandler) PatchVehicle(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.Error(apperr.Validation("invalid vehicle ID"))
+		return
+	}
+
+	var patch map[string]json.RawMessage
+	if err := json.NewDecoder(c.Request.Body).Decode(&patch); err != nil {
+		c.Error(apperr.Validation("invalid JSON body"))
+		return
+	}
+
+	existing, err := h.repo.GetVehicleByID(id)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	vehicle, err := mergeVehiclePatch(existing, patch)
+	if err != nil {
+		c.Error(apperr.Invalid(err))
+		return
+	}
+
+	if err := vehicle.Validate(); err != nil {
+		c.Error(apperr.Invalid(err))
+		return
+	}
+
+	if err := h.repo.UpdateVehicle(id, vehicle); err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, vehicle)
+}
+
+// DeleteVehicle godoc
+// @Summary Delete vehicle
+// @Description Delete a vehicle listing
+// @Tags vehicles
+// @Security BearerAuth
+// @Param id path int true "Vehicle ID"
+// @Success 204 "Vehicle deleted"
+// @Failure 400 {object} apperr.Problem "Bad request"
+// @Failure 401 {object} apperr.Problem "Authentication required"
+// @Failure 403 {object} apperr.Problem "Insufficient permissions"
+// @Failure 404 {object} apperr.Problem "Vehicle not found"
+// @Failure 500 {object} apperr.Problem "Internal server error"
+// @Router /vehicles/{id} [delete]
+func (h *VehicleHandler) DeleteVehicle(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.Error(apperr.Validation("invalid vehicle ID"))
+		return
+	}
+
+	if err := h.repo.DeleteVehicle(id); err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// decodeStrictJSON decodes the request body, rejecting fields the target does not declare
+func decodeStrictJSON(c *gin.Context, target interface{}) error {
+	decoder := json.NewDecoder(c.Request.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(target); err != nil {
+		return fmt.Errorf("invalid request body: %v", err)
 	}
+	return nil
+}
 
-	value, err := strconv.Atoi(valueStr)
+// readOnlyVehicleFields lists fields that cannot be changed through PATCH. The site
+// only changes through POST /vehicles/:id/transfer.
+var readOnlyVehicleFields = map[string]bool{
+	"vehicle_id":   true,
+	"created_at":   true,
+	"updated_at":   true,
+	"source":       true,
+	"stock_status": true,
+	"site_id":      true,
+	"site":         true,
+	"site_slug":    true,
+}
+
+// checkSiteUnchanged rejects a replacement that would move a vehicle to another
+// site, which only POST /vehicles/:id/transfer may do. Blank site fields keep the
+// current site, as a blank slug keeps the current slug.
+func checkSiteUnchanged(existing, vehicle *models.Vehicle) error {
+	switch {
+	case vehicle.SiteID != nil && (existing.SiteID == nil || *vehicle.SiteID != *existing.SiteID):
+		return apperr.Validation("field %q cannot be changed; transfer the vehicle instead", "site_id")
+	case vehicle.SiteSlug != "" && vehicle.SiteSlug != existing.SiteSlug:
+		return apperr.Validation("field %q cannot be changed; transfer the vehicle instead", "site_slug")
+	case vehicle.Site != "" && vehicle.Site != existing.Site:
+		return apperr.Validation("field %q cannot be changed; transfer the vehicle instead", "site")
+	}
+	return nil
+}
+
+// mergeVehiclePatch applies a partial JSON document on top of an existing vehicle
+func mergeVehiclePatch(existing *models.Vehicle, patch map[string]json.RawMessage) (*models.Vehicle, error) {
+	current, err := json.Marshal(existing)
 	if err != nil {
-		return defaultValue
+		return nil, err
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(current, &fields); err != nil {
+		return nil, err
+	}
+
+	for key, value := range patch {
+		if _, ok := fields[key]; !ok {
+			return nil, fmt.Errorf("unknown field %q", key)
+		}
+		if readOnlyVehicleFields[key] {
+			return nil, fmt.Errorf("field %q cannot be changed", key)
+		}
+		fields[key] = value
+	}
+
+	merged, err := json.Marshal(fields)
+	if err != nil {
+		return nil, err
+	}
+
+	var vehicle models.Vehicle
+	if err := json.Unmarshal(merged, &vehicle); err != nil {
+		return nil, fmt.Errorf("invalid request body: %v", err)
+	}
+
+	return &vehicle, nil
+}
+
+// hasSortField reports whether the sort includes the named field
+func hasSortField(sort []models.SortField, name string) bool {
+	for _, field := range sort {
+		if field.Field == name {
+			return true
+		}
+	}
+	return false
+}
+
+// parseStockStatusQuery parses the stock_status filter. Sold and withdrawn stock is
+// hidden unless requested explicitly or with "all".
+func parseStockStatusQuery(value string) ([]models.StockStatus, error) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "":
+		return models.ListedStockStatuses, nil
+	case "all":
+		return nil, nil
+	}
+
+	var statuses []models.StockStatus
+	for _, part := range strings.Split(value, ",") {
+		status, err := models.ParseStockStatus(part)
+		if err != nil {
+			return nil, err
+		}
+		statuses = append(statuses, status)
 	}
 
-	return value
+	return statuses, nil
 }
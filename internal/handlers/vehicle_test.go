@@ -0,0 +1,301 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/Candoo/vehicles-api/internal/apperr"
+	"github.com/Candoo/vehicles-api/internal/middleware"
+	"github.com/Candoo/vehicles-api/internal/models"
+)
+
+func TestGetVehiclesPaginates(t *testing.T) {
+	api := newTestAPI(t, testVehicle(1, 9000), testVehicle(2, 5000), testVehicle(3, 7000))
+
+	rec := api.serve(http.MethodGet, "/vehicles?results_per_page=2&sort=price:asc", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", rec.Code, rec.Body)
+	}
+
+	var response models.VehicleResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(response.Data) != 2 || response.Data[0].VehicleID != 2 || response.Data[1].VehicleID != 3 {
+		t.Errorf("data = %+v", response.Data)
+	}
+	if response.Meta.Total != 3 || response.Meta.LastPage != 2 || response.Meta.NextCursor == "" {
+		t.Errorf("meta = %+v", response.Meta)
+	}
+}
+
+func TestGetVehiclesRejectsBadQuery(t *testing.T) {
+	api := newTestAPI(t)
+
+	for _, query := range []string{"sort=colour", "page=2&cursor=abc", "sort=relevance", "stock_status=parked", "min_year=twenty", "facets=maybe", "doors=five", "has_offer=yes", "min_mileage=9000&max_mileage=100"} {
+		if rec := api.serve(http.MethodGet, "/vehicles?"+query, nil); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want 400", query, rec.Code)
+		}
+	}
+}
+
+func TestGetVehiclesReportsEveryInvalidField(t *testing.T) {
+	api := newTestAPI(t)
+
+	rec := api.serve(http.MethodGet, "/vehicles?page=abc&min_price=9000&max_price=5000&advert_classification=Old&min_year=1800&paint=red", nil)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want 400", rec.Code)
+	}
+
+	var problem apperr.Problem
+	if err := json.Unmarshal(rec.Body.Bytes(), &problem); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+
+	got := map[string]bool{}
+	for _, fieldError := range problem.Errors {
+		if fieldError.Reason == "" {
+			t.Errorf("%s: empty reason", fieldError.Field)
+		}
+		got[fieldError.Field] = true
+	}
+	for _, field := range []string{"paint", "page", "advert_classification", "min_price", "min_year"} {
+		if !got[field] {
+			t.Errorf("no error reported for %s, got %+v", field, problem.Errors)
+		}
+	}
+	if len(problem.Errors) != 5 {
+		t.Errorf("errors = %+v, want 5", problem.Errors)
+	}
+}
+
+func TestGetVehiclesMultiValueFilters(t *testing.T) {
+	fiesta := testVehicle(1, 6000)
+	fiesta.Make, fiesta.Colour = "Ford", "Red"
+	fabia := testVehicle(2, 5000)
+	fabia.Colour = "Blue"
+	corsa := testVehicle(3, 7000)
+	corsa.Make, corsa.Colour = "Vauxhall", "Red"
+	api := newTestAPI(t, fiesta, fabia, corsa)
+
+	tests := []struct {
+		query string
+		want  []int
+	}{
+		{"make=Ford,Skoda", []int{1, 2}},
+		{"make=Ford&make=skoda", []int{1, 2}},
+		{"make=Ford,Vauxhall&colour=red", []int{3, 1}},
+		{"colour=Red,Blue&max_mileage=0", []int{3, 1, 2}},
+	}
+
+	for _, tt := range tests {
+		rec := api.serve(http.MethodGet, "/vehicles?sort=price:desc&"+tt.query, nil)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: status = %d, body %s", tt.query, rec.Code, rec.Body)
+		}
+
+		var response models.VehicleResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		var got []int
+		for _, vehicle := range response.Data {
+			got = append(got, vehicle.VehicleID)
+		}
+		if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+			t.Errorf("%s: vehicle IDs = %v, want %v", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestGetVehicleBySlug(t *testing.T) {
+	fiesta := testVehicle(1, 6000)
+	fiesta.Make, fiesta.Model = "Ford", "Fiesta"
+	api := newTestAPI(t, fiesta)
+
+	rec := api.serve(http.MethodGet, "/vehicles/slug/ford-fiesta-stk1", nil)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"vehicle_id":1`) {
+		t.Fatalf("by slug: status = %d, body %s", rec.Code, rec.Body)
+	}
+	if rec := api.serve(http.MethodGet, "/vehicles/slug/ford-focus", nil); rec.Code != http.StatusNotFound {
+		t.Errorf("unknown slug: status = %d, want 404", rec.Code)
+	}
+}
+
+func TestGetVehiclesNear(t *testing.T) {
+	winsford := testVehicle(1, 5000)
+	winsford.SiteSlug = "winsford"
+	trafford := testVehicle(2, 6000)
+	trafford.SiteSlug = "trafford"
+	api := newTestAPI(t, winsford, trafford, testVehicle(3, 7000))
+
+	// Site coordinates come from the postcode table when they are not given
+	for slug, postcode := range map[string]string{"winsford": "CW7 3QP", "trafford": "M17 1AA"} {
+		site := map[string]string{"slug": slug, "name": slug, "postcode": postcode}
+		if rec := api.serveAs(models.RoleAdmin, http.MethodPost, "/admin/sites", site); rec.Code != http.StatusCreated {
+			t.Fatalf("create %s: status = %d, body %s", slug, rec.Code, rec.Body)
+		}
+	}
+
+	nearest := func(path string) []models.Vehicle {
+		t.Helper()
+		rec := api.serve(http.MethodGet, path, nil)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: status = %d, body %s", path, rec.Code, rec.Body)
+		}
+		var response models.VehicleResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		return response.Data
+	}
+
+	vehicles := nearest("/vehicles?near=m17+1aa")
+	if len(vehicles) != 2 || vehicles[0].VehicleID != 2 || vehicles[1].VehicleID != 1 {
+		t.Fatalf("near M17 1AA = %+v", vehicles)
+	}
+	if vehicles[1].DistanceMiles == nil || *vehicles[1].DistanceMiles != 20.71 {
+		t.Errorf("distance_miles = %v, want 20.71", vehicles[1].DistanceMiles)
+	}
+	if vehicles := nearest("/vehicles?near=53.1905,-2.5196&radius=10"); len(vehicles) != 1 || vehicles[0].VehicleID != 1 {
+		t.Errorf("within 10 miles of Winsford = %+v", vehicles)
+	}
+	if vehicles := nearest("/vehicles?near=CW7+1AB&sort=distance:desc"); len(vehicles) != 2 || vehicles[0].VehicleID != 2 {
+		t.Errorf("furthest first = %+v", vehicles)
+	}
+
+	tests := map[string]string{
+		"/vehicles?near=ZZ9+9ZZ":           "near",
+		"/vehicles?near=95,0":              "near",
+		"/vehicles?radius=10":              "radius",
+		"/vehicles?near=CW7&radius=0":      "radius",
+		"/vehicles?sort=distance":          "sort",
+		"/vehicles?near=CW7&sort=distance": "",
+	}
+	for path, field := range tests {
+		rec := api.serve(http.MethodGet, path, nil)
+		if field == "" {
+			if rec.Code != http.StatusOK {
+				t.Errorf("%s: status = %d, want 200", path, rec.Code)
+			}
+			continue
+		}
+		var problem apperr.Problem
+		if err := json.Unmarshal(rec.Body.Bytes(), &problem); err != nil {
+			t.Fatalf("%s: decode: %v", path, err)
+		}
+		if rec.Code != http.StatusBadRequest || len(problem.Errors) != 1 || problem.Errors[0].Field != field {
+			t.Errorf("%s: status = %d, errors %+v, want one on %s", path, rec.Code, problem.Errors, field)
+		}
+	}
+}
+
+func TestGetVehicleByIDNotFound(t *testing.T) {
+	api := newTestAPI(t, testVehicle(1, 5000))
+
+	if rec := api.serve(http.MethodGet, "/vehicles/1", nil); rec.Code != http.StatusOK {
+		t.Errorf("existing vehicle: status = %d", rec.Code)
+	}
+	rec := api.serve(http.MethodGet, "/vehicles/2", nil)
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("missing vehicle: status = %d, want 404", rec.Code)
+	}
+	if contentType := rec.Header().Get("Content-Type"); contentType != "application/problem+json" {
+		t.Errorf("Content-Type = %q", contentType)
+	}
+
+	var problem apperr.Problem
+	if err := json.Unmarshal(rec.Body.Bytes(), &problem); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if problem.Status != http.StatusNotFound || problem.Detail != "vehicle not found" || problem.Instance != "/vehicles/2" {
+		t.Errorf("problem = %+v", problem)
+	}
+	if problem.RequestID == "" || problem.RequestID != rec.Header().Get(middleware.RequestIDHeader) {
+		t.Errorf("request_id = %q, header %q", problem.RequestID, rec.Header().Get(middleware.RequestIDHeader))
+	}
+}
+
+func TestCreateVehicle(t *testing.T) {
+	api := newTestAPI(t, testVehicle(1, 5000))
+
+	rec := api.serveAs(models.RoleStaff, http.MethodPost, "/vehicles", testVehicle(2, 6000))
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("status = %d, body %s", rec.Code, rec.Body)
+	}
+	created, err := api.vehicles.GetVehicleByID(2)
+	if err != nil {
+		t.Fatalf("GetVehicleByID: %v", err)
+	}
+	if created.Source != models.VehicleSourceAPI || created.StockStatus != models.StockStatusInStock {
+		t.Errorf("created vehicle source %q, stock_status %q", created.Source, created.StockStatus)
+	}
+
+	if rec := api.serveAs(models.RoleStaff, http.MethodPost, "/vehicles", testVehicle(1, 5000)); rec.Code != http.StatusConflict {
+		t.Errorf("duplicate: status = %d, want 409", rec.Code)
+	}
+	if rec := api.serveAs(models.RoleStaff, http.MethodPost, "/vehicles", models.Vehicle{VehicleID: 3}); rec.Code != http.StatusBadRequest {
+		t.Errorf("invalid: status = %d, want 400", rec.Code)
+	}
+
+	missingID := testVehicle(0, 5000)
+	missingID.VRM, missingID.StockID = "XY18ZZZ", "STK9"
+	if rec := api.serveAs(models.RoleStaff, http.MethodPost, "/vehicles", missingID); rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "vehicle_id") {
+		t.Errorf("missing vehicle_id: status = %d, body %s, want 400", rec.Code, rec.Body)
+	}
+	if _, err := api.vehicles.GetVehicleByID(0); err == nil {
+		t.Error("vehicle 0 was created")
+	}
+}
+
+func TestPatchVehicleRecordsPriceChange(t *testing.T) {
+	api := newTestAPI(t, testVehicle(1, 5000))
+
+	rec := api.serveAs(models.RoleStaff, http.MethodPatch, "/vehicles/1", map[string]string{"price": "4599.00"})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", rec.Code, rec.Body)
+	}
+
+	history, err := api.vehicles.GetPriceHistory(1)
+	if err != nil {
+		t.Fatalf("GetPriceHistory: %v", err)
+	}
+	if len(history) != 1 || history[0].NewPrice != models.MoneyFromPounds(4599) {
+		t.Errorf("price history = %+v", history)
+	}
+
+	if rec := api.serveAs(models.RoleStaff, http.MethodPatch, "/vehicles/1", map[string]string{"stock_status": "sold"}); rec.Code != http.StatusBadRequest {
+		t.Errorf("read-only field: status = %d, want 400", rec.Code)
+	}
+}
+
+func TestVehicleSiteIsReadOnly(t *testing.T) {
+	api := newTestAPI(t, testVehicle(1, 5000))
+
+	for _, field := range []string{"site_id", "site", "site_slug"} {
+		if rec := api.serveAs(models.RoleStaff, http.MethodPatch, "/vehicles/1", map[string]interface{}{field: nil}); rec.Code != http.StatusBadRequest {
+			t.Errorf("patch %s: status = %d, want 400", field, rec.Code)
+		}
+	}
+
+	moved := testVehicle(1, 5000)
+	moved.SiteSlug = "northwich"
+	if rec := api.serveAs(models.RoleStaff, http.MethodPut, "/vehicles/1", moved); rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "site_slug") {
+		t.Errorf("put another site: status = %d, body %s, want 400", rec.Code, rec.Body)
+	}
+
+	// A vehicle fetched and sent back unchanged keeps its site
+	rec := api.serve(http.MethodGet, "/vehicles/1", nil)
+	var current map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &current); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	current["price"] = "4500.00"
+	delete(current, "relevance")
+	if rec := api.serveAs(models.RoleStaff, http.MethodPut, "/vehicles/1", current); rec.Code != http.StatusOK {
+		t.Errorf("put round trip: status = %d, body %s", rec.Code, rec.Body)
+	}
+}
@@ -0,0 +1,313 @@
+package handlers
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/Candoo/vehicles-api/internal/apperr"
+	"github.com/Candoo/vehicles-api/internal/auth"
+	"github.com/Candoo/vehicles-api/internal/models"
+	"github.com/Candoo/vehicles-api/internal/repository"
+	"github.com/Candoo/vehicles-api/internal/webhook"
+	"github.com/gin-gonic/gin"
+)
+
+// webhookDeliveryQueryKeys lists the query parameters accepted by the delivery log
+var webhookDeliveryQueryKeys = []string{"page", "results_per_page", "status", "event"}
+
+// WebhookHandler handles HTTP requests for webhook endpoints and their deliveries
+type WebhookHandler struct {
+	repo repository.WebhookStore
+	now  func() time.Time
+}
+
+// NewWebhookHandler creates a new webhook handler
+func NewWebhookHandler(repo repository.WebhookStore) *WebhookHandler {
+	return &WebhookHandler{repo: repo, now: time.Now}
+}
+
+// CreateWebhookEndpoint godoc
+// @Summary Register webhook
+// @Description Register an endpoint to receive the vehicle events it subscribes to, or "*" for every event. Deliveries are signed with the returned secret, which is shown once and cannot be retrieved later.
+// @Tags webhooks
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param webhook body models.WebhookEndpointRequest true "Endpoint URL and events"
+// @Success 201 {object} models.CreateWebhookEndpointResponse
+// @Failure 400 {object} apperr.Problem "Bad request"
+// @Failure 401 {object} apperr.Problem "Authentication required"
+// @Failure 403 {object} apperr.Problem "Insufficient permissions"
+// @Failure 500 {object} apperr.Problem "Internal server error"
+// @Router /admin/webhooks [post]
+func (h *WebhookHandler) CreateWebhookEndpoint(c *gin.Context) {
+	var req models.WebhookEndpointRequest
+	if err := decodeStrictJSON(c, &req); err != nil {
+		c.Error(apperr.Invalid(err))
+		return
+	}
+	if err := req.Validate(); err != nil {
+		c.Error(apperr.Invalid(err))
+		return
+	}
+
+	secret, err := webhook.NewSecret()
+	if err != nil {
+		c.Error(fmt.Errorf("failed to generate webhook secret: %w", err))
+		return
+	}
+
+	endpoint := models.WebhookEndpoint{
+		URL:         req.URL,
+		Description: req.Description,
+		Events:      req.Events,
+		Secret:      secret,
+		CreatedBy:   auth.FromContext(c.Request.Context()).Subject,
+	}
+	if err := h.repo.CreateWebhookEndpoint(&endpoint); err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, models.CreateWebhookEndpointResponse{
+		WebhookEndpoint: endpoint,
+		Secret:          secret,
+	})
+}
+
+// ListWebhookEndpoints godoc
+// @Summary List webhooks
+// @Description List every registered webhook endpoint. Secrets are never returned.
+// @Tags webhooks
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} map[string]interface{} "Webhook endpoints"
+// @Failure 401 {object} apperr.Problem "Authentication required"
+// @Failure 403 {object} apperr.Problem "Insufficient permissions"
+// @Failure 500 {object} apperr.Problem "Internal server error"
+// @Router /admin/webhooks [get]
+func (h *WebhookHandler) ListWebhookEndpoints(c *gin.Context) {
+	endpoints, err := h.repo.ListWebhookEndpoints()
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"webhooks": endpoints,
+	})
+}
+
+// GetWebhookEndpoint godoc
+// @Summary Get webhook
+// @Description Get a registered webhook endpoint
+// @Tags webhooks
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Webhook ID"
+// @Success 200 {object} models.WebhookEndpoint
+// @Failure 400 {object} apperr.Problem "Invalid webhook ID"
+// @Failure 401 {object} apperr.Problem "Authentication required"
+// @Failure 403 {object} apperr.Problem "Insufficient permissions"
+// @Failure 404 {object} apperr.Problem "Webhook not found"
+// @Failure 500 {object} apperr.Problem "Internal server error"
+// @Router /admin/webhooks/{id} [get]
+func (h *WebhookHandler) GetWebhookEndpoint(c *gin.Context) {
+	endpoint, ok := h.endpoint(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, endpoint)
+}
+
+// DeleteWebhookEndpoint godoc
+// @Summary Delete webhook
+// @Description Stop sending events to a webhook endpoint, discarding its pending deliveries, delivery log and dead letters
+// @Tags webhooks
+// @Security BearerAuth
+// @Param id path int true "Webhook ID"
+// @Success 204 "Webhook deleted"
+// @Failure 400 {object} apperr.Problem "Invalid webhook ID"
+// @Failure 401 {object} apperr.Problem "Authentication required"
+// @Failure 403 {object} apperr.Problem "Insufficient permissions"
+// @Failure 404 {object} apperr.Problem "Webhook not found"
+// @Failure 500 {object} apperr.Problem "Internal server error"
+// @Router /admin/webhooks/{id} [delete]
+func (h *WebhookHandler) DeleteWebhookEndpoint(c *gin.Context) {
+	id, ok := webhookID(c)
+	if !ok {
+		return
+	}
+
+	if err := h.repo.DeleteWebhookEndpoint(id); err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// GetWebhookDeliveries godoc
+// @Summary Get webhook delivery log
+// @Description Get the deliveries of events to a webhook endpoint, newest first, with the outcome of their latest attempt
+// @Tags webhooks
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Webhook ID"
+// @Param page query int false "Page number" default(1)
+// @Param results_per_page query int false "Results per page (1-100)" default(20)
+// @Param status query string false "Comma separated delivery statuses (pending, delivered, dead)"
+// @Param event query string false "Comma separated event types"
+// @Success 200 {object} models.WebhookDeliveryResponse
+// @Failure 400 {object} apperr.Problem "Bad request"
+// @Failure 401 {object} apperr.Problem "Authentication required"
+// @Failure 403 {object} apperr.Problem "Insufficient permissions"
+// @Failure 404 {object} apperr.Problem "Webhook not found"
+// @Failure 500 {object} apperr.Problem "Internal server error"
+// @Router /admin/webhooks/{id}/deliveries [get]
+func (h *WebhookHandler) GetWebhookDeliveries(c *gin.Context) {
+	endpoint, ok := h.endpoint(c)
+	if !ok {
+		return
+	}
+
+	filters, err := parseWebhookDeliveryFilters(c.Request.URL.Query())
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	filters.EndpointID = endpoint.ID
+
+	deliveries, metadata, err := h.repo.ListWebhookDeliveries(filters)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.WebhookDeliveryResponse{
+		Data: deliveries,
+		Meta: *metadata,
+	})
+}
+
+// GetWebhookDeadLetters godoc
+// @Summary Get webhook dead letters
+// @Description Get the deliveries to a webhook endpoint that ran out of attempts, newest first
+// @Tags webhooks
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Webhook ID"
+// @Success 200 {object} map[string]interface{} "Dead letters"
+// @Failure 400 {object} apperr.Problem "Invalid webhook ID"
+// @Failure 401 {object} apperr.Problem "Authentication required"
+// @Failure 403 {object} apperr.Problem "Insufficient permissions"
+// @Failure 404 {object} apperr.Problem "Webhook not found"
+// @Failure 500 {object} apperr.Problem "Internal server error"
+// @Router /admin/webhooks/{id}/dead-letters [get]
+func (h *WebhookHandler) GetWebhookDeadLetters(c *gin.Context) {
+	endpoint, ok := h.endpoint(c)
+	if !ok {
+		return
+	}
+
+	deadLetters, err := h.repo.ListWebhookDeadLetters(endpoint.ID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"dead_letters": deadLetters,
+	})
+}
+
+// RetryWebhookDeadLetter godoc
+// @Summary Retry webhook dead letter
+// @Description Queue a dead delivery to be sent again straight away, with a fresh set of attempts
+// @Tags webhooks
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Dead letter ID"
+// @Success 202 {object} models.WebhookDelivery
+// @Failure 400 {object} apperr.Problem "Invalid dead letter ID"
+// @Failure 401 {object} apperr.Problem "Authentication required"
+// @Failure 403 {object} apperr.Problem "Insufficient permissions"
+// @Failure 404 {object} apperr.Problem "Dead letter not found"
+// @Failure 500 {object} apperr.Problem "Internal server error"
+// @Router /admin/webhook-dead-letters/{id}/retry [post]
+func (h *WebhookHandler) RetryWebhookDeadLetter(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.Error(apperr.Validation("invalid dead letter ID"))
+		return
+	}
+
+	delivery, err := h.repo.RetryWebhookDeadLetter(uint(id), h.now())
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, delivery)
+}
+
+// endpoint fetches the webhook endpoint named by the id path parameter, writing
+// the error when it cannot
+func (h *WebhookHandler) endpoint(c *gin.Context) (*models.WebhookEndpoint, bool) {
+	id, ok := webhookID(c)
+	if !ok {
+		return nil, false
+	}
+
+	endpoint, err := h.repo.GetWebhookEndpoint(id)
+	if err != nil {
+		c.Error(err)
+		return nil, false
+	}
+	return endpoint, true
+}
+
+// webhookID parses the id path parameter of a webhook route
+func webhookID(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.Error(apperr.Validation("invalid webhook ID"))
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// parseWebhookDeliveryFilters parses the query of the delivery log
+func parseWebhookDeliveryFilters(values url.Values) (models.WebhookDeliveryFilters, error) {
+	p := newQueryParser(values, webhookDeliveryQueryKeys)
+
+	filters := models.WebhookDeliveryFilters{
+		Page:           p.integer("page", 1, 1, math.MaxInt32),
+		ResultsPerPage: p.integer("results_per_page", 20, 1, 100),
+	}
+
+	for _, value := range p.list("status") {
+		status, err := models.ParseWebhookDeliveryStatus(value)
+		if err != nil {
+			p.fail("status", "%s", err.Error())
+			continue
+		}
+		filters.Statuses = append(filters.Statuses, status)
+	}
+
+	for _, value := range p.list("event") {
+		eventType, err := models.ParseEventType(value)
+		if err != nil {
+			p.fail("event", "%s", err.Error())
+			continue
+		}
+		filters.EventTypes = append(filters.EventTypes, eventType)
+	}
+
+	return filters, p.err()
+}
@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Candoo/vehicles-api/internal/models"
+	"github.com/Candoo/vehicles-api/internal/webhook"
+)
+
+// registerWebhook registers an endpoint at url for eventTypes
+func registerWebhook(t *testing.T, api *testAPI, url string, eventTypes ...string) models.CreateWebhookEndpointResponse {
+	t.Helper()
+	rec := api.serveAs(models.RoleAdmin, http.MethodPost, "/admin/webhooks", map[string]interface{}{
+		"url":         url,
+		"description": "CRM",
+		"events":      eventTypes,
+	})
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("register: status = %d, body %s", rec.Code, rec.Body)
+	}
+	var registered models.CreateWebhookEndpointResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &registered); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	return registered
+}
+
+func TestCreateWebhookEndpoint(t *testing.T) {
+	api := newTestAPI(t)
+
+	registered := registerWebhook(t, api, "https://crm.example.com/hooks", "vehicle.price_changed", "Vehicle.Sold")
+	if !strings.HasPrefix(registered.Secret, webhook.SecretPrefix) || len(registered.Events) != 2 || registered.Events[1] != "vehicle.sold" {
+		t.Errorf("registered = %+v", registered)
+	}
+
+	// The secret is only shown when the endpoint is registered
+	path := fmt.Sprintf("/admin/webhooks/%d", registered.ID)
+	if rec := api.serveAs(models.RoleAdmin, http.MethodGet, path, nil); rec.Code != http.StatusOK || strings.Contains(rec.Body.String(), registered.Secret) {
+		t.Errorf("get: status = %d, body %s, want no secret", rec.Code, rec.Body)
+	}
+	if rec := api.serveAs(models.RoleAdmin, http.MethodGet, "/admin/webhooks", nil); rec.Code != http.StatusOK || strings.Contains(rec.Body.String(), registered.Secret) {
+		t.Errorf("list: status = %d, body %s, want no secret", rec.Code, rec.Body)
+	}
+}
+
+func TestCreateWebhookEndpointRejectsInvalidRequests(t *testing.T) {
+	api := newTestAPI(t)
+
+	for name, body := range map[string]interface{}{
+		"no events":     map[string]interface{}{"url": "https://crm.example.com/hooks"},
+		"unknown event": map[string]interface{}{"url": "https://crm.example.com/hooks", "events": []string{"vehicle.crashed"}},
+		"bad url":       map[string]interface{}{"url": "ftp://example.com", "events": []string{"*"}},
+	} {
+		if rec := api.serveAs(models.RoleAdmin, http.MethodPost, "/admin/webhooks", body); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want 400", name, rec.Code)
+		}
+	}
+}
+
+func TestGetWebhookDeliveries(t *testing.T) {
+	var received []models.VehicleEvent
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var event models.VehicleEvent
+		if err := json.NewDecoder(req.Body).Decode(&event); err != nil {
+			t.Errorf("receiver: %v", err)
+		}
+		received = append(received, event)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer receiver.Close()
+
+	api := newTestAPI(t, testVehicle(1, 5000))
+	path := fmt.Sprintf("/admin/webhooks/%d", registerWebhook(t, api, receiver.URL, "vehicle.price_changed").ID)
+
+	// Only the price change is subscribed to, not the update that comes with it
+	if rec := api.serveAs(models.RoleStaff, http.MethodPatch, "/vehicles/1", map[string]string{"price": "4599.00"}); rec.Code != http.StatusOK {
+		t.Fatalf("patch: status = %d, body %s", rec.Code, rec.Body)
+	}
+	api.publish()
+	if _, err := webhook.NewWorker(api.webhooks, 3, time.Second).Run(context.Background()); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if len(received) != 1 || received[0].Type != models.EventVehiclePriceChanged || received[0].NewPrice.String() != "4599.00" {
+		t.Fatalf("received = %+v", received)
+	}
+
+	rec := api.serveAs(models.RoleAdmin, http.MethodGet, path+"/deliveries?status=delivered", nil)
+	var log models.WebhookDeliveryResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &log); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if rec.Code != http.StatusOK || log.Meta.Total != 1 || log.Data[0].EventID != received[0].ID || log.Data[0].ResponseStatus != http.StatusNoContent {
+		t.Errorf("delivery log: status = %d, body %s", rec.Code, rec.Body)
+	}
+	if rec := api.serveAs(models.RoleAdmin, http.MethodGet, path+"/deliveries?status=lost", nil); rec.Code != http.StatusBadRequest {
+		t.Errorf("bad status filter: status = %d, want 400", rec.Code)
+	}
+}
+
+func TestGetWebhookDeadLetters(t *testing.T) {
+	api := newTestAPI(t)
+	path := fmt.Sprintf("/admin/webhooks/%d", registerWebhook(t, api, "https://crm.example.com/hooks", "*").ID)
+
+	if rec := api.serveAs(models.RoleAdmin, http.MethodGet, path+"/dead-letters", nil); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"dead_letters":[]`) {
+		t.Errorf("dead letters: status = %d, body %s", rec.Code, rec.Body)
+	}
+	if rec := api.serveAs(models.RoleAdmin, http.MethodPost, "/admin/webhook-dead-letters/9/retry", nil); rec.Code != http.StatusNotFound {
+		t.Errorf("retry unknown dead letter: status = %d, want 404", rec.Code)
+	}
+}
+
+func TestDeleteWebhookEndpoint(t *testing.T) {
+	api := newTestAPI(t)
+	path := fmt.Sprintf("/admin/webhooks/%d", registerWebhook(t, api, "https://crm.example.com/hooks", "*").ID)
+
+	if rec := api.serveAs(models.RoleAdmin, http.MethodDelete, path, nil); rec.Code != http.StatusNoContent {
+		t.Errorf("delete: status = %d", rec.Code)
+	}
+	if rec := api.serveAs(models.RoleAdmin, http.MethodGet, path+"/deliveries", nil); rec.Code != http.StatusNotFound {
+		t.Errorf("deliveries of deleted webhook: status = %d, want 404", rec.Code)
+	}
+}
@@ -0,0 +1,18 @@
+// Package ids generates the unguessable identifiers given to bookings, reservations
+// and events.
+package ids
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+)
+
+// New returns a random identifier of the form <prefix>_<24 hex characters>
+func New(prefix string) (string, error) {
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate %s ID: %w", prefix, err)
+	}
+	return prefix + "_" + hex.EncodeToString(b), nil
+}
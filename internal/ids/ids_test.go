@@ -0,0 +1,26 @@
+package ids
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestNew(t *testing.T) {
+	format := regexp.MustCompile(`^rs_[0-9a-f]{24}$`)
+
+	first, err := New("rs")
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	second, err := New("rs")
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	if !format.MatchString(first) {
+		t.Errorf("New() = %q, want rs_ and 24 hex characters", first)
+	}
+	if first == second {
+		t.Errorf("New() returned %q twice", first)
+	}
+}
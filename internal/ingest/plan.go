@@ -0,0 +1,160 @@
+package ingest
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/Candoo/vehicles-api/internal/models"
+)
+
+// Plan lists the changes needed to bring stored feed vehicles in line with the feed
+type Plan struct {
+	Inserts   []models.Vehicle
+	Updates   []models.Vehicle
+	Removals  []int
+	Unchanged int
+	// Conflicts are the feed vehicles left out because they clash with a vehicle
+	// that did not come from the feed
+	Conflicts []Conflict
+}
+
+// Conflict is a feed vehicle the plan leaves out
+type Conflict struct {
+	VehicleID int
+	Reason    string
+}
+
+// BuildPlan compares the feed against every stored vehicle. Vehicles are matched on
+// vehicle_id first and stock_id second; a stock_id match keeps the stored vehicle_id.
+// When the feed repeats a vehicle, by either, the first occurrence wins.
+// The feed only changes vehicles it created: a feed vehicle matching a vehicle added
+// through the API, or a new one whose VRM is already listed, is a conflict and left out.
+// Stored feed vehicles missing from the feed are removed unless already withdrawn or sold.
+// The feed never changes stock_status; a withdrawn vehicle that reappears is updated
+// but has to be put back on sale through the status endpoint. A vehicle keeps the
+// slug it was listed under so its URL stays stable, and keeps its site and location,
+// which change through transfers.
+func BuildPlan(existing []models.Vehicle, feed []models.Vehicle) Plan {
+	byID := make(map[int]*models.Vehicle, len(existing))
+	byStockID := make(map[string]*models.Vehicle, len(existing))
+	byVRM := make(map[string]*models.Vehicle, len(existing))
+	for i := range existing {
+		byID[existing[i].VehicleID] = &existing[i]
+		if existing[i].StockID != "" {
+			byStockID[existing[i].StockID] = &existing[i]
+		}
+		if existing[i].VRM != "" {
+			byVRM[strings.ToLower(existing[i].VRM)] = &existing[i]
+		}
+	}
+
+	var plan Plan
+	seen := make(map[int]bool, len(feed))
+	insertedIDs := make(map[int]bool)
+	insertedStockIDs := make(map[string]bool)
+
+	for _, incoming := range feed {
+		incoming.Source = models.VehicleSourceFeed
+
+		current, ok := byID[incoming.VehicleID]
+		if !ok && incoming.StockID != "" {
+			current, ok = byStockID[incoming.StockID]
+		}
+
+		if ok && current.Source != models.VehicleSourceFeed {
+			plan.Conflicts = append(plan.Conflicts, Conflict{
+				VehicleID: incoming.VehicleID,
+				Reason:    fmt.Sprintf("matches vehicle %d, which was not added by the feed", current.VehicleID),
+			})
+			continue
+		}
+
+		if !ok {
+			if listed, taken := byVRM[strings.ToLower(incoming.VRM)]; taken && incoming.VRM != "" {
+				plan.Conflicts = append(plan.Conflicts, Conflict{
+					VehicleID: incoming.VehicleID,
+					Reason:    fmt.Sprintf("VRM %s is already listed as vehicle %d", incoming.VRM, listed.VehicleID),
+				})
+				continue
+			}
+			if insertedIDs[incoming.VehicleID] || (incoming.StockID != "" && insertedStockIDs[incoming.StockID]) {
+				// The feed repeats a new vehicle; the first occurrence wins
+				continue
+			}
+			insertedIDs[incoming.VehicleID] = true
+			if incoming.StockID != "" {
+				insertedStockIDs[incoming.StockID] = true
+			}
+			plan.Inserts = append(plan.Inserts, incoming)
+			continue
+		}
+
+		if seen[current.VehicleID] {
+			// The feed repeats a vehicle; the first occurrence wins
+			continue
+		}
+		seen[current.VehicleID] = true
+
+		incoming.VehicleID = current.VehicleID
+		incoming.Slug = current.Slug
+		incoming.SiteID, incoming.Site, incoming.SiteSlug = current.SiteID, current.Site, current.SiteSlug
+		incoming.Location, incoming.LocationSlug = current.Location, current.LocationSlug
+		if vehicleChanged(current, &incoming) {
+			plan.Updates = append(plan.Updates, incoming)
+		} else {
+			plan.Unchanged++
+		}
+	}
+
+	for _, vehicle := range existing {
+		if seen[vehicle.VehicleID] || vehicle.Source != models.VehicleSourceFeed {
+			continue
+		}
+		if vehicle.StockStatus == models.StockStatusWithdrawn || vehicle.StockStatus == models.StockStatusSold {
+			continue
+		}
+		plan.Removals = append(plan.Removals, vehicle.VehicleID)
+	}
+
+	return plan
+}
+
+// vehicleChanged reports whether the feed copy of a vehicle differs from the stored one
+// in any field the feed controls
+func vehicleChanged(stored, incoming *models.Vehicle) bool {
+	return !reflect.DeepEqual(comparable(stored), comparable(incoming))
+}
+
+// comparable normalises a vehicle for comparison by dropping fields the feed does not
+// control and smoothing over differences introduced by the database round trip
+func comparable(vehicle *models.Vehicle) map[string]interface{} {
+	normalised := *vehicle
+	normalised.CreatedAt = time.Time{}
+	normalised.UpdatedAt = time.Time{}
+	normalised.Relevance = 0
+	normalised.DistanceMiles = nil
+	normalised.Source = ""
+	normalised.StockStatus = ""
+
+	// Dates come back from Postgres as timestamps
+	if normalised.DateFirstRegistered != nil && len(*normalised.DateFirstRegistered) > 10 {
+		date := (*normalised.DateFirstRegistered)[:10]
+		normalised.DateFirstRegistered = &date
+	}
+
+	data, _ := json.Marshal(normalised)
+	var fields map[string]interface{}
+	_ = json.Unmarshal(data, &fields)
+
+	// Treat empty and null arrays alike
+	for key, value := range fields {
+		if list, ok := value.([]interface{}); ok && len(list) == 0 {
+			fields[key] = nil
+		}
+	}
+
+	return fields
+}
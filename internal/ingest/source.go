@@ -0,0 +1,110 @@
+package ingest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/Candoo/vehicles-api/internal/models"
+)
+
+// Source supplies a complete NexusPoint-format vehicle feed
+type Source interface {
+	// Fetch returns every vehicle currently in the feed
+	Fetch(ctx context.Context) ([]models.Vehicle, error)
+	// Name describes the source for logs and sync run records
+	Name() string
+}
+
+// HTTPSource fetches the feed from a URL
+type HTTPSource struct {
+	URL    string
+	Client *http.Client
+}
+
+// NewHTTPSource creates a source reading the feed from a URL
+func NewHTTPSource(url string) *HTTPSource {
+	return &HTTPSource{
+		URL:    url,
+		Client: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// Fetch downloads and decodes the feed
+func (s *HTTPSource) Fetch(ctx context.Context) ([]models.Vehicle, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.URL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build feed request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch feed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch feed: unexpected status %d", resp.StatusCode)
+	}
+
+	return decodeFeed(resp.Body)
+}
+
+// Name returns the feed URL
+func (s *HTTPSource) Name() string {
+	return s.URL
+}
+
+// FileSource reads the feed from a local JSON file
+type FileSource struct {
+	Path string
+}
+
+// NewFileSource creates a source reading the feed from a file
+func NewFileSource(path string) *FileSource {
+	return &FileSource{Path: path}
+}
+
+// Fetch reads and decodes the feed file
+func (s *FileSource) Fetch(ctx context.Context) ([]models.Vehicle, error) {
+	file, err := os.Open(s.Path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open feed file: %w", err)
+	}
+	defer file.Close()
+
+	return decodeFeed(file)
+}
+
+// Name returns the feed file path
+func (s *FileSource) Name() string {
+	return s.Path
+}
+
+// decodeFeed decodes a NexusPoint feed, which is either a bare array of vehicles
+// or an API page wrapping them in a data field
+func decodeFeed(r io.Reader) ([]models.Vehicle, error) {
+	body, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read feed: %w", err)
+	}
+
+	var vehicles []models.Vehicle
+	if err := json.Unmarshal(body, &vehicles); err == nil {
+		return vehicles, nil
+	}
+
+	var page struct {
+		Data []models.Vehicle `json:"data"`
+	}
+	if err := json.Unmarshal(body, &page); err != nil {
+		return nil, fmt.Errorf("failed to decode feed: %w", err)
+	}
+
+	return page.Data, nil
+}
@@ -0,0 +1,108 @@
+package ingest
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/Candoo/vehicles-api/internal/models"
+)
+
+// Store is the persistence the syncer needs
+type Store interface {
+	// ListAllVehicles returns every stored vehicle, whatever its source or stock status
+	ListAllVehicles() ([]models.Vehicle, error)
+	// ApplyFeedSync inserts, replaces and removes vehicles in a single transaction,
+	// returning the changes it applied
+	ApplyFeedSync(inserts, updates []models.Vehicle, removals []int) (models.FeedSyncCounts, error)
+	// CreateFeedSyncRun records the outcome of a sync run
+	CreateFeedSyncRun(run *models.FeedSyncRun) error
+}
+
+// Syncer pulls the feed and reconciles stored stock with it
+type Syncer struct {
+	source Source
+	store  Store
+}
+
+// NewSyncer creates a feed syncer
+func NewSyncer(source Source, store Store) *Syncer {
+	return &Syncer{source: source, store: store}
+}
+
+// Run performs one sync and records it, returning the run even when it failed
+func (s *Syncer) Run(ctx context.Context) (*models.FeedSyncRun, error) {
+	run := &models.FeedSyncRun{
+		Source:    s.source.Name(),
+		StartedAt: time.Now(),
+	}
+
+	err := s.sync(ctx, run)
+	if err != nil {
+		run.Error = err.Error()
+	}
+
+	finished := time.Now()
+	run.FinishedAt = &finished
+
+	if recordErr := s.store.CreateFeedSyncRun(run); recordErr != nil {
+		log.Printf("Warning: Failed to record feed sync run: %v", recordErr)
+	}
+
+	return run, err
+}
+
+// sync fetches the feed and applies the resulting plan, filling in the run counts
+func (s *Syncer) sync(ctx context.Context, run *models.FeedSyncRun) error {
+	feed, err := s.source.Fetch(ctx)
+	if err != nil {
+		return err
+	}
+	run.Fetched = len(feed)
+
+	existing, err := s.store.ListAllVehicles()
+	if err != nil {
+		return fmt.Errorf("failed to list vehicles: %w", err)
+	}
+
+	plan := BuildPlan(existing, feed)
+	for _, conflict := range plan.Conflicts {
+		log.Printf("Warning: Skipped feed vehicle %d: %s", conflict.VehicleID, conflict.Reason)
+	}
+
+	applied, err := s.store.ApplyFeedSync(plan.Inserts, plan.Updates, plan.Removals)
+	if err != nil {
+		return fmt.Errorf("failed to apply feed sync: %w", err)
+	}
+
+	run.Inserted = applied.Inserted
+	run.Updated = applied.Updated
+	run.Removed = applied.Removed
+	run.Unchanged = plan.Unchanged
+	run.Skipped = len(plan.Conflicts)
+
+	return nil
+}
+
+// Start runs the syncer immediately and then on every interval until the context is cancelled
+func (s *Syncer) Start(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		run, err := s.Run(ctx)
+		if err != nil {
+			log.Printf("Feed sync from %s failed: %v", run.Source, err)
+		} else {
+			log.Printf("Feed sync from %s: %d inserted, %d updated, %d removed, %d unchanged, %d skipped",
+				run.Source, run.Inserted, run.Updated, run.Removed, run.Unchanged, run.Skipped)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
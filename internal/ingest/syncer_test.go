@@ -0,0 +1,308 @@
+package ingest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Candoo/vehicles-api/internal/models"
+)
+
+// fakeStore keeps vehicles in memory. Vehicles in held stand for those held by a
+// reservation, which the sync does not withdraw.
+type fakeStore struct {
+	vehicles map[int]models.Vehicle
+	held     map[int]bool
+	runs     []models.FeedSyncRun
+}
+
+func newFakeStore(vehicles ...models.Vehicle) *fakeStore {
+	store := &fakeStore{vehicles: make(map[int]models.Vehicle), held: make(map[int]bool)}
+	for _, vehicle := range vehicles {
+		store.vehicles[vehicle.VehicleID] = vehicle
+	}
+	return store
+}
+
+func (s *fakeStore) ListAllVehicles() ([]models.Vehicle, error) {
+	var vehicles []models.Vehicle
+	for _, vehicle := range s.vehicles {
+		vehicles = append(vehicles, vehicle)
+	}
+	return vehicles, nil
+}
+
+func (s *fakeStore) ApplyFeedSync(inserts, updates []models.Vehicle, removals []int) (models.FeedSyncCounts, error) {
+	var applied models.FeedSyncCounts
+	for _, vehicle := range inserts {
+		if _, ok := s.vehicles[vehicle.VehicleID]; ok {
+			return applied, fmt.Errorf("duplicate vehicle_id %d", vehicle.VehicleID)
+		}
+	}
+	for _, vehicle := range inserts {
+		s.vehicles[vehicle.VehicleID] = vehicle
+		applied.Inserted++
+	}
+	for _, vehicle := range updates {
+		s.vehicles[vehicle.VehicleID] = vehicle
+		applied.Updated++
+	}
+	for _, id := range removals {
+		if s.held[id] {
+			continue
+		}
+		vehicle := s.vehicles[id]
+		vehicle.StockStatus = models.StockStatusWithdrawn
+		s.vehicles[id] = vehicle
+		applied.Removed++
+	}
+	return applied, nil
+}
+
+func (s *fakeStore) CreateFeedSyncRun(run *models.FeedSyncRun) error {
+	s.runs = append(s.runs, *run)
+	return nil
+}
+
+func vehicle(id int, stockID string, price int64) models.Vehicle {
+	return models.Vehicle{
+		VehicleID:   id,
+		StockID:     stockID,
+		VRM:         "VRM" + stockID,
+		Make:        "Skoda",
+		Model:       "Fabia",
+		Price:       models.MoneyFromPounds(price),
+		Status:      "FOR_SALE_RETAIL",
+		StockStatus: models.StockStatusInStock,
+		Source:      models.VehicleSourceFeed,
+	}
+}
+
+// apiVehicle is a vehicle staff added through the API
+func apiVehicle(id int, stockID string, price int64) models.Vehicle {
+	vehicle := vehicle(id, stockID, price)
+	vehicle.Source = models.VehicleSourceAPI
+	return vehicle
+}
+
+// feedServer serves the given vehicles as a NexusPoint feed
+func feedServer(t *testing.T, vehicles []models.Vehicle) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(vehicles)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestSyncerRun(t *testing.T) {
+	store := newFakeStore(
+		vehicle(1, "001", 5000),
+		vehicle(2, "002", 6000),
+		vehicle(3, "003", 7000),
+	)
+
+	server := feedServer(t, []models.Vehicle{
+		vehicle(1, "001", 5000),
+		vehicle(2, "002", 5500),
+		vehicle(4, "004", 8000),
+	})
+
+	run, err := NewSyncer(NewHTTPSource(server.URL), store).Run(context.Background())
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	if run.Fetched != 3 || run.Inserted != 1 || run.Updated != 1 || run.Removed != 1 || run.Unchanged != 1 {
+		t.Errorf("Run() counts = fetched %d, inserted %d, updated %d, removed %d, unchanged %d; want 3, 1, 1, 1, 1",
+			run.Fetched, run.Inserted, run.Updated, run.Removed, run.Unchanged)
+	}
+	if run.FinishedAt == nil || run.Error != "" {
+		t.Errorf("Run() did not finish cleanly: %+v", run)
+	}
+	if len(store.runs) != 1 {
+		t.Fatalf("recorded %d runs, want 1", len(store.runs))
+	}
+
+	if got := store.vehicles[2].Price; got != models.MoneyFromPounds(5500) {
+		t.Errorf("vehicle 2 price = %s, want 5500.00", got)
+	}
+	if got := store.vehicles[3].StockStatus; got != models.StockStatusWithdrawn {
+		t.Errorf("vehicle 3 stock_status = %q, want %q", got, models.StockStatusWithdrawn)
+	}
+	if got := store.vehicles[4].Source; got != models.VehicleSourceFeed {
+		t.Errorf("vehicle 4 source = %q, want %q", got, models.VehicleSourceFeed)
+	}
+
+	// A second run against the same feed changes nothing
+	run, err = NewSyncer(NewHTTPSource(server.URL), store).Run(context.Background())
+	if err != nil {
+		t.Fatalf("second Run() error = %v", err)
+	}
+	if run.Inserted != 0 || run.Updated != 0 || run.Removed != 0 || run.Unchanged != 3 {
+		t.Errorf("second Run() counts = inserted %d, updated %d, removed %d, unchanged %d; want 0, 0, 0, 3",
+			run.Inserted, run.Updated, run.Removed, run.Unchanged)
+	}
+}
+
+func TestSyncerRunSkipsVehiclesNotFromFeed(t *testing.T) {
+	store := newFakeStore(
+		vehicle(1, "001", 5000),
+		apiVehicle(2, "002", 6000),
+	)
+
+	server := feedServer(t, []models.Vehicle{
+		vehicle(1, "001", 5000),
+		vehicle(2, "020", 6500),
+		vehicle(3, "003", 7000),
+	})
+
+	run, err := NewSyncer(NewHTTPSource(server.URL), store).Run(context.Background())
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if run.Inserted != 1 || run.Updated != 0 || run.Removed != 0 || run.Unchanged != 1 || run.Skipped != 1 {
+		t.Errorf("Run() counts = inserted %d, updated %d, removed %d, unchanged %d, skipped %d; want 1, 0, 0, 1, 1",
+			run.Inserted, run.Updated, run.Removed, run.Unchanged, run.Skipped)
+	}
+	if got := store.vehicles[2]; got.Source != models.VehicleSourceAPI || got.Price != models.MoneyFromPounds(6000) {
+		t.Errorf("API vehicle = source %q, price %s; want it left alone", got.Source, got.Price)
+	}
+}
+
+func TestSyncerRunCountsAppliedChanges(t *testing.T) {
+	store := newFakeStore(
+		vehicle(1, "001", 5000),
+		vehicle(2, "002", 6000),
+	)
+	store.held[2] = true
+
+	server := feedServer(t, []models.Vehicle{vehicle(1, "001", 5000)})
+
+	run, err := NewSyncer(NewHTTPSource(server.URL), store).Run(context.Background())
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if run.Removed != 0 || run.Unchanged != 1 {
+		t.Errorf("Run() counts = removed %d, unchanged %d; want 0, 1", run.Removed, run.Unchanged)
+	}
+	if got := store.vehicles[2].StockStatus; got != models.StockStatusInStock {
+		t.Errorf("held vehicle stock_status = %q, want %q", got, models.StockStatusInStock)
+	}
+}
+
+func TestSyncerRunRecordsFetchFailure(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	store := newFakeStore(vehicle(1, "001", 5000))
+
+	run, err := NewSyncer(NewHTTPSource(server.URL), store).Run(context.Background())
+	if err == nil {
+		t.Fatal("Run() error = nil, want fetch failure")
+	}
+	if len(store.runs) != 1 || store.runs[0].Error == "" {
+		t.Errorf("failed run not recorded: %+v", store.runs)
+	}
+	if run.Removed != 0 || store.vehicles[1].StockStatus == models.StockStatusWithdrawn {
+		t.Error("a failed fetch must not withdraw stock")
+	}
+}
+
+func TestHTTPSourceAcceptsDataEnvelope(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"data": []models.Vehicle{vehicle(7, "007", 9000)},
+		})
+	}))
+	defer server.Close()
+
+	vehicles, err := NewHTTPSource(server.URL).Fetch(context.Background())
+	if err != nil {
+		t.Fatalf("Fetch() error = %v", err)
+	}
+	if len(vehicles) != 1 || vehicles[0].VehicleID != 7 {
+		t.Errorf("Fetch() = %+v, want vehicle 7", vehicles)
+	}
+}
+
+func TestBuildPlanMatchesOnStockID(t *testing.T) {
+	existing := []models.Vehicle{vehicle(10, "010", 5000)}
+	incoming := vehicle(99, "010", 4500)
+
+	plan := BuildPlan(existing, []models.Vehicle{incoming})
+
+	if len(plan.Inserts) != 0 || len(plan.Removals) != 0 {
+		t.Fatalf("BuildPlan() = %+v, want a single update", plan)
+	}
+	if len(plan.Updates) != 1 || plan.Updates[0].VehicleID != 10 {
+		t.Errorf("BuildPlan() updates = %+v, want vehicle 10 updated in place", plan.Updates)
+	}
+}
+
+func TestBuildPlanSkipsAlreadyWithdrawn(t *testing.T) {
+	withdrawn := vehicle(5, "005", 5000)
+	withdrawn.StockStatus = models.StockStatusWithdrawn
+
+	plan := BuildPlan([]models.Vehicle{withdrawn}, nil)
+
+	if len(plan.Removals) != 0 {
+		t.Errorf("BuildPlan() removals = %v, want none", plan.Removals)
+	}
+}
+
+func TestBuildPlanKeepsStoredSlug(t *testing.T) {
+	stored := vehicle(10, "010", 5000)
+	stored.Slug = "skoda-fabia-010-10"
+	incoming := vehicle(10, "010", 5000)
+	incoming.Slug = "skoda-fabia-010"
+
+	plan := BuildPlan([]models.Vehicle{stored}, []models.Vehicle{incoming})
+
+	if len(plan.Updates) != 0 || plan.Unchanged != 1 {
+		t.Errorf("BuildPlan() = %+v, want the vehicle unchanged", plan)
+	}
+}
+
+func TestBuildPlanSkipsVehiclesNotFromFeed(t *testing.T) {
+	existing := []models.Vehicle{apiVehicle(10, "010", 5000), vehicle(20, "020", 6000)}
+	sameVRM := vehicle(12, "012", 5000)
+	sameVRM.VRM = "vrm010"
+	feed := []models.Vehicle{
+		vehicle(10, "099", 5000), // same vehicle_id
+		vehicle(11, "010", 5000), // same stock_id
+		sameVRM,
+		vehicle(20, "020", 6000),
+	}
+
+	plan := BuildPlan(existing, feed)
+
+	if len(plan.Inserts) != 0 || len(plan.Updates) != 0 || len(plan.Removals) != 0 || plan.Unchanged != 1 {
+		t.Errorf("BuildPlan() = %+v, want only vehicle 20 unchanged", plan)
+	}
+	if len(plan.Conflicts) != 3 || plan.Conflicts[0].VehicleID != 10 || plan.Conflicts[1].VehicleID != 11 || plan.Conflicts[2].VehicleID != 12 {
+		t.Errorf("BuildPlan() conflicts = %+v, want vehicles 10, 11 and 12", plan.Conflicts)
+	}
+}
+
+func TestBuildPlanSkipsRepeatedNewVehicles(t *testing.T) {
+	feed := []models.Vehicle{
+		vehicle(1, "001", 5000),
+		vehicle(1, "001", 5100), // repeated outright
+		vehicle(2, "001", 5200), // same stock_id under another vehicle_id
+		vehicle(1, "003", 5300), // same vehicle_id under another stock_id
+		vehicle(4, "004", 5400),
+	}
+
+	plan := BuildPlan(nil, feed)
+
+	if len(plan.Inserts) != 2 || plan.Inserts[0].VehicleID != 1 || plan.Inserts[0].Price != models.MoneyFromPounds(5000) || plan.Inserts[1].VehicleID != 4 {
+		t.Errorf("BuildPlan() inserts = %+v, want vehicles 1 and 4 once each", plan.Inserts)
+	}
+}
@@ -0,0 +1,164 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/Candoo/vehicles-api/internal/apperr"
+	"github.com/Candoo/vehicles-api/internal/auth"
+	"github.com/Candoo/vehicles-api/internal/models"
+	"github.com/gin-gonic/gin"
+)
+
+// KeyStore looks up issued API keys
+type KeyStore interface {
+	FindAPIKeyByPrefix(prefix string) (*models.APIKey, error)
+	FindAPIKeyByID(id uint) (*models.APIKey, error)
+	TouchAPIKey(id uint, at time.Time) error
+}
+
+// AuthConfig configures request authentication
+type AuthConfig struct {
+	// JWTSecret verifies HS256 tokens; JWTs are rejected when empty
+	JWTSecret []byte
+	// BootstrapAdminKey is accepted as an admin credential so the first keys can be issued
+	BootstrapAdminKey string
+}
+
+// touchInterval limits how often last_used_at is written for a busy key
+const touchInterval = time.Minute
+
+// Authenticate resolves the caller from an API key or JWT and attaches the identity to
+// the request context. Requests without credentials continue as auth.Anonymous;
+// requests with bad credentials are rejected. Rejections are rendered by Errors.
+func Authenticate(keys KeyStore, cfg AuthConfig) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		credential := bearerToken(c)
+		if credential == "" {
+			c.Request = c.Request.WithContext(auth.WithIdentity(c.Request.Context(), auth.Anonymous))
+			c.Next()
+			return
+		}
+
+		identity, ok := resolveIdentity(keys, cfg, credential)
+		if !ok {
+			c.Header("WWW-Authenticate", `Bearer realm="vehicles-api"`)
+			c.Error(apperr.Unauthorized("invalid or expired credentials"))
+			c.Abort()
+			return
+		}
+
+		c.Request = c.Request.WithContext(auth.WithIdentity(c.Request.Context(), identity))
+		c.Next()
+	}
+}
+
+// RequireRole rejects callers whose role does not include the required role
+func RequireRole(required models.Role) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		identity := auth.FromContext(c.Request.Context())
+		if identity.Role.Allows(required) {
+			c.Next()
+			return
+		}
+
+		if !identity.Authenticated() {
+			c.Header("WWW-Authenticate", `Bearer realm="vehicles-api"`)
+			c.Error(apperr.Unauthorized("authentication required"))
+			c.Abort()
+			return
+		}
+
+		c.Error(apperr.Forbidden("insufficient permissions"))
+		c.Abort()
+	}
+}
+
+// bearerToken reads the credential from the Authorization or X-API-Key header
+func bearerToken(c *gin.Context) string {
+	if header := c.GetHeader("Authorization"); header != "" {
+		scheme, token, ok := strings.Cut(header, " ")
+		if ok && strings.EqualFold(scheme, "Bearer") {
+			return strings.TrimSpace(token)
+		}
+		return ""
+	}
+	return strings.TrimSpace(c.GetHeader("X-API-Key"))
+}
+
+// resolveIdentity validates a credential and returns the identity it grants
+func resolveIdentity(keys KeyStore, cfg AuthConfig, credential string) (auth.Identity, bool) {
+	if cfg.BootstrapAdminKey != "" &&
+		subtle.ConstantTimeCompare([]byte(credential), []byte(cfg.BootstrapAdminKey)) == 1 {
+		return auth.Identity{Subject: "bootstrap-admin", Role: models.RoleAdmin, Method: auth.MethodAPIKey}, true
+	}
+
+	if strings.HasPrefix(credential, auth.APIKeyPrefix) {
+		return resolveAPIKey(keys, credential)
+	}
+
+	if len(cfg.JWTSecret) == 0 {
+		return auth.Identity{}, false
+	}
+
+	claims, err := auth.VerifyJWT(credential, cfg.JWTSecret, time.Now())
+	if err != nil {
+		return auth.Identity{}, false
+	}
+
+	if claims.KeyID != 0 && !keyActive(keys, claims.KeyID) {
+		return auth.Identity{}, false
+	}
+
+	return auth.Identity{Subject: claims.Subject, Role: claims.Role, Method: auth.MethodJWT, KeyID: claims.KeyID}, true
+}
+
+// keyActive reports whether the API key a token was issued for still exists and has not
+// been revoked
+func keyActive(keys KeyStore, id uint) bool {
+	if keys == nil {
+		return false
+	}
+
+	key, err := keys.FindAPIKeyByID(id)
+	if err != nil {
+		if !errors.Is(err, apperr.ErrNotFound) {
+			log.Printf("Warning: Failed to look up API key: %v", err)
+		}
+		return false
+	}
+
+	return key.RevokedAt == nil
+}
+
+// resolveAPIKey validates an API key against the stored hash
+func resolveAPIKey(keys KeyStore, credential string) (auth.Identity, bool) {
+	prefix, err := auth.ParseAPIKey(credential)
+	if err != nil {
+		return auth.Identity{}, false
+	}
+
+	key, err := keys.FindAPIKeyByPrefix(prefix)
+	if err != nil {
+		if !errors.Is(err, apperr.ErrNotFound) {
+			log.Printf("Warning: Failed to look up API key: %v", err)
+		}
+		return auth.Identity{}, false
+	}
+
+	if key.RevokedAt != nil || !auth.MatchAPIKey(credential, key.SecretHash) {
+		return auth.Identity{}, false
+	}
+
+	now := time.Now()
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) > touchInterval {
+		if err := keys.TouchAPIKey(key.ID, now); err != nil {
+			log.Printf("Warning: %v", err)
+		}
+	}
+
+	return auth.Identity{Subject: key.Name, Role: key.Role, Method: auth.MethodAPIKey, KeyID: key.ID}, true
+}
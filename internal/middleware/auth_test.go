@@ -0,0 +1,128 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Candoo/vehicles-api/internal/apperr"
+	"github.com/Candoo/vehicles-api/internal/auth"
+	"github.com/Candoo/vehicles-api/internal/models"
+	"github.com/gin-gonic/gin"
+)
+
+type fakeKeyStore struct {
+	keys map[string]*models.APIKey
+}
+
+func (s *fakeKeyStore) FindAPIKeyByPrefix(prefix string) (*models.APIKey, error) {
+	key, ok := s.keys[prefix]
+	if !ok {
+		return nil, apperr.NotFound("api key not found")
+	}
+	return key, nil
+}
+
+func (s *fakeKeyStore) FindAPIKeyByID(id uint) (*models.APIKey, error) {
+	for _, key := range s.keys {
+		if key.ID == id {
+			return key, nil
+		}
+	}
+	return nil, apperr.NotFound("api key not found")
+}
+
+func (s *fakeKeyStore) TouchAPIKey(id uint, at time.Time) error {
+	return nil
+}
+
+func newTestRouter(t *testing.T) (*gin.Engine, *fakeKeyStore, map[models.Role]string) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	store := &fakeKeyStore{keys: map[string]*models.APIKey{}}
+	plaintext := map[models.Role]string{}
+	for i, role := range []models.Role{models.RoleStaff, models.RoleAdmin} {
+		key, prefix, err := auth.GenerateAPIKey()
+		if err != nil {
+			t.Fatalf("GenerateAPIKey: %v", err)
+		}
+		store.keys[prefix] = &models.APIKey{ID: uint(i + 1), Name: string(role), Prefix: prefix, SecretHash: auth.HashAPIKey(key), Role: role}
+		plaintext[role] = key
+	}
+
+	r := gin.New()
+	r.Use(Errors(), Authenticate(store, AuthConfig{JWTSecret: []byte("secret")}))
+	ok := func(c *gin.Context) { c.String(http.StatusOK, auth.FromContext(c.Request.Context()).Subject) }
+	r.GET("/public", ok)
+	r.POST("/staff", RequireRole(models.RoleStaff), ok)
+	r.POST("/admin", RequireRole(models.RoleAdmin), ok)
+	return r, store, plaintext
+}
+
+func TestRoleAccess(t *testing.T) {
+	r, _, keys := newTestRouter(t)
+
+	token, _ := auth.SignJWT(auth.Claims{Subject: "jwt-user", Role: models.RoleStaff, ExpiresAt: time.Now().Add(time.Minute).Unix()}, []byte("secret"))
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		header     string
+		credential string
+		want       int
+	}{
+		{"anonymous read", http.MethodGet, "/public", "", "", http.StatusOK},
+		{"anonymous write", http.MethodPost, "/staff", "", "", http.StatusUnauthorized},
+		{"staff write", http.MethodPost, "/staff", "Authorization", "Bearer " + keys[models.RoleStaff], http.StatusOK},
+		{"staff via X-API-Key", http.MethodPost, "/staff", "X-API-Key", keys[models.RoleStaff], http.StatusOK},
+		{"staff on admin route", http.MethodPost, "/admin", "Authorization", "Bearer " + keys[models.RoleStaff], http.StatusForbidden},
+		{"admin on staff route", http.MethodPost, "/staff", "Authorization", "Bearer " + keys[models.RoleAdmin], http.StatusOK},
+		{"jwt staff write", http.MethodPost, "/staff", "Authorization", "Bearer " + token, http.StatusOK},
+		{"wrong secret", http.MethodGet, "/public", "Authorization", "Bearer " + keys[models.RoleStaff] + "0", http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.path, nil)
+		if tt.header != "" {
+			req.Header.Set(tt.header, tt.credential)
+		}
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		if rec.Code != tt.want {
+			t.Errorf("%s: status = %d, want %d", tt.name, rec.Code, tt.want)
+		}
+	}
+}
+
+func TestRevokingKeyRejectsItsTokens(t *testing.T) {
+	r, store, _ := newTestRouter(t)
+
+	token, _ := auth.SignJWT(auth.Claims{Subject: "staff", Role: models.RoleStaff, KeyID: 1, ExpiresAt: time.Now().Add(time.Minute).Unix()}, []byte("secret"))
+	unknown, _ := auth.SignJWT(auth.Claims{Subject: "gone", Role: models.RoleStaff, KeyID: 99, ExpiresAt: time.Now().Add(time.Minute).Unix()}, []byte("secret"))
+
+	post := func(token string) int {
+		req := httptest.NewRequest(http.MethodPost, "/staff", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	if code := post(token); code != http.StatusOK {
+		t.Fatalf("before revoking: status = %d, want %d", code, http.StatusOK)
+	}
+	if code := post(unknown); code != http.StatusUnauthorized {
+		t.Errorf("unknown key: status = %d, want %d", code, http.StatusUnauthorized)
+	}
+
+	key, _ := store.FindAPIKeyByID(1)
+	revokedAt := time.Now()
+	key.RevokedAt = &revokedAt
+
+	if code := post(token); code != http.StatusUnauthorized {
+		t.Errorf("after revoking: status = %d, want %d", code, http.StatusUnauthorized)
+	}
+}
@@ -0,0 +1,65 @@
+package middleware
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/Candoo/vehicles-api/internal/apperr"
+	"github.com/gin-gonic/gin"
+)
+
+// problemStatuses maps error kinds onto HTTP statuses
+var problemStatuses = []struct {
+	kind   error
+	status int
+}{
+	{apperr.ErrValidation, http.StatusBadRequest},
+	{apperr.ErrUnauthorized, http.StatusUnauthorized},
+	{apperr.ErrForbidden, http.StatusForbidden},
+	{apperr.ErrNotFound, http.StatusNotFound},
+	{apperr.ErrConflict, http.StatusConflict},
+	{apperr.ErrUnavailable, http.StatusServiceUnavailable},
+	{apperr.ErrBadGateway, http.StatusBadGateway},
+	{apperr.ErrPayment, http.StatusPaymentRequired},
+}
+
+// Errors renders the last error a handler attached with c.Error as an
+// application/problem+json response. Untyped errors become a 500 without details.
+func Errors() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+
+		if len(c.Errors) == 0 || c.Writer.Written() {
+			return
+		}
+
+		err := c.Errors.Last().Err
+		status := http.StatusInternalServerError
+		for _, mapping := range problemStatuses {
+			if errors.Is(err, mapping.kind) {
+				status = mapping.status
+				break
+			}
+		}
+
+		detail := apperr.Message(err)
+		if status >= http.StatusInternalServerError {
+			log.Printf("request %s: %s %s: %v", GetRequestID(c), c.Request.Method, c.Request.URL.Path, err)
+		}
+		if detail == "" || status == http.StatusInternalServerError {
+			detail = "internal server error"
+		}
+
+		c.Header("Content-Type", "application/problem+json")
+		c.JSON(status, apperr.Problem{
+			Type:      "about:blank",
+			Title:     http.StatusText(status),
+			Status:    status,
+			Detail:    detail,
+			Instance:  c.Request.URL.Path,
+			RequestID: GetRequestID(c),
+			Errors:    apperr.Fields(err),
+		})
+	}
+}
@@ -0,0 +1,64 @@
+package models
+
+import "time"
+
+// Role grants access to a set of endpoints. Each role includes the ones below it.
+type Role string
+
+// Roles
+const (
+	RolePublic Role = "public"
+	RoleStaff  Role = "staff"
+	RoleAdmin  Role = "admin"
+)
+
+// roleRanks orders roles from least to most privileged
+var roleRanks = map[Role]int{
+	RolePublic: 0,
+	RoleStaff:  1,
+	RoleAdmin:  2,
+}
+
+// Valid reports whether r is a known role
+func (r Role) Valid() bool {
+	_, ok := roleRanks[r]
+	return ok
+}
+
+// Allows reports whether a caller with role r may use endpoints requiring role required
+func (r Role) Allows(required Role) bool {
+	rank, ok := roleRanks[r]
+	return ok && rank >= roleRanks[required]
+}
+
+// APIKey is an issued API key. Only a hash of the secret is stored.
+type APIKey struct {
+	ID         uint       `gorm:"primaryKey" json:"id"`
+	Name       string     `gorm:"type:varchar(100);not null" json:"name"`
+	Prefix     string     `gorm:"type:varchar(16);uniqueIndex;not null" json:"prefix"`
+	SecretHash string     `gorm:"type:varchar(64);not null" json:"-"`
+	Role       Role       `gorm:"type:varchar(20);not null" json:"role"`
+	CreatedBy  string     `gorm:"type:varchar(100)" json:"created_by"`
+	CreatedAt  time.Time  `gorm:"autoCreateTime" json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+}
+
+// CreateAPIKeyRequest is the body of POST /admin/api-keys
+type CreateAPIKeyRequest struct {
+	Name string `json:"name" binding:"required" example:"jane.smith"`
+	Role Role   `json:"role" binding:"required" example:"staff"`
+}
+
+// CreateAPIKeyResponse returns a newly issued key. The plaintext key is only shown once.
+type CreateAPIKeyResponse struct {
+	APIKey
+	Key string `json:"key" example:"vk_1a2b3c4d_5e6f..."`
+}
+
+// TokenResponse is returned by POST /auth/token
+type TokenResponse struct {
+	Token     string    `json:"token"`
+	TokenType string    `json:"token_type" example:"Bearer"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
@@ -0,0 +1,136 @@
+package models
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Cursor marks a position in a sorted vehicle list for keyset pagination.
+// It is handed to clients as an opaque string and holds the sort key values of the
+// boundary vehicle plus its vehicle_id as the final tiebreaker.
+type Cursor struct {
+	Sort      string            `json:"s"`
+	Values    []json.RawMessage `json:"v,omitempty"`
+	VehicleID int               `json:"id"`
+	Backward  bool              `json:"b,omitempty"`
+}
+
+// NewCursor builds a cursor positioned on the given vehicle for the active sort
+func NewCursor(vehicle *Vehicle, sort []SortField, backward bool) (*Cursor, error) {
+	cursor := &Cursor{
+		Sort:      SortSignature(sort),
+		VehicleID: vehicle.VehicleID,
+		Backward:  backward,
+	}
+
+	for _, field := range sort {
+		raw, err := json.Marshal(SortValue(vehicle, field.Field))
+		if err != nil {
+			return nil, err
+		}
+		cursor.Values = append(cursor.Values, raw)
+	}
+
+	return cursor, nil
+}
+
+// Encode serialises the cursor into an opaque URL-safe string
+func (c *Cursor) Encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// DecodeCursor parses a cursor produced by Encode and checks it belongs to the given sort
+func DecodeCursor(encoded string, sort []SortField) (*Cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, errors.New("invalid cursor")
+	}
+
+	var cursor Cursor
+	if err := json.Unmarshal(data, &cursor); err != nil {
+		return nil, errors.New("invalid cursor")
+	}
+
+	if cursor.Sort != SortSignature(sort) || len(cursor.Values) != len(sort) {
+		return nil, errors.New("cursor does not match the requested sort")
+	}
+
+	for i, field := range sort {
+		if _, err := cursor.Value(i, field.Field); err != nil {
+			return nil, errors.New("invalid cursor")
+		}
+	}
+
+	return &cursor, nil
+}
+
+// Value decodes the i-th sort key value into the Go type used by the field
+func (c *Cursor) Value(i int, field string) (interface{}, error) {
+	raw := c.Values[i]
+
+	switch field {
+	case "price":
+		var value Money
+		err := json.Unmarshal(raw, &value)
+		return value, err
+	case "odometer_value":
+		var value int
+		err := json.Unmarshal(raw, &value)
+		return value, err
+	case "created_at":
+		var value time.Time
+		err := json.Unmarshal(raw, &value)
+		return value, err
+	case "relevance", "distance":
+		var value float64
+		err := json.Unmarshal(raw, &value)
+		return value, err
+	case "year", "make", "model":
+		var value string
+		err := json.Unmarshal(raw, &value)
+		return value, err
+	default:
+		return nil, fmt.Errorf("unknown sort field %q", field)
+	}
+}
+
+// SortValue returns the value of a sortable field on a vehicle
+func SortValue(vehicle *Vehicle, field string) interface{} {
+	switch field {
+	case "price":
+		return vehicle.Price
+	case "year":
+		return vehicle.Year
+	case "odometer_value":
+		return vehicle.OdometerValue
+	case "created_at":
+		return vehicle.CreatedAt
+	case "make":
+		return vehicle.Make
+	case "model":
+		return vehicle.Model
+	case "relevance":
+		return vehicle.Relevance
+	case "distance":
+		if vehicle.DistanceMiles == nil {
+			return 0.0
+		}
+		return *vehicle.DistanceMiles
+	default:
+		return nil
+	}
+}
+
+// SortSignature identifies a sort so that cursors cannot be replayed against a different ordering
+func SortSignature(sort []SortField) string {
+	parts := make([]string, len(sort))
+	for i, field := range sort {
+		parts[i] = field.String()
+	}
+	return strings.Join(parts, ",")
+}
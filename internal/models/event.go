@@ -0,0 +1,69 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// EventType names a change to our stock that webhooks can subscribe to
+type EventType string
+
+// Event types
+const (
+	EventVehicleCreated       EventType = "vehicle.created"
+	EventVehicleUpdated       EventType = "vehicle.updated"
+	EventVehiclePriceChanged  EventType = "vehicle.price_changed"
+	EventVehicleStatusChanged EventType = "vehicle.status_changed"
+	EventVehicleSold          EventType = "vehicle.sold"
+	EventVehicleDeleted       EventType = "vehicle.deleted"
+)
+
+// EventTypes lists every event type
+var EventTypes = []EventType{
+	EventVehicleCreated,
+	EventVehicleUpdated,
+	EventVehiclePriceChanged,
+	EventVehicleStatusChanged,
+	EventVehicleSold,
+	EventVehicleDeleted,
+}
+
+// ParseEventType parses an event type name
+func ParseEventType(s string) (EventType, error) {
+	eventType := EventType(strings.ToLower(strings.TrimSpace(s)))
+	for _, known := range EventTypes {
+		if known == eventType {
+			return eventType, nil
+		}
+	}
+	return "", fmt.Errorf("unknown event type %q", s)
+}
+
+// VehicleEvent is a change to a vehicle, as delivered to webhooks. Vehicle is the
+// vehicle after the change and is absent when it was deleted. Updates carry the
+// vehicle as it was before in Previous, price changes the old and new price, and
+// status changes and sales the old and new status.
+type VehicleEvent struct {
+	ID         string      `json:"id" example:"evt_8c1f4e2a9d7b3c5e6f0a1b2c"`
+	Type       EventType   `json:"type" example:"vehicle.price_changed"`
+	OccurredAt time.Time   `json:"occurred_at"`
+	VehicleID  int         `json:"vehicle_id" example:"42"`
+	Vehicle    *Vehicle    `json:"vehicle,omitempty"`
+	Previous   *Vehicle    `json:"previous,omitempty"`
+	OldPrice   *Money      `json:"old_price,omitempty" swaggertype:"string" example:"4999.00"`
+	NewPrice   *Money      `json:"new_price,omitempty" swaggertype:"string" example:"4799.00"`
+	FromStatus StockStatus `json:"from_status,omitempty" example:"reserved"`
+	ToStatus   StockStatus `json:"to_status,omitempty" example:"sold"`
+}
+
+// OutboxEvent is a vehicle event stored in the transaction that made the change,
+// waiting to be published. Events are published in Seq order and then marked
+// published, so a change can never commit without its event.
+type OutboxEvent struct {
+	Seq         uint       `gorm:"primaryKey"`
+	EventID     string     `gorm:"type:varchar(32);uniqueIndex;not null"`
+	Payload     string     `gorm:"type:text;not null"`
+	OccurredAt  time.Time  `gorm:"not null"`
+	PublishedAt *time.Time `gorm:"index"`
+}
@@ -0,0 +1,38 @@
+package models
+
+// FacetCount is the number of vehicles sharing one value of a facet
+type FacetCount struct {
+	Value string `json:"value"`
+	Count int64  `json:"count"`
+	Min   *Money `json:"min,omitempty" swaggertype:"string"`
+	Max   *Money `json:"max,omitempty" swaggertype:"string"`
+}
+
+// Facets holds the counts shown next to each search option. Each facet is computed
+// under the active filters except its own, so selecting a make still shows the
+// counts for every other make.
+type Facets struct {
+	AdvertClassification []FacetCount `json:"advert_classification"`
+	Make                 []FacetCount `json:"make"`
+	FuelType             []FacetCount `json:"fuel_type"`
+	Transmission         []FacetCount `json:"transmission"`
+	BodyType             []FacetCount `json:"body_type"`
+	PriceBand            []FacetCount `json:"price_band"`
+	HasOffer             []FacetCount `json:"has_offer"`
+}
+
+// PriceBand is a price range used by the price_band facet. A zero Max means no upper bound.
+type PriceBand struct {
+	Label string
+	Min   Money
+	Max   Money
+}
+
+// PriceBands lists the price_band facet buckets in display order
+var PriceBands = []PriceBand{
+	{Label: "under-5000", Min: 0, Max: MoneyFromPounds(5000)},
+	{Label: "5000-10000", Min: MoneyFromPounds(5000), Max: MoneyFromPounds(10000)},
+	{Label: "10000-15000", Min: MoneyFromPounds(10000), Max: MoneyFromPounds(15000)},
+	{Label: "15000-20000", Min: MoneyFromPounds(15000), Max: MoneyFromPounds(20000)},
+	{Label: "20000-plus", Min: MoneyFromPounds(20000)},
+}
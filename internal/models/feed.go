@@ -0,0 +1,26 @@
+package models
+
+import "time"
+
+// FeedSyncCounts are the changes a feed sync applied. Updates to vehicles deleted since
+// the sync was planned, and removals of vehicles held by a reservation, are left out.
+type FeedSyncCounts struct {
+	Inserted int
+	Updated  int
+	Removed  int
+}
+
+// FeedSyncRun records the outcome of one feed synchronisation
+type FeedSyncRun struct {
+	ID         uint       `gorm:"primaryKey" json:"id"`
+	Source     string     `gorm:"type:varchar(255)" json:"source"`
+	StartedAt  time.Time  `gorm:"index" json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at"`
+	Fetched    int        `json:"fetched"`
+	Inserted   int        `json:"inserted"`
+	Updated    int        `json:"updated"`
+	Removed    int        `json:"removed"`
+	Unchanged  int        `json:"unchanged"`
+	Skipped    int        `json:"skipped"`
+	Error      string     `gorm:"type:text" json:"error,omitempty"`
+}
@@ -0,0 +1,227 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"net/mail"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// LeadStatus is where a lead is in the sales team's follow-up
+type LeadStatus string
+
+// Lead statuses
+const (
+	LeadStatusNew       LeadStatus = "new"
+	LeadStatusContacted LeadStatus = "contacted"
+	LeadStatusClosed    LeadStatus = "closed"
+)
+
+// LeadStatuses lists every lead status
+var LeadStatuses = []LeadStatus{
+	LeadStatusNew,
+	LeadStatusContacted,
+	LeadStatusClosed,
+}
+
+// leadTransitions lists the statuses each lead status may move to. Closed is final;
+// a later enquiry from the same contact opens a new lead.
+var leadTransitions = map[LeadStatus][]LeadStatus{
+	LeadStatusNew:       {LeadStatusContacted, LeadStatusClosed},
+	LeadStatusContacted: {LeadStatusClosed},
+	LeadStatusClosed:    {},
+}
+
+// ParseLeadStatus parses a lead status name
+func ParseLeadStatus(s string) (LeadStatus, error) {
+	status := LeadStatus(strings.ToLower(strings.TrimSpace(s)))
+	if _, ok := leadTransitions[status]; !ok {
+		return "", fmt.Errorf("unknown lead status %q", s)
+	}
+	return status, nil
+}
+
+// CanTransitionTo reports whether a lead may move from s to next
+func (s LeadStatus) CanTransitionTo(next LeadStatus) bool {
+	for _, allowed := range leadTransitions[s] {
+		if allowed == next {
+			return true
+		}
+	}
+	return false
+}
+
+// ContactMethod is how a customer would like to be contacted
+type ContactMethod string
+
+// Contact methods
+const (
+	ContactMethodEmail ContactMethod = "email"
+	ContactMethodPhone ContactMethod = "phone"
+)
+
+// NormalisePhone reduces a UK phone number to its digits in national format, so
+// "+44 7700 900123" and "07700 900123" compare equal
+func NormalisePhone(phone string) string {
+	digits := strings.Map(func(r rune) rune {
+		if unicode.IsDigit(r) {
+			return r
+		}
+		return -1
+	}, phone)
+
+	if strings.HasPrefix(strings.TrimSpace(phone), "+44") {
+		digits = "0" + strings.TrimPrefix(digits, "44")
+	}
+	return digits
+}
+
+// EnquiryRequest is the body of POST /vehicles/:id/enquiries. At least one of email
+// and phone is required, and the preferred contact method must have its detail.
+type EnquiryRequest struct {
+	Name                   string        `json:"name" example:"Sam Taylor"`
+	Email                  string        `json:"email" example:"sam@example.com"`
+	Phone                  string        `json:"phone" example:"07700 900123"`
+	Message                string        `json:"message" example:"Is the car still available to view on Saturday?"`
+	PreferredContactMethod ContactMethod `json:"preferred_contact_method" example:"email"`
+}
+
+// Validate checks an enquiry, normalising the email, phone and contact method and
+// defaulting the method to email when an email address is given
+func (r *EnquiryRequest) Validate() error {
+	if err := validateContact(&r.Name, &r.Email, &r.Phone); err != nil {
+		return err
+	}
+
+	r.Message = strings.TrimSpace(r.Message)
+	if len(r.Message) > 2000 {
+		return errors.New("message must be at most 2000 characters")
+	}
+
+	r.PreferredContactMethod = ContactMethod(strings.ToLower(strings.TrimSpace(string(r.PreferredContactMethod))))
+	switch r.PreferredContactMethod {
+	case "":
+		r.PreferredContactMethod = ContactMethodEmail
+		if r.Email == "" {
+			r.PreferredContactMethod = ContactMethodPhone
+		}
+	case ContactMethodEmail:
+		if r.Email == "" {
+			return errors.New("email is required when the preferred contact method is email")
+		}
+	case ContactMethodPhone:
+		if r.Phone == "" {
+			return errors.New("phone is required when the preferred contact method is phone")
+		}
+	default:
+		return errors.New("preferred_contact_method must be email or phone")
+	}
+
+	return nil
+}
+
+// validateContact checks a customer's name and that they gave a valid email address
+// or UK phone number, normalising all three
+func validateContact(name, email, phone *string) error {
+	*name = strings.TrimSpace(*name)
+	if *name == "" {
+		return errors.New("name is required")
+	}
+	if len(*name) > 100 {
+		return errors.New("name must be at most 100 characters")
+	}
+
+	*email = strings.ToLower(strings.TrimSpace(*email))
+	*phone = NormalisePhone(*phone)
+	if *email == "" && *phone == "" {
+		return errors.New("email or phone is required")
+	}
+	if *email != "" {
+		if address, err := mail.ParseAddress(*email); err != nil || address.Address != *email {
+			return errors.New("email must be a valid email address")
+		}
+	}
+	if *phone != "" && (len(*phone) < 10 || len(*phone) > 11) {
+		return errors.New("phone must be a UK phone number")
+	}
+
+	return nil
+}
+
+// Lead is a customer's interest in a vehicle, linked to the vehicle's site at the
+// time. Repeat enquiries from the same email or phone about the same vehicle are
+// added to its open lead rather than starting another.
+type Lead struct {
+	ID                     uint          `gorm:"primaryKey" json:"id"`
+	VehicleID              int           `gorm:"index;not null" json:"vehicle_id"`
+	SiteID                 *uint         `gorm:"index" json:"site_id"`
+	SiteSlug               string        `gorm:"type:varchar(100);index" json:"site_slug" example:"winsford"`
+	Name                   string        `gorm:"type:varchar(100);not null" json:"name" example:"Sam Taylor"`
+	Email                  string        `gorm:"type:varchar(255);index" json:"email,omitempty" example:"sam@example.com"`
+	Phone                  string        `gorm:"type:varchar(20);index" json:"phone,omitempty" example:"07700900123"`
+	PreferredContactMethod ContactMethod `gorm:"type:varchar(20);not null" json:"preferred_contact_method" example:"email"`
+	Status                 LeadStatus    `gorm:"type:varchar(20);not null;default:new;index" json:"status" example:"new"`
+	AssignedTo             string        `gorm:"type:varchar(100);index" json:"assigned_to,omitempty" example:"sales-winsford"`
+	EnquiryCount           int           `gorm:"not null;default:1" json:"enquiry_count" example:"1"`
+	LastEnquiryAt          time.Time     `gorm:"index" json:"last_enquiry_at"`
+	ContactedAt            *time.Time    `json:"contacted_at,omitempty"`
+	ClosedAt               *time.Time    `json:"closed_at,omitempty"`
+	CreatedAt              time.Time     `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt              time.Time     `gorm:"autoUpdateTime" json:"updated_at"`
+	Enquiries              []LeadEnquiry `gorm:"foreignKey:LeadID" json:"enquiries,omitempty"`
+}
+
+// Open reports whether the lead still takes repeat enquiries
+func (l *Lead) Open() bool {
+	return l.Status != LeadStatusClosed
+}
+
+// LeadEnquiry is one message received on a lead
+type LeadEnquiry struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	LeadID    uint      `gorm:"index;not null" json:"lead_id"`
+	Message   string    `gorm:"type:text" json:"message"`
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
+}
+
+// EnquiryReceipt is returned to the customer for an enquiry. Repeat marks an enquiry
+// added to a lead already open for the same contact and vehicle.
+type EnquiryReceipt struct {
+	LeadID     uint      `json:"lead_id" example:"12"`
+	VehicleID  int       `json:"vehicle_id" example:"42"`
+	Repeat     bool      `json:"repeat" example:"false"`
+	ReceivedAt time.Time `json:"received_at"`
+}
+
+// LeadFilters contains filtering options for lead queries. Zero values leave a
+// filter unset; Unassigned keeps only leads not assigned to anyone.
+type LeadFilters struct {
+	Page           int
+	ResultsPerPage int
+	Statuses       []LeadStatus
+	AssignedTo     string
+	Unassigned     bool
+	SiteSlugs      []string
+	VehicleID      int
+	Since          *time.Time
+}
+
+// LeadResponse represents the paginated response for leads
+type LeadResponse struct {
+	Data []Lead           `json:"data"`
+	Meta ResponseMetadata `json:"meta"`
+}
+
+// LeadStatusRequest is the body of POST /leads/:id/status. A lead marked contacted
+// while unassigned is assigned to the authenticated caller.
+type LeadStatusRequest struct {
+	Status string `json:"status" binding:"required" example:"contacted"`
+}
+
+// LeadAssignmentRequest is the body of POST /leads/:id/assign. An empty assignee
+// unassigns the lead.
+type LeadAssignmentRequest struct {
+	AssignedTo string `json:"assigned_to" example:"sales-winsford"`
+}
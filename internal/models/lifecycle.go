@@ -0,0 +1,101 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// StockStatus is the lifecycle state of a vehicle in our stock
+type StockStatus string
+
+// Stock statuses
+const (
+	StockStatusInPrep    StockStatus = "in_prep"
+	StockStatusInStock   StockStatus = "in_stock"
+	StockStatusReserved  StockStatus = "reserved"
+	StockStatusSold      StockStatus = "sold"
+	StockStatusWithdrawn StockStatus = "withdrawn"
+)
+
+// StockStatuses lists every stock status
+var StockStatuses = []StockStatus{
+	StockStatusInPrep,
+	StockStatusInStock,
+	StockStatusReserved,
+	StockStatusSold,
+	StockStatusWithdrawn,
+}
+
+// ListedStockStatuses are the statuses shown by GET /vehicles unless asked otherwise
+var ListedStockStatuses = []StockStatus{
+	StockStatusInPrep,
+	StockStatusInStock,
+	StockStatusReserved,
+}
+
+// stockTransitions lists the statuses each status may move to. Sold is final.
+var stockTransitions = map[StockStatus][]StockStatus{
+	StockStatusInPrep:    {StockStatusInStock, StockStatusWithdrawn},
+	StockStatusInStock:   {StockStatusInPrep, StockStatusReserved, StockStatusSold, StockStatusWithdrawn},
+	StockStatusReserved:  {StockStatusInStock, StockStatusSold, StockStatusWithdrawn},
+	StockStatusSold:      {},
+	StockStatusWithdrawn: {StockStatusInPrep, StockStatusInStock},
+}
+
+// ParseStockStatus parses a stock status name
+func ParseStockStatus(s string) (StockStatus, error) {
+	status := StockStatus(strings.ToLower(strings.TrimSpace(s)))
+	if _, ok := stockTransitions[status]; !ok {
+		return "", fmt.Errorf("unknown stock status %q", s)
+	}
+	return status, nil
+}
+
+// CanTransitionTo reports whether a vehicle may move from s to next
+func (s StockStatus) CanTransitionTo(next StockStatus) bool {
+	for _, allowed := range stockTransitions[s] {
+		if allowed == next {
+			return true
+		}
+	}
+	return false
+}
+
+// Listed reports whether vehicles in status s are shown in listings and can be sold
+func (s StockStatus) Listed() bool {
+	for _, listed := range ListedStockStatuses {
+		if listed == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Reservable reports whether vehicles in status s can be reserved online
+func (s StockStatus) Reservable() bool {
+	return s == StockStatusInStock
+}
+
+// VehicleStatusChange is one entry in a vehicle's lifecycle history
+type VehicleStatusChange struct {
+	ID         uint        `gorm:"primaryKey" json:"id"`
+	VehicleID  int         `gorm:"index;not null" json:"vehicle_id"`
+	FromStatus StockStatus `gorm:"type:varchar(20)" json:"from_status"`
+	ToStatus   StockStatus `gorm:"type:varchar(20);not null" json:"to_status"`
+	ChangedBy  string      `gorm:"type:varchar(100)" json:"changed_by"`
+	Reason     string      `gorm:"type:text" json:"reason,omitempty"`
+	ChangedAt  time.Time   `gorm:"autoCreateTime;index" json:"changed_at"`
+}
+
+// TableName keeps the history table name singular as it is a log
+func (VehicleStatusChange) TableName() string {
+	return "vehicle_status_history"
+}
+
+// StatusTransitionRequest is the body of POST /vehicles/:id/status. The change is
+// attributed to the authenticated caller.
+type StatusTransitionRequest struct {
+	Status string `json:"status" binding:"required" example:"reserved"`
+	Reason string `json:"reason" example:"Deposit taken over the phone"`
+}
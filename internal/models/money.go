@@ -0,0 +1,168 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Money is an amount in pence, stored as an integer column and rendered as a decimal string
+type Money int64
+
+// ParseMoney parses a decimal pounds amount such as "4799", "4799.5" or "4799.00"
+func ParseMoney(s string) (Money, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, errors.New("empty amount")
+	}
+
+	negative := false
+	if strings.HasPrefix(s, "-") {
+		negative = true
+		s = s[1:]
+	}
+
+	pounds, pence, hasPence := strings.Cut(s, ".")
+	if pounds == "" && !hasPence {
+		return 0, fmt.Errorf("invalid amount %q", s)
+	}
+	if len(pence) > 2 {
+		return 0, fmt.Errorf("invalid amount %q: more than two decimal places", s)
+	}
+	if hasPence && pence == "" {
+		return 0, fmt.Errorf("invalid amount %q", s)
+	}
+
+	var whole int64
+	if pounds != "" {
+		if !isDigits(pounds) {
+			return 0, fmt.Errorf("invalid amount %q", s)
+		}
+		var err error
+		whole, err = strconv.ParseInt(pounds, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid amount %q: %w", s, err)
+		}
+	}
+
+	var fraction int64
+	if pence != "" {
+		if !isDigits(pence) {
+			return 0, fmt.Errorf("invalid amount %q", s)
+		}
+		fraction, _ = strconv.ParseInt(pence, 10, 64)
+		if len(pence) == 1 {
+			fraction *= 10
+		}
+	}
+
+	amount := Money(whole*100 + fraction)
+	if negative {
+		amount = -amount
+	}
+	return amount, nil
+}
+
+// MoneyFromPounds converts a whole number of pounds to Money
+func MoneyFromPounds(pounds int64) Money {
+	return Money(pounds * 100)
+}
+
+// Pence returns the amount in pence
+func (m Money) Pence() int64 {
+	return int64(m)
+}
+
+// Pounds returns the amount in pounds as a float, for display and calculations only
+func (m Money) Pounds() float64 {
+	return float64(m) / 100
+}
+
+// String formats the amount with two decimal places, e.g. "4799.00"
+func (m Money) String() string {
+	sign := ""
+	value := int64(m)
+	if value < 0 {
+		sign = "-"
+		value = -value
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, value/100, value%100)
+}
+
+// MarshalJSON renders the amount as a decimal string to match the NexusPoint feed
+func (m Money) MarshalJSON() ([]byte, error) {
+	return json.Marshal(m.String())
+}
+
+// UnmarshalJSON accepts a decimal string, a JSON number or null
+func (m *Money) UnmarshalJSON(data []byte) error {
+	raw := strings.TrimSpace(string(data))
+	if raw == "null" {
+		*m = 0
+		return nil
+	}
+
+	if strings.HasPrefix(raw, `"`) {
+		var s string
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+		if strings.TrimSpace(s) == "" {
+			*m = 0
+			return nil
+		}
+		raw = s
+	}
+
+	amount, err := ParseMoney(raw)
+	if err != nil {
+		return err
+	}
+	*m = amount
+	return nil
+}
+
+// Scan implements the sql.Scanner interface
+func (m *Money) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		*m = 0
+	case int64:
+		*m = Money(v)
+	case int32:
+		*m = Money(v)
+	case []byte:
+		value, err := strconv.ParseInt(string(v), 10, 64)
+		if err != nil {
+			return fmt.Errorf("incompatible value for Money: %w", err)
+		}
+		*m = Money(value)
+	case string:
+		value, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return fmt.Errorf("incompatible value for Money: %w", err)
+		}
+		*m = Money(value)
+	default:
+		return errors.New("incompatible type for Money")
+	}
+	return nil
+}
+
+// Value implements the driver.Valuer interface
+func (m Money) Value() (driver.Value, error) {
+	return int64(m), nil
+}
+
+// isDigits reports whether s consists only of ASCII digits
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return s != ""
+}
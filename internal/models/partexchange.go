@@ -0,0 +1,113 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// VehicleCondition is a customer's description of the condition of their car
+type VehicleCondition string
+
+// Vehicle conditions, best first
+const (
+	ConditionExcellent VehicleCondition = "excellent"
+	ConditionGood      VehicleCondition = "good"
+	ConditionFair      VehicleCondition = "fair"
+	ConditionPoor      VehicleCondition = "poor"
+)
+
+// VehicleConditions lists every vehicle condition
+var VehicleConditions = []VehicleCondition{
+	ConditionExcellent,
+	ConditionGood,
+	ConditionFair,
+	ConditionPoor,
+}
+
+// vrmPattern matches a UK registration mark with the spaces removed
+var vrmPattern = regexp.MustCompile(`^[A-Z0-9]{2,8}$`)
+
+// NormaliseVRM upper-cases a registration mark and removes its spaces
+func NormaliseVRM(vrm string) string {
+	return strings.ToUpper(strings.Join(strings.Fields(vrm), ""))
+}
+
+// PartExchangeRequest is the body of POST /vehicles/:id/part-exchange. Make, model
+// and year help the valuation; the year is read from the VRM when not given.
+type PartExchangeRequest struct {
+	VRM       string           `json:"vrm" example:"BX63 NSJ"`
+	Mileage   *int             `json:"mileage" example:"48000"`
+	Condition VehicleCondition `json:"condition" example:"good"`
+	Make      string           `json:"make" example:"Skoda"`
+	Model     string           `json:"model" example:"Citigo"`
+	Year      int              `json:"year" example:"2013"`
+}
+
+// Validate checks that a part-exchange request names a car, its mileage and a known
+// condition, normalising the VRM and condition
+func (r *PartExchangeRequest) Validate() error {
+	r.VRM = NormaliseVRM(r.VRM)
+	if r.VRM == "" {
+		return errors.New("vrm is required")
+	}
+	if !vrmPattern.MatchString(r.VRM) {
+		return errors.New("vrm must be a UK registration mark")
+	}
+
+	if r.Mileage == nil {
+		return errors.New("mileage is required")
+	}
+	if *r.Mileage < 0 {
+		return errors.New("mileage must not be negative")
+	}
+
+	r.Condition = VehicleCondition(strings.ToLower(strings.TrimSpace(string(r.Condition))))
+	if !containsCondition(r.Condition) {
+		names := make([]string, len(VehicleConditions))
+		for i, condition := range VehicleConditions {
+			names[i] = string(condition)
+		}
+		return fmt.Errorf("condition must be one of %s", strings.Join(names, ", "))
+	}
+
+	if r.Year != 0 && (r.Year < 1900 || r.Year > 9999) {
+		return errors.New("year must be a four digit year")
+	}
+
+	return nil
+}
+
+// containsCondition reports whether condition is a known vehicle condition
+func containsCondition(condition VehicleCondition) bool {
+	for _, known := range VehicleConditions {
+		if condition == known {
+			return true
+		}
+	}
+	return false
+}
+
+// PartExchange is a customer's request to part-exchange their car against one of
+// ours, with the indicative value we gave. Value is empty when the car could not
+// be valued.
+type PartExchange struct {
+	ID        uint             `gorm:"primaryKey" json:"id"`
+	VehicleID int              `gorm:"index;not null" json:"vehicle_id"`
+	VRM       string           `gorm:"type:varchar(20);index;not null" json:"vrm" example:"BX63NSJ"`
+	Make      string           `gorm:"type:varchar(100)" json:"make,omitempty" example:"Skoda"`
+	Model     string           `gorm:"type:varchar(100)" json:"model,omitempty" example:"Citigo"`
+	Year      int              `json:"year,omitempty" example:"2013"`
+	Mileage   int              `gorm:"not null" json:"mileage" example:"48000"`
+	Condition VehicleCondition `gorm:"type:varchar(20);not null" json:"condition" example:"good"`
+	Value     *Money           `gorm:"type:bigint" json:"value" swaggertype:"string" example:"2150.00"`
+	Provider  string           `gorm:"type:varchar(50)" json:"provider" example:"stock-estimator"`
+	CreatedAt time.Time        `gorm:"autoCreateTime;index" json:"created_at"`
+}
+
+// TableName names the table after the requests it holds
+func (PartExchange) TableName() string {
+	return "part_exchange_requests"
+}
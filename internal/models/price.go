@@ -0,0 +1,34 @@
+package models
+
+import "time"
+
+// Price change sources
+const (
+	PriceSourceAPI  = "api"
+	PriceSourceFeed = "feed"
+)
+
+// VehiclePriceChange records one change to a vehicle's price
+type VehiclePriceChange struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	VehicleID int       `gorm:"index;not null" json:"vehicle_id"`
+	OldPrice  Money     `gorm:"type:bigint;not null" json:"old_price" swaggertype:"string" example:"4999.00"`
+	NewPrice  Money     `gorm:"type:bigint;not null" json:"new_price" swaggertype:"string" example:"4799.00"`
+	Source    string    `gorm:"type:varchar(20)" json:"source"`
+	ChangedAt time.Time `gorm:"autoCreateTime;index" json:"changed_at"`
+}
+
+// TableName keeps the history table name singular as it is a log
+func (VehiclePriceChange) TableName() string {
+	return "vehicle_price_history"
+}
+
+// PriceDrop describes a vehicle whose price is lower than it was at the start of a period
+type PriceDrop struct {
+	Vehicle          Vehicle   `json:"vehicle"`
+	PreviousPrice    Money     `json:"previous_price" swaggertype:"string" example:"4999.00"`
+	CurrentPrice     Money     `json:"current_price" swaggertype:"string" example:"4799.00"`
+	Reduction        Money     `json:"reduction" swaggertype:"string" example:"200.00"`
+	ReductionPercent float64   `json:"reduction_percent" example:"4.0"`
+	ReducedAt        time.Time `json:"reduced_at"`
+}
@@ -0,0 +1,67 @@
+package models
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+// ReservationStatus is the state of an online reservation
+type ReservationStatus string
+
+// Reservation statuses. A held reservation keeps the vehicle reserved, and so does one
+// completing, whose deposit is being taken to finish the sale.
+const (
+	ReservationStatusHeld       ReservationStatus = "held"
+	ReservationStatusCompleting ReservationStatus = "completing"
+	ReservationStatusCancelled  ReservationStatus = "cancelled"
+	ReservationStatusExpired    ReservationStatus = "expired"
+	ReservationStatusCompleted  ReservationStatus = "completed"
+)
+
+// Reservation is a customer's time-limited hold on a vehicle, secured by a deposit
+// held on their card. While it is held the vehicle is reserved; when it is
+// cancelled or expires the vehicle is back in stock and the deposit released, and
+// when the sale completes the deposit is taken and the vehicle sold. A vehicle has
+// at most one reservation holding it.
+type Reservation struct {
+	ID              uint              `gorm:"primaryKey" json:"id"`
+	Reference       string            `gorm:"type:varchar(32);uniqueIndex;not null" json:"reference" example:"rs_5d0c8e2a9b7f4c1e3a6b8d0f"`
+	VehicleID       int               `gorm:"index;uniqueIndex:idx_reservations_holding_vehicle,where:status = 'held' OR status = 'completing';not null" json:"vehicle_id"`
+	Name            string            `gorm:"type:varchar(100);not null" json:"name" example:"Sam Taylor"`
+	Email           string            `gorm:"type:varchar(255)" json:"email,omitempty" example:"sam@example.com"`
+	Phone           string            `gorm:"type:varchar(20)" json:"phone,omitempty" example:"07700900123"`
+	Deposit         Money             `gorm:"type:bigint;not null" json:"deposit" swaggertype:"string" example:"99.00"`
+	PaymentProvider string            `gorm:"type:varchar(50);not null" json:"-"`
+	PaymentHoldID   string            `gorm:"type:varchar(255);not null" json:"-"`
+	Status          ReservationStatus `gorm:"type:varchar(20);not null;default:held;index" json:"status" example:"held"`
+	ExpiresAt       time.Time         `gorm:"index;not null" json:"expires_at"`
+	EndedAt         *time.Time        `json:"ended_at,omitempty"`
+	CreatedAt       time.Time         `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt       time.Time         `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+// Held reports whether the reservation still holds the vehicle: it is held, or its
+// sale is completing
+func (r *Reservation) Held() bool {
+	return r.Status == ReservationStatusHeld || r.Status == ReservationStatusCompleting
+}
+
+// ReservationRequest is the body of POST /vehicles/:id/reservations
+type ReservationRequest struct {
+	Name  string `json:"name" example:"Sam Taylor"`
+	Email string `json:"email" example:"sam@example.com"`
+	Phone string `json:"phone" example:"07700 900123"`
+	// PaymentToken is the customer's card as tokenised by the payment provider's checkout
+	PaymentToken string `json:"payment_token" example:"tok_visa"`
+}
+
+// Validate checks that a reservation names a card and the customer's contact
+// details, normalising the contact details
+func (r *ReservationRequest) Validate() error {
+	r.PaymentToken = strings.TrimSpace(r.PaymentToken)
+	if r.PaymentToken == "" {
+		return errors.New("payment_token is required")
+	}
+	return validateContact(&r.Name, &r.Email, &r.Phone)
+}
@@ -0,0 +1,166 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/mail"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Days of the week used by opening hours, in display order
+var weekdays = []string{"monday", "tuesday", "wednesday", "thursday", "friday", "saturday", "sunday"}
+
+var clockPattern = regexp.MustCompile(`^([01][0-9]|2[0-3]):[0-5][0-9]$`)
+
+// OpeningHours are a site's hours on one day of the week. Days without an entry are closed.
+type OpeningHours struct {
+	Day    string `json:"day" example:"monday"`
+	Opens  string `json:"opens" example:"09:00"`
+	Closes string `json:"closes" example:"18:00"`
+}
+
+// OpeningHoursList is a custom type for storing a week of opening hours as JSON
+type OpeningHoursList []OpeningHours
+
+// Scan implements the sql.Scanner interface
+func (o *OpeningHoursList) Scan(src interface{}) error {
+	if src == nil {
+		*o = OpeningHoursList{}
+		return nil
+	}
+
+	var source []byte
+	switch v := src.(type) {
+	case string:
+		source = []byte(v)
+	case []byte:
+		source = v
+	default:
+		return errors.New("incompatible type for OpeningHoursList")
+	}
+
+	var hours []OpeningHours
+	if err := json.Unmarshal(source, &hours); err != nil {
+		return err
+	}
+	*o = OpeningHoursList(hours)
+	return nil
+}
+
+// Value implements the driver.Valuer interface
+func (o OpeningHoursList) Value() (driver.Value, error) {
+	if len(o) == 0 {
+		return "[]", nil
+	}
+	return json.Marshal(o)
+}
+
+// Site is one of the dealership's forecourts. Vehicles link to it through SiteID and
+// keep its name and slug in Site and SiteSlug, as the stock feed sends them.
+type Site struct {
+	ID           uint             `gorm:"primaryKey" json:"id"`
+	Slug         string           `gorm:"type:varchar(100);uniqueIndex;not null" json:"slug" example:"winsford"`
+	Name         string           `gorm:"type:varchar(100);not null" json:"name" example:"Winsford"`
+	AddressLine1 string           `gorm:"type:varchar(255)" json:"address_line1"`
+	AddressLine2 string           `gorm:"type:varchar(255)" json:"address_line2"`
+	Town         string           `gorm:"type:varchar(100)" json:"town"`
+	County       string           `gorm:"type:varchar(100)" json:"county"`
+	Postcode     string           `gorm:"type:varchar(10)" json:"postcode" example:"CW7 3QP"`
+	Latitude     *float64         `json:"latitude" example:"53.1905"`
+	Longitude    *float64         `json:"longitude" example:"-2.5196"`
+	Phone        string           `gorm:"type:varchar(30)" json:"phone"`
+	Email        string           `gorm:"type:varchar(255)" json:"email"`
+	OpeningHours OpeningHoursList `gorm:"type:jsonb" json:"opening_hours"`
+	CreatedAt    time.Time        `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt    time.Time        `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+// Validate checks that a site has a name, a well-formed slug and sensible contact
+// details, coordinates and opening hours
+func (s *Site) Validate() error {
+	if strings.TrimSpace(s.Name) == "" {
+		return errors.New("name is required")
+	}
+	if !IsSlug(s.Slug) {
+		return errors.New("slug must contain only lower case letters, digits and single hyphens")
+	}
+
+	if (s.Latitude == nil) != (s.Longitude == nil) {
+		return errors.New("latitude and longitude must be given together")
+	}
+	if s.Latitude != nil && (*s.Latitude < -90 || *s.Latitude > 90) {
+		return errors.New("latitude must be between -90 and 90")
+	}
+	if s.Longitude != nil && (*s.Longitude < -180 || *s.Longitude > 180) {
+		return errors.New("longitude must be between -180 and 180")
+	}
+
+	if s.Email != "" {
+		if _, err := mail.ParseAddress(s.Email); err != nil {
+			return errors.New("email must be a valid email address")
+		}
+	}
+
+	seen := make(map[string]bool, len(s.OpeningHours))
+	for i := range s.OpeningHours {
+		hours := &s.OpeningHours[i]
+		hours.Day = strings.ToLower(strings.TrimSpace(hours.Day))
+		if !containsDay(hours.Day) {
+			return fmt.Errorf("opening_hours day must be one of %s", strings.Join(weekdays, ", "))
+		}
+		if seen[hours.Day] {
+			return fmt.Errorf("opening_hours lists %s more than once", hours.Day)
+		}
+		seen[hours.Day] = true
+
+		if !clockPattern.MatchString(hours.Opens) || !clockPattern.MatchString(hours.Closes) {
+			return fmt.Errorf("opening_hours for %s must use HH:MM times", hours.Day)
+		}
+		// Zero-padded HH:MM times sort as strings
+		if hours.Opens >= hours.Closes {
+			return fmt.Errorf("opening_hours for %s must close after opening", hours.Day)
+		}
+	}
+
+	return nil
+}
+
+// containsDay reports whether day is a lower case weekday name
+func containsDay(day string) bool {
+	for _, weekday := range weekdays {
+		if day == weekday {
+			return true
+		}
+	}
+	return false
+}
+
+// VehicleTransfer records a vehicle moving from one site to another
+type VehicleTransfer struct {
+	ID            uint      `gorm:"primaryKey" json:"id"`
+	VehicleID     int       `gorm:"index;not null" json:"vehicle_id"`
+	FromSiteSlug  string    `gorm:"type:varchar(100)" json:"from_site_slug"`
+	ToSiteSlug    string    `gorm:"type:varchar(100);not null" json:"to_site_slug"`
+	TransferredBy string    `gorm:"type:varchar(100)" json:"transferred_by"`
+	Reason        string    `gorm:"type:text" json:"reason,omitempty"`
+	TransferredAt time.Time `gorm:"autoCreateTime;index" json:"transferred_at"`
+}
+
+// TableName names the table after the site-to-site moves it holds, rather than
+// GORM's default of vehicle_transfers
+func (VehicleTransfer) TableName() string {
+	return "vehicle_site_transfers"
+}
+
+// TransferRequest is the body of POST /vehicles/:id/transfer. Location is the bay or
+// row at the new site and is cleared when not given. The transfer is attributed to
+// the authenticated caller.
+type TransferRequest struct {
+	SiteSlug string `json:"site_slug" binding:"required" example:"trafford"`
+	Location string `json:"location" example:"TRAFFORD ROW D"`
+	Reason   string `json:"reason" example:"Customer viewing in Manchester"`
+}
@@ -0,0 +1,55 @@
+package models
+
+import (
+	"regexp"
+	"strings"
+)
+
+var (
+	slugSeparators = regexp.MustCompile(`[^a-z0-9]+`)
+	slugPattern    = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+)
+
+// Slugify turns a name into a URL slug the way the NexusPoint feed does: lower case,
+// dots dropped and every other run of punctuation or spaces replaced by a hyphen,
+// so "1.0 MPI GreenTech SE 5dr" becomes "10-mpi-greentech-se-5dr"
+func Slugify(s string) string {
+	s = strings.ToLower(strings.ReplaceAll(s, ".", ""))
+	return strings.Trim(slugSeparators.ReplaceAllString(s, "-"), "-")
+}
+
+// IsSlug reports whether s is a well-formed slug
+func IsSlug(s string) bool {
+	return slugPattern.MatchString(s)
+}
+
+// FillSlugs derives any missing slug from the name it belongs to. The listing slug
+// is built from the make, model, derivative and stock ID; the range falls back to
+// the model when the vehicle has no range.
+func (v *Vehicle) FillSlugs() {
+	if v.Slug == "" {
+		v.Slug = Slugify(strings.Join([]string{v.Make, v.Model, v.Derivative, v.StockID}, " "))
+	}
+
+	rangeName := v.Range
+	if rangeName == "" {
+		rangeName = v.Model
+	}
+
+	derived := []struct {
+		slug *string
+		name string
+	}{
+		{&v.MakeSlug, v.Make},
+		{&v.RangeSlug, rangeName},
+		{&v.BodyTypeSlug, v.BodyType},
+		{&v.FuelTypeSlug, v.FuelType},
+		{&v.LocationSlug, v.Location},
+		{&v.SiteSlug, v.Site},
+	}
+	for _, field := range derived {
+		if *field.slug == "" {
+			*field.slug = Slugify(field.name)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+)
+
+// SortableFields lists the vehicle fields that can be used with the sort query parameter.
+// relevance is only meaningful alongside a free-text search and distance alongside near.
+var SortableFields = []string{"price", "year", "odometer_value", "created_at", "make", "model", "relevance", "distance"}
+
+// SortField is a single ordering key, e.g. price descending
+type SortField struct {
+	Field      string
+	Descending bool
+}
+
+// String formats the sort key the same way it is accepted by ParseSort
+func (s SortField) String() string {
+	if s.Descending {
+		return s.Field + ":desc"
+	}
+	return s.Field + ":asc"
+}
+
+// ParseSort parses a comma separated sort expression such as "price:asc,year:desc".
+// The direction is optional and defaults to ascending.
+func ParseSort(expr string) ([]SortField, error) {
+	if strings.TrimSpace(expr) == "" {
+		return nil, nil
+	}
+
+	var fields []SortField
+	seen := make(map[string]bool)
+
+	for _, part := range strings.Split(expr, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			return nil, fmt.Errorf("sort contains an empty field")
+		}
+
+		name, direction, _ := strings.Cut(part, ":")
+		name = strings.ToLower(strings.TrimSpace(name))
+
+		if !isSortable(name) {
+			return nil, fmt.Errorf("cannot sort by %q, allowed fields are %s", name, strings.Join(SortableFields, ", "))
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("sort field %q is repeated", name)
+		}
+		seen[name] = true
+
+		field := SortField{Field: name}
+		switch strings.ToLower(strings.TrimSpace(direction)) {
+		case "", "asc":
+		case "desc":
+			field.Descending = true
+		default:
+			return nil, fmt.Errorf("sort direction for %q must be asc or desc", name)
+		}
+
+		fields = append(fields, field)
+	}
+
+	return fields, nil
+}
+
+// isSortable reports whether a field is in SortableFields
+func isSortable(name string) bool {
+	for _, field := range SortableFields {
+		if field == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,59 @@
+package models
+
+// TaxonomyStats summarises the listed stock under one taxonomy entry
+type TaxonomyStats struct {
+	Count    int64 `json:"count"`
+	MinPrice Money `json:"min_price" swaggertype:"string" example:"4799.00"`
+	MaxPrice Money `json:"max_price" swaggertype:"string" example:"12999.00"`
+}
+
+// Add folds the figures of a subset of stock into the summary
+func (s *TaxonomyStats) Add(other TaxonomyStats) {
+	if other.Count == 0 {
+		return
+	}
+	if s.Count == 0 || other.MinPrice < s.MinPrice {
+		s.MinPrice = other.MinPrice
+	}
+	if s.Count == 0 || other.MaxPrice > s.MaxPrice {
+		s.MaxPrice = other.MaxPrice
+	}
+	s.Count += other.Count
+}
+
+// TaxonomyMake is a make with its ranges
+type TaxonomyMake struct {
+	Name string `json:"name"`
+	Slug string `json:"slug"`
+	TaxonomyStats
+	Ranges []TaxonomyRange `json:"ranges"`
+}
+
+// TaxonomyRange is a range of one make with its models. Vehicles without a range
+// are grouped under their model name.
+type TaxonomyRange struct {
+	Name string `json:"name"`
+	Slug string `json:"slug"`
+	TaxonomyStats
+	Models []TaxonomyModel `json:"models"`
+}
+
+// TaxonomyModel is a model within a range with its derivatives
+type TaxonomyModel struct {
+	Name string `json:"name"`
+	Slug string `json:"slug"`
+	TaxonomyStats
+	Derivatives []TaxonomyDerivative `json:"derivatives"`
+}
+
+// TaxonomyDerivative is a derivative of a model, e.g. "1.2 12V SE 5dr"
+type TaxonomyDerivative struct {
+	Name string `json:"name"`
+	Slug string `json:"slug"`
+	TaxonomyStats
+}
+
+// TaxonomyResponse is the navigation tree returned by GET /taxonomy
+type TaxonomyResponse struct {
+	Makes []TaxonomyMake `json:"makes"`
+}
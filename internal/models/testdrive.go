@@ -0,0 +1,94 @@
+package models
+
+import (
+	"errors"
+	"time"
+)
+
+// TestDriveStatus is the state of a test drive booking
+type TestDriveStatus string
+
+// Test drive statuses
+const (
+	TestDriveStatusBooked    TestDriveStatus = "booked"
+	TestDriveStatusCancelled TestDriveStatus = "cancelled"
+)
+
+// TestDrive is a customer's booking to drive a vehicle from its site. Customers
+// manage their booking with its unguessable Reference rather than by signing in.
+// Sequence counts the changes to the booking so calendar apps replace older copies.
+type TestDrive struct {
+	ID                 uint            `gorm:"primaryKey" json:"id"`
+	Reference          string          `gorm:"type:varchar(32);uniqueIndex;not null" json:"reference" example:"td_3f9a1c2b7e4d5a6f08b1c2d3"`
+	VehicleID          int             `gorm:"index;not null" json:"vehicle_id"`
+	SiteID             *uint           `gorm:"index" json:"site_id"`
+	SiteSlug           string          `gorm:"type:varchar(100)" json:"site_slug" example:"winsford"`
+	StartsAt           time.Time       `gorm:"index;not null" json:"starts_at"`
+	EndsAt             time.Time       `gorm:"not null" json:"ends_at"`
+	Name               string          `gorm:"type:varchar(100);not null" json:"name" example:"Sam Taylor"`
+	Email              string          `gorm:"type:varchar(255)" json:"email,omitempty" example:"sam@example.com"`
+	Phone              string          `gorm:"type:varchar(20)" json:"phone,omitempty" example:"07700900123"`
+	Status             TestDriveStatus `gorm:"type:varchar(20);not null;default:booked;index" json:"status" example:"booked"`
+	Sequence           int             `gorm:"not null;default:0" json:"sequence"`
+	CancelledAt        *time.Time      `json:"cancelled_at,omitempty"`
+	CancellationReason string          `gorm:"type:text" json:"cancellation_reason,omitempty"`
+	CreatedAt          time.Time       `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt          time.Time       `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+// Overlaps reports whether a booked test drive takes up any of the time from start to end
+func (d *TestDrive) Overlaps(start, end time.Time) bool {
+	return d.Status == TestDriveStatusBooked && d.StartsAt.Before(end) && start.Before(d.EndsAt)
+}
+
+// TestDriveRequest is the body of POST /vehicles/:id/test-drives. StartsAt must be the
+// start of one of the vehicle's free test drive slots.
+type TestDriveRequest struct {
+	StartsAt time.Time `json:"starts_at" example:"2026-10-17T10:00:00+01:00"`
+	Name     string    `json:"name" example:"Sam Taylor"`
+	Email    string    `json:"email" example:"sam@example.com"`
+	Phone    string    `json:"phone" example:"07700 900123"`
+}
+
+// Validate checks that a booking names a time and the customer's contact details,
+// normalising the contact details
+func (r *TestDriveRequest) Validate() error {
+	if r.StartsAt.IsZero() {
+		return errors.New("starts_at is required")
+	}
+	return validateContact(&r.Name, &r.Email, &r.Phone)
+}
+
+// RescheduleTestDriveRequest is the body of POST /test-drives/:reference/reschedule
+type RescheduleTestDriveRequest struct {
+	StartsAt time.Time `json:"starts_at" example:"2026-10-18T14:00:00+01:00"`
+}
+
+// Validate checks that a reschedule names the new time
+func (r *RescheduleTestDriveRequest) Validate() error {
+	if r.StartsAt.IsZero() {
+		return errors.New("starts_at is required")
+	}
+	return nil
+}
+
+// CancelTestDriveRequest is the optional body of POST /test-drives/:reference/cancel
+type CancelTestDriveRequest struct {
+	Reason string `json:"reason" example:"Bought elsewhere"`
+}
+
+// TestDriveSlot is a time a vehicle can be test driven from its site
+type TestDriveSlot struct {
+	StartsAt  time.Time `json:"starts_at"`
+	EndsAt    time.Time `json:"ends_at"`
+	Available bool      `json:"available"`
+}
+
+// TestDriveSlotsResponse lists a vehicle's test drive slots on a run of days. Slots
+// follow the opening hours of the vehicle's site, in its time zone.
+type TestDriveSlotsResponse struct {
+	VehicleID int             `json:"vehicle_id" example:"42"`
+	SiteSlug  string          `json:"site_slug" example:"winsford"`
+	TimeZone  string          `json:"time_zone" example:"Europe/London"`
+	Slots     []TestDriveSlot `json:"slots"`
+}
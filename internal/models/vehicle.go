@@ -4,7 +4,13 @@ import (
 	"database/sql/driver"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
 	"time"
+
+	"github.com/Candoo/vehicles-api/internal/geo"
 )
 
 // MediaURL represents a vehicle image with different sizes
@@ -86,56 +92,63 @@ func (m MediaURLArray) Value() (driver.Value, error) {
 	return json.Marshal(m)
 }
 
+// Vehicle sources
+const (
+	VehicleSourceFeed = "feed"
+	VehicleSourceAPI  = "api"
+)
+
 // Vehicle represents a complete vehicle listing matching NexusPoint API structure
 type Vehicle struct {
-	VehicleID            int       `gorm:"primaryKey;autoIncrement:false" json:"vehicle_id"`
-	AdvertClassification string    `gorm:"type:varchar(20);index" json:"advert_classification"`
-	AttentionGrabber     *string   `gorm:"type:text" json:"attention_grabber"`
-	BodyType             string    `gorm:"type:varchar(50);index" json:"body_type"`
-	BodyTypeSlug         string    `gorm:"type:varchar(50)" json:"body_type_slug"`
-	Colour               string    `gorm:"type:varchar(50)" json:"colour"`
-	Company              string    `gorm:"type:varchar(255)" json:"company"`
-	DateFirstRegistered  *string   `gorm:"type:date" json:"date_first_registered"`
-	Derivative           string    `gorm:"type:varchar(255)" json:"derivative"`
-	Description          string    `gorm:"type:text" json:"description"`
-	Doors                string    `gorm:"type:varchar(2)" json:"doors"`
-	Drivetrain           string    `gorm:"type:varchar(50)" json:"drivetrain"`
-	ExtraDescription     string    `gorm:"type:text" json:"extra_description"`
-	FuelType             string    `gorm:"type:varchar(50);index" json:"fuel_type"`
-	FuelTypeSlug         string    `gorm:"type:varchar(50)" json:"fuel_type_slug"`
-	InsuranceGroup       string    `gorm:"type:varchar(10)" json:"insurance_group"`
-	Location             string    `gorm:"type:varchar(100)" json:"location"`
-	LocationSlug         string    `gorm:"type:varchar(100)" json:"location_slug"`
-	Make                 string    `gorm:"type:varchar(100);index" json:"make"`
-	MakeSlug             string    `gorm:"type:varchar(100)" json:"make_slug"`
-	Model                string    `gorm:"type:varchar(100);index" json:"model"`
-	ModelYear            *string   `gorm:"type:varchar(4)" json:"model_year"`
-	Name                 string    `gorm:"type:varchar(255)" json:"name"`
-	OdometerUnits        string    `gorm:"type:varchar(20)" json:"odometer_units"`
-	OdometerValue        int       `json:"odometer_value"`
-	OriginalPrice        string    `gorm:"type:varchar(20)" json:"original_price"`
-	Plate                string    `gorm:"type:varchar(50)" json:"plate"`
-	PreviousKeepers      int       `json:"previous_keepers"`
-	Price                string    `gorm:"type:varchar(20);index" json:"price"`
-	PriceExVat           string    `gorm:"type:varchar(20)" json:"price_ex_vat"`
-	PriceWhenNew         string    `gorm:"type:varchar(20)" json:"price_when_new"`
-	Range                string    `gorm:"type:varchar(100)" json:"range"`
-	RangeSlug            string    `gorm:"type:varchar(100)" json:"range_slug"`
-	Reserved             string    `gorm:"type:varchar(50)" json:"reserved"`
-	Seats                string    `gorm:"type:varchar(2)" json:"seats"`
-	Site                 string    `gorm:"type:varchar(100)" json:"site"`
-	SiteSlug             string    `gorm:"type:varchar(100)" json:"site_slug"`
-	Slug                 string    `gorm:"type:varchar(255);index" json:"slug"`
-	Status               string    `gorm:"type:varchar(50)" json:"status"`
-	StockID              string    `gorm:"type:varchar(50);index" json:"stock_id"`
-	TaxRateValue         *string   `gorm:"type:varchar(20)" json:"tax_rate_value"`
-	Transmission         string    `gorm:"type:varchar(50);index" json:"transmission"`
-	Vat                  string    `gorm:"type:varchar(20)" json:"vat"`
-	VatScheme            string    `gorm:"type:varchar(50)" json:"vat_scheme"`
-	VatWhenNew           string    `gorm:"type:varchar(20)" json:"vat_when_new"`
-	Vin                  string    `gorm:"type:varchar(50)" json:"vin"`
-	VRM                  string    `gorm:"type:varchar(20);index" json:"vrm"`
-	Year                 string    `gorm:"type:varchar(4);index" json:"year"`
+	VehicleID            int     `gorm:"primaryKey;autoIncrement:false" json:"vehicle_id"`
+	AdvertClassification string  `gorm:"type:varchar(20);index" json:"advert_classification"`
+	AttentionGrabber     *string `gorm:"type:text" json:"attention_grabber"`
+	BodyType             string  `gorm:"type:varchar(50);index" json:"body_type"`
+	BodyTypeSlug         string  `gorm:"type:varchar(50)" json:"body_type_slug"`
+	Colour               string  `gorm:"type:varchar(50)" json:"colour"`
+	Company              string  `gorm:"type:varchar(255)" json:"company"`
+	DateFirstRegistered  *string `gorm:"type:date" json:"date_first_registered"`
+	Derivative           string  `gorm:"type:varchar(255)" json:"derivative"`
+	Description          string  `gorm:"type:text" json:"description"`
+	Doors                string  `gorm:"type:varchar(2)" json:"doors"`
+	Drivetrain           string  `gorm:"type:varchar(50)" json:"drivetrain"`
+	ExtraDescription     string  `gorm:"type:text" json:"extra_description"`
+	FuelType             string  `gorm:"type:varchar(50);index" json:"fuel_type"`
+	FuelTypeSlug         string  `gorm:"type:varchar(50)" json:"fuel_type_slug"`
+	InsuranceGroup       string  `gorm:"type:varchar(10)" json:"insurance_group"`
+	Location             string  `gorm:"type:varchar(100)" json:"location"`
+	LocationSlug         string  `gorm:"type:varchar(100)" json:"location_slug"`
+	Make                 string  `gorm:"type:varchar(100);index" json:"make"`
+	MakeSlug             string  `gorm:"type:varchar(100)" json:"make_slug"`
+	Model                string  `gorm:"type:varchar(100);index" json:"model"`
+	ModelYear            *string `gorm:"type:varchar(4)" json:"model_year"`
+	Name                 string  `gorm:"type:varchar(255)" json:"name"`
+	OdometerUnits        string  `gorm:"type:varchar(20)" json:"odometer_units"`
+	OdometerValue        int     `json:"odometer_value"`
+	OriginalPrice        Money   `gorm:"type:bigint" json:"original_price" swaggertype:"string"`
+	Plate                string  `gorm:"type:varchar(50)" json:"plate"`
+	PreviousKeepers      int     `json:"previous_keepers"`
+	Price                Money   `gorm:"type:bigint;index" json:"price" swaggertype:"string" example:"4799.00"`
+	PriceExVat           Money   `gorm:"type:bigint" json:"price_ex_vat" swaggertype:"string"`
+	PriceWhenNew         Money   `gorm:"type:bigint" json:"price_when_new" swaggertype:"string"`
+	Range                string  `gorm:"type:varchar(100)" json:"range"`
+	RangeSlug            string  `gorm:"type:varchar(100)" json:"range_slug"`
+	Reserved             string  `gorm:"type:varchar(50)" json:"reserved"`
+	Seats                string  `gorm:"type:varchar(2)" json:"seats"`
+	Site                 string  `gorm:"type:varchar(100)" json:"site"`
+	SiteID               *uint   `gorm:"index" json:"site_id"`
+	SiteSlug             string  `gorm:"type:varchar(100)" json:"site_slug"`
+	Slug                 string  `gorm:"type:varchar(255);uniqueIndex:idx_vehicles_slug_unique" json:"slug"`
+	Status               string  `gorm:"type:varchar(50)" json:"status"`
+	StockID              string  `gorm:"type:varchar(50);index" json:"stock_id"`
+	TaxRateValue         *string `gorm:"type:varchar(20)" json:"tax_rate_value"`
+	Transmission         string  `gorm:"type:varchar(50);index" json:"transmission"`
+	Vat                  Money   `gorm:"type:bigint" json:"vat" swaggertype:"string"`
+	VatScheme            string  `gorm:"type:varchar(50)" json:"vat_scheme"`
+	VatWhenNew           Money   `gorm:"type:bigint" json:"vat_when_new" swaggertype:"string"`
+	Vin                  string  `gorm:"type:varchar(50)" json:"vin"`
+	VRM                  string  `gorm:"type:varchar(20);index" json:"vrm"`
+	Year                 string  `gorm:"type:varchar(4);index" json:"year"`
 
 	// JSON fields
 	MediaURLs         MediaURLArray `gorm:"type:jsonb" json:"media_urls"`
@@ -143,47 +156,160 @@ type Vehicle struct {
 	KeyFeatures       StringArray   `gorm:"type:jsonb" json:"key_features"`
 
 	// Finance
-	MonthlyPayment     string `gorm:"type:varchar(20)" json:"monthly_payment"`
+	MonthlyPayment     Money  `gorm:"type:bigint" json:"monthly_payment" swaggertype:"string" example:"199.96"`
 	MonthlyFinanceType string `gorm:"type:varchar(20)" json:"monthly_finance_type"`
 
 	// Offer flag
 	HasOffer bool `gorm:"default:false;index" json:"has_offer"`
 
+	// Lifecycle state, changed through POST /vehicles/:id/status. Status and Reserved
+	// above are passed through from the feed unchanged.
+	StockStatus StockStatus `gorm:"type:varchar(20);default:in_stock;index" json:"stock_status"`
+
+	// Origin of the listing: VehicleSourceFeed or VehicleSourceAPI
+	Source string `gorm:"type:varchar(20);default:feed;index" json:"source"`
+
+	// Search rank, only populated when listing with a free-text query
+	Relevance float64 `gorm:"->;-:migration" json:"relevance,omitempty"`
+
+	// Miles from the point given in near, only populated when searching near a place
+	DistanceMiles *float64 `gorm:"->;-:migration" json:"distance_miles,omitempty" example:"12.4"`
+
 	// Timestamps
 	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
 	UpdatedAt time.Time `gorm:"autoUpdateTime" json:"updated_at"`
 }
 
+var yearPattern = regexp.MustCompile(`^[0-9]{4}$`)
+
+// Validate checks that a vehicle has the fields required to be listed
+func (v *Vehicle) Validate() error {
+	if v.VehicleID <= 0 {
+		return errors.New("vehicle_id must be greater than 0")
+	}
+
+	required := map[string]string{
+		"name":     v.Name,
+		"make":     v.Make,
+		"model":    v.Model,
+		"vrm":      v.VRM,
+		"stock_id": v.StockID,
+	}
+	for _, field := range []string{"name", "make", "model", "vrm", "stock_id"} {
+		if strings.TrimSpace(required[field]) == "" {
+			return fmt.Errorf("%s is required", field)
+		}
+	}
+
+	switch strings.ToLower(v.AdvertClassification) {
+	case "new", "used":
+	default:
+		return errors.New("advert_classification must be New or Used")
+	}
+
+	if v.Price <= 0 {
+		return errors.New("price must be greater than 0")
+	}
+
+	prices := map[string]Money{
+		"original_price":  v.OriginalPrice,
+		"price_ex_vat":    v.PriceExVat,
+		"price_when_new":  v.PriceWhenNew,
+		"vat":             v.Vat,
+		"vat_when_new":    v.VatWhenNew,
+		"monthly_payment": v.MonthlyPayment,
+	}
+	for _, field := range []string{"original_price", "price_ex_vat", "price_when_new", "vat", "vat_when_new", "monthly_payment"} {
+		if prices[field] < 0 {
+			return fmt.Errorf("%s must not be negative", field)
+		}
+	}
+
+	if v.Year != "" && !yearPattern.MatchString(v.Year) {
+		return errors.New("year must be a four digit year")
+	}
+
+	if v.Slug != "" && !IsSlug(v.Slug) {
+		return errors.New("slug must contain only lower case letters, digits and single hyphens")
+	}
+
+	for field, value := range map[string]string{"doors": v.Doors, "seats": v.Seats} {
+		if value == "" {
+			continue
+		}
+		if n, err := strconv.Atoi(value); err != nil || n < 0 || len(value) > 2 {
+			return fmt.Errorf("%s must be a number between 0 and 99", field)
+		}
+	}
+
+	if v.StockStatus != "" {
+		if _, err := ParseStockStatus(string(v.StockStatus)); err != nil {
+			return errors.New("stock_status must be one of in_prep, in_stock, reserved, sold, withdrawn")
+		}
+	}
+
+	if v.OdometerValue < 0 {
+		return errors.New("odometer_value must not be negative")
+	}
+
+	if v.PreviousKeepers < 0 {
+		return errors.New("previous_keepers must not be negative")
+	}
+
+	return nil
+}
+
 // VehicleResponse represents the API response structure for vehicle listings
 type VehicleResponse struct {
-	Data []Vehicle        `json:"data"`
-	Meta ResponseMetadata `json:"meta"`
+	Data   []Vehicle        `json:"data"`
+	Meta   ResponseMetadata `json:"meta"`
+	Facets *Facets          `json:"facets,omitempty"`
 }
 
-// ResponseMetadata contains pagination information
+// ResponseMetadata contains pagination information. When paging with a cursor
+// current_page is omitted and next_cursor/prev_cursor should be followed instead.
 type ResponseMetadata struct {
-	CurrentPage        int   `json:"current_page"`
-	LastPage           int   `json:"last_page"`
-	PerPage            int   `json:"per_page"`
-	Total              int64 `json:"total"`
-	AllTotal           int64 `json:"all_total,omitempty"`
-	TotalNewVehicles   int64 `json:"total_new_vehicles,omitempty"`
-	TotalUsedVehicles  int64 `json:"total_used_vehicles,omitempty"`
-	OfferVehicles      int64 `json:"offer_vehicles"`
+	CurrentPage int    `json:"current_page,omitempty"`
+	LastPage    int    `json:"last_page"`
+	PerPage     int    `json:"per_page"`
+	Total       int64  `json:"total"`
+	NextCursor  string `json:"next_cursor,omitempty"`
+	PrevCursor  string `json:"prev_cursor,omitempty"`
 }
 
-// VehicleFilters contains filtering options for vehicle queries
+// VehicleFilters contains filtering options for vehicle queries. Slice filters match
+// any of their values; nil pointers and zero values leave a filter unset. Near keeps
+// only vehicles at sites with coordinates, within RadiusMiles of it when that is set.
 type VehicleFilters struct {
-	Page                   int
-	ResultsPerPage         int
-	AdvertClassification   string
-	Make                   string
-	Model                  string
-	FuelType               string
-	Transmission           string
-	BodyType               string
-	MinPrice               string
-	MaxPrice               string
-	MinYear                string
-	MaxYear                string
+	Page                 int
+	ResultsPerPage       int
+	AdvertClassification string
+	Makes                []string
+	MakeSlugs            []string
+	Model                string
+	RangeSlugs           []string
+	FuelTypes            []string
+	Transmissions        []string
+	BodyTypes            []string
+	Colours              []string
+	Drivetrains          []string
+	Doors                []int
+	Seats                []int
+	InsuranceGroups      []string
+	SiteSlugs            []string
+	Locations            []string
+	MinPrice             Money
+	MaxPrice             Money
+	MinYear              int
+	MaxYear              int
+	MinMileage           *int
+	MaxMileage           *int
+	MaxPreviousKeepers   *int
+	HasOffer             *bool
+	Query                string
+	Near                 *geo.Point
+	RadiusMiles          int
+	StockStatuses        []StockStatus
+	Sort                 []SortField
+	Cursor               *Cursor
 }
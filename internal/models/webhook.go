@@ -0,0 +1,150 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// WebhookAllEvents subscribes an endpoint to every event type
+const WebhookAllEvents = "*"
+
+// WebhookEndpoint is a URL that receives the events it subscribes to. Deliveries
+// are signed with Secret, which is only shown when the endpoint is registered.
+type WebhookEndpoint struct {
+	ID          uint        `gorm:"primaryKey" json:"id"`
+	URL         string      `gorm:"type:varchar(2048);not null" json:"url" example:"https://crm.example.com/hooks/stock"`
+	Description string      `gorm:"type:varchar(255)" json:"description" example:"CRM stock sync"`
+	Events      StringArray `gorm:"type:jsonb" json:"events" swaggertype:"array,string" example:"vehicle.price_changed,vehicle.sold"`
+	Secret      string      `gorm:"type:varchar(100);not null" json:"-"`
+	CreatedBy   string      `gorm:"type:varchar(100)" json:"created_by"`
+	CreatedAt   time.Time   `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt   time.Time   `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+// Subscribes reports whether the endpoint receives events of type t
+func (e *WebhookEndpoint) Subscribes(t EventType) bool {
+	for _, subscribed := range e.Events {
+		if subscribed == WebhookAllEvents || EventType(subscribed) == t {
+			return true
+		}
+	}
+	return false
+}
+
+// WebhookEndpointRequest is the body of POST /admin/webhooks
+type WebhookEndpointRequest struct {
+	URL         string   `json:"url" example:"https://crm.example.com/hooks/stock"`
+	Description string   `json:"description" example:"CRM stock sync"`
+	Events      []string `json:"events" example:"vehicle.price_changed,vehicle.sold"`
+}
+
+// Validate checks the URL and event types of an endpoint, normalising the event types
+func (r *WebhookEndpointRequest) Validate() error {
+	r.URL = strings.TrimSpace(r.URL)
+	target, err := url.Parse(r.URL)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		return errors.New("url must be an absolute http or https URL")
+	}
+
+	r.Description = strings.TrimSpace(r.Description)
+	if len(r.Description) > 255 {
+		return errors.New("description must be at most 255 characters")
+	}
+
+	if len(r.Events) == 0 {
+		return fmt.Errorf("events is required; use %q for every event", WebhookAllEvents)
+	}
+	for i, name := range r.Events {
+		if strings.TrimSpace(name) == WebhookAllEvents {
+			r.Events[i] = WebhookAllEvents
+			continue
+		}
+		eventType, err := ParseEventType(name)
+		if err != nil {
+			return err
+		}
+		r.Events[i] = string(eventType)
+	}
+	return nil
+}
+
+// CreateWebhookEndpointResponse returns a newly registered endpoint. The signing
+// secret is only shown once.
+type CreateWebhookEndpointResponse struct {
+	WebhookEndpoint
+	Secret string `json:"secret" example:"whsec_4f1c..."`
+}
+
+// WebhookDeliveryStatus is the state of one event's delivery to one endpoint
+type WebhookDeliveryStatus string
+
+// Webhook delivery statuses. A delivery is retried while pending and moves to the
+// dead-letter table once it runs out of attempts.
+const (
+	WebhookDeliveryPending   WebhookDeliveryStatus = "pending"
+	WebhookDeliveryDelivered WebhookDeliveryStatus = "delivered"
+	WebhookDeliveryDead      WebhookDeliveryStatus = "dead"
+)
+
+// ParseWebhookDeliveryStatus parses a delivery status name
+func ParseWebhookDeliveryStatus(s string) (WebhookDeliveryStatus, error) {
+	status := WebhookDeliveryStatus(strings.ToLower(strings.TrimSpace(s)))
+	switch status {
+	case WebhookDeliveryPending, WebhookDeliveryDelivered, WebhookDeliveryDead:
+		return status, nil
+	}
+	return "", fmt.Errorf("unknown delivery status %q", s)
+}
+
+// WebhookDelivery is the delivery of one event to one endpoint and the outcome of
+// its latest attempt
+type WebhookDelivery struct {
+	ID             uint                  `gorm:"primaryKey" json:"id"`
+	EndpointID     uint                  `gorm:"index;uniqueIndex:idx_webhook_deliveries_endpoint_event;not null" json:"endpoint_id"`
+	Endpoint       *WebhookEndpoint      `gorm:"foreignKey:EndpointID" json:"-"`
+	EventID        string                `gorm:"type:varchar(32);index;uniqueIndex:idx_webhook_deliveries_endpoint_event;not null" json:"event_id" example:"evt_8c1f4e2a9d7b3c5e6f0a1b2c"`
+	EventType      EventType             `gorm:"type:varchar(50);not null" json:"event_type" example:"vehicle.sold"`
+	Payload        string                `gorm:"type:text;not null" json:"-"`
+	Status         WebhookDeliveryStatus `gorm:"type:varchar(20);not null;default:pending;index" json:"status" example:"pending"`
+	Attempts       int                   `gorm:"not null;default:0" json:"attempts"`
+	NextAttemptAt  *time.Time            `gorm:"index" json:"next_attempt_at,omitempty"`
+	LastAttemptAt  *time.Time            `json:"last_attempt_at,omitempty"`
+	ResponseStatus int                   `json:"response_status,omitempty" example:"503"`
+	LastError      string                `gorm:"type:text" json:"last_error,omitempty" example:"receiver responded 503 Service Unavailable"`
+	DeliveredAt    *time.Time            `json:"delivered_at,omitempty"`
+	CreatedAt      time.Time             `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt      time.Time             `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+// WebhookDeadLetter is a delivery that ran out of attempts, kept so it can be
+// inspected and retried
+type WebhookDeadLetter struct {
+	ID             uint      `gorm:"primaryKey" json:"id"`
+	DeliveryID     uint      `gorm:"uniqueIndex;not null" json:"delivery_id"`
+	EndpointID     uint      `gorm:"index;not null" json:"endpoint_id"`
+	EventID        string    `gorm:"type:varchar(32);not null" json:"event_id"`
+	EventType      EventType `gorm:"type:varchar(50);not null" json:"event_type"`
+	Payload        string    `gorm:"type:text;not null" json:"-"`
+	Attempts       int       `json:"attempts"`
+	ResponseStatus int       `json:"response_status,omitempty"`
+	LastError      string    `gorm:"type:text" json:"last_error,omitempty"`
+	CreatedAt      time.Time `gorm:"autoCreateTime" json:"created_at"`
+}
+
+// WebhookDeliveryFilters holds the filters of the delivery log
+type WebhookDeliveryFilters struct {
+	Page           int
+	ResultsPerPage int
+	EndpointID     uint
+	Statuses       []WebhookDeliveryStatus
+	EventTypes     []EventType
+}
+
+// WebhookDeliveryResponse represents a page of the delivery log
+type WebhookDeliveryResponse struct {
+	Data []WebhookDelivery `json:"data"`
+	Meta ResponseMetadata  `json:"meta"`
+}
@@ -0,0 +1,124 @@
+package payment
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/Candoo/vehicles-api/internal/models"
+)
+
+// DeclinedToken is the payment token the fake provider declines
+const DeclinedToken = "tok_declined"
+
+// HoldState is the state of a hold kept by the fake provider
+type HoldState string
+
+// Hold states
+const (
+	HoldStateHeld     HoldState = "held"
+	HoldStateCaptured HoldState = "captured"
+	HoldStateReleased HoldState = "released"
+)
+
+// FakeHold is a hold placed with the fake provider
+type FakeHold struct {
+	ID        string
+	Amount    models.Money
+	Reference string
+	State     HoldState
+	// CaptureKey is the idempotency key the hold was captured with
+	CaptureKey string
+	// Captures counts the times the deposit was taken
+	Captures int
+}
+
+// Fake is an in-memory Provider for tests and local development. It holds every
+// deposit except those paid with DeclinedToken, and never moves money.
+type Fake struct {
+	mu    sync.Mutex
+	holds map[string]*FakeHold
+	next  int
+}
+
+// NewFake creates a fake payment provider with no holds
+func NewFake() *Fake {
+	return &Fake{holds: make(map[string]*FakeHold)}
+}
+
+// Hold places a hold unless the token is DeclinedToken
+func (f *Fake) Hold(ctx context.Context, request HoldRequest) (string, error) {
+	if request.Token == DeclinedToken {
+		return "", ErrDeclined
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.next++
+	hold := &FakeHold{
+		ID:        fmt.Sprintf("hold_%d", f.next),
+		Amount:    request.Amount,
+		Reference: request.Reference,
+		State:     HoldStateHeld,
+	}
+	f.holds[hold.ID] = hold
+	return hold.ID, nil
+}
+
+// Capture takes a held deposit, or does nothing if it was already taken with
+// idempotencyKey
+func (f *Fake) Capture(ctx context.Context, holdID, idempotencyKey string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	hold, ok := f.holds[holdID]
+	if !ok {
+		return fmt.Errorf("unknown hold %s", holdID)
+	}
+	if hold.State == HoldStateCaptured && hold.CaptureKey == idempotencyKey {
+		return nil
+	}
+	if hold.State != HoldStateHeld {
+		return fmt.Errorf("hold %s is %s", holdID, hold.State)
+	}
+	hold.State = HoldStateCaptured
+	hold.CaptureKey = idempotencyKey
+	hold.Captures++
+	return nil
+}
+
+// Release cancels a hold
+func (f *Fake) Release(ctx context.Context, holdID string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	hold, ok := f.holds[holdID]
+	if !ok {
+		return fmt.Errorf("unknown hold %s", holdID)
+	}
+	switch hold.State {
+	case HoldStateCaptured:
+		return fmt.Errorf("hold %s is captured", holdID)
+	case HoldStateHeld:
+		hold.State = HoldStateReleased
+	}
+	return nil
+}
+
+// Name returns "fake"
+func (f *Fake) Name() string {
+	return "fake"
+}
+
+// Get returns a copy of a hold, for tests to check what happened to it
+func (f *Fake) Get(holdID string) (FakeHold, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	hold, ok := f.holds[holdID]
+	if !ok {
+		return FakeHold{}, false
+	}
+	return *hold, true
+}
@@ -0,0 +1,43 @@
+// Package payment takes reservation deposits. A Provider places a hold on the
+// customer's card for the deposit, which is captured when the sale goes through or
+// released when the reservation is cancelled or runs out.
+package payment
+
+import (
+	"context"
+	"errors"
+
+	"github.com/Candoo/vehicles-api/internal/models"
+)
+
+// ErrDeclined is returned when the customer's card refuses a hold. Any other error
+// means the provider could not be reached or failed.
+var ErrDeclined = errors.New("payment declined")
+
+// HoldRequest describes a deposit to hold
+type HoldRequest struct {
+	// Amount is the deposit
+	Amount models.Money
+	// Token identifies the customer's payment method, as tokenised by the provider's
+	// checkout in the browser
+	Token string
+	// Reference is our reference for the reservation, shown on the customer's statement
+	Reference string
+	// Description describes the hold to the customer
+	Description string
+}
+
+// Provider places, captures and releases deposit holds
+type Provider interface {
+	// Hold authorises the deposit on the customer's card without taking it, returning
+	// the provider's ID for the hold, or ErrDeclined
+	Hold(ctx context.Context, request HoldRequest) (string, error)
+	// Capture takes a held deposit. Capturing again with the same idempotencyKey
+	// succeeds without taking the deposit twice, so a capture can be retried safely.
+	Capture(ctx context.Context, holdID, idempotencyKey string) error
+	// Release cancels a hold so the customer is not charged. Releasing a hold that is
+	// already released succeeds.
+	Release(ctx context.Context, holdID string) error
+	// Name describes the provider for logs and stored reservations
+	Name() string
+}
@@ -0,0 +1,94 @@
+package repository
+
+import (
+	"errors"
+	"time"
+
+	"github.com/Candoo/vehicles-api/internal/apperr"
+	"github.com/Candoo/vehicles-api/internal/models"
+	"gorm.io/gorm"
+)
+
+// APIKeyRepository handles database operations for API keys
+type APIKeyRepository struct {
+	db *gorm.DB
+}
+
+// NewAPIKeyRepository creates a new API key repository
+func NewAPIKeyRepository(db *gorm.DB) *APIKeyRepository {
+	return &APIKeyRepository{db: db}
+}
+
+// CreateAPIKey stores a newly issued API key
+func (r *APIKeyRepository) CreateAPIKey(key *models.APIKey) error {
+	if err := r.db.Create(key).Error; err != nil {
+		return dbError(err, "failed to create API key")
+	}
+	return nil
+}
+
+// FindAPIKeyByPrefix retrieves an API key by its lookup prefix, including revoked keys
+func (r *APIKeyRepository) FindAPIKeyByPrefix(prefix string) (*models.APIKey, error) {
+	var key models.APIKey
+
+	if err := r.db.Where("prefix = ?", prefix).First(&key).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, apperr.NotFound("api key not found")
+		}
+		return nil, dbError(err, "failed to fetch API key")
+	}
+
+	return &key, nil
+}
+
+// FindAPIKeyByID retrieves an API key by ID, including revoked keys
+func (r *APIKeyRepository) FindAPIKeyByID(id uint) (*models.APIKey, error) {
+	var key models.APIKey
+
+	if err := r.db.First(&key, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, apperr.NotFound("api key not found")
+		}
+		return nil, dbError(err, "failed to fetch API key")
+	}
+
+	return &key, nil
+}
+
+// ListAPIKeys retrieves every API key, newest first
+func (r *APIKeyRepository) ListAPIKeys() ([]models.APIKey, error) {
+	keys := []models.APIKey{}
+
+	if err := r.db.Order("created_at DESC, id DESC").Find(&keys).Error; err != nil {
+		return nil, dbError(err, "failed to fetch API keys")
+	}
+
+	return keys, nil
+}
+
+// RevokeAPIKey marks an API key as revoked. Revoking twice keeps the first revocation time.
+func (r *APIKeyRepository) RevokeAPIKey(id uint) (*models.APIKey, error) {
+	key, err := r.FindAPIKeyByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if key.RevokedAt == nil {
+		now := time.Now()
+		if err := r.db.Model(key).Update("revoked_at", now).Error; err != nil {
+			return nil, dbError(err, "failed to revoke API key")
+		}
+	}
+
+	return key, nil
+}
+
+// TouchAPIKey records when an API key was last used
+func (r *APIKeyRepository) TouchAPIKey(id uint, at time.Time) error {
+	if err := r.db.Model(&models.APIKey{}).
+		Where("id = ?", id).
+		Update("last_used_at", at).Error; err != nil {
+		return dbError(err, "failed to update API key")
+	}
+	return nil
+}
@@ -0,0 +1,37 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/Candoo/vehicles-api/internal/apperr"
+)
+
+// errVehicleExists is returned when a vehicle clashes with another on vehicle ID, VRM or stock ID
+var errVehicleExists = apperr.Conflict("a vehicle with the same vehicle_id, vrm or stock_id already exists")
+
+// errSlugTaken is returned when a client picks a slug another vehicle already uses
+var errSlugTaken = apperr.Conflict("slug is already used by another vehicle")
+
+// dbError wraps a database error with context. Errors caused by the database being
+// unreachable are marked apperr.ErrUnavailable so clients get a 503 instead of a 500.
+func dbError(err error, format string, args ...interface{}) error {
+	wrapped := fmt.Errorf(format+": %w", append(args, err)...)
+	if isUnavailable(err) {
+		return apperr.Unavailable(wrapped, "database unavailable")
+	}
+	return wrapped
+}
+
+// isUnavailable reports whether an error means the database could not be reached
+func isUnavailable(err error) bool {
+	var netErr net.Error
+	return errors.Is(err, driver.ErrBadConn) ||
+		errors.Is(err, sql.ErrConnDone) ||
+		errors.Is(err, context.DeadlineExceeded) ||
+		errors.As(err, &netErr)
+}
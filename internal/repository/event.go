@@ -0,0 +1,135 @@
+package repository
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/Candoo/vehicles-api/internal/ids"
+	"github.com/Candoo/vehicles-api/internal/models"
+	"gorm.io/gorm"
+)
+
+// OutboxStore is the outbox of vehicle events waiting to be published.
+// VehicleRepository and MemoryVehicleStore implement it, as events are recorded in
+// the same transaction as the vehicle change they describe.
+type OutboxStore interface {
+	PendingEvents(limit int) ([]models.VehicleEvent, error)
+	MarkEventPublished(id string, at time.Time) error
+}
+
+var (
+	_ OutboxStore = (*VehicleRepository)(nil)
+	_ OutboxStore = (*MemoryVehicleStore)(nil)
+)
+
+// PendingEvents retrieves up to limit events not yet published, oldest first
+func (r *VehicleRepository) PendingEvents(limit int) ([]models.VehicleEvent, error) {
+	var outbox []models.OutboxEvent
+	if err := r.db.Where("published_at IS NULL").
+		Order("seq ASC").
+		Limit(limit).
+		Find(&outbox).Error; err != nil {
+		return nil, dbError(err, "failed to fetch pending events")
+	}
+	return decodeEvents(outbox)
+}
+
+// MarkEventPublished records that an event was published at at
+func (r *VehicleRepository) MarkEventPublished(id string, at time.Time) error {
+	if err := r.db.Model(&models.OutboxEvent{}).
+		Where("event_id = ?", id).
+		Update("published_at", at).Error; err != nil {
+		return dbError(err, "failed to mark event %s published", id)
+	}
+	return nil
+}
+
+// recordEvents stores events in the outbox as part of the transaction making the
+// change they describe
+func recordEvents(tx *gorm.DB, events ...models.VehicleEvent) error {
+	for _, event := range events {
+		outbox, err := newOutboxEvent(event)
+		if err != nil {
+			return err
+		}
+		if err := tx.Create(&outbox).Error; err != nil {
+			return dbError(err, "failed to record %s event", event.Type)
+		}
+	}
+	return nil
+}
+
+// vehicleEvent builds an event carrying a vehicle as it is after the change
+func vehicleEvent(eventType models.EventType, vehicle models.Vehicle) models.VehicleEvent {
+	vehicle.Relevance, vehicle.DistanceMiles = 0, nil
+	return models.VehicleEvent{Type: eventType, VehicleID: vehicle.VehicleID, Vehicle: &vehicle}
+}
+
+// updatedEvent builds vehicle.updated, carrying the vehicle as it was before the
+// change as well as after
+func updatedEvent(previous, vehicle models.Vehicle) models.VehicleEvent {
+	event := vehicleEvent(models.EventVehicleUpdated, vehicle)
+	previous.Relevance, previous.DistanceMiles = 0, nil
+	event.Previous = &previous
+	return event
+}
+
+// updateEvents builds vehicle.updated and, when the price moved, vehicle.price_changed
+func updateEvents(previous, vehicle models.Vehicle) []models.VehicleEvent {
+	events := []models.VehicleEvent{updatedEvent(previous, vehicle)}
+	oldPrice := previous.Price
+	if oldPrice == vehicle.Price {
+		return events
+	}
+
+	priceChange := vehicleEvent(models.EventVehiclePriceChanged, vehicle)
+	newPrice := vehicle.Price
+	priceChange.OldPrice, priceChange.NewPrice = &oldPrice, &newPrice
+	return append(events, priceChange)
+}
+
+// statusEvent builds vehicle.sold for a sale and vehicle.status_changed for any
+// other move of a vehicle away from status from
+func statusEvent(from models.StockStatus, vehicle models.Vehicle) models.VehicleEvent {
+	eventType := models.EventVehicleStatusChanged
+	if vehicle.StockStatus == models.StockStatusSold {
+		eventType = models.EventVehicleSold
+	}
+	event := vehicleEvent(eventType, vehicle)
+	event.FromStatus, event.ToStatus = from, vehicle.StockStatus
+	return event
+}
+
+// deletedEvent builds vehicle.deleted, which carries only the vehicle ID
+func deletedEvent(id int) models.VehicleEvent {
+	return models.VehicleEvent{Type: models.EventVehicleDeleted, VehicleID: id}
+}
+
+// newOutboxEvent stamps an event with an ID and the time it occurred and encodes it
+// for the outbox
+func newOutboxEvent(event models.VehicleEvent) (models.OutboxEvent, error) {
+	id, err := ids.New("evt")
+	if err != nil {
+		return models.OutboxEvent{}, err
+	}
+	event.ID = id
+	event.OccurredAt = now().UTC()
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return models.OutboxEvent{}, fmt.Errorf("failed to encode %s event: %w", event.Type, err)
+	}
+	return models.OutboxEvent{EventID: event.ID, Payload: string(payload), OccurredAt: event.OccurredAt}, nil
+}
+
+// decodeEvents decodes the events held in outbox rows
+func decodeEvents(outbox []models.OutboxEvent) ([]models.VehicleEvent, error) {
+	events := make([]models.VehicleEvent, len(outbox))
+	for i := range outbox {
+		if err := json.Unmarshal([]byte(outbox[i].Payload), &events[i]); err != nil {
+			return nil, fmt.Errorf("failed to decode event %s: %w", outbox[i].EventID, err)
+		}
+	}
+	return events, nil
+}
@@ -0,0 +1,105 @@
+package repository
+
+import (
+	"strings"
+
+	"github.com/Candoo/vehicles-api/internal/models"
+)
+
+// GetFacets counts vehicles per facet value under the given filters, each facet ignoring its own filter
+func (r *VehicleRepository) GetFacets(filters models.VehicleFilters) (*models.Facets, error) {
+	facets := &models.Facets{}
+
+	targets := map[string]*[]models.FacetCount{
+		"advert_classification": &facets.AdvertClassification,
+		"make":                  &facets.Make,
+		"fuel_type":             &facets.FuelType,
+		"transmission":          &facets.Transmission,
+		"body_type":             &facets.BodyType,
+	}
+
+	// These facets are named after the column they count
+	for column, target := range targets {
+		counts, err := r.countByExpression(filters, column, column)
+		if err != nil {
+			return nil, err
+		}
+		*target = counts
+	}
+
+	priceBands, err := r.countPriceBands(filters)
+	if err != nil {
+		return nil, err
+	}
+	facets.PriceBand = priceBands
+
+	hasOffer, err := r.countByExpression(filters, "has_offer", "CASE WHEN has_offer THEN 'true' ELSE 'false' END")
+	if err != nil {
+		return nil, err
+	}
+	facets.HasOffer = hasOffer
+
+	return facets, nil
+}
+
+// countByExpression counts vehicles per distinct value of a SQL expression
+func (r *VehicleRepository) countByExpression(filters models.VehicleFilters, facet, expression string, args ...interface{}) ([]models.FacetCount, error) {
+	counts := []models.FacetCount{}
+
+	query := applyFilters(r.db.Model(&models.Vehicle{}), filters, facet)
+	if err := query.
+		Select(expression+" AS value, COUNT(*) AS count", args...).
+		Group("value").
+		Order("count DESC, value ASC").
+		Scan(&counts).Error; err != nil {
+		return nil, dbError(err, "failed to count %s facet", facet)
+	}
+
+	return counts, nil
+}
+
+// countPriceBands counts vehicles per models.PriceBands bucket, including empty buckets
+func (r *VehicleRepository) countPriceBands(filters models.VehicleFilters) ([]models.FacetCount, error) {
+	var cases []string
+	var args []interface{}
+
+	for _, band := range models.PriceBands {
+		if band.Max > 0 {
+			cases = append(cases, "WHEN price >= ? AND price < ? THEN ?")
+			args = append(args, band.Min, band.Max, band.Label)
+		} else {
+			cases = append(cases, "WHEN price >= ? THEN ?")
+			args = append(args, band.Min, band.Label)
+		}
+	}
+	expression := "CASE " + strings.Join(cases, " ") + " END"
+
+	counts, err := r.countByExpression(filters, "price", expression, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return priceBandCounts(counts), nil
+}
+
+// priceBandCounts orders raw band counts as models.PriceBands and fills in the bounds
+func priceBandCounts(counts []models.FacetCount) []models.FacetCount {
+	byLabel := make(map[string]int64, len(counts))
+	for _, count := range counts {
+		byLabel[count.Value] = count.Count
+	}
+
+	result := make([]models.FacetCount, 0, len(models.PriceBands))
+	for _, band := range models.PriceBands {
+		count := models.FacetCount{Value: band.Label, Count: byLabel[band.Label]}
+		min := band.Min
+		count.Min = &min
+		if band.Max > 0 {
+			max := band.Max
+			count.Max = &max
+		}
+		result = append(result, count)
+	}
+
+	return result
+}
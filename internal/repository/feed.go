@@ -0,0 +1,174 @@
+package repository
+
+import (
+	"errors"
+
+	"github.com/Candoo/vehicles-api/internal/apperr"
+	"github.com/Candoo/vehicles-api/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// FeedStore is the storage the stock feed sync needs. VehicleRepository and
+// MemoryVehicleStore implement it, as the sync changes stored vehicles.
+type FeedStore interface {
+	ListAllVehicles() ([]models.Vehicle, error)
+	ApplyFeedSync(inserts, updates []models.Vehicle, removals []int) (models.FeedSyncCounts, error)
+	CreateFeedSyncRun(run *models.FeedSyncRun) error
+}
+
+var (
+	_ FeedStore = (*VehicleRepository)(nil)
+	_ FeedStore = (*MemoryVehicleStore)(nil)
+)
+
+// FeedSyncActor is recorded as the author of status changes made by the feed sync
+const FeedSyncActor = "feed-sync"
+
+// ListAllVehicles retrieves every vehicle, whatever its source or stock status, for the
+// feed sync to plan against
+func (r *VehicleRepository) ListAllVehicles() ([]models.Vehicle, error) {
+	var vehicles []models.Vehicle
+
+	if err := r.db.Order("vehicle_id ASC").
+		Find(&vehicles).Error; err != nil {
+		return nil, dbError(err, "failed to fetch vehicles")
+	}
+
+	return vehicles, nil
+}
+
+// ApplyFeedSync inserts new feed vehicles, replaces changed ones and withdraws vehicles
+// that dropped out of the feed, all in one transaction. Updates leave stock_status, the
+// slug, the site and the location alone. New vehicles whose feed slug is already taken
+// are given a unique one, and are linked to their site. A vehicle held by an online
+// reservation is not withdrawn until the reservation ends; a later sync withdraws it.
+// The counts returned leave out the vehicles skipped.
+func (r *VehicleRepository) ApplyFeedSync(inserts, updates []models.Vehicle, removals []int) (models.FeedSyncCounts, error) {
+	var applied models.FeedSyncCounts
+
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		for i := range inserts {
+			if err := assignSlug(&inserts[i], false, slugTaken(tx, inserts[i].VehicleID)); err != nil {
+				return err
+			}
+			if err := linkSite(tx, &inserts[i]); err != nil {
+				return err
+			}
+
+			// Omit("") forces GORM to include the feed's primary key
+			if err := tx.Omit("").Create(&inserts[i]).Error; err != nil {
+				if errors.Is(err, gorm.ErrDuplicatedKey) {
+					return apperr.Conflict("feed vehicle %d clashes with a stored vehicle on vehicle_id, vrm or stock_id", inserts[i].VehicleID)
+				}
+				return dbError(err, "failed to insert vehicle %d", inserts[i].VehicleID)
+			}
+			if err := recordEvents(tx, vehicleEvent(models.EventVehicleCreated, inserts[i])); err != nil {
+				return err
+			}
+			applied.Inserted++
+		}
+
+		current, err := lockedVehicles(tx, updates)
+		if err != nil {
+			return err
+		}
+
+		for i := range updates {
+			// Skip vehicles deleted since the sync was planned
+			previous, ok := current[updates[i].VehicleID]
+			if !ok {
+				continue
+			}
+
+			if err := tx.Model(&models.Vehicle{}).
+				Where("vehicle_id = ?", updates[i].VehicleID).
+				Select("*").
+				Omit("vehicle_id", "created_at", "stock_status", "slug", "site_id", "site", "site_slug", "location", "location_slug").
+				Updates(&updates[i]).Error; err != nil {
+				if errors.Is(err, gorm.ErrDuplicatedKey) {
+					return apperr.Conflict("feed vehicle %d clashes with a stored vehicle on vrm or stock_id", updates[i].VehicleID)
+				}
+				return dbError(err, "failed to update vehicle %d", updates[i].VehicleID)
+			}
+
+			if err := recordPriceChange(tx, updates[i].VehicleID, previous.Price, updates[i].Price, models.PriceSourceFeed); err != nil {
+				return err
+			}
+
+			// The event carries the stored vehicle, with the fields the update leaves alone
+			var stored models.Vehicle
+			if err := tx.First(&stored, updates[i].VehicleID).Error; err != nil {
+				return dbError(err, "failed to fetch vehicle %d", updates[i].VehicleID)
+			}
+			if err := recordEvents(tx, updateEvents(previous, stored)...); err != nil {
+				return err
+			}
+			applied.Updated++
+		}
+
+		if len(removals) > 0 {
+			var vehicles []models.Vehicle
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+				Where("vehicle_id IN ?", removals).
+				Find(&vehicles).Error; err != nil {
+				return dbError(err, "failed to fetch vehicles to withdraw")
+			}
+
+			for i := range vehicles {
+				held, err := heldReservation(tx, vehicles[i].VehicleID)
+				if err != nil {
+					return err
+				}
+				if held != nil {
+					continue
+				}
+				if err := transitionStatus(tx, &vehicles[i], models.StockStatusWithdrawn, FeedSyncActor, "no longer in stock feed"); err != nil {
+					return dbError(err, "failed to withdraw vehicle %d", vehicles[i].VehicleID)
+				}
+				applied.Removed++
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return models.FeedSyncCounts{}, err
+	}
+
+	return applied, nil
+}
+
+// lockedVehicles locks the vehicles about to be updated and returns them as they are
+func lockedVehicles(tx *gorm.DB, vehicles []models.Vehicle) (map[int]models.Vehicle, error) {
+	locked := make(map[int]models.Vehicle, len(vehicles))
+	if len(vehicles) == 0 {
+		return locked, nil
+	}
+
+	ids := make([]int, len(vehicles))
+	for i, vehicle := range vehicles {
+		ids[i] = vehicle.VehicleID
+	}
+
+	var current []models.Vehicle
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("vehicle_id IN ?", ids).
+		Find(&current).Error; err != nil {
+		return nil, dbError(err, "failed to fetch current vehicles")
+	}
+
+	for _, vehicle := range current {
+		locked[vehicle.VehicleID] = vehicle
+	}
+
+	return locked, nil
+}
+
+// CreateFeedSyncRun records the outcome of a feed sync
+func (r *VehicleRepository) CreateFeedSyncRun(run *models.FeedSyncRun) error {
+	if err := r.db.Create(run).Error; err != nil {
+		return dbError(err, "failed to record feed sync run")
+	}
+	return nil
+}
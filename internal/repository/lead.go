@@ -0,0 +1,303 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Candoo/vehicles-api/internal/apperr"
+	"github.com/Candoo/vehicles-api/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// LeadStore is the storage of customer enquiries and the leads they create.
+// LeadRepository implements it on Postgres and MemoryLeadStore in memory.
+type LeadStore interface {
+	CreateEnquiry(vehicleID int, request models.EnquiryRequest) (*models.Lead, bool, error)
+	ListLeads(filters models.LeadFilters) ([]models.Lead, *models.ResponseMetadata, error)
+	ExportLeads(filters models.LeadFilters) ([]models.Lead, error)
+	GetLead(id uint) (*models.Lead, error)
+	TransitionLeadStatus(id uint, to models.LeadStatus, changedBy string) (*models.Lead, error)
+	AssignLead(id uint, assignee string) (*models.Lead, error)
+}
+
+var (
+	_ LeadStore = (*LeadRepository)(nil)
+	_ LeadStore = (*MemoryLeadStore)(nil)
+)
+
+// LeadRepository handles database operations for leads
+type LeadRepository struct {
+	db *gorm.DB
+}
+
+// NewLeadRepository creates a new lead repository
+func NewLeadRepository(db *gorm.DB) *LeadRepository {
+	return &LeadRepository{db: db}
+}
+
+// CreateEnquiry records an enquiry about a vehicle. It is added to the open lead of
+// the same contact for the vehicle when there is one, which repeat reports, and
+// starts a new lead at the vehicle's site otherwise.
+func (r *LeadRepository) CreateEnquiry(vehicleID int, request models.EnquiryRequest) (lead *models.Lead, repeat bool, err error) {
+	err = r.db.Transaction(func(tx *gorm.DB) error {
+		vehicle, err := findVehicle(tx, vehicleID)
+		if err != nil {
+			return err
+		}
+		if err := lockEnquiryContact(tx, vehicleID, request); err != nil {
+			return err
+		}
+
+		// The lead row is locked too, as an enquiry from the same customer under their
+		// other contact detail may be adding to it
+		var existing models.Lead
+		query := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("vehicle_id = ? AND status <> ?", vehicleID, models.LeadStatusClosed)
+		switch {
+		case request.Email != "" && request.Phone != "":
+			query = query.Where("(email = ? OR phone = ?)", request.Email, request.Phone)
+		case request.Email != "":
+			query = query.Where("email = ?", request.Email)
+		default:
+			query = query.Where("phone = ?", request.Phone)
+		}
+		err = query.Order("id ASC").First(&existing).Error
+
+		switch {
+		case err == nil:
+			lead, repeat = &existing, true
+			mergeEnquiry(lead, request, time.Now())
+			if err := tx.Model(lead).Updates(map[string]interface{}{
+				"name":                     lead.Name,
+				"email":                    lead.Email,
+				"phone":                    lead.Phone,
+				"preferred_contact_method": lead.PreferredContactMethod,
+				"enquiry_count":            lead.EnquiryCount,
+				"last_enquiry_at":          lead.LastEnquiryAt,
+			}).Error; err != nil {
+				return dbError(err, "failed to update lead")
+			}
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			lead = newLead(vehicle, request, time.Now())
+			if err := tx.Create(lead).Error; err != nil {
+				return dbError(err, "failed to create lead")
+			}
+		default:
+			return dbError(err, "failed to fetch lead")
+		}
+
+		enquiry := models.LeadEnquiry{LeadID: lead.ID, Message: request.Message}
+		if err := tx.Create(&enquiry).Error; err != nil {
+			return dbError(err, "failed to record enquiry")
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, false, err
+	}
+
+	return lead, repeat, nil
+}
+
+// lockEnquiryContact serialises enquiries from the same email address or phone number
+// about a vehicle until the transaction ends, so two first enquiries from one contact
+// cannot both miss the lead the other is creating. Enquiries from other customers
+// carry on alongside. Email is always locked before phone, so no two enquiries wait
+// on each other.
+func lockEnquiryContact(tx *gorm.DB, vehicleID int, request models.EnquiryRequest) error {
+	var keys []string
+	if request.Email != "" {
+		keys = append(keys, fmt.Sprintf("lead:%d:email:%s", vehicleID, request.Email))
+	}
+	if request.Phone != "" {
+		keys = append(keys, fmt.Sprintf("lead:%d:phone:%s", vehicleID, request.Phone))
+	}
+
+	for _, key := range keys {
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(hashtextextended(?, 0))", key).Error; err != nil {
+			return dbError(err, "failed to lock enquiry contact")
+		}
+	}
+	return nil
+}
+
+// ListLeads retrieves leads with pagination and filtering, most recent enquiry first
+func (r *LeadRepository) ListLeads(filters models.LeadFilters) ([]models.Lead, *models.ResponseMetadata, error) {
+	pageDefaults(&filters.Page, &filters.ResultsPerPage, 20)
+
+	var total int64
+	if err := applyLeadFilters(r.db.Model(&models.Lead{}), filters).Count(&total).Error; err != nil {
+		return nil, nil, dbError(err, "failed to count leads")
+	}
+
+	leads := []models.Lead{}
+	if err := applyLeadFilters(r.db, filters).
+		Order("last_enquiry_at DESC, id DESC").
+		Offset((filters.Page - 1) * filters.ResultsPerPage).
+		Limit(filters.ResultsPerPage).
+		Find(&leads).Error; err != nil {
+		return nil, nil, dbError(err, "failed to fetch leads")
+	}
+
+	return leads, pageMetadata(filters.Page, filters.ResultsPerPage, total), nil
+}
+
+// ExportLeads retrieves every lead matching the filters with its enquiries, ignoring
+// pagination, oldest first
+func (r *LeadRepository) ExportLeads(filters models.LeadFilters) ([]models.Lead, error) {
+	leads := []models.Lead{}
+	if err := applyLeadFilters(r.db, filters).
+		Preload("Enquiries", func(db *gorm.DB) *gorm.DB { return db.Order("created_at ASC, id ASC") }).
+		Order("created_at ASC, id ASC").
+		Find(&leads).Error; err != nil {
+		return nil, dbError(err, "failed to fetch leads")
+	}
+	return leads, nil
+}
+
+// GetLead retrieves a single lead with its enquiries, oldest first
+func (r *LeadRepository) GetLead(id uint) (*models.Lead, error) {
+	var lead models.Lead
+	if err := r.db.
+		Preload("Enquiries", func(db *gorm.DB) *gorm.DB { return db.Order("created_at ASC, id ASC") }).
+		First(&lead, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, apperr.NotFound("lead not found")
+		}
+		return nil, dbError(err, "failed to fetch lead")
+	}
+	return &lead, nil
+}
+
+// TransitionLeadStatus moves a lead to a new status. A lead marked contacted while
+// unassigned is assigned to changedBy.
+func (r *LeadRepository) TransitionLeadStatus(id uint, to models.LeadStatus, changedBy string) (*models.Lead, error) {
+	return r.updateLead(id, func(lead *models.Lead) error {
+		return transitionLead(lead, to, changedBy, time.Now())
+	})
+}
+
+// AssignLead assigns a lead to a member of staff, or unassigns it when assignee is empty
+func (r *LeadRepository) AssignLead(id uint, assignee string) (*models.Lead, error) {
+	return r.updateLead(id, func(lead *models.Lead) error {
+		return assignLead(lead, assignee)
+	})
+}
+
+// updateLead locks a lead, applies change to it and saves the status, assignment and
+// timestamps it may have changed
+func (r *LeadRepository) updateLead(id uint, change func(lead *models.Lead) error) (*models.Lead, error) {
+	var lead models.Lead
+
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&lead, id).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return apperr.NotFound("lead not found")
+			}
+			return dbError(err, "failed to fetch lead")
+		}
+
+		if err := change(&lead); err != nil {
+			return err
+		}
+
+		if err := tx.Model(&lead).Updates(map[string]interface{}{
+			"status":       lead.Status,
+			"assigned_to":  lead.AssignedTo,
+			"contacted_at": lead.ContactedAt,
+			"closed_at":    lead.ClosedAt,
+		}).Error; err != nil {
+			return dbError(err, "failed to update lead")
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &lead, nil
+}
+
+// applyLeadFilters adds the WHERE clauses for a set of lead filters
+func applyLeadFilters(query *gorm.DB, filters models.LeadFilters) *gorm.DB {
+	if len(filters.Statuses) > 0 {
+		query = query.Where("status IN ?", filters.Statuses)
+	}
+	if filters.AssignedTo != "" {
+		query = query.Where("assigned_to = ?", filters.AssignedTo)
+	}
+	if filters.Unassigned {
+		query = query.Where("(assigned_to = '' OR assigned_to IS NULL)")
+	}
+	if len(filters.SiteSlugs) > 0 {
+		query = query.Where("site_slug IN ?", filters.SiteSlugs)
+	}
+	if filters.VehicleID > 0 {
+		query = query.Where("vehicle_id = ?", filters.VehicleID)
+	}
+	if filters.Since != nil {
+		query = query.Where("last_enquiry_at >= ?", *filters.Since)
+	}
+	return query
+}
+
+// newLead starts a lead for an enquiry at the vehicle's site
+func newLead(vehicle *models.Vehicle, request models.EnquiryRequest, at time.Time) *models.Lead {
+	return &models.Lead{
+		VehicleID:              vehicle.VehicleID,
+		SiteID:                 vehicle.SiteID,
+		SiteSlug:               vehicle.SiteSlug,
+		Name:                   request.Name,
+		Email:                  request.Email,
+		Phone:                  request.Phone,
+		PreferredContactMethod: request.PreferredContactMethod,
+		Status:                 models.LeadStatusNew,
+		EnquiryCount:           1,
+		LastEnquiryAt:          at,
+	}
+}
+
+// mergeEnquiry adds a repeat enquiry to an open lead. The latest name and contact
+// method win, and a detail the lead lacked is filled in.
+func mergeEnquiry(lead *models.Lead, request models.EnquiryRequest, at time.Time) {
+	lead.Name = request.Name
+	lead.PreferredContactMethod = request.PreferredContactMethod
+	if lead.Email == "" {
+		lead.Email = request.Email
+	}
+	if lead.Phone == "" {
+		lead.Phone = request.Phone
+	}
+	lead.EnquiryCount++
+	lead.LastEnquiryAt = at
+}
+
+// transitionLead applies a status change allowed by the lead workflow
+func transitionLead(lead *models.Lead, to models.LeadStatus, changedBy string, at time.Time) error {
+	if !lead.Status.CanTransitionTo(to) {
+		return apperr.Conflict("invalid lead status transition from %s to %s", lead.Status, to)
+	}
+
+	lead.Status = to
+	switch to {
+	case models.LeadStatusContacted:
+		lead.ContactedAt = &at
+		if lead.AssignedTo == "" {
+			lead.AssignedTo = changedBy
+		}
+	case models.LeadStatusClosed:
+		lead.ClosedAt = &at
+	}
+	return nil
+}
+
+// assignLead assigns an open lead
+func assignLead(lead *models.Lead, assignee string) error {
+	if !lead.Open() {
+		return apperr.Conflict("closed leads cannot be reassigned")
+	}
+	lead.AssignedTo = assignee
+	return nil
+}
@@ -0,0 +1,169 @@
+package repository
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/Candoo/vehicles-api/internal/apperr"
+	"github.com/Candoo/vehicles-api/internal/models"
+)
+
+func testLeads(t *testing.T, store stores) {
+	if err := store.CreateSite(&models.Site{Slug: "winsford", Name: "Winsford"}); err != nil {
+		t.Fatalf("CreateSite: %v", err)
+	}
+	atSite := testVehicle(1, "Skoda", "Fabia", 5000)
+	atSite.SiteSlug = "winsford"
+	mustCreate(t, store, atSite, testVehicle(2, "Ford", "Fiesta", 7000))
+
+	enquire := func(vehicleID int, request models.EnquiryRequest) (*models.Lead, bool) {
+		t.Helper()
+		lead, repeat, err := store.CreateEnquiry(vehicleID, request)
+		if err != nil {
+			t.Fatalf("CreateEnquiry: %v", err)
+		}
+		return lead, repeat
+	}
+
+	first, repeat := enquire(1, models.EnquiryRequest{Name: "Sam", Email: "sam@example.com", Message: "Still available?", PreferredContactMethod: models.ContactMethodEmail})
+	if repeat || first.Status != models.LeadStatusNew || first.SiteSlug != "winsford" || first.SiteID == nil || first.EnquiryCount != 1 {
+		t.Fatalf("first lead = %+v, repeat %v", first, repeat)
+	}
+
+	// The same contact by phone after giving both details joins the open lead
+	again, repeat := enquire(1, models.EnquiryRequest{Name: "Sam Taylor", Email: "sam@example.com", Phone: "07700900123", Message: "Can I view it Saturday?", PreferredContactMethod: models.ContactMethodPhone})
+	if !repeat || again.ID != first.ID || again.EnquiryCount != 2 || again.Phone != "07700900123" || again.Name != "Sam Taylor" {
+		t.Fatalf("repeat lead = %+v, repeat %v", again, repeat)
+	}
+	byPhone, repeat := enquire(1, models.EnquiryRequest{Name: "Sam Taylor", Phone: "07700900123", PreferredContactMethod: models.ContactMethodPhone})
+	if !repeat || byPhone.ID != first.ID || byPhone.EnquiryCount != 3 {
+		t.Fatalf("phone repeat lead = %+v, repeat %v", byPhone, repeat)
+	}
+
+	// Another vehicle or another contact is another lead
+	other, repeat := enquire(2, models.EnquiryRequest{Name: "Sam", Email: "sam@example.com", PreferredContactMethod: models.ContactMethodEmail})
+	if repeat || other.ID == first.ID || other.SiteSlug != "" {
+		t.Fatalf("other vehicle lead = %+v, repeat %v", other, repeat)
+	}
+	enquire(1, models.EnquiryRequest{Name: "Alex", Phone: "01606555000", PreferredContactMethod: models.ContactMethodPhone})
+	_, _, err := store.CreateEnquiry(99, models.EnquiryRequest{Name: "Sam", Email: "sam@example.com"})
+	expectError(t, err, apperr.ErrNotFound)
+
+	lead, err := store.GetLead(first.ID)
+	if err != nil {
+		t.Fatalf("GetLead: %v", err)
+	}
+	if len(lead.Enquiries) != 3 || lead.Enquiries[0].Message != "Still available?" || lead.Enquiries[1].Message != "Can I view it Saturday?" {
+		t.Errorf("enquiries = %+v", lead.Enquiries)
+	}
+	_, err = store.GetLead(99)
+	expectError(t, err, apperr.ErrNotFound)
+
+	// Contacting an unassigned lead assigns it to whoever made contact
+	contacted, err := store.TransitionLeadStatus(first.ID, models.LeadStatusContacted, "sales-winsford")
+	if err != nil {
+		t.Fatalf("TransitionLeadStatus: %v", err)
+	}
+	if contacted.Status != models.LeadStatusContacted || contacted.AssignedTo != "sales-winsford" || contacted.ContactedAt == nil {
+		t.Errorf("contacted lead = %+v", contacted)
+	}
+	_, err = store.TransitionLeadStatus(first.ID, models.LeadStatusNew, "sales-winsford")
+	expectError(t, err, apperr.ErrConflict)
+
+	if assigned, err := store.AssignLead(other.ID, "sales-trafford"); err != nil || assigned.AssignedTo != "sales-trafford" {
+		t.Errorf("AssignLead = %+v, %v", assigned, err)
+	}
+
+	leads, meta, err := store.ListLeads(models.LeadFilters{Statuses: []models.LeadStatus{models.LeadStatusNew}})
+	if err != nil {
+		t.Fatalf("ListLeads: %v", err)
+	}
+	if len(leads) != 2 || meta.Total != 2 || leads[0].Name != "Alex" || leads[1].ID != other.ID {
+		t.Errorf("new leads = %+v, meta %+v", leads, meta)
+	}
+	if leads, _, _ := store.ListLeads(models.LeadFilters{Unassigned: true}); len(leads) != 1 || leads[0].Name != "Alex" {
+		t.Errorf("unassigned leads = %+v", leads)
+	}
+	if leads, _, _ := store.ListLeads(models.LeadFilters{SiteSlugs: []string{"winsford"}, ResultsPerPage: 1, Page: 2}); len(leads) != 1 || leads[0].ID != first.ID {
+		t.Errorf("second page of winsford leads = %+v", leads)
+	}
+
+	// Closed leads are final and a later enquiry starts a new one
+	if _, err := store.TransitionLeadStatus(first.ID, models.LeadStatusClosed, "sales-winsford"); err != nil {
+		t.Fatalf("TransitionLeadStatus: %v", err)
+	}
+	_, err = store.AssignLead(first.ID, "sales-trafford")
+	expectError(t, err, apperr.ErrConflict)
+	reopened, repeat := enquire(1, models.EnquiryRequest{Name: "Sam", Email: "sam@example.com", PreferredContactMethod: models.ContactMethodEmail})
+	if repeat || reopened.ID == first.ID {
+		t.Errorf("enquiry after close = %+v, repeat %v", reopened, repeat)
+	}
+
+	exported, err := store.ExportLeads(models.LeadFilters{VehicleID: 1})
+	if err != nil {
+		t.Fatalf("ExportLeads: %v", err)
+	}
+	if len(exported) != 3 || exported[0].ID != first.ID || len(exported[0].Enquiries) != 3 || exported[2].ID != reopened.ID {
+		t.Errorf("exported leads = %+v", exported)
+	}
+}
+
+func testConcurrentEnquiries(t *testing.T, store stores) {
+	mustCreate(t, store, testVehicle(1, "Skoda", "Fabia", 5000), testVehicle(2, "Ford", "Fiesta", 7000))
+
+	// Every first enquiry from the same contact races to create the lead
+	const enquiries = 8
+	var wg sync.WaitGroup
+	errs := make([]error, enquiries)
+	for i := range errs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, _, errs[i] = store.CreateEnquiry(1, models.EnquiryRequest{Name: "Sam", Email: "sam@example.com"})
+		}()
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			t.Fatalf("CreateEnquiry: %v", err)
+		}
+	}
+
+	leads, _, err := store.ListLeads(models.LeadFilters{})
+	if err != nil {
+		t.Fatalf("ListLeads: %v", err)
+	}
+	if len(leads) != 1 || leads[0].EnquiryCount != enquiries {
+		t.Errorf("leads = %+v, want one lead with %d enquiries", leads, enquiries)
+	}
+
+	// Repeat enquiries under either of a customer's contact details all add to their lead
+	if _, _, err := store.CreateEnquiry(2, models.EnquiryRequest{Name: "Alex", Email: "alex@example.com", Phone: "07700900123"}); err != nil {
+		t.Fatalf("CreateEnquiry: %v", err)
+	}
+	for i := range errs {
+		request := models.EnquiryRequest{Name: "Alex", Email: "alex@example.com"}
+		if i%2 == 1 {
+			request = models.EnquiryRequest{Name: "Alex", Phone: "07700900123"}
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, _, errs[i] = store.CreateEnquiry(2, request)
+		}()
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			t.Fatalf("CreateEnquiry: %v", err)
+		}
+	}
+
+	leads, _, err = store.ListLeads(models.LeadFilters{VehicleID: 2})
+	if err != nil {
+		t.Fatalf("ListLeads: %v", err)
+	}
+	if len(leads) != 1 || leads[0].EnquiryCount != enquiries+1 {
+		t.Errorf("leads = %+v, want one lead with %d enquiries", leads, enquiries+1)
+	}
+}
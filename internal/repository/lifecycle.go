@@ -0,0 +1,87 @@
+package repository
+
+import (
+	"errors"
+
+	"github.com/Candoo/vehicles-api/internal/apperr"
+	"github.com/Candoo/vehicles-api/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// TransitionVehicleStatus moves a vehicle to a new stock status and records the change.
+// A vehicle held by an online reservation only leaves reserved through the reservation.
+func (r *VehicleRepository) TransitionVehicleStatus(id int, to models.StockStatus, changedBy, reason string) (*models.Vehicle, error) {
+	var vehicle models.Vehicle
+
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&vehicle, id).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return apperr.NotFound("vehicle not found")
+			}
+			return dbError(err, "failed to fetch vehicle")
+		}
+
+		if err := checkNotHeld(tx, &vehicle, to); err != nil {
+			return err
+		}
+
+		return transitionStatus(tx, &vehicle, to, changedBy, reason)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &vehicle, nil
+}
+
+// GetStatusHistory retrieves the lifecycle changes of a vehicle, oldest first
+func (r *VehicleRepository) GetStatusHistory(id int) ([]models.VehicleStatusChange, error) {
+	if _, err := r.GetVehicleByID(id); err != nil {
+		return nil, err
+	}
+
+	history := []models.VehicleStatusChange{}
+	if err := r.db.Where("vehicle_id = ?", id).
+		Order("changed_at ASC, id ASC").
+		Find(&history).Error; err != nil {
+		return nil, dbError(err, "failed to fetch status history")
+	}
+
+	return history, nil
+}
+
+// transitionStatus applies a status change to a vehicle already locked by the caller,
+// recording it in the status history and the event outbox
+func transitionStatus(tx *gorm.DB, vehicle *models.Vehicle, to models.StockStatus, changedBy, reason string) error {
+	from := vehicle.StockStatus
+	if err := checkTransition(from, to); err != nil {
+		return err
+	}
+
+	if err := tx.Model(vehicle).Update("stock_status", to).Error; err != nil {
+		return dbError(err, "failed to update status")
+	}
+	vehicle.StockStatus = to
+
+	change := models.VehicleStatusChange{
+		VehicleID:  vehicle.VehicleID,
+		FromStatus: from,
+		ToStatus:   to,
+		ChangedBy:  changedBy,
+		Reason:     reason,
+	}
+	if err := tx.Create(&change).Error; err != nil {
+		return dbError(err, "failed to record status change")
+	}
+
+	return recordEvents(tx, statusEvent(from, *vehicle))
+}
+
+// checkTransition rejects status changes not allowed by the stock lifecycle
+func checkTransition(from, to models.StockStatus) error {
+	if !from.CanTransitionTo(to) {
+		return apperr.Conflict("invalid status transition from %s to %s", from, to)
+	}
+	return nil
+}
@@ -0,0 +1,166 @@
+package repository
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/Candoo/vehicles-api/internal/geo"
+	"github.com/Candoo/vehicles-api/internal/models"
+)
+
+// matchVehicle reports whether a vehicle passes the filters other than exclude,
+// setting its relevance and distance as it goes. query and siteLocations are the
+// parsed search query and the site locations needed by near, when those are set.
+func matchVehicle(vehicle *models.Vehicle, filters models.VehicleFilters, exclude string, query *searchQuery, siteLocations map[uint]geo.Point) bool {
+	if len(filters.StockStatuses) > 0 && !containsStatus(filters.StockStatuses, vehicle.StockStatus) {
+		return false
+	}
+
+	if query != nil {
+		relevance, ok := query.match(vehicle)
+		if !ok {
+			return false
+		}
+		vehicle.Relevance = relevance
+	}
+
+	if exclude != "advert_classification" && filters.AdvertClassification != "" && !strings.EqualFold(filters.AdvertClassification, "all") &&
+		!strings.EqualFold(vehicle.AdvertClassification, filters.AdvertClassification) {
+		return false
+	}
+	if exclude != "make" && (!matchesFold(vehicle.Make, filters.Makes) || !matchesFold(vehicle.MakeSlug, filters.MakeSlugs)) {
+		return false
+	}
+	if !matchesFold(vehicle.RangeSlug, filters.RangeSlugs) {
+		return false
+	}
+	if filters.Model != "" && !strings.Contains(strings.ToLower(vehicle.Model), strings.ToLower(filters.Model)) {
+		return false
+	}
+	if exclude != "fuel_type" && !matchesFold(vehicle.FuelType, filters.FuelTypes) {
+		return false
+	}
+	if exclude != "transmission" && !matchesFold(vehicle.Transmission, filters.Transmissions) {
+		return false
+	}
+	if exclude != "body_type" && !matchesFold(vehicle.BodyType, filters.BodyTypes) {
+		return false
+	}
+	if !matchesFold(vehicle.Colour, filters.Colours) || !matchesFold(vehicle.Drivetrain, filters.Drivetrains) ||
+		!matchesFold(vehicle.InsuranceGroup, filters.InsuranceGroups) || !matchesFold(vehicle.SiteSlug, filters.SiteSlugs) ||
+		!matchesFold(vehicle.Location, filters.Locations) {
+		return false
+	}
+	if !matchesNumber(vehicle.Doors, filters.Doors) || !matchesNumber(vehicle.Seats, filters.Seats) {
+		return false
+	}
+	if filters.MinMileage != nil && vehicle.OdometerValue < *filters.MinMileage {
+		return false
+	}
+	if filters.MaxMileage != nil && vehicle.OdometerValue > *filters.MaxMileage {
+		return false
+	}
+	if filters.MaxPreviousKeepers != nil && vehicle.PreviousKeepers > *filters.MaxPreviousKeepers {
+		return false
+	}
+	if exclude != "has_offer" && filters.HasOffer != nil && vehicle.HasOffer != *filters.HasOffer {
+		return false
+	}
+	if exclude != "price" && filters.MinPrice > 0 && vehicle.Price < filters.MinPrice {
+		return false
+	}
+	if exclude != "price" && filters.MaxPrice > 0 && vehicle.Price > filters.MaxPrice {
+		return false
+	}
+	if !yearInRange(vehicle.Year, filters.MinYear, filters.MaxYear) {
+		return false
+	}
+	if filters.Near != nil {
+		location, ok := siteLocations[siteID(vehicle.SiteID)]
+		if !ok {
+			return false
+		}
+		distance := geo.RoundMiles(geo.DistanceMiles(*filters.Near, location))
+		if filters.RadiusMiles > 0 && distance > float64(filters.RadiusMiles) {
+			return false
+		}
+		vehicle.DistanceMiles = &distance
+	}
+
+	return true
+}
+
+// VehicleMatcher checks single vehicles against GET /vehicles filters, as vehicles
+// arrive one at a time on the live stock stream. Free-text search needs Postgres, so
+// the query is ignored; callers must not accept one.
+type VehicleMatcher struct {
+	filters       models.VehicleFilters
+	siteLocations map[uint]geo.Point
+}
+
+// NewVehicleMatcher creates a matcher for filters. sites places vehicles for near
+// searches and is only needed when near is set.
+func NewVehicleMatcher(filters models.VehicleFilters, sites []models.Site) *VehicleMatcher {
+	matcher := &VehicleMatcher{filters: filters, siteLocations: make(map[uint]geo.Point)}
+	for _, site := range sites {
+		if site.Latitude != nil && site.Longitude != nil {
+			matcher.siteLocations[site.ID] = geo.Point{Latitude: *site.Latitude, Longitude: *site.Longitude}
+		}
+	}
+	return matcher
+}
+
+// Match reports whether a vehicle passes the filters
+func (m *VehicleMatcher) Match(vehicle models.Vehicle) bool {
+	return matchVehicle(&vehicle, m.filters, "", nil, m.siteLocations)
+}
+
+// siteID dereferences a vehicle's site ID, returning 0 when it has no site
+func siteID(id *uint) uint {
+	if id == nil {
+		return 0
+	}
+	return *id
+}
+
+// matchesFold reports whether value equals any of values ignoring case, or values is empty
+func matchesFold(value string, values []string) bool {
+	if len(values) == 0 {
+		return true
+	}
+	for _, candidate := range values {
+		if strings.EqualFold(value, candidate) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesNumber reports whether a numeric text value is one of values, or values is empty
+func matchesNumber(value string, values []int) bool {
+	if len(values) == 0 {
+		return true
+	}
+	number, err := strconv.Atoi(value)
+	if err != nil {
+		return false
+	}
+	for _, candidate := range values {
+		if number == candidate {
+			return true
+		}
+	}
+	return false
+}
+
+// yearInRange checks a vehicle year against the optional min_year and max_year filters
+func yearInRange(year string, minYear, maxYear int) bool {
+	value, err := strconv.Atoi(year)
+	if minYear > 0 && (err != nil || value < minYear) {
+		return false
+	}
+	if maxYear > 0 && (err != nil || value > maxYear) {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,1331 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/Candoo/vehicles-api/internal/apperr"
+	"github.com/Candoo/vehicles-api/internal/geo"
+	"github.com/Candoo/vehicles-api/internal/models"
+)
+
+// MemoryVehicleStore is an in-memory VehicleStore for tests. It applies the same
+// filtering, ordering, pagination and errors as VehicleRepository; free-text search
+// approximates Postgres full-text search with plain word matching.
+type MemoryVehicleStore struct {
+	mu            sync.RWMutex
+	vehicles      map[int]models.Vehicle
+	statusHistory []models.VehicleStatusChange
+	priceHistory  []models.VehiclePriceChange
+	syncRuns      []models.FeedSyncRun
+	sites         map[string]models.Site
+	transfers     []models.VehicleTransfer
+	partExchanges []models.PartExchange
+	outbox        []models.OutboxEvent
+	// reservations holds the vehicles reserved online; nil until a reservation
+	// store is created on this store
+	reservations *MemoryReservationStore
+}
+
+// NewMemoryVehicleStore creates an empty in-memory vehicle store
+func NewMemoryVehicleStore() *MemoryVehicleStore {
+	return &MemoryVehicleStore{
+		vehicles: make(map[int]models.Vehicle),
+		sites:    make(map[string]models.Site),
+	}
+}
+
+// GetVehicles retrieves vehicles with pagination and filtering
+func (s *MemoryVehicleStore) GetVehicles(filters models.VehicleFilters) ([]models.Vehicle, *models.ResponseMetadata, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	matched := s.filter(filters, "")
+	total := int64(len(matched))
+
+	pageDefaults(&filters.Page, &filters.ResultsPerPage, 10)
+
+	backward := filters.Cursor != nil && filters.Cursor.Backward
+	sort.Slice(matched, func(i, j int) bool {
+		return compareSortKeys(sortKeys(&matched[i], filters.Sort), sortKeys(&matched[j], filters.Sort), filters.Sort, backward) < 0
+	})
+
+	if filters.Cursor != nil {
+		cursorKeys := make([]interface{}, 0, len(filters.Sort)+1)
+		for i, field := range filters.Sort {
+			value, err := filters.Cursor.Value(i, field.Field)
+			if err != nil {
+				return nil, nil, apperr.Validation("invalid cursor: %v", err)
+			}
+			cursorKeys = append(cursorKeys, value)
+		}
+		cursorKeys = append(cursorKeys, filters.Cursor.VehicleID)
+
+		after := matched[:0]
+		for _, vehicle := range matched {
+			if compareSortKeys(sortKeys(&vehicle, filters.Sort), cursorKeys, filters.Sort, backward) > 0 {
+				after = append(after, vehicle)
+			}
+		}
+		matched = after
+	} else {
+		offset := (filters.Page - 1) * filters.ResultsPerPage
+		if offset > len(matched) {
+			offset = len(matched)
+		}
+		matched = matched[offset:]
+	}
+
+	// Keep one extra row to find out whether another page follows
+	if len(matched) > filters.ResultsPerPage+1 {
+		matched = matched[:filters.ResultsPerPage+1]
+	}
+
+	return buildPage(matched, filters, total)
+}
+
+// GetFacets counts vehicles per facet value under the given filters, each facet ignoring its own filter
+func (s *MemoryVehicleStore) GetFacets(filters models.VehicleFilters) (*models.Facets, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	column := func(value func(v *models.Vehicle) string) func(v *models.Vehicle) (string, bool) {
+		return func(v *models.Vehicle) (string, bool) { return value(v), true }
+	}
+
+	facets := &models.Facets{
+		AdvertClassification: s.countBy(filters, "advert_classification", column(func(v *models.Vehicle) string { return v.AdvertClassification })),
+		Make:                 s.countBy(filters, "make", column(func(v *models.Vehicle) string { return v.Make })),
+		FuelType:             s.countBy(filters, "fuel_type", column(func(v *models.Vehicle) string { return v.FuelType })),
+		Transmission:         s.countBy(filters, "transmission", column(func(v *models.Vehicle) string { return v.Transmission })),
+		BodyType:             s.countBy(filters, "body_type", column(func(v *models.Vehicle) string { return v.BodyType })),
+		HasOffer:             s.countBy(filters, "has_offer", column(func(v *models.Vehicle) string { return strconv.FormatBool(v.HasOffer) })),
+	}
+
+	facets.PriceBand = priceBandCounts(s.countBy(filters, "price", func(v *models.Vehicle) (string, bool) {
+		for _, band := range models.PriceBands {
+			if v.Price >= band.Min && (band.Max == 0 || v.Price < band.Max) {
+				return band.Label, true
+			}
+		}
+		return "", false
+	}))
+
+	return facets, nil
+}
+
+// countBy counts matching vehicles per value, most common first
+func (s *MemoryVehicleStore) countBy(filters models.VehicleFilters, facet string, value func(v *models.Vehicle) (string, bool)) []models.FacetCount {
+	byValue := make(map[string]int64)
+	for _, vehicle := range s.filter(filters, facet) {
+		if key, ok := value(&vehicle); ok {
+			byValue[key]++
+		}
+	}
+
+	counts := make([]models.FacetCount, 0, len(byValue))
+	for key, count := range byValue {
+		counts = append(counts, models.FacetCount{Value: key, Count: count})
+	}
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].Count != counts[j].Count {
+			return counts[i].Count > counts[j].Count
+		}
+		return counts[i].Value < counts[j].Value
+	})
+
+	return counts
+}
+
+// GetVehicleByID retrieves a single vehicle by ID
+func (s *MemoryVehicleStore) GetVehicleByID(id int) (*models.Vehicle, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	vehicle, ok := s.vehicles[id]
+	if !ok {
+		return nil, apperr.NotFound("vehicle not found")
+	}
+	return &vehicle, nil
+}
+
+// GetVehicleByVRM retrieves a single vehicle by VRM (Vehicle Registration Mark)
+func (s *MemoryVehicleStore) GetVehicleByVRM(vrm string) (*models.Vehicle, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, vehicle := range s.sorted() {
+		if strings.EqualFold(vehicle.VRM, vrm) {
+			return &vehicle, nil
+		}
+	}
+	return nil, apperr.NotFound("vehicle not found")
+}
+
+// GetVehicleBySlug retrieves a single vehicle by its listing slug
+func (s *MemoryVehicleStore) GetVehicleBySlug(slug string) (*models.Vehicle, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, vehicle := range s.sorted() {
+		if vehicle.Slug == strings.ToLower(slug) {
+			return &vehicle, nil
+		}
+	}
+	return nil, apperr.NotFound("vehicle not found")
+}
+
+// GetAvailableMakes retrieves all unique makes
+func (s *MemoryVehicleStore) GetAvailableMakes() ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.distinct(func(v *models.Vehicle) (string, bool) { return v.Make, true }), nil
+}
+
+// GetAvailableModels retrieves all unique models for a given make
+func (s *MemoryVehicleStore) GetAvailableModels(make string) ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.distinct(func(v *models.Vehicle) (string, bool) {
+		return v.Model, make == "" || strings.EqualFold(v.Make, make)
+	}), nil
+}
+
+// GetTaxonomy builds the make, range, model and derivative tree of listed vehicles
+func (s *MemoryVehicleStore) GetTaxonomy() ([]models.TaxonomyMake, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var rows []taxonomyRow
+	for _, vehicle := range s.sorted() {
+		if !isListed(vehicle.StockStatus) {
+			continue
+		}
+		rows = append(rows, taxonomyRow{
+			Make:       vehicle.Make,
+			MakeSlug:   vehicle.MakeSlug,
+			Range:      vehicle.Range,
+			RangeSlug:  vehicle.RangeSlug,
+			Model:      vehicle.Model,
+			Derivative: vehicle.Derivative,
+			Count:      1,
+			MinPrice:   vehicle.Price,
+			MaxPrice:   vehicle.Price,
+		})
+	}
+
+	return buildTaxonomy(rows), nil
+}
+
+// CreateVehicle inserts a new vehicle, rejecting clashes on vehicle ID, VRM, stock ID
+// or a chosen slug. Missing slugs are generated.
+func (s *MemoryVehicleStore) CreateVehicle(vehicle *models.Vehicle) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.conflicts(vehicle, nil) {
+		return errVehicleExists
+	}
+	if err := assignSlug(vehicle, true, s.slugTaken(vehicle.VehicleID)); err != nil {
+		return err
+	}
+	s.linkSite(vehicle)
+
+	s.insert(vehicle)
+	return s.recordEvents(vehicleEvent(models.EventVehicleCreated, *vehicle))
+}
+
+// UpdateVehicle replaces every field of an existing vehicle. The slug is kept
+// unless a new one is given; the site only changes through TransferVehicle.
+func (s *MemoryVehicleStore) UpdateVehicle(id int, vehicle *models.Vehicle) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	existing, ok := s.vehicles[id]
+	if !ok {
+		return apperr.NotFound("vehicle not found")
+	}
+
+	vehicle.VehicleID = id
+	if s.conflicts(vehicle, &id) {
+		return errVehicleExists
+	}
+	if vehicle.Slug == "" {
+		vehicle.Slug = existing.Slug
+	}
+	if err := assignSlug(vehicle, true, s.slugTaken(id)); err != nil {
+		return err
+	}
+
+	updated := *vehicle
+	updated.CreatedAt = existing.CreatedAt
+	updated.Source = existing.Source
+	updated.StockStatus = existing.StockStatus
+	updated.SiteID, updated.Site, updated.SiteSlug = existing.SiteID, existing.Site, existing.SiteSlug
+	updated.Relevance, updated.DistanceMiles = 0, nil
+	updated.UpdatedAt = now()
+	s.vehicles[id] = updated
+
+	s.recordPriceChange(id, existing.Price, updated.Price, models.PriceSourceAPI)
+
+	*vehicle = updated
+	return s.recordEvents(updateEvents(existing, updated)...)
+}
+
+// DeleteVehicle removes a vehicle by ID
+func (s *MemoryVehicleStore) DeleteVehicle(id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.vehicles[id]; !ok {
+		return apperr.NotFound("vehicle not found")
+	}
+
+	delete(s.vehicles, id)
+	return s.recordEvents(deletedEvent(id))
+}
+
+// TransitionVehicleStatus moves a vehicle to a new stock status and records the change
+func (s *MemoryVehicleStore) TransitionVehicleStatus(id int, to models.StockStatus, changedBy, reason string) (*models.Vehicle, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	vehicle, ok := s.vehicles[id]
+	if !ok {
+		return nil, apperr.NotFound("vehicle not found")
+	}
+
+	if held := s.heldReservation(id); held != nil && vehicle.StockStatus == models.StockStatusReserved && to != models.StockStatusReserved {
+		return nil, errReservationHeld(held)
+	}
+	if err := s.transitionStatus(&vehicle, to, changedBy, reason); err != nil {
+		return nil, err
+	}
+
+	return &vehicle, nil
+}
+
+// GetStatusHistory retrieves the lifecycle changes of a vehicle, oldest first
+func (s *MemoryVehicleStore) GetStatusHistory(id int) ([]models.VehicleStatusChange, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if _, ok := s.vehicles[id]; !ok {
+		return nil, apperr.NotFound("vehicle not found")
+	}
+
+	history := []models.VehicleStatusChange{}
+	for _, change := range s.statusHistory {
+		if change.VehicleID == id {
+			history = append(history, change)
+		}
+	}
+	return history, nil
+}
+
+// GetPriceHistory retrieves the price changes of a vehicle, oldest first
+func (s *MemoryVehicleStore) GetPriceHistory(id int) ([]models.VehiclePriceChange, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if _, ok := s.vehicles[id]; !ok {
+		return nil, apperr.NotFound("vehicle not found")
+	}
+
+	history := []models.VehiclePriceChange{}
+	for _, change := range s.priceHistory {
+		if change.VehicleID == id {
+			history = append(history, change)
+		}
+	}
+	return history, nil
+}
+
+// GetPriceDrops retrieves listed vehicles now cheaper than before their first price
+// change since the given time, biggest percentage reduction first
+func (s *MemoryVehicleStore) GetPriceDrops(since time.Time) ([]models.PriceDrop, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	type window struct {
+		previousPrice models.Money
+		reducedAt     time.Time
+	}
+
+	// Price history is kept in insertion order, so the first change seen is the oldest
+	windows := make(map[int]*window)
+	for _, change := range s.priceHistory {
+		if change.ChangedAt.Before(since) {
+			continue
+		}
+		w, ok := windows[change.VehicleID]
+		if !ok {
+			windows[change.VehicleID] = &window{previousPrice: change.OldPrice, reducedAt: change.ChangedAt}
+			continue
+		}
+		if change.ChangedAt.After(w.reducedAt) {
+			w.reducedAt = change.ChangedAt
+		}
+	}
+
+	drops := []models.PriceDrop{}
+	for id, w := range windows {
+		vehicle, ok := s.vehicles[id]
+		if !ok || !isListed(vehicle.StockStatus) || vehicle.Price >= w.previousPrice {
+			continue
+		}
+		drops = append(drops, newPriceDrop(vehicle, w.previousPrice, w.reducedAt))
+	}
+
+	sortPriceDrops(drops)
+	return drops, nil
+}
+
+// ListAllVehicles retrieves every vehicle, whatever its source or stock status, for the
+// feed sync to plan against
+func (s *MemoryVehicleStore) ListAllVehicles() ([]models.Vehicle, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.sorted(), nil
+}
+
+// ApplyFeedSync inserts new feed vehicles, replaces changed ones and withdraws vehicles
+// that dropped out of the feed. Nothing is changed when any step fails. Updates leave
+// stock_status, the slug, the site and the location alone. The counts returned leave
+// out the vehicles skipped.
+func (s *MemoryVehicleStore) ApplyFeedSync(inserts, updates []models.Vehicle, removals []int) (models.FeedSyncCounts, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	vehicles := make(map[int]models.Vehicle, len(s.vehicles))
+	for id, vehicle := range s.vehicles {
+		vehicles[id] = vehicle
+	}
+	statusHistory, priceHistory, outbox := len(s.statusHistory), len(s.priceHistory), len(s.outbox)
+
+	applied, err := s.applyFeedSync(inserts, updates, removals)
+	if err != nil {
+		s.vehicles = vehicles
+		s.statusHistory = s.statusHistory[:statusHistory]
+		s.priceHistory = s.priceHistory[:priceHistory]
+		s.outbox = s.outbox[:outbox]
+		return models.FeedSyncCounts{}, err
+	}
+	return applied, nil
+}
+
+// applyFeedSync applies a feed sync, leaving the caller to roll back on error
+func (s *MemoryVehicleStore) applyFeedSync(inserts, updates []models.Vehicle, removals []int) (models.FeedSyncCounts, error) {
+	var applied models.FeedSyncCounts
+
+	for i := range inserts {
+		if _, ok := s.vehicles[inserts[i].VehicleID]; ok {
+			return applied, fmt.Errorf("failed to insert vehicle %d: %w", inserts[i].VehicleID, errors.New("duplicate vehicle_id"))
+		}
+		if err := assignSlug(&inserts[i], false, s.slugTaken(inserts[i].VehicleID)); err != nil {
+			return applied, err
+		}
+		s.linkSite(&inserts[i])
+		s.insert(&inserts[i])
+		if err := s.recordEvents(vehicleEvent(models.EventVehicleCreated, inserts[i])); err != nil {
+			return applied, err
+		}
+		applied.Inserted++
+	}
+
+	for i := range updates {
+		existing, ok := s.vehicles[updates[i].VehicleID]
+		if !ok {
+			continue
+		}
+
+		updated := updates[i]
+		updated.CreatedAt = existing.CreatedAt
+		updated.StockStatus = existing.StockStatus
+		updated.Slug = existing.Slug
+		updated.SiteID, updated.Site, updated.SiteSlug = existing.SiteID, existing.Site, existing.SiteSlug
+		updated.Location, updated.LocationSlug = existing.Location, existing.LocationSlug
+		updated.Relevance, updated.DistanceMiles = 0, nil
+		updated.UpdatedAt = now()
+		s.vehicles[updated.VehicleID] = updated
+
+		s.recordPriceChange(updated.VehicleID, existing.Price, updated.Price, models.PriceSourceFeed)
+		if err := s.recordEvents(updateEvents(existing, updated)...); err != nil {
+			return applied, err
+		}
+		applied.Updated++
+	}
+
+	for _, id := range removals {
+		vehicle, ok := s.vehicles[id]
+		if !ok || s.heldReservation(id) != nil {
+			continue
+		}
+		if err := s.transitionStatus(&vehicle, models.StockStatusWithdrawn, FeedSyncActor, "no longer in stock feed"); err != nil {
+			return applied, fmt.Errorf("failed to withdraw vehicle %d: %w", id, err)
+		}
+		applied.Removed++
+	}
+
+	return applied, nil
+}
+
+// ListSites retrieves every site ordered by name
+func (s *MemoryVehicleStore) ListSites() ([]models.Site, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	sites := make([]models.Site, 0, len(s.sites))
+	for _, site := range s.sites {
+		sites = append(sites, site)
+	}
+	sort.Slice(sites, func(i, j int) bool {
+		if sites[i].Name != sites[j].Name {
+			return sites[i].Name < sites[j].Name
+		}
+		return sites[i].Slug < sites[j].Slug
+	})
+	return sites, nil
+}
+
+// GetSiteBySlug retrieves a single site by slug
+func (s *MemoryVehicleStore) GetSiteBySlug(slug string) (*models.Site, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	site, ok := s.sites[strings.ToLower(slug)]
+	if !ok {
+		return nil, apperr.NotFound("site not found")
+	}
+	return &site, nil
+}
+
+// CreateSite inserts a new site, rejecting a slug that is already used
+func (s *MemoryVehicleStore) CreateSite(site *models.Site) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.sites[site.Slug]; ok {
+		return errSiteExists
+	}
+
+	var lastID uint
+	for _, existing := range s.sites {
+		if existing.ID > lastID {
+			lastID = existing.ID
+		}
+	}
+	site.ID = lastID + 1
+	site.CreatedAt = now()
+	site.UpdatedAt = site.CreatedAt
+	if site.OpeningHours == nil {
+		site.OpeningHours = models.OpeningHoursList{}
+	}
+	s.sites[site.Slug] = *site
+
+	// Vehicles already carrying the slug from the feed now belong to the site
+	for id, vehicle := range s.vehicles {
+		if vehicle.SiteSlug == site.Slug && vehicle.SiteID == nil {
+			siteID := site.ID
+			vehicle.SiteID = &siteID
+			s.vehicles[id] = vehicle
+		}
+	}
+
+	return nil
+}
+
+// UpdateSite replaces every field of an existing site except its slug. A new name
+// is copied to the site's vehicles.
+func (s *MemoryVehicleStore) UpdateSite(slug string, site *models.Site) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	existing, ok := s.sites[strings.ToLower(slug)]
+	if !ok {
+		return apperr.NotFound("site not found")
+	}
+
+	updated := *site
+	updated.ID = existing.ID
+	updated.Slug = existing.Slug
+	updated.CreatedAt = existing.CreatedAt
+	updated.UpdatedAt = now()
+	if updated.OpeningHours == nil {
+		updated.OpeningHours = models.OpeningHoursList{}
+	}
+	s.sites[updated.Slug] = updated
+
+	if updated.Name != existing.Name {
+		for id, vehicle := range s.vehicles {
+			if vehicle.SiteID != nil && *vehicle.SiteID == existing.ID {
+				vehicle.Site = updated.Name
+				s.vehicles[id] = vehicle
+			}
+		}
+	}
+
+	*site = updated
+	return nil
+}
+
+// TransferVehicle moves a vehicle to another site and records the transfer
+func (s *MemoryVehicleStore) TransferVehicle(id int, transfer models.TransferRequest, transferredBy string) (*models.Vehicle, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	vehicle, ok := s.vehicles[id]
+	if !ok {
+		return nil, apperr.NotFound("vehicle not found")
+	}
+
+	site, ok := s.sites[strings.ToLower(transfer.SiteSlug)]
+	if !ok {
+		return nil, apperr.Validation("site %q does not exist", transfer.SiteSlug)
+	}
+
+	record, err := checkTransfer(&vehicle, &site, transfer, transferredBy)
+	if err != nil {
+		return nil, err
+	}
+
+	previous := vehicle
+	vehicle.SiteID, vehicle.Site, vehicle.SiteSlug = &site.ID, site.Name, site.Slug
+	vehicle.Location, vehicle.LocationSlug = transfer.Location, models.Slugify(transfer.Location)
+	vehicle.UpdatedAt = now()
+	s.vehicles[id] = vehicle
+
+	record.ID = uint(len(s.transfers) + 1)
+	record.TransferredAt = vehicle.UpdatedAt
+	s.transfers = append(s.transfers, *record)
+
+	if err := s.recordEvents(updatedEvent(previous, vehicle)); err != nil {
+		return nil, err
+	}
+	return &vehicle, nil
+}
+
+// GetTransferHistory retrieves the site transfers of a vehicle, oldest first
+func (s *MemoryVehicleStore) GetTransferHistory(id int) ([]models.VehicleTransfer, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if _, ok := s.vehicles[id]; !ok {
+		return nil, apperr.NotFound("vehicle not found")
+	}
+
+	history := []models.VehicleTransfer{}
+	for _, transfer := range s.transfers {
+		if transfer.VehicleID == id {
+			history = append(history, transfer)
+		}
+	}
+	return history, nil
+}
+
+// GetValuationSamples retrieves every vehicle with both a price and a price when
+// new, whatever its stock status, for the part-exchange estimator
+func (s *MemoryVehicleStore) GetValuationSamples() ([]models.Vehicle, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	vehicles := []models.Vehicle{}
+	for _, vehicle := range s.sorted() {
+		if vehicle.Price > 0 && vehicle.PriceWhenNew > 0 {
+			vehicles = append(vehicles, vehicle)
+		}
+	}
+	return vehicles, nil
+}
+
+// CreatePartExchange records a part-exchange request against a vehicle
+func (s *MemoryVehicleStore) CreatePartExchange(request *models.PartExchange) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.vehicles[request.VehicleID]; !ok {
+		return apperr.NotFound("vehicle not found")
+	}
+
+	request.ID = uint(len(s.partExchanges) + 1)
+	request.CreatedAt = now()
+	s.partExchanges = append(s.partExchanges, *request)
+	return nil
+}
+
+// GetPartExchanges retrieves the part-exchange requests made against a vehicle,
+// newest first
+func (s *MemoryVehicleStore) GetPartExchanges(id int) ([]models.PartExchange, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if _, ok := s.vehicles[id]; !ok {
+		return nil, apperr.NotFound("vehicle not found")
+	}
+
+	requests := []models.PartExchange{}
+	for i := len(s.partExchanges) - 1; i >= 0; i-- {
+		if s.partExchanges[i].VehicleID == id {
+			requests = append(requests, s.partExchanges[i])
+		}
+	}
+	return requests, nil
+}
+
+// CreateFeedSyncRun records the outcome of a feed sync
+func (s *MemoryVehicleStore) CreateFeedSyncRun(run *models.FeedSyncRun) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	run.ID = uint(len(s.syncRuns) + 1)
+	s.syncRuns = append(s.syncRuns, *run)
+	return nil
+}
+
+// PendingEvents retrieves up to limit events not yet published, oldest first
+func (s *MemoryVehicleStore) PendingEvents(limit int) ([]models.VehicleEvent, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	pending := []models.OutboxEvent{}
+	for _, event := range s.outbox {
+		if event.PublishedAt == nil && len(pending) < limit {
+			pending = append(pending, event)
+		}
+	}
+	return decodeEvents(pending)
+}
+
+// MarkEventPublished records that an event was published at at
+func (s *MemoryVehicleStore) MarkEventPublished(id string, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.outbox {
+		if s.outbox[i].EventID == id {
+			s.outbox[i].PublishedAt = &at
+		}
+	}
+	return nil
+}
+
+// heldReservation returns the reservation holding a vehicle, or nil when it is not held
+func (s *MemoryVehicleStore) heldReservation(vehicleID int) *models.Reservation {
+	if s.reservations == nil {
+		return nil
+	}
+	return s.reservations.heldReservation(vehicleID, 0)
+}
+
+// insert stores a new vehicle, filling in the column defaults and timestamps
+func (s *MemoryVehicleStore) insert(vehicle *models.Vehicle) {
+	if vehicle.StockStatus == "" {
+		vehicle.StockStatus = models.StockStatusInStock
+	}
+	if vehicle.Source == "" {
+		vehicle.Source = models.VehicleSourceFeed
+	}
+	created := now()
+	if vehicle.CreatedAt.IsZero() {
+		vehicle.CreatedAt = created
+	}
+	if vehicle.UpdatedAt.IsZero() {
+		vehicle.UpdatedAt = created
+	}
+	vehicle.Relevance, vehicle.DistanceMiles = 0, nil
+
+	s.vehicles[vehicle.VehicleID] = *vehicle
+}
+
+// conflicts reports whether another vehicle already uses the same ID, VRM or stock ID
+func (s *MemoryVehicleStore) conflicts(vehicle *models.Vehicle, excludeID *int) bool {
+	for id, other := range s.vehicles {
+		if excludeID != nil && id == *excludeID {
+			continue
+		}
+		if excludeID == nil && id == vehicle.VehicleID {
+			return true
+		}
+		if strings.EqualFold(other.VRM, vehicle.VRM) || other.StockID == vehicle.StockID {
+			return true
+		}
+	}
+	return false
+}
+
+// linkSite points a vehicle at the site its site_slug names, like the Postgres linkSite
+func (s *MemoryVehicleStore) linkSite(vehicle *models.Vehicle) {
+	vehicle.SiteID = nil
+	if site, ok := s.sites[strings.ToLower(vehicle.SiteSlug)]; ok && vehicle.SiteSlug != "" {
+		applySite(vehicle, &site)
+	}
+}
+
+// slugTaken returns a check for whether a vehicle other than vehicleID uses a slug
+func (s *MemoryVehicleStore) slugTaken(vehicleID int) func(slug string) (bool, error) {
+	return func(slug string) (bool, error) {
+		for id, other := range s.vehicles {
+			if id != vehicleID && other.Slug == slug {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+}
+
+// transitionStatus applies a status change to a stored vehicle and records it
+func (s *MemoryVehicleStore) transitionStatus(vehicle *models.Vehicle, to models.StockStatus, changedBy, reason string) error {
+	from := vehicle.StockStatus
+	if err := checkTransition(from, to); err != nil {
+		return err
+	}
+
+	vehicle.StockStatus = to
+	vehicle.UpdatedAt = now()
+	s.vehicles[vehicle.VehicleID] = *vehicle
+
+	s.statusHistory = append(s.statusHistory, models.VehicleStatusChange{
+		ID:         uint(len(s.statusHistory) + 1),
+		VehicleID:  vehicle.VehicleID,
+		FromStatus: from,
+		ToStatus:   to,
+		ChangedBy:  changedBy,
+		Reason:     reason,
+		ChangedAt:  now(),
+	})
+	return s.recordEvents(statusEvent(from, *vehicle))
+}
+
+// recordEvents stores events in the outbox
+func (s *MemoryVehicleStore) recordEvents(events ...models.VehicleEvent) error {
+	for _, event := range events {
+		outbox, err := newOutboxEvent(event)
+		if err != nil {
+			return err
+		}
+		outbox.Seq = uint(len(s.outbox) + 1)
+		s.outbox = append(s.outbox, outbox)
+	}
+	return nil
+}
+
+// recordPriceChange stores a price change when the price actually moved
+func (s *MemoryVehicleStore) recordPriceChange(vehicleID int, oldPrice, newPrice models.Money, source string) {
+	if oldPrice == newPrice {
+		return
+	}
+
+	s.priceHistory = append(s.priceHistory, models.VehiclePriceChange{
+		ID:        uint(len(s.priceHistory) + 1),
+		VehicleID: vehicleID,
+		OldPrice:  oldPrice,
+		NewPrice:  newPrice,
+		Source:    source,
+		ChangedAt: now(),
+	})
+}
+
+// sorted returns the stored vehicles ordered by vehicle ID
+func (s *MemoryVehicleStore) sorted() []models.Vehicle {
+	vehicles := make([]models.Vehicle, 0, len(s.vehicles))
+	for _, vehicle := range s.vehicles {
+		vehicles = append(vehicles, vehicle)
+	}
+	sort.Slice(vehicles, func(i, j int) bool { return vehicles[i].VehicleID < vehicles[j].VehicleID })
+	return vehicles
+}
+
+// distinct returns the sorted unique values picked from the stored vehicles
+func (s *MemoryVehicleStore) distinct(value func(v *models.Vehicle) (string, bool)) []string {
+	seen := make(map[string]bool)
+	values := []string{}
+	for _, vehicle := range s.vehicles {
+		key, ok := value(&vehicle)
+		if !ok || seen[key] {
+			continue
+		}
+		seen[key] = true
+		values = append(values, key)
+	}
+	sort.Strings(values)
+	return values
+}
+
+// filter returns the vehicles matching the filters, skipping the filter named by exclude
+// like applyFilters. Relevance is filled in when there is a free-text query and the
+// distance when searching near a point.
+func (s *MemoryVehicleStore) filter(filters models.VehicleFilters, exclude string) []models.Vehicle {
+	var query *searchQuery
+	if filters.Query != "" {
+		query = parseSearchQuery(filters.Query)
+	}
+
+	var siteLocations map[uint]geo.Point
+	if filters.Near != nil {
+		siteLocations = s.siteLocations()
+	}
+
+	matched := []models.Vehicle{}
+	for _, vehicle := range s.sorted() {
+		if matchVehicle(&vehicle, filters, exclude, query, siteLocations) {
+			matched = append(matched, vehicle)
+		}
+	}
+
+	return matched
+}
+
+// siteLocations maps the ID of every site with coordinates to its location
+func (s *MemoryVehicleStore) siteLocations() map[uint]geo.Point {
+	locations := make(map[uint]geo.Point, len(s.sites))
+	for _, site := range s.sites {
+		if site.Latitude != nil && site.Longitude != nil {
+			locations[site.ID] = geo.Point{Latitude: *site.Latitude, Longitude: *site.Longitude}
+		}
+	}
+	return locations
+}
+
+// containsStatus reports whether status is one of statuses
+func containsStatus(statuses []models.StockStatus, status models.StockStatus) bool {
+	for _, candidate := range statuses {
+		if candidate == status {
+			return true
+		}
+	}
+	return false
+}
+
+// isListed reports whether a vehicle in the given status is shown in listings
+func isListed(status models.StockStatus) bool {
+	return containsStatus(models.ListedStockStatuses, status)
+}
+
+// sortKeys returns a vehicle's values for the active sort followed by its vehicle_id
+func sortKeys(vehicle *models.Vehicle, sortFields []models.SortField) []interface{} {
+	keys := make([]interface{}, 0, len(sortFields)+1)
+	for _, field := range sortFields {
+		keys = append(keys, models.SortValue(vehicle, field.Field))
+	}
+	return append(keys, vehicle.VehicleID)
+}
+
+// compareSortKeys compares two sort key lists under the active ordering, the same
+// ordering GetVehicles builds in SQL. backward reverses the whole ordering.
+func compareSortKeys(a, b []interface{}, sortFields []models.SortField, backward bool) int {
+	for i := range a {
+		result := compareValues(a[i], b[i])
+		if i < len(sortFields) && sortFields[i].Descending {
+			result = -result
+		}
+		if backward {
+			result = -result
+		}
+		if result != 0 {
+			return result
+		}
+	}
+	return 0
+}
+
+// compareValues compares two sort values of the same type
+func compareValues(a, b interface{}) int {
+	switch a := a.(type) {
+	case models.Money:
+		return compareOrdered(a, b.(models.Money))
+	case int:
+		return compareOrdered(a, b.(int))
+	case float64:
+		return compareOrdered(a, b.(float64))
+	case string:
+		return strings.Compare(a, b.(string))
+	case time.Time:
+		return a.Compare(b.(time.Time))
+	default:
+		return 0
+	}
+}
+
+// compareOrdered compares two ordered values
+func compareOrdered[T models.Money | int | float64](a, b T) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// searchQuery is a parsed free-text query: words that must appear and words that must not
+type searchQuery struct {
+	include []string
+	exclude []string
+}
+
+// Search weights mirror the setweight labels of the search_vector column
+var searchWeights = []float64{1.0, 0.4, 0.2}
+
+// parseSearchQuery splits a websearch-style query into words. A leading "-" excludes a word.
+func parseSearchQuery(q string) *searchQuery {
+	query := &searchQuery{}
+	for _, field := range strings.Fields(q) {
+		negated := strings.HasPrefix(field, "-")
+		for _, word := range searchWords(field) {
+			if word == "or" {
+				continue
+			}
+			if negated {
+				query.exclude = append(query.exclude, word)
+			} else {
+				query.include = append(query.include, word)
+			}
+		}
+	}
+	return query
+}
+
+// match reports whether a vehicle contains every included word and none of the excluded
+// ones, and scores it higher the more heavily weighted the fields the words are found in
+func (q *searchQuery) match(vehicle *models.Vehicle) (float64, bool) {
+	if len(q.include) == 0 {
+		return 0, false
+	}
+
+	fields := [][]string{
+		searchWords(vehicle.Name + " " + vehicle.Derivative),
+		searchWords(strings.Join(vehicle.KeyFeatures, " ")),
+		searchWords(vehicle.Description + " " + vehicle.ExtraDescription),
+	}
+
+	for _, word := range q.exclude {
+		for _, words := range fields {
+			if containsWord(words, word) {
+				return 0, false
+			}
+		}
+	}
+
+	relevance := 0.0
+	for _, word := range q.include {
+		found := false
+		for i, words := range fields {
+			if containsWord(words, word) {
+				relevance += searchWeights[i]
+				found = true
+				break
+			}
+		}
+		if !found {
+			return 0, false
+		}
+	}
+
+	return relevance / 10, true
+}
+
+// searchWords lower-cases text and splits it into words with a crude plural stemmer
+func searchWords(text string) []string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for i, word := range words {
+		if len(word) > 3 && strings.HasSuffix(word, "s") && !strings.HasSuffix(word, "ss") {
+			words[i] = strings.TrimSuffix(word, "s")
+		}
+	}
+	return words
+}
+
+// containsWord reports whether word is one of words
+func containsWord(words []string, word string) bool {
+	for _, candidate := range words {
+		if candidate == word {
+			return true
+		}
+	}
+	return false
+}
+
+// now returns the current time at the microsecond precision Postgres stores
+func now() time.Time {
+	return time.Now().Truncate(time.Microsecond)
+}
+
+// MemoryWebhookStore is an in-memory WebhookStore for tests
+type MemoryWebhookStore struct {
+	mu          sync.Mutex
+	endpoints   []models.WebhookEndpoint
+	deliveries  []models.WebhookDelivery
+	deadLetters []models.WebhookDeadLetter
+	// IDs are not reused after deletes, as in Postgres
+	lastEndpointID   uint
+	lastDeliveryID   uint
+	lastDeadLetterID uint
+}
+
+// NewMemoryWebhookStore creates an empty in-memory webhook store
+func NewMemoryWebhookStore() *MemoryWebhookStore {
+	return &MemoryWebhookStore{}
+}
+
+// CreateWebhookEndpoint registers a webhook endpoint
+func (s *MemoryWebhookStore) CreateWebhookEndpoint(endpoint *models.WebhookEndpoint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.lastEndpointID++
+	endpoint.ID = s.lastEndpointID
+	endpoint.CreatedAt = now()
+	endpoint.UpdatedAt = endpoint.CreatedAt
+	s.endpoints = append(s.endpoints, *endpoint)
+	return nil
+}
+
+// ListWebhookEndpoints retrieves every webhook endpoint, oldest first
+func (s *MemoryWebhookStore) ListWebhookEndpoints() ([]models.WebhookEndpoint, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]models.WebhookEndpoint{}, s.endpoints...), nil
+}
+
+// GetWebhookEndpoint retrieves a webhook endpoint by ID
+func (s *MemoryWebhookStore) GetWebhookEndpoint(id uint) (*models.WebhookEndpoint, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, endpoint := range s.endpoints {
+		if endpoint.ID == id {
+			return &endpoint, nil
+		}
+	}
+	return nil, errWebhookEndpointNotFound
+}
+
+// DeleteWebhookEndpoint removes a webhook endpoint with its deliveries and dead letters
+func (s *MemoryWebhookStore) DeleteWebhookEndpoint(id uint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	endpoints := s.endpoints[:0]
+	for _, endpoint := range s.endpoints {
+		if endpoint.ID != id {
+			endpoints = append(endpoints, endpoint)
+		}
+	}
+	if len(endpoints) == len(s.endpoints) {
+		return errWebhookEndpointNotFound
+	}
+	s.endpoints = endpoints
+
+	deliveries := s.deliveries[:0]
+	for _, delivery := range s.deliveries {
+		if delivery.EndpointID != id {
+			deliveries = append(deliveries, delivery)
+		}
+	}
+	s.deliveries = deliveries
+
+	deadLetters := s.deadLetters[:0]
+	for _, deadLetter := range s.deadLetters {
+		if deadLetter.EndpointID != id {
+			deadLetters = append(deadLetters, deadLetter)
+		}
+	}
+	s.deadLetters = deadLetters
+	return nil
+}
+
+// EnqueueWebhookDeliveries queues an event for every endpoint subscribed to it,
+// due at once, unless it is already queued for the endpoint
+func (s *MemoryWebhookStore) EnqueueWebhookDeliveries(event models.VehicleEvent, payload string, at time.Time) ([]models.WebhookDelivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	queued := make(map[uint]bool)
+	for _, delivery := range s.deliveries {
+		if delivery.EventID == event.ID {
+			queued[delivery.EndpointID] = true
+		}
+	}
+
+	deliveries := []models.WebhookDelivery{}
+	for _, delivery := range newWebhookDeliveries(s.endpoints, event, payload, at) {
+		if !queued[delivery.EndpointID] {
+			deliveries = append(deliveries, delivery)
+		}
+	}
+	for i := range deliveries {
+		s.lastDeliveryID++
+		deliveries[i].ID = s.lastDeliveryID
+		deliveries[i].CreatedAt = now()
+		deliveries[i].UpdatedAt = deliveries[i].CreatedAt
+		s.deliveries = append(s.deliveries, deliveries[i])
+	}
+	return deliveries, nil
+}
+
+// ClaimWebhookDeliveries returns up to limit pending deliveries that are due, with
+// their endpoints, and pushes their next attempt back by lease
+func (s *MemoryWebhookStore) ClaimWebhookDeliveries(at time.Time, lease time.Duration, limit int) ([]models.WebhookDelivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	due := []int{}
+	for i, delivery := range s.deliveries {
+		if delivery.Status == models.WebhookDeliveryPending && !delivery.NextAttemptAt.After(at) {
+			due = append(due, i)
+		}
+	}
+	sort.SliceStable(due, func(i, j int) bool {
+		return s.deliveries[due[i]].NextAttemptAt.Before(*s.deliveries[due[j]].NextAttemptAt)
+	})
+	if len(due) > limit {
+		due = due[:limit]
+	}
+
+	leaseEnd := at.Add(lease)
+	claimed := make([]models.WebhookDelivery, 0, len(due))
+	for _, i := range due {
+		s.deliveries[i].NextAttemptAt = &leaseEnd
+		claimed = append(claimed, s.deliveries[i])
+	}
+	attachEndpoints(claimed, s.endpoints)
+	return claimed, nil
+}
+
+// RecordWebhookAttempt stores the outcome of a delivery attempt. A delivery that is
+// dead is copied to the dead-letter table.
+func (s *MemoryWebhookStore) RecordWebhookAttempt(delivery *models.WebhookDelivery) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.deliveries {
+		if s.deliveries[i].ID != delivery.ID {
+			continue
+		}
+
+		stored := *delivery
+		stored.Endpoint = nil
+		stored.UpdatedAt = now()
+		s.deliveries[i] = stored
+
+		if delivery.Status == models.WebhookDeliveryDead {
+			s.lastDeadLetterID++
+			deadLetter := newDeadLetter(delivery)
+			deadLetter.ID = s.lastDeadLetterID
+			deadLetter.CreatedAt = now()
+			s.deadLetters = append(s.deadLetters, deadLetter)
+		}
+		return nil
+	}
+	return apperr.NotFound("webhook delivery not found")
+}
+
+// ListWebhookDeliveries retrieves a page of the delivery log, newest first
+func (s *MemoryWebhookStore) ListWebhookDeliveries(filters models.WebhookDeliveryFilters) ([]models.WebhookDelivery, *models.ResponseMetadata, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	pageDefaults(&filters.Page, &filters.ResultsPerPage, 20)
+
+	matched := []models.WebhookDelivery{}
+	for i := len(s.deliveries) - 1; i >= 0; i-- {
+		delivery := s.deliveries[i]
+		if filters.EndpointID > 0 && delivery.EndpointID != filters.EndpointID {
+			continue
+		}
+		if len(filters.Statuses) > 0 && !containsDeliveryStatus(filters.Statuses, delivery.Status) {
+			continue
+		}
+		if len(filters.EventTypes) > 0 && !containsEventType(filters.EventTypes, delivery.EventType) {
+			continue
+		}
+		matched = append(matched, delivery)
+	}
+	total := int64(len(matched))
+
+	offset := (filters.Page - 1) * filters.ResultsPerPage
+	if offset > len(matched) {
+		offset = len(matched)
+	}
+	end := offset + filters.ResultsPerPage
+	if end > len(matched) {
+		end = len(matched)
+	}
+
+	return matched[offset:end], pageMetadata(filters.Page, filters.ResultsPerPage, total), nil
+}
+
+// ListWebhookDeadLetters retrieves the dead letters of an endpoint, or of every
+// endpoint when endpointID is 0, newest first
+func (s *MemoryWebhookStore) ListWebhookDeadLetters(endpointID uint) ([]models.WebhookDeadLetter, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	deadLetters := []models.WebhookDeadLetter{}
+	for i := len(s.deadLetters) - 1; i >= 0; i-- {
+		if endpointID == 0 || s.deadLetters[i].EndpointID == endpointID {
+			deadLetters = append(deadLetters, s.deadLetters[i])
+		}
+	}
+	return deadLetters, nil
+}
+
+// RetryWebhookDeadLetter puts a dead delivery back in the queue with a fresh set of
+// attempts, due at at, and removes its dead letter
+func (s *MemoryWebhookStore) RetryWebhookDeadLetter(id uint, at time.Time) (*models.WebhookDelivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, deadLetter := range s.deadLetters {
+		if deadLetter.ID != id {
+			continue
+		}
+
+		for j := range s.deliveries {
+			if s.deliveries[j].ID != deadLetter.DeliveryID {
+				continue
+			}
+			requeueDelivery(&s.deliveries[j], at)
+			s.deliveries[j].UpdatedAt = now()
+			s.deadLetters = append(s.deadLetters[:i], s.deadLetters[i+1:]...)
+
+			delivery := s.deliveries[j]
+			return &delivery, nil
+		}
+		return nil, apperr.NotFound("webhook delivery not found")
+	}
+	return nil, errDeadLetterNotFound
+}
+
+// containsDeliveryStatus reports whether status is one of statuses
+func containsDeliveryStatus(statuses []models.WebhookDeliveryStatus, status models.WebhookDeliveryStatus) bool {
+	for _, candidate := range statuses {
+		if candidate == status {
+			return true
+		}
+	}
+	return false
+}
+
+// containsEventType reports whether eventType is one of eventTypes
+func containsEventType(eventTypes []models.EventType, eventType models.EventType) bool {
+	for _, candidate := range eventTypes {
+		if candidate == eventType {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,199 @@
+package repository
+
+import (
+	"sort"
+
+	"github.com/Candoo/vehicles-api/internal/apperr"
+	"github.com/Candoo/vehicles-api/internal/models"
+)
+
+// MemoryLeadStore is an in-memory LeadStore for tests. It shares the lock and
+// vehicles of the MemoryVehicleStore it was created on, as the tables share a database.
+type MemoryLeadStore struct {
+	vehicles      *MemoryVehicleStore
+	leads         []models.Lead
+	leadEnquiries []models.LeadEnquiry
+}
+
+// NewMemoryLeadStore creates an empty in-memory lead store on a vehicle store
+func NewMemoryLeadStore(vehicles *MemoryVehicleStore) *MemoryLeadStore {
+	return &MemoryLeadStore{vehicles: vehicles}
+}
+
+// CreateEnquiry records an enquiry about a vehicle. It is added to the open lead of
+// the same contact for the vehicle when there is one, which repeat reports, and
+// starts a new lead at the vehicle's site otherwise.
+func (s *MemoryLeadStore) CreateEnquiry(vehicleID int, request models.EnquiryRequest) (*models.Lead, bool, error) {
+	s.vehicles.mu.Lock()
+	defer s.vehicles.mu.Unlock()
+
+	vehicle, ok := s.vehicles.vehicles[vehicleID]
+	if !ok {
+		return nil, false, apperr.NotFound("vehicle not found")
+	}
+
+	at := now()
+	var lead *models.Lead
+	for i := range s.leads {
+		existing := &s.leads[i]
+		if existing.VehicleID != vehicleID || !existing.Open() {
+			continue
+		}
+		if (request.Email != "" && existing.Email == request.Email) || (request.Phone != "" && existing.Phone == request.Phone) {
+			lead = existing
+			break
+		}
+	}
+
+	repeat := lead != nil
+	if repeat {
+		mergeEnquiry(lead, request, at)
+		lead.UpdatedAt = at
+	} else {
+		lead = newLead(&vehicle, request, at)
+		lead.ID = uint(len(s.leads) + 1)
+		lead.CreatedAt, lead.UpdatedAt = at, at
+		s.leads = append(s.leads, *lead)
+		lead = &s.leads[len(s.leads)-1]
+	}
+
+	s.leadEnquiries = append(s.leadEnquiries, models.LeadEnquiry{
+		ID:        uint(len(s.leadEnquiries) + 1),
+		LeadID:    lead.ID,
+		Message:   request.Message,
+		CreatedAt: at,
+	})
+
+	created := *lead
+	return &created, repeat, nil
+}
+
+// ListLeads retrieves leads with pagination and filtering, most recent enquiry first
+func (s *MemoryLeadStore) ListLeads(filters models.LeadFilters) ([]models.Lead, *models.ResponseMetadata, error) {
+	s.vehicles.mu.RLock()
+	defer s.vehicles.mu.RUnlock()
+
+	pageDefaults(&filters.Page, &filters.ResultsPerPage, 20)
+
+	matched := s.filterLeads(filters)
+	sort.Slice(matched, func(i, j int) bool {
+		if !matched[i].LastEnquiryAt.Equal(matched[j].LastEnquiryAt) {
+			return matched[i].LastEnquiryAt.After(matched[j].LastEnquiryAt)
+		}
+		return matched[i].ID > matched[j].ID
+	})
+
+	total := int64(len(matched))
+	offset := (filters.Page - 1) * filters.ResultsPerPage
+	if offset > len(matched) {
+		offset = len(matched)
+	}
+	matched = matched[offset:]
+	if len(matched) > filters.ResultsPerPage {
+		matched = matched[:filters.ResultsPerPage]
+	}
+
+	return matched, pageMetadata(filters.Page, filters.ResultsPerPage, total), nil
+}
+
+// ExportLeads retrieves every lead matching the filters with its enquiries, ignoring
+// pagination, oldest first
+func (s *MemoryLeadStore) ExportLeads(filters models.LeadFilters) ([]models.Lead, error) {
+	s.vehicles.mu.RLock()
+	defer s.vehicles.mu.RUnlock()
+
+	leads := s.filterLeads(filters)
+	for i := range leads {
+		leads[i].Enquiries = s.enquiriesOf(leads[i].ID)
+	}
+	return leads, nil
+}
+
+// GetLead retrieves a single lead with its enquiries, oldest first
+func (s *MemoryLeadStore) GetLead(id uint) (*models.Lead, error) {
+	s.vehicles.mu.RLock()
+	defer s.vehicles.mu.RUnlock()
+
+	for _, lead := range s.leads {
+		if lead.ID == id {
+			lead.Enquiries = s.enquiriesOf(id)
+			return &lead, nil
+		}
+	}
+	return nil, apperr.NotFound("lead not found")
+}
+
+// TransitionLeadStatus moves a lead to a new status. A lead marked contacted while
+// unassigned is assigned to changedBy.
+func (s *MemoryLeadStore) TransitionLeadStatus(id uint, to models.LeadStatus, changedBy string) (*models.Lead, error) {
+	return s.updateLead(id, func(lead *models.Lead) error {
+		return transitionLead(lead, to, changedBy, now())
+	})
+}
+
+// AssignLead assigns a lead to a member of staff, or unassigns it when assignee is empty
+func (s *MemoryLeadStore) AssignLead(id uint, assignee string) (*models.Lead, error) {
+	return s.updateLead(id, func(lead *models.Lead) error {
+		return assignLead(lead, assignee)
+	})
+}
+
+// updateLead applies change to a copy of a lead and stores it when the change succeeds
+func (s *MemoryLeadStore) updateLead(id uint, change func(lead *models.Lead) error) (*models.Lead, error) {
+	s.vehicles.mu.Lock()
+	defer s.vehicles.mu.Unlock()
+
+	for i := range s.leads {
+		if s.leads[i].ID != id {
+			continue
+		}
+
+		lead := s.leads[i]
+		if err := change(&lead); err != nil {
+			return nil, err
+		}
+		lead.UpdatedAt = now()
+		s.leads[i] = lead
+		return &lead, nil
+	}
+	return nil, apperr.NotFound("lead not found")
+}
+
+// filterLeads returns copies of the leads matching the filters, in creation order
+func (s *MemoryLeadStore) filterLeads(filters models.LeadFilters) []models.Lead {
+	matched := []models.Lead{}
+	for _, lead := range s.leads {
+		switch {
+		case len(filters.Statuses) > 0 && !containsLeadStatus(filters.Statuses, lead.Status):
+		case filters.AssignedTo != "" && lead.AssignedTo != filters.AssignedTo:
+		case filters.Unassigned && lead.AssignedTo != "":
+		case len(filters.SiteSlugs) > 0 && !matchesFold(lead.SiteSlug, filters.SiteSlugs):
+		case filters.VehicleID > 0 && lead.VehicleID != filters.VehicleID:
+		case filters.Since != nil && lead.LastEnquiryAt.Before(*filters.Since):
+		default:
+			matched = append(matched, lead)
+		}
+	}
+	return matched
+}
+
+// enquiriesOf returns the enquiries received on a lead, oldest first
+func (s *MemoryLeadStore) enquiriesOf(leadID uint) []models.LeadEnquiry {
+	enquiries := []models.LeadEnquiry{}
+	for _, enquiry := range s.leadEnquiries {
+		if enquiry.LeadID == leadID {
+			enquiries = append(enquiries, enquiry)
+		}
+	}
+	return enquiries
+}
+
+// containsLeadStatus reports whether status is one of statuses
+func containsLeadStatus(statuses []models.LeadStatus, status models.LeadStatus) bool {
+	for _, candidate := range statuses {
+		if candidate == status {
+			return true
+		}
+	}
+	return false
+}
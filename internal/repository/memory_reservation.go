@@ -0,0 +1,213 @@
+package repository
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/Candoo/vehicles-api/internal/apperr"
+	"github.com/Candoo/vehicles-api/internal/models"
+)
+
+// MemoryReservationStore is an in-memory ReservationStore for tests. It shares the
+// lock and vehicles of the MemoryVehicleStore it was created on, which checks it so
+// staff and the feed sync leave a held vehicle to its reservation.
+type MemoryReservationStore struct {
+	vehicles     *MemoryVehicleStore
+	reservations []models.Reservation
+}
+
+// NewMemoryReservationStore creates an empty in-memory reservation store on a vehicle
+// store. A vehicle store has at most one reservation store.
+func NewMemoryReservationStore(vehicles *MemoryVehicleStore) *MemoryReservationStore {
+	store := &MemoryReservationStore{vehicles: vehicles}
+	vehicles.mu.Lock()
+	vehicles.reservations = store
+	vehicles.mu.Unlock()
+	return store
+}
+
+// CreateReservation reserves a vehicle in stock for a customer
+func (s *MemoryReservationStore) CreateReservation(reservation *models.Reservation) error {
+	s.vehicles.mu.Lock()
+	defer s.vehicles.mu.Unlock()
+
+	vehicle, ok := s.vehicles.vehicles[reservation.VehicleID]
+	if !ok {
+		return apperr.NotFound("vehicle not found")
+	}
+	if err := checkReservable(&vehicle); err != nil {
+		return err
+	}
+	if s.heldReservation(vehicle.VehicleID, 0) != nil {
+		return errVehicleReserved
+	}
+
+	reservation.ID = uint(len(s.reservations) + 1)
+	reservation.Status = models.ReservationStatusHeld
+	reservation.CreatedAt = now()
+	reservation.UpdatedAt = reservation.CreatedAt
+	s.reservations = append(s.reservations, *reservation)
+
+	return s.vehicles.transitionStatus(&vehicle, models.StockStatusReserved, reservationActor, "Reserved online: "+reservation.Reference)
+}
+
+// GetReservation retrieves a reservation by its reference
+func (s *MemoryReservationStore) GetReservation(reference string) (*models.Reservation, error) {
+	s.vehicles.mu.RLock()
+	defer s.vehicles.mu.RUnlock()
+
+	for _, reservation := range s.reservations {
+		if reservation.Reference == reference {
+			return &reservation, nil
+		}
+	}
+	return nil, apperr.NotFound("reservation not found")
+}
+
+// GetReservations retrieves the reservations of a vehicle, newest first
+func (s *MemoryReservationStore) GetReservations(vehicleID int) ([]models.Reservation, error) {
+	s.vehicles.mu.RLock()
+	defer s.vehicles.mu.RUnlock()
+
+	if _, ok := s.vehicles.vehicles[vehicleID]; !ok {
+		return nil, apperr.NotFound("vehicle not found")
+	}
+
+	reservations := []models.Reservation{}
+	for i := len(s.reservations) - 1; i >= 0; i-- {
+		if s.reservations[i].VehicleID == vehicleID {
+			reservations = append(reservations, s.reservations[i])
+		}
+	}
+	return reservations, nil
+}
+
+// CancelReservation cancels a held reservation, returning the vehicle to stock
+func (s *MemoryReservationStore) CancelReservation(reference string) (*models.Reservation, error) {
+	return s.updateReservation(reference, func(reservation *models.Reservation) error {
+		if err := checkReservationHeld(reservation); err != nil {
+			return err
+		}
+		return s.endReservation(reservation, models.ReservationStatusCancelled, reservationActor, now())
+	})
+}
+
+// MarkReservationCompleting starts the sale of a held reservation's vehicle, or
+// returns a reservation already completing
+func (s *MemoryReservationStore) MarkReservationCompleting(reference string) (*models.Reservation, error) {
+	return s.updateReservation(reference, func(reservation *models.Reservation) error {
+		if reservation.Status == models.ReservationStatusCompleting {
+			return nil
+		}
+		if err := checkReservationHeld(reservation); err != nil {
+			return err
+		}
+
+		vehicle, ok := s.vehicles.vehicles[reservation.VehicleID]
+		if !ok {
+			return apperr.NotFound("vehicle not found")
+		}
+		if err := checkTransition(vehicle.StockStatus, models.StockStatusSold); err != nil {
+			return err
+		}
+
+		reservation.Status = models.ReservationStatusCompleting
+		return nil
+	})
+}
+
+// CompleteReservation marks a completing reservation completed and its vehicle sold
+func (s *MemoryReservationStore) CompleteReservation(reference, changedBy string) (*models.Reservation, error) {
+	return s.updateReservation(reference, func(reservation *models.Reservation) error {
+		if err := checkReservationCompleting(reservation); err != nil {
+			return err
+		}
+
+		vehicle, ok := s.vehicles.vehicles[reservation.VehicleID]
+		if !ok {
+			return apperr.NotFound("vehicle not found")
+		}
+		if err := s.vehicles.transitionStatus(&vehicle, models.StockStatusSold, changedBy, "Reservation completed: "+reservation.Reference); err != nil {
+			return err
+		}
+
+		return s.endReservation(reservation, models.ReservationStatusCompleted, changedBy, now())
+	})
+}
+
+// ExpireReservations ends the held reservations that ran out by now, returning
+// their vehicles to stock
+func (s *MemoryReservationStore) ExpireReservations(at time.Time) ([]models.Reservation, error) {
+	s.vehicles.mu.Lock()
+	defer s.vehicles.mu.Unlock()
+
+	expired := []models.Reservation{}
+	for i := range s.reservations {
+		reservation := s.reservations[i]
+		if reservation.Status != models.ReservationStatusHeld || reservation.ExpiresAt.After(at) {
+			continue
+		}
+
+		if err := s.endReservation(&reservation, models.ReservationStatusExpired, expiryActor, at); err != nil {
+			return expired, fmt.Errorf("failed to expire reservation %s: %w", reservation.Reference, err)
+		}
+		reservation.UpdatedAt = now()
+		s.reservations[i] = reservation
+		expired = append(expired, reservation)
+	}
+	sort.SliceStable(expired, func(i, j int) bool {
+		return expired[i].ExpiresAt.Before(expired[j].ExpiresAt)
+	})
+	return expired, nil
+}
+
+// updateReservation applies change to a copy of a reservation and stores it when the
+// change succeeds
+func (s *MemoryReservationStore) updateReservation(reference string, change func(reservation *models.Reservation) error) (*models.Reservation, error) {
+	s.vehicles.mu.Lock()
+	defer s.vehicles.mu.Unlock()
+
+	for i := range s.reservations {
+		if s.reservations[i].Reference != reference {
+			continue
+		}
+
+		reservation := s.reservations[i]
+		if err := change(&reservation); err != nil {
+			return nil, err
+		}
+		reservation.UpdatedAt = now()
+		s.reservations[i] = reservation
+		return &reservation, nil
+	}
+	return nil, apperr.NotFound("reservation not found")
+}
+
+// endReservation records the end of a reservation holding its vehicle and, unless it
+// completed, returns its vehicle to stock if it is still reserved and no other
+// reservation holds it
+func (s *MemoryReservationStore) endReservation(reservation *models.Reservation, status models.ReservationStatus, changedBy string, at time.Time) error {
+	closeReservation(reservation, status, at)
+	if status == models.ReservationStatusCompleted {
+		return nil
+	}
+
+	vehicle, ok := s.vehicles.vehicles[reservation.VehicleID]
+	if !ok || vehicle.StockStatus != models.StockStatusReserved || s.heldReservation(vehicle.VehicleID, reservation.ID) != nil {
+		return nil
+	}
+	return s.vehicles.transitionStatus(&vehicle, models.StockStatusInStock, changedBy, releaseReason(reservation))
+}
+
+// heldReservation returns the reservation other than the one with ID excludeID holding
+// a vehicle, or nil when it is not held
+func (s *MemoryReservationStore) heldReservation(vehicleID int, excludeID uint) *models.Reservation {
+	for i := range s.reservations {
+		reservation := &s.reservations[i]
+		if reservation.VehicleID == vehicleID && reservation.ID != excludeID && reservation.Held() {
+			return reservation
+		}
+	}
+	return nil
+}
@@ -0,0 +1,139 @@
+package repository
+
+import (
+	"sort"
+	"time"
+
+	"github.com/Candoo/vehicles-api/internal/apperr"
+	"github.com/Candoo/vehicles-api/internal/models"
+)
+
+// MemoryTestDriveStore is an in-memory TestDriveStore for tests. It shares the lock
+// and vehicles of the MemoryVehicleStore it was created on.
+type MemoryTestDriveStore struct {
+	vehicles   *MemoryVehicleStore
+	testDrives []models.TestDrive
+}
+
+// NewMemoryTestDriveStore creates an empty in-memory test drive store on a vehicle store
+func NewMemoryTestDriveStore(vehicles *MemoryVehicleStore) *MemoryTestDriveStore {
+	return &MemoryTestDriveStore{vehicles: vehicles}
+}
+
+// CreateTestDrive books a test drive at the vehicle's site, rejecting a time that
+// overlaps another booking of the vehicle
+func (s *MemoryTestDriveStore) CreateTestDrive(drive *models.TestDrive) error {
+	s.vehicles.mu.Lock()
+	defer s.vehicles.mu.Unlock()
+
+	vehicle, ok := s.vehicles.vehicles[drive.VehicleID]
+	if !ok {
+		return apperr.NotFound("vehicle not found")
+	}
+	if s.testDriveClash(drive.VehicleID, drive.StartsAt, drive.EndsAt, 0) {
+		return errTestDriveClash
+	}
+
+	drive.ID = uint(len(s.testDrives) + 1)
+	drive.SiteID, drive.SiteSlug = vehicle.SiteID, vehicle.SiteSlug
+	drive.Status = models.TestDriveStatusBooked
+	drive.CreatedAt = now()
+	drive.UpdatedAt = drive.CreatedAt
+	s.testDrives = append(s.testDrives, *drive)
+	return nil
+}
+
+// GetTestDrive retrieves a test drive by its booking reference
+func (s *MemoryTestDriveStore) GetTestDrive(reference string) (*models.TestDrive, error) {
+	s.vehicles.mu.RLock()
+	defer s.vehicles.mu.RUnlock()
+
+	for _, drive := range s.testDrives {
+		if drive.Reference == reference {
+			return &drive, nil
+		}
+	}
+	return nil, apperr.NotFound("test drive not found")
+}
+
+// GetTestDrives retrieves the booked test drives of a vehicle overlapping the time
+// from from to to, earliest first
+func (s *MemoryTestDriveStore) GetTestDrives(vehicleID int, from, to time.Time) ([]models.TestDrive, error) {
+	s.vehicles.mu.RLock()
+	defer s.vehicles.mu.RUnlock()
+
+	if _, ok := s.vehicles.vehicles[vehicleID]; !ok {
+		return nil, apperr.NotFound("vehicle not found")
+	}
+
+	drives := []models.TestDrive{}
+	for _, drive := range s.testDrives {
+		if drive.VehicleID == vehicleID && drive.Overlaps(from, to) {
+			drives = append(drives, drive)
+		}
+	}
+	sort.Slice(drives, func(i, j int) bool {
+		if !drives[i].StartsAt.Equal(drives[j].StartsAt) {
+			return drives[i].StartsAt.Before(drives[j].StartsAt)
+		}
+		return drives[i].ID < drives[j].ID
+	})
+	return drives, nil
+}
+
+// RescheduleTestDrive moves a booked test drive to another time, rejecting a time
+// that overlaps another booking of the vehicle
+func (s *MemoryTestDriveStore) RescheduleTestDrive(reference string, startsAt, endsAt time.Time) (*models.TestDrive, error) {
+	return s.updateTestDrive(reference, func(drive *models.TestDrive) error {
+		if err := checkReschedule(drive); err != nil {
+			return err
+		}
+		if s.testDriveClash(drive.VehicleID, startsAt, endsAt, drive.ID) {
+			return errTestDriveClash
+		}
+
+		drive.StartsAt, drive.EndsAt = startsAt, endsAt
+		drive.Sequence++
+		return nil
+	})
+}
+
+// CancelTestDrive cancels a booked test drive, freeing its slot
+func (s *MemoryTestDriveStore) CancelTestDrive(reference, reason string) (*models.TestDrive, error) {
+	return s.updateTestDrive(reference, func(drive *models.TestDrive) error {
+		return cancelTestDrive(drive, reason, now())
+	})
+}
+
+// updateTestDrive applies change to a copy of a test drive and stores it when the
+// change succeeds
+func (s *MemoryTestDriveStore) updateTestDrive(reference string, change func(drive *models.TestDrive) error) (*models.TestDrive, error) {
+	s.vehicles.mu.Lock()
+	defer s.vehicles.mu.Unlock()
+
+	for i := range s.testDrives {
+		if s.testDrives[i].Reference != reference {
+			continue
+		}
+
+		drive := s.testDrives[i]
+		if err := change(&drive); err != nil {
+			return nil, err
+		}
+		drive.UpdatedAt = now()
+		s.testDrives[i] = drive
+		return &drive, nil
+	}
+	return nil, apperr.NotFound("test drive not found")
+}
+
+// testDriveClash reports whether a time overlaps a booked test drive of the vehicle
+// other than the one with ID excludeID
+func (s *MemoryTestDriveStore) testDriveClash(vehicleID int, startsAt, endsAt time.Time, excludeID uint) bool {
+	for _, drive := range s.testDrives {
+		if drive.VehicleID == vehicleID && drive.ID != excludeID && drive.Overlaps(startsAt, endsAt) {
+			return true
+		}
+	}
+	return false
+}
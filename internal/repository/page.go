@@ -0,0 +1,28 @@
+package repository
+
+import "github.com/Candoo/vehicles-api/internal/models"
+
+// pageDefaults fills in the page number and page size when they are missing
+func pageDefaults(page, perPage *int, defaultPerPage int) {
+	if *page < 1 {
+		*page = 1
+	}
+	if *perPage < 1 {
+		*perPage = defaultPerPage
+	}
+}
+
+// pageMetadata describes page number page of perPage results out of total
+func pageMetadata(page, perPage int, total int64) *models.ResponseMetadata {
+	lastPage := int(total) / perPage
+	if int(total)%perPage > 0 {
+		lastPage++
+	}
+
+	return &models.ResponseMetadata{
+		CurrentPage: page,
+		LastPage:    lastPage,
+		PerPage:     perPage,
+		Total:       total,
+	}
+}
@@ -0,0 +1,60 @@
+package repository
+
+import (
+	"github.com/Candoo/vehicles-api/internal/models"
+)
+
+// PartExchangeStore is the storage of part-exchange requests and the vehicles the
+// estimator values them against. VehicleRepository and MemoryVehicleStore implement
+// it, as requests are kept against stored vehicles.
+type PartExchangeStore interface {
+	GetValuationSamples() ([]models.Vehicle, error)
+	CreatePartExchange(request *models.PartExchange) error
+	GetPartExchanges(id int) ([]models.PartExchange, error)
+}
+
+var (
+	_ PartExchangeStore = (*VehicleRepository)(nil)
+	_ PartExchangeStore = (*MemoryVehicleStore)(nil)
+)
+
+// GetValuationSamples retrieves every vehicle with both a price and a price when
+// new, whatever its stock status, for the part-exchange estimator
+func (r *VehicleRepository) GetValuationSamples() ([]models.Vehicle, error) {
+	vehicles := []models.Vehicle{}
+	if err := r.db.Where("price > 0 AND price_when_new > 0").
+		Order("vehicle_id ASC").
+		Find(&vehicles).Error; err != nil {
+		return nil, dbError(err, "failed to fetch valuation samples")
+	}
+	return vehicles, nil
+}
+
+// CreatePartExchange records a part-exchange request against a vehicle
+func (r *VehicleRepository) CreatePartExchange(request *models.PartExchange) error {
+	if _, err := r.GetVehicleByID(request.VehicleID); err != nil {
+		return err
+	}
+
+	if err := r.db.Create(request).Error; err != nil {
+		return dbError(err, "failed to record part-exchange request")
+	}
+	return nil
+}
+
+// GetPartExchanges retrieves the part-exchange requests made against a vehicle,
+// newest first
+func (r *VehicleRepository) GetPartExchanges(id int) ([]models.PartExchange, error) {
+	if _, err := r.GetVehicleByID(id); err != nil {
+		return nil, err
+	}
+
+	requests := []models.PartExchange{}
+	if err := r.db.Where("vehicle_id = ?", id).
+		Order("created_at DESC, id DESC").
+		Find(&requests).Error; err != nil {
+		return nil, dbError(err, "failed to fetch part-exchange requests")
+	}
+
+	return requests, nil
+}
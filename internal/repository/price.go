@@ -0,0 +1,124 @@
+package repository
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"github.com/Candoo/vehicles-api/internal/models"
+	"gorm.io/gorm"
+)
+
+// GetPriceHistory retrieves the price changes of a vehicle, oldest first
+func (r *VehicleRepository) GetPriceHistory(id int) ([]models.VehiclePriceChange, error) {
+	if _, err := r.GetVehicleByID(id); err != nil {
+		return nil, err
+	}
+
+	history := []models.VehiclePriceChange{}
+	if err := r.db.Where("vehicle_id = ?", id).
+		Order("changed_at ASC, id ASC").
+		Find(&history).Error; err != nil {
+		return nil, dbError(err, "failed to fetch price history")
+	}
+
+	return history, nil
+}
+
+// GetPriceDrops retrieves listed vehicles now cheaper than before their first price
+// change since the given time, biggest percentage reduction first
+func (r *VehicleRepository) GetPriceDrops(since time.Time) ([]models.PriceDrop, error) {
+	var changes []struct {
+		VehicleID     int
+		PreviousPrice models.Money
+		ReducedAt     time.Time
+	}
+
+	if err := r.db.Model(&models.VehiclePriceChange{}).
+		Select("vehicle_id, (ARRAY_AGG(old_price ORDER BY changed_at ASC, id ASC))[1] AS previous_price, MAX(changed_at) AS reduced_at").
+		Where("changed_at >= ?", since).
+		Group("vehicle_id").
+		Scan(&changes).Error; err != nil {
+		return nil, dbError(err, "failed to fetch price changes")
+	}
+
+	drops := []models.PriceDrop{}
+	if len(changes) == 0 {
+		return drops, nil
+	}
+
+	ids := make([]int, len(changes))
+	for i, change := range changes {
+		ids[i] = change.VehicleID
+	}
+
+	var vehicles []models.Vehicle
+	if err := r.db.Where("vehicle_id IN ?", ids).
+		Where("stock_status IN ?", models.ListedStockStatuses).
+		Find(&vehicles).Error; err != nil {
+		return nil, dbError(err, "failed to fetch vehicles")
+	}
+
+	byID := make(map[int]models.Vehicle, len(vehicles))
+	for _, vehicle := range vehicles {
+		byID[vehicle.VehicleID] = vehicle
+	}
+
+	for _, change := range changes {
+		vehicle, ok := byID[change.VehicleID]
+		if !ok || vehicle.Price >= change.PreviousPrice {
+			continue
+		}
+		drops = append(drops, newPriceDrop(vehicle, change.PreviousPrice, change.ReducedAt))
+	}
+
+	sortPriceDrops(drops)
+	return drops, nil
+}
+
+// sortPriceDrops orders price drops by biggest percentage reduction first
+func sortPriceDrops(drops []models.PriceDrop) {
+	sort.Slice(drops, func(i, j int) bool {
+		if drops[i].ReductionPercent != drops[j].ReductionPercent {
+			return drops[i].ReductionPercent > drops[j].ReductionPercent
+		}
+		return drops[i].Vehicle.VehicleID < drops[j].Vehicle.VehicleID
+	})
+}
+
+// newPriceDrop works out the reduction of a vehicle from a previous price
+func newPriceDrop(vehicle models.Vehicle, previous models.Money, reducedAt time.Time) models.PriceDrop {
+	reduction := previous - vehicle.Price
+	percent := 0.0
+	if previous > 0 {
+		percent = math.Round(float64(reduction)/float64(previous)*1000) / 10
+	}
+
+	return models.PriceDrop{
+		Vehicle:          vehicle,
+		PreviousPrice:    previous,
+		CurrentPrice:     vehicle.Price,
+		Reduction:        reduction,
+		ReductionPercent: percent,
+		ReducedAt:        reducedAt,
+	}
+}
+
+// recordPriceChange stores a price change when the price actually moved
+func recordPriceChange(tx *gorm.DB, vehicleID int, oldPrice, newPrice models.Money, source string) error {
+	if oldPrice == newPrice {
+		return nil
+	}
+
+	change := models.VehiclePriceChange{
+		VehicleID: vehicleID,
+		OldPrice:  oldPrice,
+		NewPrice:  newPrice,
+		Source:    source,
+	}
+	if err := tx.Create(&change).Error; err != nil {
+		return dbError(err, "failed to record price change")
+	}
+
+	return nil
+}
@@ -0,0 +1,361 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Candoo/vehicles-api/internal/apperr"
+	"github.com/Candoo/vehicles-api/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ReservationStore is the storage of online reservations. ReservationRepository
+// implements it on Postgres and MemoryReservationStore in memory. Reserving and
+// ending a reservation move its vehicle's stock status in the same transaction.
+type ReservationStore interface {
+	CreateReservation(reservation *models.Reservation) error
+	GetReservation(reference string) (*models.Reservation, error)
+	GetReservations(vehicleID int) ([]models.Reservation, error)
+	CancelReservation(reference string) (*models.Reservation, error)
+	MarkReservationCompleting(reference string) (*models.Reservation, error)
+	CompleteReservation(reference, changedBy string) (*models.Reservation, error)
+	ExpireReservations(now time.Time) ([]models.Reservation, error)
+}
+
+var (
+	_ ReservationStore = (*ReservationRepository)(nil)
+	_ ReservationStore = (*MemoryReservationStore)(nil)
+)
+
+// ReservationRepository handles database operations for reservations
+type ReservationRepository struct {
+	db *gorm.DB
+}
+
+// NewReservationRepository creates a new reservation repository
+func NewReservationRepository(db *gorm.DB) *ReservationRepository {
+	return &ReservationRepository{db: db}
+}
+
+// Actors recorded in the status history of vehicles reserved online
+const (
+	reservationActor = "online-reservation"
+	expiryActor      = "reservation-expiry"
+)
+
+// holdingStatuses are the statuses of reservations that hold their vehicle
+var holdingStatuses = []models.ReservationStatus{models.ReservationStatusHeld, models.ReservationStatusCompleting}
+
+// errVehicleReserved is returned when reserving a vehicle someone else has reserved
+var errVehicleReserved = apperr.Conflict("vehicle is already reserved")
+
+// CreateReservation reserves a vehicle in stock for a customer. The vehicle row is
+// locked so two customers cannot reserve the same vehicle at once.
+func (r *ReservationRepository) CreateReservation(reservation *models.Reservation) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		vehicle, err := lockVehicle(tx, reservation.VehicleID)
+		if err != nil {
+			return err
+		}
+		if err := checkReservable(vehicle); err != nil {
+			return err
+		}
+
+		reservation.Status = models.ReservationStatusHeld
+		if err := tx.Create(reservation).Error; err != nil {
+			if errors.Is(err, gorm.ErrDuplicatedKey) {
+				return errVehicleReserved
+			}
+			return dbError(err, "failed to create reservation")
+		}
+
+		return transitionStatus(tx, vehicle, models.StockStatusReserved, reservationActor, "Reserved online: "+reservation.Reference)
+	})
+}
+
+// GetReservation retrieves a reservation by its reference
+func (r *ReservationRepository) GetReservation(reference string) (*models.Reservation, error) {
+	var reservation models.Reservation
+	if err := r.db.Where("reference = ?", reference).First(&reservation).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, apperr.NotFound("reservation not found")
+		}
+		return nil, dbError(err, "failed to fetch reservation")
+	}
+	return &reservation, nil
+}
+
+// GetReservations retrieves the reservations of a vehicle, newest first
+func (r *ReservationRepository) GetReservations(vehicleID int) ([]models.Reservation, error) {
+	if _, err := findVehicle(r.db, vehicleID); err != nil {
+		return nil, err
+	}
+
+	reservations := []models.Reservation{}
+	if err := r.db.Where("vehicle_id = ?", vehicleID).
+		Order("created_at DESC, id DESC").
+		Find(&reservations).Error; err != nil {
+		return nil, dbError(err, "failed to fetch reservations")
+	}
+	return reservations, nil
+}
+
+// CancelReservation cancels a held reservation, returning the vehicle to stock
+func (r *ReservationRepository) CancelReservation(reference string) (*models.Reservation, error) {
+	var reservation models.Reservation
+
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := lockReservation(tx, reference, &reservation); err != nil {
+			return err
+		}
+		if err := checkReservationHeld(&reservation); err != nil {
+			return err
+		}
+
+		return endReservation(tx, &reservation, models.ReservationStatusCancelled, reservationActor, time.Now())
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &reservation, nil
+}
+
+// MarkReservationCompleting starts the sale of a held reservation's vehicle. The
+// reservation keeps holding the vehicle while the deposit is taken, but can no longer
+// be cancelled or expire. Marking a reservation already completing returns it, so a
+// sale whose deposit could not be taken is tried again.
+func (r *ReservationRepository) MarkReservationCompleting(reference string) (*models.Reservation, error) {
+	var reservation models.Reservation
+
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := lockReservation(tx, reference, &reservation); err != nil {
+			return err
+		}
+		if reservation.Status == models.ReservationStatusCompleting {
+			return nil
+		}
+		if err := checkReservationHeld(&reservation); err != nil {
+			return err
+		}
+
+		vehicle, err := lockVehicle(tx, reservation.VehicleID)
+		if err != nil {
+			return err
+		}
+		if err := checkTransition(vehicle.StockStatus, models.StockStatusSold); err != nil {
+			return err
+		}
+
+		reservation.Status = models.ReservationStatusCompleting
+		if err := tx.Model(&reservation).Update("status", reservation.Status).Error; err != nil {
+			return dbError(err, "failed to update reservation")
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &reservation, nil
+}
+
+// CompleteReservation marks a completing reservation completed and its vehicle sold,
+// once its deposit has been taken
+func (r *ReservationRepository) CompleteReservation(reference, changedBy string) (*models.Reservation, error) {
+	var reservation models.Reservation
+
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := lockReservation(tx, reference, &reservation); err != nil {
+			return err
+		}
+		if err := checkReservationCompleting(&reservation); err != nil {
+			return err
+		}
+
+		vehicle, err := lockVehicle(tx, reservation.VehicleID)
+		if err != nil {
+			return err
+		}
+		if err := transitionStatus(tx, vehicle, models.StockStatusSold, changedBy, "Reservation completed: "+reservation.Reference); err != nil {
+			return err
+		}
+
+		return endReservation(tx, &reservation, models.ReservationStatusCompleted, changedBy, time.Now())
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &reservation, nil
+}
+
+// ExpireReservations ends the held reservations that ran out by now, returning
+// their vehicles to stock. It returns the reservations it expired, including those
+// expired before an error stopped it.
+func (r *ReservationRepository) ExpireReservations(now time.Time) ([]models.Reservation, error) {
+	var references []string
+	if err := r.db.Model(&models.Reservation{}).
+		Where("status = ? AND expires_at <= ?", models.ReservationStatusHeld, now).
+		Order("expires_at ASC, id ASC").
+		Pluck("reference", &references).Error; err != nil {
+		return nil, dbError(err, "failed to fetch expired reservations")
+	}
+
+	expired := []models.Reservation{}
+	for _, reference := range references {
+		var reservation models.Reservation
+		ended := false
+		err := r.db.Transaction(func(tx *gorm.DB) error {
+			if err := lockReservation(tx, reference, &reservation); err != nil {
+				return err
+			}
+			// Cancelled or completing since it was selected
+			if reservation.Status != models.ReservationStatusHeld || reservation.ExpiresAt.After(now) {
+				return nil
+			}
+
+			ended = true
+			return endReservation(tx, &reservation, models.ReservationStatusExpired, expiryActor, now)
+		})
+		if err != nil {
+			return expired, fmt.Errorf("failed to expire reservation %s: %w", reference, err)
+		}
+		if ended {
+			expired = append(expired, reservation)
+		}
+	}
+
+	return expired, nil
+}
+
+// lockReservation fetches a reservation by reference and locks its row
+func lockReservation(tx *gorm.DB, reference string, reservation *models.Reservation) error {
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("reference = ?", reference).First(reservation).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return apperr.NotFound("reservation not found")
+		}
+		return dbError(err, "failed to fetch reservation")
+	}
+	return nil
+}
+
+// endReservation records the end of a reservation holding its vehicle and, unless it
+// completed, returns its vehicle to stock. Staff may already have moved the vehicle
+// on, in which case its status is left alone, and the vehicle stays reserved while
+// another reservation holds it.
+func endReservation(tx *gorm.DB, reservation *models.Reservation, status models.ReservationStatus, changedBy string, at time.Time) error {
+	closeReservation(reservation, status, at)
+	if err := tx.Model(reservation).Updates(map[string]interface{}{
+		"status":   reservation.Status,
+		"ended_at": reservation.EndedAt,
+	}).Error; err != nil {
+		return dbError(err, "failed to update reservation")
+	}
+
+	if status == models.ReservationStatusCompleted {
+		return nil
+	}
+
+	vehicle, err := lockVehicle(tx, reservation.VehicleID)
+	if errors.Is(err, apperr.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if vehicle.StockStatus != models.StockStatusReserved {
+		return nil
+	}
+	other, err := heldReservation(tx, vehicle.VehicleID)
+	if err != nil || other != nil {
+		return err
+	}
+	return transitionStatus(tx, vehicle, models.StockStatusInStock, changedBy, releaseReason(reservation))
+}
+
+// heldReservation returns the reservation holding a vehicle, or nil when it is not held
+func heldReservation(tx *gorm.DB, vehicleID int) (*models.Reservation, error) {
+	var reservations []models.Reservation
+	if err := tx.Where("vehicle_id = ? AND status IN ?", vehicleID, holdingStatuses).
+		Limit(1).
+		Find(&reservations).Error; err != nil {
+		return nil, dbError(err, "failed to fetch held reservation")
+	}
+	if len(reservations) == 0 {
+		return nil, nil
+	}
+	return &reservations[0], nil
+}
+
+// checkNotHeld rejects moving a vehicle out of reserved while a reservation holds
+// it. The reservation is completed or cancelled instead, so the deposit is taken or
+// released with it.
+func checkNotHeld(tx *gorm.DB, vehicle *models.Vehicle, to models.StockStatus) error {
+	if vehicle.StockStatus != models.StockStatusReserved || to == models.StockStatusReserved {
+		return nil
+	}
+	held, err := heldReservation(tx, vehicle.VehicleID)
+	if err != nil {
+		return err
+	}
+	if held != nil {
+		return errReservationHeld(held)
+	}
+	return nil
+}
+
+// checkReservable rejects reserving a vehicle that is not in stock
+func checkReservable(vehicle *models.Vehicle) error {
+	switch vehicle.StockStatus {
+	case models.StockStatusInStock:
+		return nil
+	case models.StockStatusReserved:
+		return errVehicleReserved
+	default:
+		return apperr.Conflict("vehicle is not available to reserve")
+	}
+}
+
+// checkReservationHeld rejects changing a reservation that has ended or whose sale is
+// completing
+func checkReservationHeld(reservation *models.Reservation) error {
+	switch reservation.Status {
+	case models.ReservationStatusHeld:
+		return nil
+	case models.ReservationStatusCompleting:
+		return apperr.Conflict("reservation is completing; complete it again to finish the sale")
+	default:
+		return apperr.Conflict("reservation is already %s", reservation.Status)
+	}
+}
+
+// checkReservationCompleting rejects completing a reservation whose sale was not started
+func checkReservationCompleting(reservation *models.Reservation) error {
+	switch reservation.Status {
+	case models.ReservationStatusCompleting:
+		return nil
+	case models.ReservationStatusHeld:
+		return apperr.Conflict("reservation is not completing")
+	default:
+		return apperr.Conflict("reservation is already %s", reservation.Status)
+	}
+}
+
+// errReservationHeld is returned when staff try to move a vehicle a reservation holds
+func errReservationHeld(reservation *models.Reservation) error {
+	return apperr.Conflict("vehicle is held by reservation %s; complete or cancel the reservation instead", reservation.Reference)
+}
+
+// closeReservation marks a reservation ended
+func closeReservation(reservation *models.Reservation, status models.ReservationStatus, at time.Time) {
+	reservation.Status = status
+	reservation.EndedAt = &at
+}
+
+// releaseReason describes why an ended reservation returned its vehicle to stock
+func releaseReason(reservation *models.Reservation) string {
+	return fmt.Sprintf("Reservation %s: %s", reservation.Status, reservation.Reference)
+}
@@ -0,0 +1,152 @@
+package repository
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Candoo/vehicles-api/internal/apperr"
+	"github.com/Candoo/vehicles-api/internal/models"
+)
+
+func testReservations(t *testing.T, store stores) {
+	inPrep := testVehicle(3, "Kia", "Picanto", 6000)
+	inPrep.StockStatus = models.StockStatusInPrep
+	mustCreate(t, store, testVehicle(1, "Skoda", "Fabia", 5000), testVehicle(2, "Ford", "Fiesta", 7000), inPrep)
+
+	expiresAt := time.Now().Add(time.Hour).Truncate(time.Microsecond)
+	reserve := func(reference string, vehicleID int) error {
+		t.Helper()
+		return store.CreateReservation(&models.Reservation{
+			Reference:       reference,
+			VehicleID:       vehicleID,
+			Name:            "Sam Taylor",
+			Email:           "sam@example.com",
+			Deposit:         models.MoneyFromPounds(99),
+			PaymentProvider: "fake",
+			PaymentHoldID:   "hold_" + reference,
+			ExpiresAt:       expiresAt,
+		})
+	}
+	expectStatus := func(vehicleID int, want models.StockStatus) {
+		t.Helper()
+		vehicle, err := store.GetVehicleByID(vehicleID)
+		if err != nil {
+			t.Fatalf("GetVehicleByID: %v", err)
+		}
+		if vehicle.StockStatus != want {
+			t.Errorf("vehicle %d stock_status = %q, want %q", vehicleID, vehicle.StockStatus, want)
+		}
+	}
+
+	if err := reserve("rs_first", 1); err != nil {
+		t.Fatalf("CreateReservation: %v", err)
+	}
+	expectStatus(1, models.StockStatusReserved)
+	expectError(t, reserve("rs_second", 1), apperr.ErrConflict)
+	expectError(t, reserve("rs_prep", 3), apperr.ErrConflict)
+	expectError(t, reserve("rs_missing", 99), apperr.ErrNotFound)
+
+	first, err := store.GetReservation("rs_first")
+	if err != nil {
+		t.Fatalf("GetReservation: %v", err)
+	}
+	if !first.Held() || first.Deposit != models.MoneyFromPounds(99) || first.PaymentHoldID != "hold_rs_first" || !first.ExpiresAt.Equal(expiresAt) {
+		t.Errorf("reservation = %+v", first)
+	}
+	_, err = store.GetReservation("rs_unknown")
+	expectError(t, err, apperr.ErrNotFound)
+
+	// Cancelling returns the vehicle to stock so it can be reserved again
+	cancelled, err := store.CancelReservation("rs_first")
+	if err != nil {
+		t.Fatalf("CancelReservation: %v", err)
+	}
+	if cancelled.Status != models.ReservationStatusCancelled || cancelled.EndedAt == nil {
+		t.Errorf("cancelled = %+v", cancelled)
+	}
+	expectStatus(1, models.StockStatusInStock)
+	_, err = store.CancelReservation("rs_first")
+	expectError(t, err, apperr.ErrConflict)
+
+	if err := reserve("rs_again", 1); err != nil {
+		t.Fatalf("reserve again: %v", err)
+	}
+	reservations, err := store.GetReservations(1)
+	if err != nil {
+		t.Fatalf("GetReservations: %v", err)
+	}
+	if len(reservations) != 2 || reservations[0].Reference != "rs_again" || reservations[1].Reference != "rs_first" {
+		t.Errorf("reservations = %+v", reservations)
+	}
+	_, err = store.GetReservations(99)
+	expectError(t, err, apperr.ErrNotFound)
+
+	// Staff and the feed leave a held vehicle to its reservation
+	_, err = store.TransitionVehicleStatus(1, models.StockStatusInStock, "jane.smith", "")
+	expectError(t, err, apperr.ErrConflict)
+	if applied, err := store.ApplyFeedSync(nil, nil, []int{1}); err != nil || applied.Removed != 0 {
+		t.Fatalf("ApplyFeedSync = %+v, %v", applied, err)
+	}
+	expectStatus(1, models.StockStatusReserved)
+
+	// Only reservations that have run out expire
+	if err := reserve("rs_other", 2); err != nil {
+		t.Fatalf("reserve vehicle 2: %v", err)
+	}
+	if expired, err := store.ExpireReservations(expiresAt.Add(-time.Minute)); err != nil || len(expired) != 0 {
+		t.Fatalf("early expiry = %+v, %v", expired, err)
+	}
+
+	// A sale completes in two steps around taking the deposit
+	_, err = store.CompleteReservation("rs_other", "jane.smith")
+	expectError(t, err, apperr.ErrConflict)
+	completing, err := store.MarkReservationCompleting("rs_other")
+	if err != nil {
+		t.Fatalf("MarkReservationCompleting: %v", err)
+	}
+	if completing.Status != models.ReservationStatusCompleting || !completing.Held() || completing.EndedAt != nil {
+		t.Errorf("completing = %+v", completing)
+	}
+	if again, err := store.MarkReservationCompleting("rs_other"); err != nil || again.Status != models.ReservationStatusCompleting {
+		t.Fatalf("mark completing again = %+v, %v", again, err)
+	}
+	expectStatus(2, models.StockStatusReserved)
+
+	// A completing reservation keeps its vehicle until the sale is recorded
+	_, err = store.CancelReservation("rs_other")
+	expectError(t, err, apperr.ErrConflict)
+	_, err = store.TransitionVehicleStatus(2, models.StockStatusInStock, "jane.smith", "")
+	expectError(t, err, apperr.ErrConflict)
+	expectError(t, reserve("rs_during", 2), apperr.ErrConflict)
+
+	expired, err := store.ExpireReservations(expiresAt)
+	if err != nil {
+		t.Fatalf("ExpireReservations: %v", err)
+	}
+	if len(expired) != 1 || expired[0].Reference != "rs_again" || expired[0].Status != models.ReservationStatusExpired {
+		t.Fatalf("expired = %+v", expired)
+	}
+	expectStatus(1, models.StockStatusInStock)
+	expectStatus(2, models.StockStatusReserved)
+	_, err = store.MarkReservationCompleting("rs_again")
+	expectError(t, err, apperr.ErrConflict)
+
+	completed, err := store.CompleteReservation("rs_other", "jane.smith")
+	if err != nil {
+		t.Fatalf("CompleteReservation: %v", err)
+	}
+	if completed.Status != models.ReservationStatusCompleted || completed.EndedAt == nil {
+		t.Errorf("completed = %+v", completed)
+	}
+	expectStatus(2, models.StockStatusSold)
+	_, err = store.CompleteReservation("rs_other", "jane.smith")
+	expectError(t, err, apperr.ErrConflict)
+
+	history, err := store.GetStatusHistory(1)
+	if err != nil {
+		t.Fatalf("GetStatusHistory: %v", err)
+	}
+	if len(history) != 4 || history[3].ChangedBy != "reservation-expiry" || history[3].ToStatus != models.StockStatusInStock {
+		t.Errorf("history = %+v", history)
+	}
+}
@@ -0,0 +1,233 @@
+package repository
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/Candoo/vehicles-api/internal/apperr"
+	"github.com/Candoo/vehicles-api/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// SiteStore is the storage of dealership sites. VehicleRepository and
+// MemoryVehicleStore implement it, as saving a site links the vehicles at it.
+type SiteStore interface {
+	ListSites() ([]models.Site, error)
+	GetSiteBySlug(slug string) (*models.Site, error)
+	CreateSite(site *models.Site) error
+	UpdateSite(slug string, site *models.Site) error
+}
+
+var (
+	_ SiteStore = (*VehicleRepository)(nil)
+	_ SiteStore = (*MemoryVehicleStore)(nil)
+)
+
+// errSiteExists is returned when a site clashes with another on slug
+var errSiteExists = apperr.Conflict("a site with the same slug already exists")
+
+// ListSites retrieves every site ordered by name
+func (r *VehicleRepository) ListSites() ([]models.Site, error) {
+	sites := []models.Site{}
+	if err := r.db.Order("name ASC, slug ASC").Find(&sites).Error; err != nil {
+		return nil, dbError(err, "failed to fetch sites")
+	}
+	return sites, nil
+}
+
+// GetSiteBySlug retrieves a single site by slug
+func (r *VehicleRepository) GetSiteBySlug(slug string) (*models.Site, error) {
+	return findSite(r.db, slug)
+}
+
+// CreateSite inserts a new site, rejecting a slug that is already used
+func (r *VehicleRepository) CreateSite(site *models.Site) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if _, err := findSite(tx, site.Slug); err == nil {
+			return errSiteExists
+		} else if !errors.Is(err, apperr.ErrNotFound) {
+			return err
+		}
+
+		if err := tx.Create(site).Error; err != nil {
+			if errors.Is(err, gorm.ErrDuplicatedKey) {
+				return errSiteExists
+			}
+			return dbError(err, "failed to create site")
+		}
+
+		// Vehicles already carrying the slug from the feed now belong to the site
+		if err := tx.Model(&models.Vehicle{}).
+			Where("site_slug = ? AND site_id IS NULL", site.Slug).
+			UpdateColumn("site_id", site.ID).Error; err != nil {
+			return dbError(err, "failed to link vehicles to site")
+		}
+
+		return nil
+	})
+}
+
+// UpdateSite replaces every field of an existing site except its slug. A new name
+// is copied to the site's vehicles.
+func (r *VehicleRepository) UpdateSite(slug string, site *models.Site) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		var existing models.Site
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("slug = ?", slug).First(&existing).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return apperr.NotFound("site not found")
+			}
+			return dbError(err, "failed to fetch site")
+		}
+
+		site.ID = existing.ID
+		site.Slug = existing.Slug
+
+		// Select("*") makes GORM write zero values so the update is a full replacement
+		if err := tx.Model(&models.Site{}).
+			Where("id = ?", existing.ID).
+			Select("*").
+			Omit("id", "slug", "created_at").
+			Updates(site).Error; err != nil {
+			return dbError(err, "failed to update site")
+		}
+
+		if site.Name != existing.Name {
+			if err := tx.Model(&models.Vehicle{}).
+				Where("site_id = ?", existing.ID).
+				UpdateColumn("site", site.Name).Error; err != nil {
+				return dbError(err, "failed to rename site on vehicles")
+			}
+		}
+
+		return tx.First(site, existing.ID).Error
+	})
+}
+
+// TransferVehicle moves a vehicle to another site and records the transfer
+func (r *VehicleRepository) TransferVehicle(id int, transfer models.TransferRequest, transferredBy string) (*models.Vehicle, error) {
+	var vehicle models.Vehicle
+
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&vehicle, id).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return apperr.NotFound("vehicle not found")
+			}
+			return dbError(err, "failed to fetch vehicle")
+		}
+
+		site, err := findSite(tx, transfer.SiteSlug)
+		if err != nil {
+			if errors.Is(err, apperr.ErrNotFound) {
+				return apperr.Validation("site %q does not exist", transfer.SiteSlug)
+			}
+			return err
+		}
+
+		record, err := checkTransfer(&vehicle, site, transfer, transferredBy)
+		if err != nil {
+			return err
+		}
+		previous := vehicle
+
+		if err := tx.Model(&vehicle).Updates(map[string]interface{}{
+			"site_id":       site.ID,
+			"site":          site.Name,
+			"site_slug":     site.Slug,
+			"location":      transfer.Location,
+			"location_slug": models.Slugify(transfer.Location),
+		}).Error; err != nil {
+			return dbError(err, "failed to transfer vehicle")
+		}
+
+		if err := tx.Create(record).Error; err != nil {
+			return dbError(err, "failed to record transfer")
+		}
+
+		if err := tx.First(&vehicle, id).Error; err != nil {
+			return dbError(err, "failed to fetch vehicle")
+		}
+		return recordEvents(tx, updatedEvent(previous, vehicle))
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &vehicle, nil
+}
+
+// GetTransferHistory retrieves the site transfers of a vehicle, oldest first
+func (r *VehicleRepository) GetTransferHistory(id int) ([]models.VehicleTransfer, error) {
+	if _, err := r.GetVehicleByID(id); err != nil {
+		return nil, err
+	}
+
+	history := []models.VehicleTransfer{}
+	if err := r.db.Where("vehicle_id = ?", id).
+		Order("transferred_at ASC, id ASC").
+		Find(&history).Error; err != nil {
+		return nil, dbError(err, "failed to fetch transfer history")
+	}
+
+	return history, nil
+}
+
+// findSite looks a site up by slug, ignoring case
+func findSite(tx *gorm.DB, slug string) (*models.Site, error) {
+	var site models.Site
+	if err := tx.Where("slug = ?", strings.ToLower(slug)).First(&site).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, apperr.NotFound("site not found")
+		}
+		return nil, dbError(err, "failed to fetch site")
+	}
+	return &site, nil
+}
+
+// linkSite points a vehicle at the site its site_slug names, if there is one.
+// Vehicles at a site we do not know keep their plain site fields.
+func linkSite(tx *gorm.DB, vehicle *models.Vehicle) error {
+	vehicle.SiteID = nil
+	if vehicle.SiteSlug == "" {
+		return nil
+	}
+
+	site, err := findSite(tx, vehicle.SiteSlug)
+	if errors.Is(err, apperr.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	applySite(vehicle, site)
+	return nil
+}
+
+// applySite links a vehicle to a site, taking the site's name when it has none
+func applySite(vehicle *models.Vehicle, site *models.Site) {
+	vehicle.SiteID = &site.ID
+	vehicle.SiteSlug = site.Slug
+	if vehicle.Site == "" {
+		vehicle.Site = site.Name
+	}
+}
+
+// checkTransfer rejects transfers of sold vehicles and to the site a vehicle is
+// already at, and builds the audit record otherwise
+func checkTransfer(vehicle *models.Vehicle, site *models.Site, transfer models.TransferRequest, transferredBy string) (*models.VehicleTransfer, error) {
+	if vehicle.StockStatus == models.StockStatusSold {
+		return nil, apperr.Conflict("sold vehicles cannot be transferred")
+	}
+	if vehicle.SiteSlug == site.Slug {
+		return nil, apperr.Conflict("vehicle is already at site %s", site.Slug)
+	}
+
+	return &models.VehicleTransfer{
+		VehicleID:     vehicle.VehicleID,
+		FromSiteSlug:  vehicle.SiteSlug,
+		ToSiteSlug:    site.Slug,
+		TransferredBy: transferredBy,
+		Reason:        transfer.Reason,
+	}, nil
+}
@@ -0,0 +1,52 @@
+package repository
+
+import (
+	"fmt"
+
+	"github.com/Candoo/vehicles-api/internal/models"
+	"gorm.io/gorm"
+)
+
+// assignSlug fills in a vehicle's missing slugs and makes its listing slug unique.
+// A taken slug gets the vehicle ID appended, then a counter, until it is free. With
+// strict set a slug the client chose must already be free; generated slugs are
+// always made unique.
+func assignSlug(vehicle *models.Vehicle, strict bool, taken func(slug string) (bool, error)) error {
+	chosen := strict && vehicle.Slug != ""
+	vehicle.FillSlugs()
+
+	base := vehicle.Slug
+	for attempt := 0; ; attempt++ {
+		candidate := base
+		if attempt == 1 {
+			candidate = fmt.Sprintf("%s-%d", base, vehicle.VehicleID)
+		} else if attempt > 1 {
+			candidate = fmt.Sprintf("%s-%d-%d", base, vehicle.VehicleID, attempt)
+		}
+
+		used, err := taken(candidate)
+		if err != nil {
+			return err
+		}
+		if !used {
+			vehicle.Slug = candidate
+			return nil
+		}
+		if chosen {
+			return errSlugTaken
+		}
+	}
+}
+
+// slugTaken returns a check for whether a vehicle other than vehicleID uses a slug
+func slugTaken(tx *gorm.DB, vehicleID int) func(slug string) (bool, error) {
+	return func(slug string) (bool, error) {
+		var count int64
+		if err := tx.Model(&models.Vehicle{}).
+			Where("slug = ? AND vehicle_id <> ?", slug, vehicleID).
+			Count(&count).Error; err != nil {
+			return false, dbError(err, "failed to check slug")
+		}
+		return count > 0, nil
+	}
+}
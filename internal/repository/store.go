@@ -0,0 +1,39 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/Candoo/vehicles-api/internal/models"
+)
+
+// VehicleStore is the storage of vehicles and their status, price and site histories.
+// VehicleRepository implements it on Postgres and MemoryVehicleStore in memory; both
+// return the same apperr errors, e.g. apperr.ErrNotFound for an unknown vehicle and
+// apperr.ErrConflict for a clash on vehicle ID, VRM or stock ID.
+type VehicleStore interface {
+	GetVehicles(filters models.VehicleFilters) ([]models.Vehicle, *models.ResponseMetadata, error)
+	GetFacets(filters models.VehicleFilters) (*models.Facets, error)
+	GetVehicleByID(id int) (*models.Vehicle, error)
+	GetVehicleByVRM(vrm string) (*models.Vehicle, error)
+	GetVehicleBySlug(slug string) (*models.Vehicle, error)
+	GetAvailableMakes() ([]string, error)
+	GetAvailableModels(make string) ([]string, error)
+	GetTaxonomy() ([]models.TaxonomyMake, error)
+	CreateVehicle(vehicle *models.Vehicle) error
+	UpdateVehicle(id int, vehicle *models.Vehicle) error
+	DeleteVehicle(id int) error
+
+	TransitionVehicleStatus(id int, to models.StockStatus, changedBy, reason string) (*models.Vehicle, error)
+	GetStatusHistory(id int) ([]models.VehicleStatusChange, error)
+
+	GetPriceHistory(id int) ([]models.VehiclePriceChange, error)
+	GetPriceDrops(since time.Time) ([]models.PriceDrop, error)
+
+	TransferVehicle(id int, transfer models.TransferRequest, transferredBy string) (*models.Vehicle, error)
+	GetTransferHistory(id int) ([]models.VehicleTransfer, error)
+}
+
+var (
+	_ VehicleStore = (*VehicleRepository)(nil)
+	_ VehicleStore = (*MemoryVehicleStore)(nil)
+)
@@ -0,0 +1,1213 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Candoo/vehicles-api/internal/apperr"
+	"github.com/Candoo/vehicles-api/internal/database"
+	"github.com/Candoo/vehicles-api/internal/geo"
+	"github.com/Candoo/vehicles-api/internal/models"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// stores are the stores sharing one database, as the suite tests them together
+type stores struct {
+	VehicleStore
+	SiteStore
+	PartExchangeStore
+	FeedStore
+	OutboxStore
+	LeadStore
+	TestDriveStore
+	ReservationStore
+}
+
+// TestMemoryVehicleStore runs the shared suite against the in-memory stores
+func TestMemoryVehicleStore(t *testing.T) {
+	runVehicleStoreSuite(t, func(t *testing.T) stores {
+		vehicles := NewMemoryVehicleStore()
+		return stores{
+			VehicleStore:      vehicles,
+			SiteStore:         vehicles,
+			PartExchangeStore: vehicles,
+			FeedStore:         vehicles,
+			OutboxStore:       vehicles,
+			LeadStore:         NewMemoryLeadStore(vehicles),
+			TestDriveStore:    NewMemoryTestDriveStore(vehicles),
+			ReservationStore:  NewMemoryReservationStore(vehicles),
+		}
+	})
+}
+
+// TestVehicleRepository runs the shared suite against Postgres. It is skipped unless
+// TEST_DATABASE_URL points at a database the tests may wipe.
+func TestVehicleRepository(t *testing.T) {
+	db := openTestDB(t)
+
+	runVehicleStoreSuite(t, func(t *testing.T) stores {
+		if err := db.Exec("TRUNCATE vehicles, vehicle_status_history, vehicle_price_history, feed_sync_runs, sites, vehicle_site_transfers, part_exchange_requests, leads, lead_enquiries, test_drives, reservations, outbox_events RESTART IDENTITY").Error; err != nil {
+			t.Fatalf("failed to reset database: %v", err)
+		}
+		vehicles := NewVehicleRepository(db)
+		return stores{
+			VehicleStore:      vehicles,
+			SiteStore:         vehicles,
+			PartExchangeStore: vehicles,
+			FeedStore:         vehicles,
+			OutboxStore:       vehicles,
+			LeadStore:         NewLeadRepository(db),
+			TestDriveStore:    NewTestDriveRepository(db),
+			ReservationStore:  NewReservationRepository(db),
+		}
+	})
+}
+
+// openTestDB connects to and migrates the database at TEST_DATABASE_URL, skipping
+// the test when it is not set
+func openTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL not set")
+	}
+
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{
+		Logger:         logger.Default.LogMode(logger.Silent),
+		TranslateError: true,
+	})
+	if err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+	if err := database.RunMigrations(db); err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+	return db
+}
+
+// runVehicleStoreSuite checks the behaviour every implementation of the stores must
+// share. newStore returns empty stores for each subtest.
+func runVehicleStoreSuite(t *testing.T, newStore func(t *testing.T) stores) {
+	tests := []struct {
+		name string
+		run  func(t *testing.T, store stores)
+	}{
+		{"create and get", testCreateAndGet},
+		{"create conflicts", testCreateConflicts},
+		{"concurrent creates", testConcurrentCreates},
+		{"filters", testFilters},
+		{"offset pagination", testOffsetPagination},
+		{"cursor pagination", testCursorPagination},
+		{"search", testSearch},
+		{"facets", testFacets},
+		{"makes and models", testMakesAndModels},
+		{"update and delete", testUpdateAndDelete},
+		{"status transitions", testStatusTransitions},
+		{"price drops", testPriceDrops},
+		{"feed sync", testFeedSync},
+		{"slugs", testSlugs},
+		{"taxonomy", testTaxonomy},
+		{"sites", testSites},
+		{"near", testNear},
+		{"part exchanges", testPartExchanges},
+		{"leads", testLeads},
+		{"concurrent enquiries", testConcurrentEnquiries},
+		{"test drives", testTestDrives},
+		{"reservations", testReservations},
+		{"events", testEvents},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.run(t, newStore(t))
+		})
+	}
+}
+
+// testVehicle builds a valid vehicle priced in whole pounds
+func testVehicle(id int, make, model string, pounds int64) models.Vehicle {
+	return models.Vehicle{
+		VehicleID:            id,
+		Name:                 make + " " + model,
+		Make:                 make,
+		Model:                model,
+		AdvertClassification: "Used",
+		FuelType:             "Petrol",
+		Transmission:         "Manual",
+		BodyType:             "Hatchback",
+		Year:                 "2018",
+		VRM:                  fmt.Sprintf("AB%02dCDE", id),
+		StockID:              fmt.Sprintf("STK%d", id),
+		Price:                models.MoneyFromPounds(pounds),
+		Source:               models.VehicleSourceAPI,
+	}
+}
+
+// mustCreate inserts vehicles or fails the test
+func mustCreate(t *testing.T, store VehicleStore, vehicles ...models.Vehicle) {
+	t.Helper()
+	for i := range vehicles {
+		if err := store.CreateVehicle(&vehicles[i]); err != nil {
+			t.Fatalf("CreateVehicle(%d): %v", vehicles[i].VehicleID, err)
+		}
+	}
+}
+
+// vehicleIDs lists the IDs of vehicles in order
+func vehicleIDs(vehicles []models.Vehicle) []int {
+	ids := []int{}
+	for _, vehicle := range vehicles {
+		ids = append(ids, vehicle.VehicleID)
+	}
+	return ids
+}
+
+// expectIDs fails the test when vehicles are not exactly the given IDs in order
+func expectIDs(t *testing.T, vehicles []models.Vehicle, want ...int) {
+	t.Helper()
+	if want == nil {
+		want = []int{}
+	}
+	if got := vehicleIDs(vehicles); !reflect.DeepEqual(got, want) {
+		t.Errorf("vehicle IDs = %v, want %v", got, want)
+	}
+}
+
+// expectError fails the test unless err is of the given apperr kind
+func expectError(t *testing.T, err error, kind error) {
+	t.Helper()
+	if !errors.Is(err, kind) {
+		t.Errorf("err = %v, want %v", err, kind)
+	}
+}
+
+func testCreateAndGet(t *testing.T, store stores) {
+	vehicle := testVehicle(1, "Skoda", "Fabia", 5000)
+	vehicle.StockStatus = ""
+	mustCreate(t, store, vehicle)
+
+	got, err := store.GetVehicleByID(1)
+	if err != nil {
+		t.Fatalf("GetVehicleByID: %v", err)
+	}
+	if got.Make != "Skoda" || got.Price != models.MoneyFromPounds(5000) {
+		t.Errorf("vehicle = %+v", got)
+	}
+	if got.StockStatus != models.StockStatusInStock {
+		t.Errorf("stock_status = %q, want the in_stock default", got.StockStatus)
+	}
+	if got.CreatedAt.IsZero() {
+		t.Error("created_at not set")
+	}
+
+	byVRM, err := store.GetVehicleByVRM("ab01cde")
+	if err != nil || byVRM.VehicleID != 1 {
+		t.Errorf("GetVehicleByVRM = %v, %v", byVRM, err)
+	}
+
+	_, err = store.GetVehicleByID(2)
+	expectError(t, err, apperr.ErrNotFound)
+	_, err = store.GetVehicleByVRM("ZZ99ZZZ")
+	expectError(t, err, apperr.ErrNotFound)
+}
+
+func testCreateConflicts(t *testing.T, store stores) {
+	mustCreate(t, store, testVehicle(1, "Skoda", "Fabia", 5000))
+
+	sameID := testVehicle(1, "Ford", "Fiesta", 6000)
+	sameID.VRM, sameID.StockID = "XX11XXX", "OTHER"
+
+	sameVRM := testVehicle(2, "Ford", "Fiesta", 6000)
+	sameVRM.VRM = "ab01cde"
+
+	sameStockID := testVehicle(3, "Ford", "Fiesta", 6000)
+	sameStockID.StockID = "STK1"
+
+	for _, vehicle := range []models.Vehicle{sameID, sameVRM, sameStockID} {
+		expectError(t, store.CreateVehicle(&vehicle), apperr.ErrConflict)
+	}
+}
+
+func testConcurrentCreates(t *testing.T, store stores) {
+	// Vehicles with the same VRM race past the conflict check; only one is stored
+	const creates = 8
+	var wg sync.WaitGroup
+	errs := make([]error, creates)
+	for i := range errs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			vehicle := testVehicle(i+1, "Skoda", "Fabia", 5000)
+			vehicle.VRM = "AB12CDE"
+			errs[i] = store.CreateVehicle(&vehicle)
+		}()
+	}
+	wg.Wait()
+
+	created := 0
+	for _, err := range errs {
+		if err == nil {
+			created++
+			continue
+		}
+		expectError(t, err, apperr.ErrConflict)
+	}
+	if created != 1 {
+		t.Errorf("created %d vehicles with the same VRM, want 1", created)
+	}
+}
+
+func testFilters(t *testing.T, store stores) {
+	fabia := testVehicle(1, "Skoda", "Fabia", 5000)
+	fabia.Colour, fabia.Doors, fabia.SiteSlug = "Red", "5", "leeds"
+	fabia.OdometerValue, fabia.PreviousKeepers = 40000, 2
+	octavia := testVehicle(2, "Skoda", "Octavia Estate", 12000)
+	octavia.Year = "2021"
+	octavia.Colour, octavia.Doors, octavia.SiteSlug = "Blue", "5", "york"
+	octavia.OdometerValue, octavia.PreviousKeepers, octavia.HasOffer = 10000, 1, true
+	fiesta := testVehicle(3, "Ford", "Fiesta", 7000)
+	fiesta.AdvertClassification = "New"
+	fiesta.FuelType = "Diesel"
+	fiesta.Colour, fiesta.Doors, fiesta.SiteSlug = "red", "3", "leeds"
+	sold := testVehicle(4, "Ford", "Focus", 9000)
+	sold.StockStatus = models.StockStatusSold
+	mustCreate(t, store, fabia, octavia, fiesta, sold)
+
+	listed := models.VehicleFilters{StockStatuses: models.ListedStockStatuses}
+	with := func(change func(f *models.VehicleFilters)) models.VehicleFilters {
+		filters := listed
+		change(&filters)
+		return filters
+	}
+
+	tests := []struct {
+		name    string
+		filters models.VehicleFilters
+		want    []int
+	}{
+		{"listed only", listed, []int{1, 2, 3}},
+		{"every status", models.VehicleFilters{}, []int{1, 2, 3, 4}},
+		{"make ignores case", with(func(f *models.VehicleFilters) { f.Makes = []string{"SKODA"} }), []int{1, 2}},
+		{"any of several makes", with(func(f *models.VehicleFilters) { f.Makes = []string{"Ford", "Skoda"} }), []int{1, 2, 3}},
+		{"model substring", with(func(f *models.VehicleFilters) { f.Model = "estate" }), []int{2}},
+		{"classification", with(func(f *models.VehicleFilters) { f.AdvertClassification = "new" }), []int{3}},
+		{"classification all", with(func(f *models.VehicleFilters) { f.AdvertClassification = "All" }), []int{1, 2, 3}},
+		{"fuel type", with(func(f *models.VehicleFilters) { f.FuelTypes = []string{"diesel"} }), []int{3}},
+		{"colour ignores case", with(func(f *models.VehicleFilters) { f.Colours = []string{"RED"} }), []int{1, 3}},
+		{"doors", with(func(f *models.VehicleFilters) { f.Doors = []int{3, 4} }), []int{3}},
+		{"site", with(func(f *models.VehicleFilters) { f.SiteSlugs = []string{"york"} }), []int{2}},
+		{"mileage range", with(func(f *models.VehicleFilters) {
+			min, max := 5000, 40000
+			f.MinMileage, f.MaxMileage = &min, &max
+		}), []int{1, 2}},
+		{"zero max mileage", with(func(f *models.VehicleFilters) { f.MaxMileage = new(int) }), []int{3}},
+		{"max previous keepers", with(func(f *models.VehicleFilters) {
+			keepers := 1
+			f.MaxPreviousKeepers = &keepers
+		}), []int{2, 3}},
+		{"has offer", with(func(f *models.VehicleFilters) {
+			offer := true
+			f.HasOffer = &offer
+		}), []int{2}},
+		{"without offer", with(func(f *models.VehicleFilters) { f.HasOffer = new(bool) }), []int{1, 3}},
+		{"combined", with(func(f *models.VehicleFilters) {
+			f.Makes, f.Colours, f.SiteSlugs = []string{"Skoda", "Ford"}, []string{"red"}, []string{"leeds"}
+			f.FuelTypes = []string{"Petrol"}
+		}), []int{1}},
+		{"price range", with(func(f *models.VehicleFilters) {
+			f.MinPrice, f.MaxPrice = models.MoneyFromPounds(6000), models.MoneyFromPounds(12000)
+		}), []int{2, 3}},
+		{"year range", with(func(f *models.VehicleFilters) { f.MinYear, f.MaxYear = 2020, 2022 }), []int{2}},
+		{"no match", with(func(f *models.VehicleFilters) { f.Makes = []string{"Tesla"} }), nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vehicles, meta, err := store.GetVehicles(tt.filters)
+			if err != nil {
+				t.Fatalf("GetVehicles: %v", err)
+			}
+			expectIDs(t, vehicles, tt.want...)
+			if meta.Total != int64(len(tt.want)) {
+				t.Errorf("total = %d, want %d", meta.Total, len(tt.want))
+			}
+		})
+	}
+}
+
+func testOffsetPagination(t *testing.T, store stores) {
+	for id := 1; id <= 5; id++ {
+		mustCreate(t, store, testVehicle(id, "Skoda", "Fabia", int64(1000*id)))
+	}
+
+	sort, _ := models.ParseSort("price:desc")
+	vehicles, meta, err := store.GetVehicles(models.VehicleFilters{Page: 2, ResultsPerPage: 2, Sort: sort})
+	if err != nil {
+		t.Fatalf("GetVehicles: %v", err)
+	}
+	expectIDs(t, vehicles, 3, 2)
+	if meta.CurrentPage != 2 || meta.LastPage != 3 || meta.PerPage != 2 || meta.Total != 5 {
+		t.Errorf("meta = %+v", meta)
+	}
+	if meta.NextCursor == "" || meta.PrevCursor == "" {
+		t.Errorf("middle page should have both cursors: %+v", meta)
+	}
+
+	vehicles, meta, err = store.GetVehicles(models.VehicleFilters{Page: 4, ResultsPerPage: 2})
+	if err != nil {
+		t.Fatalf("GetVehicles: %v", err)
+	}
+	expectIDs(t, vehicles)
+	if meta.Total != 5 {
+		t.Errorf("total = %d, want 5", meta.Total)
+	}
+
+	// Missing page settings fall back to the first page of ten
+	vehicles, meta, err = store.GetVehicles(models.VehicleFilters{})
+	if err != nil {
+		t.Fatalf("GetVehicles: %v", err)
+	}
+	expectIDs(t, vehicles, 1, 2, 3, 4, 5)
+	if meta.CurrentPage != 1 || meta.PerPage != 10 || meta.NextCursor != "" {
+		t.Errorf("meta = %+v", meta)
+	}
+}
+
+func testCursorPagination(t *testing.T, store stores) {
+	// Equal prices make the vehicle_id tiebreak matter
+	prices := []int64{3000, 1000, 3000, 2000, 1000}
+	for i, price := range prices {
+		mustCreate(t, store, testVehicle(i+1, "Skoda", "Fabia", price))
+	}
+	want := []int{2, 5, 4, 1, 3}
+
+	sort, _ := models.ParseSort("price:asc")
+	filters := models.VehicleFilters{ResultsPerPage: 2, Sort: sort}
+
+	var seen []int
+	var pages []string
+	cursor := ""
+	for {
+		page := filters
+		if cursor != "" {
+			decoded, err := models.DecodeCursor(cursor, sort)
+			if err != nil {
+				t.Fatalf("DecodeCursor: %v", err)
+			}
+			page.Cursor = decoded
+		}
+
+		vehicles, meta, err := store.GetVehicles(page)
+		if err != nil {
+			t.Fatalf("GetVehicles: %v", err)
+		}
+		seen = append(seen, vehicleIDs(vehicles)...)
+		if meta.Total != 5 {
+			t.Errorf("total = %d, want 5", meta.Total)
+		}
+		if meta.NextCursor == "" {
+			break
+		}
+		pages = append(pages, meta.NextCursor)
+		cursor = meta.NextCursor
+		if len(pages) > len(want) {
+			t.Fatal("cursor pagination does not terminate")
+		}
+	}
+	if !reflect.DeepEqual(seen, want) {
+		t.Fatalf("walked %v, want %v", seen, want)
+	}
+
+	// Step back from the last page
+	decoded, _ := models.DecodeCursor(pages[len(pages)-1], sort)
+	filters.Cursor = decoded
+	_, meta, err := store.GetVehicles(filters)
+	if err != nil {
+		t.Fatalf("GetVehicles: %v", err)
+	}
+	decoded, err = models.DecodeCursor(meta.PrevCursor, sort)
+	if err != nil {
+		t.Fatalf("DecodeCursor(prev): %v", err)
+	}
+	filters.Cursor = decoded
+	vehicles, meta, err := store.GetVehicles(filters)
+	if err != nil {
+		t.Fatalf("GetVehicles: %v", err)
+	}
+	expectIDs(t, vehicles, 4, 1)
+	if meta.NextCursor == "" || meta.PrevCursor == "" {
+		t.Errorf("middle page should have both cursors: %+v", meta)
+	}
+}
+
+func testSearch(t *testing.T, store stores) {
+	inName := testVehicle(1, "Fiat", "500", 6000)
+	inName.Name = "Fiat 500 Panoramic"
+	inDescription := testVehicle(2, "Fiat", "Panda", 5000)
+	inDescription.Description = "Comes with a panoramic roof"
+	neither := testVehicle(3, "Fiat", "Tipo", 7000)
+	neither.Description = "Solid roof"
+	mustCreate(t, store, inName, inDescription, neither)
+
+	filters := models.VehicleFilters{
+		Query: "panoramic",
+		Sort:  []models.SortField{{Field: "relevance", Descending: true}},
+	}
+	vehicles, meta, err := store.GetVehicles(filters)
+	if err != nil {
+		t.Fatalf("GetVehicles: %v", err)
+	}
+	expectIDs(t, vehicles, 1, 2)
+	if meta.Total != 2 {
+		t.Errorf("total = %d, want 2", meta.Total)
+	}
+	if len(vehicles) == 2 && !(vehicles[0].Relevance > vehicles[1].Relevance && vehicles[1].Relevance > 0) {
+		t.Errorf("relevance = %v, %v", vehicles[0].Relevance, vehicles[1].Relevance)
+	}
+
+	filters.Query = "roof -panoramic"
+	vehicles, _, err = store.GetVehicles(filters)
+	if err != nil {
+		t.Fatalf("GetVehicles: %v", err)
+	}
+	expectIDs(t, vehicles, 3)
+}
+
+func testFacets(t *testing.T, store stores) {
+	fabia := testVehicle(1, "Skoda", "Fabia", 4000)
+	octavia := testVehicle(2, "Skoda", "Octavia", 12000)
+	octavia.HasOffer = true
+	fiesta := testVehicle(3, "Ford", "Fiesta", 7000)
+	fiesta.FuelType = "Diesel"
+	mustCreate(t, store, fabia, octavia, fiesta)
+
+	facets, err := store.GetFacets(models.VehicleFilters{Makes: []string{"Skoda"}})
+	if err != nil {
+		t.Fatalf("GetFacets: %v", err)
+	}
+
+	// The make facet ignores the make filter, the others honour it
+	wantMake := []models.FacetCount{{Value: "Skoda", Count: 2}, {Value: "Ford", Count: 1}}
+	if !reflect.DeepEqual(facets.Make, wantMake) {
+		t.Errorf("make facet = %+v, want %+v", facets.Make, wantMake)
+	}
+	wantFuel := []models.FacetCount{{Value: "Petrol", Count: 2}}
+	if !reflect.DeepEqual(facets.FuelType, wantFuel) {
+		t.Errorf("fuel_type facet = %+v, want %+v", facets.FuelType, wantFuel)
+	}
+	wantOffer := []models.FacetCount{{Value: "false", Count: 1}, {Value: "true", Count: 1}}
+	if !reflect.DeepEqual(facets.HasOffer, wantOffer) {
+		t.Errorf("has_offer facet = %+v, want %+v", facets.HasOffer, wantOffer)
+	}
+
+	bands := map[string]int64{}
+	for _, band := range facets.PriceBand {
+		bands[band.Value] = band.Count
+	}
+	if len(facets.PriceBand) != len(models.PriceBands) || bands["under-5000"] != 1 || bands["10000-15000"] != 1 || bands["5000-10000"] != 0 {
+		t.Errorf("price_band facet = %+v", facets.PriceBand)
+	}
+}
+
+func testMakesAndModels(t *testing.T, store stores) {
+	mustCreate(t, store,
+		testVehicle(1, "Skoda", "Octavia", 5000),
+		testVehicle(2, "Skoda", "Fabia", 5000),
+		testVehicle(3, "Ford", "Fiesta", 5000),
+		testVehicle(4, "Skoda", "Fabia", 6000),
+	)
+
+	makes, err := store.GetAvailableMakes()
+	if err != nil || !reflect.DeepEqual(makes, []string{"Ford", "Skoda"}) {
+		t.Errorf("GetAvailableMakes = %v, %v", makes, err)
+	}
+
+	modelList, err := store.GetAvailableModels("skoda")
+	if err != nil || !reflect.DeepEqual(modelList, []string{"Fabia", "Octavia"}) {
+		t.Errorf("GetAvailableModels = %v, %v", modelList, err)
+	}
+
+	modelList, err = store.GetAvailableModels("")
+	if err != nil || !reflect.DeepEqual(modelList, []string{"Fabia", "Fiesta", "Octavia"}) {
+		t.Errorf("GetAvailableModels(all) = %v, %v", modelList, err)
+	}
+}
+
+func testUpdateAndDelete(t *testing.T, store stores) {
+	original := testVehicle(1, "Skoda", "Fabia", 5000)
+	original.StockStatus = models.StockStatusReserved
+	mustCreate(t, store, original, testVehicle(2, "Ford", "Fiesta", 7000))
+
+	update := testVehicle(0, "Skoda", "Fabia SE", 4500)
+	update.VRM, update.StockID = original.VRM, original.StockID
+	update.Source = models.VehicleSourceFeed
+	update.StockStatus = models.StockStatusSold
+	if err := store.UpdateVehicle(1, &update); err != nil {
+		t.Fatalf("UpdateVehicle: %v", err)
+	}
+	if update.VehicleID != 1 || update.Model != "Fabia SE" {
+		t.Errorf("updated vehicle = %+v", update)
+	}
+
+	got, err := store.GetVehicleByID(1)
+	if err != nil {
+		t.Fatalf("GetVehicleByID: %v", err)
+	}
+	if got.Model != "Fabia SE" || got.Price != models.MoneyFromPounds(4500) {
+		t.Errorf("stored vehicle = %+v", got)
+	}
+	if got.Source != models.VehicleSourceAPI || got.StockStatus != models.StockStatusReserved {
+		t.Errorf("update changed source/stock_status: %q, %q", got.Source, got.StockStatus)
+	}
+
+	history, err := store.GetPriceHistory(1)
+	if err != nil {
+		t.Fatalf("GetPriceHistory: %v", err)
+	}
+	if len(history) != 1 || history[0].OldPrice != models.MoneyFromPounds(5000) ||
+		history[0].NewPrice != models.MoneyFromPounds(4500) || history[0].Source != models.PriceSourceAPI {
+		t.Errorf("price history = %+v", history)
+	}
+
+	clash := testVehicle(0, "Skoda", "Fabia", 4500)
+	clash.VRM = "ab02cde"
+	expectError(t, store.UpdateVehicle(1, &clash), apperr.ErrConflict)
+
+	missing := testVehicle(0, "Skoda", "Fabia", 4500)
+	expectError(t, store.UpdateVehicle(99, &missing), apperr.ErrNotFound)
+
+	if err := store.DeleteVehicle(1); err != nil {
+		t.Fatalf("DeleteVehicle: %v", err)
+	}
+	_, err = store.GetVehicleByID(1)
+	expectError(t, err, apperr.ErrNotFound)
+	expectError(t, store.DeleteVehicle(1), apperr.ErrNotFound)
+	_, err = store.GetPriceHistory(1)
+	expectError(t, err, apperr.ErrNotFound)
+}
+
+func testStatusTransitions(t *testing.T, store stores) {
+	mustCreate(t, store, testVehicle(1, "Skoda", "Fabia", 5000))
+
+	vehicle, err := store.TransitionVehicleStatus(1, models.StockStatusReserved, "jane", "deposit")
+	if err != nil {
+		t.Fatalf("TransitionVehicleStatus: %v", err)
+	}
+	if vehicle.StockStatus != models.StockStatusReserved {
+		t.Errorf("stock_status = %q", vehicle.StockStatus)
+	}
+
+	if _, err := store.TransitionVehicleStatus(1, models.StockStatusSold, "jane", ""); err != nil {
+		t.Fatalf("TransitionVehicleStatus: %v", err)
+	}
+
+	_, err = store.TransitionVehicleStatus(1, models.StockStatusInStock, "jane", "")
+	expectError(t, err, apperr.ErrConflict)
+	if apperr.Message(err) != "invalid status transition from sold to in_stock" {
+		t.Errorf("transition error = %q", apperr.Message(err))
+	}
+
+	_, err = store.TransitionVehicleStatus(2, models.StockStatusSold, "jane", "")
+	expectError(t, err, apperr.ErrNotFound)
+
+	history, err := store.GetStatusHistory(1)
+	if err != nil {
+		t.Fatalf("GetStatusHistory: %v", err)
+	}
+	if len(history) != 2 ||
+		history[0].FromStatus != models.StockStatusInStock || history[0].ToStatus != models.StockStatusReserved ||
+		history[0].ChangedBy != "jane" || history[0].Reason != "deposit" ||
+		history[1].ToStatus != models.StockStatusSold {
+		t.Errorf("status history = %+v", history)
+	}
+
+	// Sold vehicles drop out of the default listing
+	vehicles, _, err := store.GetVehicles(models.VehicleFilters{StockStatuses: models.ListedStockStatuses})
+	if err != nil {
+		t.Fatalf("GetVehicles: %v", err)
+	}
+	expectIDs(t, vehicles)
+}
+
+func testPriceDrops(t *testing.T, store stores) {
+	mustCreate(t, store,
+		testVehicle(1, "Skoda", "Fabia", 10000),
+		testVehicle(2, "Ford", "Fiesta", 10000),
+		testVehicle(3, "Ford", "Focus", 10000),
+		testVehicle(4, "Ford", "Puma", 10000),
+	)
+
+	reprice := func(id int, pounds int64) {
+		t.Helper()
+		vehicle, err := store.GetVehicleByID(id)
+		if err != nil {
+			t.Fatalf("GetVehicleByID: %v", err)
+		}
+		vehicle.Price = models.MoneyFromPounds(pounds)
+		if err := store.UpdateVehicle(id, vehicle); err != nil {
+			t.Fatalf("UpdateVehicle: %v", err)
+		}
+	}
+
+	since := time.Now().Add(-time.Minute)
+	reprice(1, 9000)  // 10% drop
+	reprice(2, 8000)  // 20% drop, over two changes
+	reprice(2, 7500)  // 25% drop from the first price in the window
+	reprice(3, 11000) // increase
+	reprice(4, 9000)
+	if _, err := store.TransitionVehicleStatus(4, models.StockStatusSold, "jane", ""); err != nil {
+		t.Fatalf("TransitionVehicleStatus: %v", err)
+	}
+
+	drops, err := store.GetPriceDrops(since)
+	if err != nil {
+		t.Fatalf("GetPriceDrops: %v", err)
+	}
+	if len(drops) != 2 {
+		t.Fatalf("drops = %+v, want vehicles 2 and 1", drops)
+	}
+	if drops[0].Vehicle.VehicleID != 2 || drops[0].PreviousPrice != models.MoneyFromPounds(10000) || drops[0].ReductionPercent != 25 {
+		t.Errorf("first drop = %+v", drops[0])
+	}
+	if drops[1].Vehicle.VehicleID != 1 || drops[1].Reduction != models.MoneyFromPounds(1000) {
+		t.Errorf("second drop = %+v", drops[1])
+	}
+
+	drops, err = store.GetPriceDrops(time.Now().Add(time.Minute))
+	if err != nil || len(drops) != 0 {
+		t.Errorf("future window = %+v, %v", drops, err)
+	}
+}
+
+func testFeedSync(t *testing.T, store stores) {
+	feed := func(id int, pounds int64) models.Vehicle {
+		vehicle := testVehicle(id, "Skoda", "Fabia", pounds)
+		vehicle.Source = models.VehicleSourceFeed
+		return vehicle
+	}
+	mustCreate(t, store, feed(1, 5000), feed(2, 6000), testVehicle(3, "Ford", "Fiesta", 7000))
+
+	changed := feed(2, 5500)
+	changed.StockStatus = models.StockStatusSold
+	applied, err := store.ApplyFeedSync([]models.Vehicle{feed(4, 8000)}, []models.Vehicle{changed, feed(9, 1000)}, []int{1, 9})
+	if err != nil {
+		t.Fatalf("ApplyFeedSync: %v", err)
+	}
+	// Vehicle 9 is gone, so its update and removal are skipped
+	if applied != (models.FeedSyncCounts{Inserted: 1, Updated: 1, Removed: 1}) {
+		t.Errorf("applied = %+v, want 1 inserted, 1 updated, 1 removed", applied)
+	}
+
+	vehicles, err := store.ListAllVehicles()
+	if err != nil {
+		t.Fatalf("ListAllVehicles: %v", err)
+	}
+	expectIDs(t, vehicles, 1, 2, 3, 4)
+
+	withdrawn, _ := store.GetVehicleByID(1)
+	if withdrawn.StockStatus != models.StockStatusWithdrawn {
+		t.Errorf("removed vehicle stock_status = %q, want withdrawn", withdrawn.StockStatus)
+	}
+	history, _ := store.GetStatusHistory(1)
+	if len(history) != 1 || history[0].ChangedBy != FeedSyncActor {
+		t.Errorf("status history = %+v", history)
+	}
+
+	updated, _ := store.GetVehicleByID(2)
+	if updated.Price != models.MoneyFromPounds(5500) || updated.StockStatus != models.StockStatusInStock {
+		t.Errorf("updated vehicle price %s, stock_status %q", updated.Price, updated.StockStatus)
+	}
+	prices, _ := store.GetPriceHistory(2)
+	if len(prices) != 1 || prices[0].Source != models.PriceSourceFeed {
+		t.Errorf("price history = %+v", prices)
+	}
+
+	// A failing sync changes nothing
+	_, err = store.ApplyFeedSync([]models.Vehicle{feed(5, 9000), feed(4, 9000)}, nil, nil)
+	if err == nil {
+		t.Fatal("ApplyFeedSync with a duplicate insert succeeded")
+	}
+	if _, err := store.GetVehicleByID(5); err == nil {
+		t.Error("vehicle from the failed sync was kept")
+	}
+
+	run := models.FeedSyncRun{Source: "test", StartedAt: time.Now(), Inserted: 1}
+	if err := store.CreateFeedSyncRun(&run); err != nil || run.ID == 0 {
+		t.Errorf("CreateFeedSyncRun = %v, id %d", err, run.ID)
+	}
+}
+
+func testSlugs(t *testing.T, store stores) {
+	fabia := testVehicle(1, "Skoda", "Fabia", 5000)
+	fabia.Derivative = "1.2 12V SE 5dr"
+	mustCreate(t, store, fabia)
+
+	got, err := store.GetVehicleBySlug("skoda-fabia-12-12v-se-5dr-stk1")
+	if err != nil {
+		t.Fatalf("GetVehicleBySlug: %v", err)
+	}
+	if got.VehicleID != 1 || got.MakeSlug != "skoda" || got.RangeSlug != "fabia" || got.BodyTypeSlug != "hatchback" {
+		t.Errorf("generated slugs: slug %q, make %q, range %q, body type %q", got.Slug, got.MakeSlug, got.RangeSlug, got.BodyTypeSlug)
+	}
+	_, err = store.GetVehicleBySlug("skoda-fabia")
+	expectError(t, err, apperr.ErrNotFound)
+
+	// A chosen slug must be free
+	taken := testVehicle(2, "Skoda", "Octavia", 9000)
+	taken.Slug = got.Slug
+	expectError(t, store.CreateVehicle(&taken), apperr.ErrConflict)
+	chosen := testVehicle(2, "Skoda", "Octavia", 9000)
+	chosen.Slug = "skoda-octavia"
+	mustCreate(t, store, chosen)
+
+	// A full update keeps the slug unless a new one is given
+	update := testVehicle(2, "Skoda", "Octavia", 8500)
+	if err := store.UpdateVehicle(2, &update); err != nil {
+		t.Fatalf("UpdateVehicle: %v", err)
+	}
+	if update.Slug != "skoda-octavia" {
+		t.Errorf("slug after update = %q, want it kept", update.Slug)
+	}
+	update.Slug = got.Slug
+	expectError(t, store.UpdateVehicle(2, &update), apperr.ErrConflict)
+
+	// Repeated feed slugs are made unique with the vehicle ID
+	repeat := func(id int) models.Vehicle {
+		vehicle := testVehicle(id, "Ford", "Fiesta", 7000)
+		vehicle.Slug = "ford-fiesta-zetec"
+		vehicle.Source = models.VehicleSourceFeed
+		return vehicle
+	}
+	if _, err := store.ApplyFeedSync([]models.Vehicle{repeat(3), repeat(4)}, nil, nil); err != nil {
+		t.Fatalf("ApplyFeedSync: %v", err)
+	}
+	for slug, want := range map[string]int{"ford-fiesta-zetec": 3, "ford-fiesta-zetec-4": 4} {
+		if vehicle, err := store.GetVehicleBySlug(slug); err != nil || vehicle.VehicleID != want {
+			t.Errorf("GetVehicleBySlug(%q) = %v, %v, want vehicle %d", slug, vehicle, err, want)
+		}
+	}
+
+	vehicles, _, err := store.GetVehicles(models.VehicleFilters{MakeSlugs: []string{"skoda"}, RangeSlugs: []string{"Octavia"}})
+	if err != nil {
+		t.Fatalf("GetVehicles: %v", err)
+	}
+	expectIDs(t, vehicles, 2)
+}
+
+func testTaxonomy(t *testing.T, store stores) {
+	se := testVehicle(1, "Skoda", "Fabia", 5000)
+	se.Range, se.Derivative = "Fabia", "1.2 SE 5dr"
+	se2 := testVehicle(2, "Skoda", "Fabia", 6500)
+	se2.Range, se2.Derivative = "Fabia", "1.2 SE 5dr"
+	estate := testVehicle(3, "Skoda", "Fabia Estate", 8000)
+	estate.Range, estate.Derivative = "Fabia", "1.4 S"
+	fiesta := testVehicle(4, "Ford", "Fiesta", 7000)
+	fiesta.Derivative = "1.0 Zetec"
+	sold := testVehicle(5, "Ford", "Focus", 9000)
+	sold.StockStatus = models.StockStatusSold
+	mustCreate(t, store, se, se2, estate, fiesta, sold)
+
+	makes, err := store.GetTaxonomy()
+	if err != nil {
+		t.Fatalf("GetTaxonomy: %v", err)
+	}
+
+	stats := func(count int64, min, max int64) models.TaxonomyStats {
+		return models.TaxonomyStats{Count: count, MinPrice: models.MoneyFromPounds(min), MaxPrice: models.MoneyFromPounds(max)}
+	}
+	want := []models.TaxonomyMake{
+		{Name: "Ford", Slug: "ford", TaxonomyStats: stats(1, 7000, 7000), Ranges: []models.TaxonomyRange{
+			{Name: "Fiesta", Slug: "fiesta", TaxonomyStats: stats(1, 7000, 7000), Models: []models.TaxonomyModel{
+				{Name: "Fiesta", Slug: "fiesta", TaxonomyStats: stats(1, 7000, 7000), Derivatives: []models.TaxonomyDerivative{
+					{Name: "1.0 Zetec", Slug: "10-zetec", TaxonomyStats: stats(1, 7000, 7000)},
+				}},
+			}},
+		}},
+		{Name: "Skoda", Slug: "skoda", TaxonomyStats: stats(3, 5000, 8000), Ranges: []models.TaxonomyRange{
+			{Name: "Fabia", Slug: "fabia", TaxonomyStats: stats(3, 5000, 8000), Models: []models.TaxonomyModel{
+				{Name: "Fabia", Slug: "fabia", TaxonomyStats: stats(2, 5000, 6500), Derivatives: []models.TaxonomyDerivative{
+					{Name: "1.2 SE 5dr", Slug: "12-se-5dr", TaxonomyStats: stats(2, 5000, 6500)},
+				}},
+				{Name: "Fabia Estate", Slug: "fabia-estate", TaxonomyStats: stats(1, 8000, 8000), Derivatives: []models.TaxonomyDerivative{
+					{Name: "1.4 S", Slug: "14-s", TaxonomyStats: stats(1, 8000, 8000)},
+				}},
+			}},
+		}},
+	}
+	if !reflect.DeepEqual(makes, want) {
+		t.Errorf("taxonomy = %+v\nwant %+v", makes, want)
+	}
+}
+
+func testSites(t *testing.T, store stores) {
+	// Vehicles from the feed already name their site before it exists
+	early := testVehicle(1, "Skoda", "Fabia", 5000)
+	early.Site = "Winsford"
+	mustCreate(t, store, early)
+
+	winsford := models.Site{Slug: "winsford", Name: "Winsford", Postcode: "CW7 3QP"}
+	if err := store.CreateSite(&winsford); err != nil {
+		t.Fatalf("CreateSite: %v", err)
+	}
+	expectError(t, store.CreateSite(&models.Site{Slug: "winsford", Name: "Winsford Again"}), apperr.ErrConflict)
+	trafford := models.Site{Slug: "trafford", Name: "Trafford"}
+	if err := store.CreateSite(&trafford); err != nil {
+		t.Fatalf("CreateSite: %v", err)
+	}
+
+	sites, err := store.ListSites()
+	if err != nil {
+		t.Fatalf("ListSites: %v", err)
+	}
+	if len(sites) != 2 || sites[0].Slug != "trafford" || sites[1].Slug != "winsford" {
+		t.Errorf("sites = %+v", sites)
+	}
+	_, err = store.GetSiteBySlug("stockport")
+	expectError(t, err, apperr.ErrNotFound)
+
+	got, err := store.GetVehicleByID(1)
+	if err != nil {
+		t.Fatalf("GetVehicleByID: %v", err)
+	}
+	if got.SiteID == nil || *got.SiteID != winsford.ID {
+		t.Errorf("vehicle site_id = %v, want %d", got.SiteID, winsford.ID)
+	}
+
+	// New vehicles are linked on create and keep the site through a full update
+	later := testVehicle(2, "Ford", "Fiesta", 7000)
+	later.SiteSlug = "trafford"
+	mustCreate(t, store, later)
+	if got, _ := store.GetVehicleByID(2); got.SiteID == nil || *got.SiteID != trafford.ID || got.Site != "Trafford" {
+		t.Errorf("created vehicle site %v %q", got.SiteID, got.Site)
+	}
+	update := testVehicle(2, "Ford", "Fiesta", 6500)
+	if err := store.UpdateVehicle(2, &update); err != nil {
+		t.Fatalf("UpdateVehicle: %v", err)
+	}
+	if update.SiteSlug != "trafford" {
+		t.Errorf("site_slug after update = %q, want it kept", update.SiteSlug)
+	}
+
+	// Renaming a site renames it on its vehicles
+	rename := models.Site{Name: "Winsford Motors"}
+	if err := store.UpdateSite("winsford", &rename); err != nil {
+		t.Fatalf("UpdateSite: %v", err)
+	}
+	if rename.Slug != "winsford" || rename.ID != winsford.ID {
+		t.Errorf("updated site = %+v", rename)
+	}
+	if got, _ := store.GetVehicleByID(1); got.Site != "Winsford Motors" {
+		t.Errorf("vehicle site after rename = %q", got.Site)
+	}
+	expectError(t, store.UpdateSite("stockport", &models.Site{Name: "Stockport"}), apperr.ErrNotFound)
+
+	// Transfers move the vehicle and leave an audit trail
+	moved, err := store.TransferVehicle(1, models.TransferRequest{SiteSlug: "trafford", Location: "Row D", Reason: "Customer viewing"}, "jo")
+	if err != nil {
+		t.Fatalf("TransferVehicle: %v", err)
+	}
+	if moved.SiteID == nil || *moved.SiteID != trafford.ID || moved.SiteSlug != "trafford" || moved.Site != "Trafford" || moved.LocationSlug != "row-d" {
+		t.Errorf("moved vehicle site %v %q %q, location %q", moved.SiteID, moved.SiteSlug, moved.Site, moved.LocationSlug)
+	}
+	history, err := store.GetTransferHistory(1)
+	if err != nil {
+		t.Fatalf("GetTransferHistory: %v", err)
+	}
+	if len(history) != 1 || history[0].FromSiteSlug != "winsford" || history[0].ToSiteSlug != "trafford" ||
+		history[0].TransferredBy != "jo" || history[0].Reason != "Customer viewing" {
+		t.Errorf("transfer history = %+v", history)
+	}
+	_, err = store.GetTransferHistory(99)
+	expectError(t, err, apperr.ErrNotFound)
+
+	_, err = store.TransferVehicle(1, models.TransferRequest{SiteSlug: "trafford"}, "jo")
+	expectError(t, err, apperr.ErrConflict)
+	_, err = store.TransferVehicle(1, models.TransferRequest{SiteSlug: "stockport"}, "jo")
+	expectError(t, err, apperr.ErrValidation)
+	_, err = store.TransferVehicle(99, models.TransferRequest{SiteSlug: "winsford"}, "jo")
+	expectError(t, err, apperr.ErrNotFound)
+
+	sold := testVehicle(3, "Ford", "Focus", 9000)
+	sold.StockStatus = models.StockStatusSold
+	mustCreate(t, store, sold)
+	_, err = store.TransferVehicle(3, models.TransferRequest{SiteSlug: "winsford"}, "jo")
+	expectError(t, err, apperr.ErrConflict)
+
+	vehicles, _, err := store.GetVehicles(models.VehicleFilters{SiteSlugs: []string{"trafford"}})
+	if err != nil {
+		t.Fatalf("GetVehicles: %v", err)
+	}
+	expectIDs(t, vehicles, 1, 2)
+}
+
+func testNear(t *testing.T, store stores) {
+	coordinates := func(lat, lng float64) (*float64, *float64) { return &lat, &lng }
+	winsford := models.Site{Slug: "winsford", Name: "Winsford"}
+	winsford.Latitude, winsford.Longitude = coordinates(53.1905, -2.5196)
+	trafford := models.Site{Slug: "trafford", Name: "Trafford"}
+	trafford.Latitude, trafford.Longitude = coordinates(53.4650, -2.3180)
+	for _, site := range []*models.Site{&winsford, &trafford, {Slug: "unplaced", Name: "Unplaced"}} {
+		if err := store.CreateSite(site); err != nil {
+			t.Fatalf("CreateSite(%s): %v", site.Slug, err)
+		}
+	}
+
+	atSite := func(id int, site string, pounds int64) models.Vehicle {
+		vehicle := testVehicle(id, "Skoda", "Fabia", pounds)
+		vehicle.SiteSlug = site
+		return vehicle
+	}
+	mustCreate(t, store,
+		atSite(1, "trafford", 5000),
+		atSite(2, "winsford", 6000),
+		atSite(3, "winsford", 4000),
+		atSite(4, "unplaced", 3000),
+		testVehicle(5, "Skoda", "Fabia", 2000),
+	)
+
+	// Near Trafford: the Trafford vehicle first, then Winsford about 20.7 miles away
+	near := geo.Point{Latitude: 53.4650, Longitude: -2.3180}
+	nearest := []models.SortField{{Field: "distance"}}
+	vehicles, meta, err := store.GetVehicles(models.VehicleFilters{Near: &near, Sort: nearest})
+	if err != nil {
+		t.Fatalf("GetVehicles: %v", err)
+	}
+	expectIDs(t, vehicles, 1, 2, 3)
+	if meta.Total != 3 {
+		t.Errorf("total = %d, want 3", meta.Total)
+	}
+	distances := make([]float64, 0, len(vehicles))
+	for _, vehicle := range vehicles {
+		if vehicle.DistanceMiles == nil {
+			t.Fatalf("vehicle %d has no distance", vehicle.VehicleID)
+		}
+		distances = append(distances, *vehicle.DistanceMiles)
+	}
+	if distances[0] != 0 || distances[1] != 20.71 || distances[2] != 20.71 {
+		t.Errorf("distances = %v, want [0 20.71 20.71]", distances)
+	}
+
+	vehicles, _, err = store.GetVehicles(models.VehicleFilters{Near: &near, RadiusMiles: 20, Sort: nearest})
+	if err != nil {
+		t.Fatalf("GetVehicles: %v", err)
+	}
+	expectIDs(t, vehicles, 1)
+
+	vehicles, _, err = store.GetVehicles(models.VehicleFilters{Near: &near, RadiusMiles: 25, Sort: []models.SortField{{Field: "distance", Descending: true}, {Field: "price"}}})
+	if err != nil {
+		t.Fatalf("GetVehicles: %v", err)
+	}
+	expectIDs(t, vehicles, 3, 2, 1)
+
+	// Cursors page through equal distances
+	filters := models.VehicleFilters{Near: &near, Sort: nearest, ResultsPerPage: 2}
+	first, meta, err := store.GetVehicles(filters)
+	if err != nil {
+		t.Fatalf("GetVehicles: %v", err)
+	}
+	expectIDs(t, first, 1, 2)
+	filters.Cursor, err = models.DecodeCursor(meta.NextCursor, nearest)
+	if err != nil {
+		t.Fatalf("DecodeCursor: %v", err)
+	}
+	second, _, err := store.GetVehicles(filters)
+	if err != nil {
+		t.Fatalf("GetVehicles: %v", err)
+	}
+	expectIDs(t, second, 3)
+
+	// Without near there is no distance
+	vehicles, _, err = store.GetVehicles(models.VehicleFilters{})
+	if err != nil {
+		t.Fatalf("GetVehicles: %v", err)
+	}
+	for _, vehicle := range vehicles {
+		if vehicle.DistanceMiles != nil {
+			t.Errorf("vehicle %d distance = %v without near", vehicle.VehicleID, *vehicle.DistanceMiles)
+		}
+	}
+}
+
+func testPartExchanges(t *testing.T, store stores) {
+	priced := testVehicle(1, "Skoda", "Citigo", 4799)
+	priced.PriceWhenNew = models.MoneyFromPounds(7437)
+	priced.StockStatus = models.StockStatusSold
+	mustCreate(t, store, priced, testVehicle(2, "Ford", "Fiesta", 7000))
+
+	samples, err := store.GetValuationSamples()
+	if err != nil {
+		t.Fatalf("GetValuationSamples: %v", err)
+	}
+	expectIDs(t, samples, 1)
+
+	value := models.MoneyFromPounds(2150)
+	first := models.PartExchange{VehicleID: 2, VRM: "BX63NSJ", Mileage: 48000, Condition: models.ConditionGood, Value: &value, Provider: "stock-estimator"}
+	second := models.PartExchange{VehicleID: 2, VRM: "AB12CDE", Mileage: 90000, Condition: models.ConditionPoor, Provider: "stock-estimator"}
+	for _, request := range []*models.PartExchange{&first, &second} {
+		if err := store.CreatePartExchange(request); err != nil {
+			t.Fatalf("CreatePartExchange: %v", err)
+		}
+	}
+	expectError(t, store.CreatePartExchange(&models.PartExchange{VehicleID: 99, VRM: "AB12CDE", Condition: models.ConditionGood}), apperr.ErrNotFound)
+
+	requests, err := store.GetPartExchanges(2)
+	if err != nil {
+		t.Fatalf("GetPartExchanges: %v", err)
+	}
+	if len(requests) != 2 || requests[0].ID != second.ID || requests[1].ID != first.ID {
+		t.Fatalf("part exchanges = %+v", requests)
+	}
+	if requests[0].Value != nil || requests[1].Value == nil || *requests[1].Value != value {
+		t.Errorf("values = %v, %v", requests[0].Value, requests[1].Value)
+	}
+
+	if requests, _ := store.GetPartExchanges(1); len(requests) != 0 {
+		t.Errorf("part exchanges of vehicle 1 = %+v", requests)
+	}
+	_, err = store.GetPartExchanges(99)
+	expectError(t, err, apperr.ErrNotFound)
+}
+
+// publishEvents marks every pending event published and returns them
+func publishEvents(t *testing.T, store OutboxStore) []models.VehicleEvent {
+	t.Helper()
+	events, err := store.PendingEvents(100)
+	if err != nil {
+		t.Fatalf("PendingEvents: %v", err)
+	}
+	for _, event := range events {
+		if err := store.MarkEventPublished(event.ID, time.Now()); err != nil {
+			t.Fatalf("MarkEventPublished: %v", err)
+		}
+	}
+	return events
+}
+
+func expectEvents(t *testing.T, store OutboxStore, want ...models.EventType) []models.VehicleEvent {
+	t.Helper()
+	events := publishEvents(t, store)
+	var types []models.EventType
+	for _, event := range events {
+		types = append(types, event.Type)
+	}
+	if !reflect.DeepEqual(types, want) {
+		t.Fatalf("events = %v, want %v", types, want)
+	}
+	return events
+}
+
+func testEvents(t *testing.T, store stores) {
+	vehicle := testVehicle(1, "Skoda", "Fabia", 5000)
+	if err := store.CreateVehicle(&vehicle); err != nil {
+		t.Fatalf("CreateVehicle: %v", err)
+	}
+	created := expectEvents(t, store, models.EventVehicleCreated)
+	if len(created[0].ID) != 28 || created[0].ID[:4] != "evt_" || created[0].OccurredAt.IsZero() || created[0].Vehicle.VehicleID != 1 {
+		t.Errorf("created = %+v", created[0])
+	}
+
+	vehicle.OdometerValue = 42000
+	if err := store.UpdateVehicle(1, &vehicle); err != nil {
+		t.Fatalf("UpdateVehicle: %v", err)
+	}
+	updated := expectEvents(t, store, models.EventVehicleUpdated)[0]
+	if updated.Previous == nil || updated.Previous.OdometerValue == 42000 || updated.Vehicle.OdometerValue != 42000 {
+		t.Errorf("updated = %+v, want the vehicle before and after", updated)
+	}
+
+	vehicle.Price = models.MoneyFromPounds(4800)
+	if err := store.UpdateVehicle(1, &vehicle); err != nil {
+		t.Fatalf("UpdateVehicle: %v", err)
+	}
+	priceChange := expectEvents(t, store, models.EventVehicleUpdated, models.EventVehiclePriceChanged)[1]
+	if priceChange.OldPrice.Pounds() != 5000 || priceChange.NewPrice.Pounds() != 4800 || priceChange.Vehicle.OdometerValue != 42000 {
+		t.Errorf("price change = %+v", priceChange)
+	}
+
+	// Reservations move the vehicle between in stock and reserved
+	at := time.Now()
+	reserve := func(reference string) {
+		t.Helper()
+		err := store.CreateReservation(&models.Reservation{
+			Reference:       reference,
+			VehicleID:       1,
+			Name:            "Sam Taylor",
+			Deposit:         models.MoneyFromPounds(99),
+			PaymentProvider: "fake",
+			PaymentHoldID:   "hold_" + reference,
+			ExpiresAt:       at.Add(time.Hour),
+		})
+		if err != nil {
+			t.Fatalf("CreateReservation: %v", err)
+		}
+	}
+	reserve("rs_cancel")
+	reserved := expectEvents(t, store, models.EventVehicleStatusChanged)[0]
+	if reserved.FromStatus != models.StockStatusInStock || reserved.ToStatus != models.StockStatusReserved {
+		t.Errorf("reserved = %s -> %s", reserved.FromStatus, reserved.ToStatus)
+	}
+	if _, err := store.CancelReservation("rs_cancel"); err != nil {
+		t.Fatalf("CancelReservation: %v", err)
+	}
+	expectEvents(t, store, models.EventVehicleStatusChanged)
+
+	reserve("rs_expire")
+	if _, err := store.ExpireReservations(at.Add(2 * time.Hour)); err != nil {
+		t.Fatalf("ExpireReservations: %v", err)
+	}
+	returned := expectEvents(t, store, models.EventVehicleStatusChanged, models.EventVehicleStatusChanged)[1]
+	if returned.FromStatus != models.StockStatusReserved || returned.ToStatus != models.StockStatusInStock {
+		t.Errorf("expired = %s -> %s", returned.FromStatus, returned.ToStatus)
+	}
+
+	reserve("rs_complete")
+	if _, err := store.MarkReservationCompleting("rs_complete"); err != nil {
+		t.Fatalf("MarkReservationCompleting: %v", err)
+	}
+	if _, err := store.CompleteReservation("rs_complete", "jane.smith"); err != nil {
+		t.Fatalf("CompleteReservation: %v", err)
+	}
+	sold := expectEvents(t, store, models.EventVehicleStatusChanged, models.EventVehicleSold)[1]
+	if sold.FromStatus != models.StockStatusReserved || sold.ToStatus != models.StockStatusSold {
+		t.Errorf("sold = %s -> %s", sold.FromStatus, sold.ToStatus)
+	}
+
+	if err := store.DeleteVehicle(1); err != nil {
+		t.Fatalf("DeleteVehicle: %v", err)
+	}
+	deleted := expectEvents(t, store, models.EventVehicleDeleted)[0]
+	if deleted.VehicleID != 1 || deleted.Vehicle != nil {
+		t.Errorf("deleted = %+v, want only the vehicle ID", deleted)
+	}
+
+	// Failed changes record nothing
+	expectError(t, store.DeleteVehicle(1), apperr.ErrNotFound)
+	expectError(t, store.UpdateVehicle(1, &vehicle), apperr.ErrNotFound)
+	expectEvents(t, store)
+
+	kept := testVehicle(2, "Skoda", "Octavia", 9000)
+	kept.Source = models.VehicleSourceFeed
+	dropped := testVehicle(3, "Ford", "Fiesta", 7000)
+	dropped.Source = models.VehicleSourceFeed
+	if _, err := store.ApplyFeedSync([]models.Vehicle{kept, dropped}, nil, nil); err != nil {
+		t.Fatalf("ApplyFeedSync: %v", err)
+	}
+	expectEvents(t, store, models.EventVehicleCreated, models.EventVehicleCreated)
+
+	kept.Price = models.MoneyFromPounds(8500)
+	if _, err := store.ApplyFeedSync(nil, []models.Vehicle{kept}, []int{3}); err != nil {
+		t.Fatalf("ApplyFeedSync: %v", err)
+	}
+	withdrawn := expectEvents(t, store, models.EventVehicleUpdated, models.EventVehiclePriceChanged, models.EventVehicleStatusChanged)[2]
+	if withdrawn.VehicleID != 3 || withdrawn.ToStatus != models.StockStatusWithdrawn {
+		t.Errorf("withdrawn = %+v", withdrawn)
+	}
+}
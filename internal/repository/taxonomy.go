@@ -0,0 +1,138 @@
+package repository
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/Candoo/vehicles-api/internal/models"
+)
+
+// taxonomyRow is the listed stock of one make, range, model and derivative combination
+type taxonomyRow struct {
+	Make       string
+	MakeSlug   string
+	Range      string
+	RangeSlug  string
+	Model      string
+	Derivative string
+	Count      int64
+	MinPrice   models.Money
+	MaxPrice   models.Money
+}
+
+// GetTaxonomy builds the make, range, model and derivative tree of listed vehicles
+func (r *VehicleRepository) GetTaxonomy() ([]models.TaxonomyMake, error) {
+	var rows []taxonomyRow
+
+	if err := r.db.Model(&models.Vehicle{}).
+		Select(`make, make_slug, "range", range_slug, model, derivative,
+			COUNT(*) AS count, MIN(price) AS min_price, MAX(price) AS max_price`).
+		Where("stock_status IN ?", models.ListedStockStatuses).
+		Group(`make, make_slug, "range", range_slug, model, derivative`).
+		Scan(&rows).Error; err != nil {
+		return nil, dbError(err, "failed to fetch taxonomy")
+	}
+
+	return buildTaxonomy(rows), nil
+}
+
+// buildTaxonomy folds rows into a tree sorted by name at every level. Entries are
+// keyed by slug, derived from the name where the vehicle has none, so spelling
+// differences in case collapse into one entry.
+func buildTaxonomy(rows []taxonomyRow) []models.TaxonomyMake {
+	makes := []models.TaxonomyMake{}
+
+	for _, row := range rows {
+		stats := models.TaxonomyStats{Count: row.Count, MinPrice: row.MinPrice, MaxPrice: row.MaxPrice}
+
+		rangeName := row.Range
+		if rangeName == "" {
+			rangeName = row.Model
+		}
+
+		make := findTaxonomyMake(&makes, row.Make, slugOrName(row.MakeSlug, row.Make))
+		make.Add(stats)
+
+		vehicleRange := findTaxonomyRange(&make.Ranges, rangeName, slugOrName(row.RangeSlug, rangeName))
+		vehicleRange.Add(stats)
+
+		model := findTaxonomyModel(&vehicleRange.Models, row.Model, models.Slugify(row.Model))
+		model.Add(stats)
+
+		derivative := findTaxonomyDerivative(&model.Derivatives, row.Derivative, models.Slugify(row.Derivative))
+		derivative.Add(stats)
+	}
+
+	sort.Slice(makes, func(i, j int) bool { return lessName(makes[i].Name, makes[j].Name) })
+	for i := range makes {
+		ranges := makes[i].Ranges
+		sort.Slice(ranges, func(i, j int) bool { return lessName(ranges[i].Name, ranges[j].Name) })
+		for j := range ranges {
+			modelList := ranges[j].Models
+			sort.Slice(modelList, func(i, j int) bool { return lessName(modelList[i].Name, modelList[j].Name) })
+			for k := range modelList {
+				derivatives := modelList[k].Derivatives
+				sort.Slice(derivatives, func(i, j int) bool { return lessName(derivatives[i].Name, derivatives[j].Name) })
+			}
+		}
+	}
+
+	return makes
+}
+
+// findTaxonomyMake returns the make with the given slug, adding it when missing
+func findTaxonomyMake(makes *[]models.TaxonomyMake, name, slug string) *models.TaxonomyMake {
+	for i := range *makes {
+		if (*makes)[i].Slug == slug {
+			return &(*makes)[i]
+		}
+	}
+	*makes = append(*makes, models.TaxonomyMake{Name: name, Slug: slug, Ranges: []models.TaxonomyRange{}})
+	return &(*makes)[len(*makes)-1]
+}
+
+// findTaxonomyRange returns the range with the given slug, adding it when missing
+func findTaxonomyRange(ranges *[]models.TaxonomyRange, name, slug string) *models.TaxonomyRange {
+	for i := range *ranges {
+		if (*ranges)[i].Slug == slug {
+			return &(*ranges)[i]
+		}
+	}
+	*ranges = append(*ranges, models.TaxonomyRange{Name: name, Slug: slug, Models: []models.TaxonomyModel{}})
+	return &(*ranges)[len(*ranges)-1]
+}
+
+// findTaxonomyModel returns the model with the given slug, adding it when missing
+func findTaxonomyModel(modelList *[]models.TaxonomyModel, name, slug string) *models.TaxonomyModel {
+	for i := range *modelList {
+		if (*modelList)[i].Slug == slug {
+			return &(*modelList)[i]
+		}
+	}
+	*modelList = append(*modelList, models.TaxonomyModel{Name: name, Slug: slug, Derivatives: []models.TaxonomyDerivative{}})
+	return &(*modelList)[len(*modelList)-1]
+}
+
+// findTaxonomyDerivative returns the derivative with the given slug, adding it when missing
+func findTaxonomyDerivative(derivatives *[]models.TaxonomyDerivative, name, slug string) *models.TaxonomyDerivative {
+	for i := range *derivatives {
+		if (*derivatives)[i].Slug == slug {
+			return &(*derivatives)[i]
+		}
+	}
+	*derivatives = append(*derivatives, models.TaxonomyDerivative{Name: name, Slug: slug})
+	return &(*derivatives)[len(*derivatives)-1]
+}
+
+// slugOrName returns slug, or a slug made from name when the vehicle has none
+func slugOrName(slug, name string) string {
+	if slug != "" {
+		return slug
+	}
+	return models.Slugify(name)
+}
+
+// lessName orders taxonomy entries by name, ignoring case
+func lessName(a, b string) bool {
+	return strings.ToLower(a) < strings.ToLower(b)
+}
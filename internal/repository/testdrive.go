@@ -0,0 +1,205 @@
+package repository
+
+import (
+	"errors"
+	"time"
+
+	"github.com/Candoo/vehicles-api/internal/apperr"
+	"github.com/Candoo/vehicles-api/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// TestDriveStore is the storage of test drive bookings. TestDriveRepository
+// implements it on Postgres and MemoryTestDriveStore in memory.
+type TestDriveStore interface {
+	CreateTestDrive(drive *models.TestDrive) error
+	GetTestDrive(reference string) (*models.TestDrive, error)
+	GetTestDrives(vehicleID int, from, to time.Time) ([]models.TestDrive, error)
+	RescheduleTestDrive(reference string, startsAt, endsAt time.Time) (*models.TestDrive, error)
+	CancelTestDrive(reference, reason string) (*models.TestDrive, error)
+}
+
+var (
+	_ TestDriveStore = (*TestDriveRepository)(nil)
+	_ TestDriveStore = (*MemoryTestDriveStore)(nil)
+)
+
+// TestDriveRepository handles database operations for test drives
+type TestDriveRepository struct {
+	db *gorm.DB
+}
+
+// NewTestDriveRepository creates a new test drive repository
+func NewTestDriveRepository(db *gorm.DB) *TestDriveRepository {
+	return &TestDriveRepository{db: db}
+}
+
+// errTestDriveClash is returned when a booking overlaps another of the same vehicle
+var errTestDriveClash = apperr.Conflict("vehicle is already booked for a test drive at that time")
+
+// CreateTestDrive books a test drive at the vehicle's site, rejecting a time that
+// overlaps another booking of the vehicle. The vehicle row is locked so two
+// customers cannot book the same slot at once.
+func (r *TestDriveRepository) CreateTestDrive(drive *models.TestDrive) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		vehicle, err := lockVehicle(tx, drive.VehicleID)
+		if err != nil {
+			return err
+		}
+
+		if err := checkTestDriveClash(tx, drive.VehicleID, drive.StartsAt, drive.EndsAt, 0); err != nil {
+			return err
+		}
+
+		drive.SiteID, drive.SiteSlug = vehicle.SiteID, vehicle.SiteSlug
+		drive.Status = models.TestDriveStatusBooked
+		if err := tx.Create(drive).Error; err != nil {
+			return dbError(err, "failed to book test drive")
+		}
+		return nil
+	})
+}
+
+// GetTestDrive retrieves a test drive by its booking reference
+func (r *TestDriveRepository) GetTestDrive(reference string) (*models.TestDrive, error) {
+	var drive models.TestDrive
+	if err := r.db.Where("reference = ?", reference).First(&drive).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, apperr.NotFound("test drive not found")
+		}
+		return nil, dbError(err, "failed to fetch test drive")
+	}
+	return &drive, nil
+}
+
+// GetTestDrives retrieves the booked test drives of a vehicle overlapping the time
+// from from to to, earliest first
+func (r *TestDriveRepository) GetTestDrives(vehicleID int, from, to time.Time) ([]models.TestDrive, error) {
+	if _, err := findVehicle(r.db, vehicleID); err != nil {
+		return nil, err
+	}
+
+	drives := []models.TestDrive{}
+	if err := r.db.Where("vehicle_id = ? AND status = ? AND starts_at < ? AND ends_at > ?",
+		vehicleID, models.TestDriveStatusBooked, to, from).
+		Order("starts_at ASC, id ASC").
+		Find(&drives).Error; err != nil {
+		return nil, dbError(err, "failed to fetch test drives")
+	}
+	return drives, nil
+}
+
+// RescheduleTestDrive moves a booked test drive to another time, rejecting a time
+// that overlaps another booking of the vehicle
+func (r *TestDriveRepository) RescheduleTestDrive(reference string, startsAt, endsAt time.Time) (*models.TestDrive, error) {
+	var drive models.TestDrive
+
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := lockTestDrive(tx, reference, &drive); err != nil {
+			return err
+		}
+		if _, err := lockVehicle(tx, drive.VehicleID); err != nil {
+			return err
+		}
+		if err := checkReschedule(&drive); err != nil {
+			return err
+		}
+		if err := checkTestDriveClash(tx, drive.VehicleID, startsAt, endsAt, drive.ID); err != nil {
+			return err
+		}
+
+		drive.StartsAt, drive.EndsAt = startsAt, endsAt
+		drive.Sequence++
+		if err := tx.Model(&drive).Updates(map[string]interface{}{
+			"starts_at": drive.StartsAt,
+			"ends_at":   drive.EndsAt,
+			"sequence":  drive.Sequence,
+		}).Error; err != nil {
+			return dbError(err, "failed to reschedule test drive")
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &drive, nil
+}
+
+// CancelTestDrive cancels a booked test drive, freeing its slot
+func (r *TestDriveRepository) CancelTestDrive(reference, reason string) (*models.TestDrive, error) {
+	var drive models.TestDrive
+
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := lockTestDrive(tx, reference, &drive); err != nil {
+			return err
+		}
+		if err := cancelTestDrive(&drive, reason, time.Now()); err != nil {
+			return err
+		}
+
+		if err := tx.Model(&drive).Updates(map[string]interface{}{
+			"status":              drive.Status,
+			"sequence":            drive.Sequence,
+			"cancelled_at":        drive.CancelledAt,
+			"cancellation_reason": drive.CancellationReason,
+		}).Error; err != nil {
+			return dbError(err, "failed to cancel test drive")
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &drive, nil
+}
+
+// lockTestDrive fetches a test drive by reference and locks its row
+func lockTestDrive(tx *gorm.DB, reference string, drive *models.TestDrive) error {
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("reference = ?", reference).First(drive).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return apperr.NotFound("test drive not found")
+		}
+		return dbError(err, "failed to fetch test drive")
+	}
+	return nil
+}
+
+// checkTestDriveClash rejects a time overlapping a booked test drive of the vehicle
+// other than the one with ID excludeID
+func checkTestDriveClash(tx *gorm.DB, vehicleID int, startsAt, endsAt time.Time, excludeID uint) error {
+	var count int64
+	if err := tx.Model(&models.TestDrive{}).
+		Where("vehicle_id = ? AND status = ? AND starts_at < ? AND ends_at > ? AND id <> ?",
+			vehicleID, models.TestDriveStatusBooked, endsAt, startsAt, excludeID).
+		Count(&count).Error; err != nil {
+		return dbError(err, "failed to check test drive bookings")
+	}
+	if count > 0 {
+		return errTestDriveClash
+	}
+	return nil
+}
+
+// checkReschedule rejects moving a cancelled test drive
+func checkReschedule(drive *models.TestDrive) error {
+	if drive.Status != models.TestDriveStatusBooked {
+		return apperr.Conflict("cancelled test drives cannot be rescheduled")
+	}
+	return nil
+}
+
+// cancelTestDrive marks a booked test drive cancelled
+func cancelTestDrive(drive *models.TestDrive, reason string, at time.Time) error {
+	if drive.Status != models.TestDriveStatusBooked {
+		return apperr.Conflict("test drive is already cancelled")
+	}
+
+	drive.Status = models.TestDriveStatusCancelled
+	drive.Sequence++
+	drive.CancelledAt = &at
+	drive.CancellationReason = reason
+	return nil
+}
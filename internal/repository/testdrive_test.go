@@ -0,0 +1,94 @@
+package repository
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Candoo/vehicles-api/internal/apperr"
+	"github.com/Candoo/vehicles-api/internal/models"
+)
+
+func testTestDrives(t *testing.T, store stores) {
+	if err := store.CreateSite(&models.Site{Slug: "winsford", Name: "Winsford"}); err != nil {
+		t.Fatalf("CreateSite: %v", err)
+	}
+	atSite := testVehicle(1, "Skoda", "Fabia", 5000)
+	atSite.SiteSlug = "winsford"
+	mustCreate(t, store, atSite, testVehicle(2, "Ford", "Fiesta", 7000))
+
+	ten := time.Date(2030, time.March, 4, 10, 0, 0, 0, time.UTC)
+	book := func(reference string, vehicleID int, start time.Time) error {
+		t.Helper()
+		return store.CreateTestDrive(&models.TestDrive{
+			Reference: reference,
+			VehicleID: vehicleID,
+			StartsAt:  start,
+			EndsAt:    start.Add(time.Hour),
+			Name:      "Sam Taylor",
+			Email:     "sam@example.com",
+		})
+	}
+
+	if err := book("td_first", 1, ten); err != nil {
+		t.Fatalf("CreateTestDrive: %v", err)
+	}
+	first, err := store.GetTestDrive("td_first")
+	if err != nil {
+		t.Fatalf("GetTestDrive: %v", err)
+	}
+	if first.Status != models.TestDriveStatusBooked || first.SiteSlug != "winsford" || first.SiteID == nil || !first.StartsAt.Equal(ten) {
+		t.Fatalf("test drive = %+v", first)
+	}
+
+	// Overlapping the booking clashes; back to back or another vehicle does not
+	expectError(t, book("td_clash", 1, ten.Add(30*time.Minute)), apperr.ErrConflict)
+	if err := book("td_next", 1, ten.Add(time.Hour)); err != nil {
+		t.Fatalf("back to back: %v", err)
+	}
+	if err := book("td_other", 2, ten); err != nil {
+		t.Fatalf("other vehicle: %v", err)
+	}
+	expectError(t, book("td_missing", 99, ten), apperr.ErrNotFound)
+
+	drives, err := store.GetTestDrives(1, ten.Add(-time.Hour), ten.Add(24*time.Hour))
+	if err != nil {
+		t.Fatalf("GetTestDrives: %v", err)
+	}
+	if len(drives) != 2 || drives[0].Reference != "td_first" || drives[1].Reference != "td_next" {
+		t.Fatalf("test drives = %+v", drives)
+	}
+
+	// Rescheduling skips the booking itself when checking for clashes
+	_, err = store.RescheduleTestDrive("td_first", ten.Add(time.Hour), ten.Add(2*time.Hour))
+	expectError(t, err, apperr.ErrConflict)
+	moved, err := store.RescheduleTestDrive("td_first", ten.Add(-30*time.Minute), ten.Add(30*time.Minute))
+	if err != nil {
+		t.Fatalf("RescheduleTestDrive: %v", err)
+	}
+	if !moved.StartsAt.Equal(ten.Add(-30*time.Minute)) || moved.Sequence != 1 {
+		t.Errorf("rescheduled = %+v", moved)
+	}
+	_, err = store.RescheduleTestDrive("td_unknown", ten, ten.Add(time.Hour))
+	expectError(t, err, apperr.ErrNotFound)
+
+	// Cancelling frees the slot for another booking
+	cancelled, err := store.CancelTestDrive("td_next", "Bought elsewhere")
+	if err != nil {
+		t.Fatalf("CancelTestDrive: %v", err)
+	}
+	if cancelled.Status != models.TestDriveStatusCancelled || cancelled.CancelledAt == nil || cancelled.CancellationReason != "Bought elsewhere" || cancelled.Sequence != 1 {
+		t.Errorf("cancelled = %+v", cancelled)
+	}
+	_, err = store.CancelTestDrive("td_next", "")
+	expectError(t, err, apperr.ErrConflict)
+	_, err = store.RescheduleTestDrive("td_next", ten.Add(5*time.Hour), ten.Add(6*time.Hour))
+	expectError(t, err, apperr.ErrConflict)
+	if err := book("td_rebooked", 1, ten.Add(time.Hour)); err != nil {
+		t.Fatalf("rebook cancelled slot: %v", err)
+	}
+
+	_, err = store.GetTestDrive("td_unknown")
+	expectError(t, err, apperr.ErrNotFound)
+	_, err = store.GetTestDrives(99, ten, ten.Add(time.Hour))
+	expectError(t, err, apperr.ErrNotFound)
+}
@@ -1,11 +1,15 @@
 package repository
 
 import (
+	"errors"
 	"fmt"
 	"strings"
 
+	"github.com/Candoo/vehicles-api/internal/apperr"
+	"github.com/Candoo/vehicles-api/internal/geo"
 	"github.com/Candoo/vehicles-api/internal/models"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 // VehicleRepository handles database operations for vehicles
@@ -24,124 +28,353 @@ func (r *VehicleRepository) GetVehicles(filters models.VehicleFilters) ([]models
 	var total int64
 
 	// Build query with filters
-	query := r.db.Model(&models.Vehicle{})
+	query := applyFilters(r.db.Model(&models.Vehicle{}), filters, "")
 
-	// Apply filters
-	if filters.AdvertClassification != "" && strings.ToLower(filters.AdvertClassification) != "all" {
+	// Count total results
+	if err := query.Count(&total).Error; err != nil {
+		return nil, nil, dbError(err, "failed to count vehicles")
+	}
+
+	pageDefaults(&filters.Page, &filters.ResultsPerPage, 10)
+
+	// Apply ordering, always finishing on vehicle_id so pages are stable.
+	// Paging backwards from a cursor walks the ordering in reverse.
+	backward := filters.Cursor != nil && filters.Cursor.Backward
+	var orderTerms []string
+	var orderArgs []interface{}
+	for _, field := range filters.Sort {
+		expression, args := sortExpression(field.Field, filters)
+		orderTerms = append(orderTerms, expression+sortDirection(field.Descending != backward))
+		orderArgs = append(orderArgs, args...)
+	}
+	orderTerms = append(orderTerms, "vehicle_id"+sortDirection(backward))
+	query = query.Order(clause.OrderBy{Expression: clause.Expr{
+		SQL:                strings.Join(orderTerms, ", "),
+		Vars:               orderArgs,
+		WithoutParentheses: true,
+	}})
+
+	// Computed columns are added alongside the stored ones
+	columns := []string{"vehicles.*"}
+	var columnArgs []interface{}
+	if filters.Query != "" {
+		columns = append(columns, searchRank+" AS relevance")
+		columnArgs = append(columnArgs, filters.Query)
+	}
+	if filters.Near != nil {
+		columns = append(columns, distanceMiles+" AS distance_miles")
+		columnArgs = append(columnArgs, distanceArgs(filters.Near)...)
+	}
+	if len(columns) > 1 {
+		query = query.Select(strings.Join(columns, ", "), columnArgs...)
+	}
+
+	if filters.Cursor != nil {
+		condition, args, err := keysetCondition(filters.Cursor, filters)
+		if err != nil {
+			return nil, nil, err
+		}
+		query = query.Where(condition, args...)
+	} else {
+		query = query.Offset((filters.Page - 1) * filters.ResultsPerPage)
+	}
+
+	// Fetch one extra row to find out whether another page follows
+	if err := query.
+		Limit(filters.ResultsPerPage + 1).
+		Find(&vehicles).Error; err != nil {
+		return nil, nil, dbError(err, "failed to fetch vehicles")
+	}
+
+	return buildPage(vehicles, filters, total)
+}
+
+// buildPage turns the rows fetched for a page, plus the one extra row used to detect a
+// following page, into the page itself and its metadata. Rows fetched backwards from a
+// cursor are put back into display order.
+func buildPage(vehicles []models.Vehicle, filters models.VehicleFilters, total int64) ([]models.Vehicle, *models.ResponseMetadata, error) {
+	backward := filters.Cursor != nil && filters.Cursor.Backward
+
+	hasMore := len(vehicles) > filters.ResultsPerPage
+	if hasMore {
+		vehicles = vehicles[:filters.ResultsPerPage]
+	}
+	if backward {
+		for i, j := 0, len(vehicles)-1; i < j; i, j = i+1, j-1 {
+			vehicles[i], vehicles[j] = vehicles[j], vehicles[i]
+		}
+	}
+
+	hasNext := hasMore
+	hasPrev := filters.Page > 1
+	if filters.Cursor != nil {
+		hasNext = backward || hasMore
+		hasPrev = !backward || hasMore
+	}
+
+	nextCursor, prevCursor, err := pageCursors(vehicles, filters.Sort, hasNext, hasPrev)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	metadata := pageMetadata(filters.Page, filters.ResultsPerPage, total)
+	metadata.NextCursor, metadata.PrevCursor = nextCursor, prevCursor
+	if filters.Cursor != nil {
+		metadata.CurrentPage = 0
+	}
+
+	return vehicles, metadata, nil
+}
+
+// applyFilters adds the WHERE clauses for a set of vehicle filters. The filter named by
+// exclude is skipped, which lets a facet count values while ignoring its own selection.
+func applyFilters(query *gorm.DB, filters models.VehicleFilters, exclude string) *gorm.DB {
+	if len(filters.StockStatuses) > 0 {
+		query = query.Where("stock_status IN ?", filters.StockStatuses)
+	}
+
+	if filters.Query != "" {
+		query = query.Where("search_vector @@ websearch_to_tsquery('english', ?)", filters.Query)
+	}
+
+	if exclude != "advert_classification" && filters.AdvertClassification != "" && strings.ToLower(filters.AdvertClassification) != "all" {
 		query = query.Where("LOWER(advert_classification) = ?", strings.ToLower(filters.AdvertClassification))
 	}
 
-	if filters.Make != "" {
-		query = query.Where("LOWER(make) = ?", strings.ToLower(filters.Make))
+	if exclude != "make" {
+		query = whereFoldIn(query, "make", filters.Makes)
+		query = whereFoldIn(query, "make_slug", filters.MakeSlugs)
 	}
 
+	query = whereFoldIn(query, "range_slug", filters.RangeSlugs)
+
 	if filters.Model != "" {
 		query = query.Where("LOWER(model) LIKE ?", "%"+strings.ToLower(filters.Model)+"%")
 	}
 
-	if filters.FuelType != "" {
-		query = query.Where("LOWER(fuel_type) = ?", strings.ToLower(filters.FuelType))
+	if exclude != "fuel_type" {
+		query = whereFoldIn(query, "fuel_type", filters.FuelTypes)
+	}
+
+	if exclude != "transmission" {
+		query = whereFoldIn(query, "transmission", filters.Transmissions)
+	}
+
+	if exclude != "body_type" {
+		query = whereFoldIn(query, "body_type", filters.BodyTypes)
+	}
+
+	query = whereFoldIn(query, "colour", filters.Colours)
+	query = whereFoldIn(query, "drivetrain", filters.Drivetrains)
+	query = whereFoldIn(query, "insurance_group", filters.InsuranceGroups)
+	query = whereFoldIn(query, "site_slug", filters.SiteSlugs)
+	query = whereFoldIn(query, "location", filters.Locations)
+
+	// Doors and seats are stored as text, so compare their numeric values
+	if len(filters.Doors) > 0 {
+		query = query.Where("CASE WHEN doors ~ '^[0-9]+$' THEN CAST(doors AS INTEGER) END IN ?", filters.Doors)
+	}
+
+	if len(filters.Seats) > 0 {
+		query = query.Where("CASE WHEN seats ~ '^[0-9]+$' THEN CAST(seats AS INTEGER) END IN ?", filters.Seats)
+	}
+
+	if filters.MinMileage != nil {
+		query = query.Where("odometer_value >= ?", *filters.MinMileage)
+	}
+
+	if filters.MaxMileage != nil {
+		query = query.Where("odometer_value <= ?", *filters.MaxMileage)
 	}
 
-	if filters.Transmission != "" {
-		query = query.Where("LOWER(transmission) = ?", strings.ToLower(filters.Transmission))
+	if filters.MaxPreviousKeepers != nil {
+		query = query.Where("previous_keepers <= ?", *filters.MaxPreviousKeepers)
 	}
 
-	if filters.BodyType != "" {
-		query = query.Where("LOWER(body_type) = ?", strings.ToLower(filters.BodyType))
+	if exclude != "has_offer" && filters.HasOffer != nil {
+		query = query.Where("has_offer = ?", *filters.HasOffer)
 	}
 
-	if filters.MinPrice != "" && filters.MinPrice != "0" {
-		query = query.Where("CAST(price AS INTEGER) >= ?", filters.MinPrice)
+	if exclude != "price" && filters.MinPrice > 0 {
+		query = query.Where("price >= ?", filters.MinPrice)
 	}
 
-	if filters.MaxPrice != "" && filters.MaxPrice != "0" {
-		query = query.Where("CAST(price AS INTEGER) <= ?", filters.MaxPrice)
+	if exclude != "price" && filters.MaxPrice > 0 {
+		query = query.Where("price <= ?", filters.MaxPrice)
 	}
 
-	if filters.MinYear != "" && filters.MinYear != "0" {
+	if filters.MinYear > 0 {
 		query = query.Where("CAST(year AS INTEGER) >= ?", filters.MinYear)
 	}
 
-	if filters.MaxYear != "" && filters.MaxYear != "0" {
+	if filters.MaxYear > 0 {
 		query = query.Where("CAST(year AS INTEGER) <= ?", filters.MaxYear)
 	}
 
-	// Count total results
-	if err := query.Count(&total).Error; err != nil {
-		return nil, nil, fmt.Errorf("failed to count vehicles: %w", err)
+	// Vehicles at a site without coordinates have no distance and are left out
+	if filters.Near != nil && filters.RadiusMiles > 0 {
+		query = query.Where(distanceMiles+" <= ?", append(distanceArgs(filters.Near), filters.RadiusMiles)...)
+	} else if filters.Near != nil {
+		query = query.Where(distanceMiles+" IS NOT NULL", distanceArgs(filters.Near)...)
 	}
 
-	// Set defaults for pagination
-	if filters.Page < 1 {
-		filters.Page = 1
+	return query
+}
+
+// whereFoldIn matches a text column against any of values, ignoring case. An empty
+// list leaves the query unchanged.
+func whereFoldIn(query *gorm.DB, column string, values []string) *gorm.DB {
+	if len(values) == 0 {
+		return query
 	}
-	if filters.ResultsPerPage < 1 {
-		filters.ResultsPerPage = 10
+
+	lowered := make([]string, len(values))
+	for i, value := range values {
+		lowered[i] = strings.ToLower(value)
 	}
+	return query.Where("LOWER("+column+") IN ?", lowered)
+}
 
-	// Calculate offset
-	offset := (filters.Page - 1) * filters.ResultsPerPage
+// searchRank scores a vehicle against the free-text query bound to its placeholder
+const searchRank = "ts_rank(search_vector, websearch_to_tsquery('english', ?))"
 
-	// Fetch paginated results
-	if err := query.
-		Order("vehicle_id ASC").
-		Limit(filters.ResultsPerPage).
-		Offset(offset).
-		Find(&vehicles).Error; err != nil {
-		return nil, nil, fmt.Errorf("failed to fetch vehicles: %w", err)
+// distanceMiles is the haversine distance in miles, rounded to hundredths, from the
+// point bound to its placeholders to the vehicle's site. It is NULL for vehicles at a
+// site without coordinates. Plain SQL maths keeps PostGIS optional.
+var distanceMiles = fmt.Sprintf("(SELECT CAST(ROUND(CAST(2 * %g * ASIN(LEAST(1, SQRT("+
+	"POWER(SIN(RADIANS(sites.latitude - ?) / 2), 2) + "+
+	"COS(RADIANS(?)) * COS(RADIANS(sites.latitude)) * POWER(SIN(RADIANS(sites.longitude - ?) / 2), 2)"+
+	"))) AS numeric), 2) AS double precision) FROM sites WHERE sites.id = vehicles.site_id)", geo.EarthRadiusMiles)
+
+// distanceArgs binds a point to the placeholders of distanceMiles
+func distanceArgs(point *geo.Point) []interface{} {
+	return []interface{}{point.Latitude, point.Latitude, point.Longitude}
+}
+
+// sortExpression returns the SQL expression and arguments ordering by a sortable field
+func sortExpression(field string, filters models.VehicleFilters) (string, []interface{}) {
+	switch field {
+	case "relevance":
+		return searchRank, []interface{}{filters.Query}
+	case "distance":
+		return distanceMiles, distanceArgs(filters.Near)
 	}
+	return field, nil
+}
 
-	// Calculate metadata
-	lastPage := int(total) / filters.ResultsPerPage
-	if int(total)%filters.ResultsPerPage > 0 {
-		lastPage++
+// sortDirection renders an ORDER BY direction keyword
+func sortDirection(descending bool) string {
+	if descending {
+		return " DESC"
 	}
+	return " ASC"
+}
 
-	// Get additional statistics
-	var allTotal, totalNew, totalUsed, offerVehicles int64
-	r.db.Model(&models.Vehicle{}).Count(&allTotal)
-	r.db.Model(&models.Vehicle{}).Where("LOWER(advert_classification) = ?", "new").Count(&totalNew)
-	r.db.Model(&models.Vehicle{}).Where("LOWER(advert_classification) = ?", "used").Count(&totalUsed)
-	r.db.Model(&models.Vehicle{}).Where("has_offer = ?", true).Count(&offerVehicles)
+// keysetCondition builds the WHERE clause selecting rows strictly after the cursor
+// in the active ordering, e.g. for price ASC: price > ? OR (price = ? AND vehicle_id > ?)
+func keysetCondition(cursor *models.Cursor, filters models.VehicleFilters) (string, []interface{}, error) {
+	var disjuncts []string
+	var args []interface{}
+
+	sort := filters.Sort
+	columns := make([]string, 0, len(sort)+1)
+	columnArgs := make([][]interface{}, 0, len(sort)+1)
+	values := make([]interface{}, 0, len(sort)+1)
+	descending := make([]bool, 0, len(sort)+1)
+
+	for i, field := range sort {
+		value, err := cursor.Value(i, field.Field)
+		if err != nil {
+			return "", nil, apperr.Validation("invalid cursor: %v", err)
+		}
+		expression, expressionArgs := sortExpression(field.Field, filters)
+		columns = append(columns, expression)
+		columnArgs = append(columnArgs, expressionArgs)
+		values = append(values, value)
+		descending = append(descending, field.Descending)
+	}
+	columns = append(columns, "vehicle_id")
+	columnArgs = append(columnArgs, nil)
+	values = append(values, cursor.VehicleID)
+	descending = append(descending, false)
+
+	for i := range columns {
+		var conjuncts []string
+		for j := 0; j < i; j++ {
+			conjuncts = append(conjuncts, columns[j]+" = ?")
+			args = append(args, columnArgs[j]...)
+			args = append(args, values[j])
+		}
+
+		operator := ">"
+		if descending[i] != cursor.Backward {
+			operator = "<"
+		}
+		conjuncts = append(conjuncts, columns[i]+" "+operator+" ?")
+		args = append(args, columnArgs[i]...)
+		args = append(args, values[i])
 
-	metadata := &models.ResponseMetadata{
-		CurrentPage:       filters.Page,
-		LastPage:          lastPage,
-		PerPage:           filters.ResultsPerPage,
-		Total:             total,
-		AllTotal:          allTotal,
-		TotalNewVehicles:  totalNew,
-		TotalUsedVehicles: totalUsed,
-		OfferVehicles:     offerVehicles,
+		disjuncts = append(disjuncts, "("+strings.Join(conjuncts, " AND ")+")")
 	}
 
-	return vehicles, metadata, nil
+	return strings.Join(disjuncts, " OR "), args, nil
+}
+
+// pageCursors encodes the cursors pointing past the last and before the first vehicle of a page
+func pageCursors(vehicles []models.Vehicle, sort []models.SortField, hasNext, hasPrev bool) (string, string, error) {
+	if len(vehicles) == 0 {
+		return "", "", nil
+	}
+
+	var next, prev string
+
+	if hasNext {
+		cursor, err := models.NewCursor(&vehicles[len(vehicles)-1], sort, false)
+		if err != nil {
+			return "", "", fmt.Errorf("failed to build cursor: %w", err)
+		}
+		next = cursor.Encode()
+	}
+
+	if hasPrev {
+		cursor, err := models.NewCursor(&vehicles[0], sort, true)
+		if err != nil {
+			return "", "", fmt.Errorf("failed to build cursor: %w", err)
+		}
+		prev = cursor.Encode()
+	}
+
+	return next, prev, nil
 }
 
 // GetVehicleByID retrieves a single vehicle by ID
 func (r *VehicleRepository) GetVehicleByID(id int) (*models.Vehicle, error) {
+	return findVehicle(r.db, id)
+}
+
+// GetVehicleByVRM retrieves a single vehicle by VRM (Vehicle Registration Mark)
+func (r *VehicleRepository) GetVehicleByVRM(vrm string) (*models.Vehicle, error) {
 	var vehicle models.Vehicle
 
-	if err := r.db.First(&vehicle, id).Error; err != nil {
+	if err := r.db.Where("LOWER(vrm) = ?", strings.ToLower(vrm)).First(&vehicle).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
-			return nil, fmt.Errorf("vehicle not found")
+			return nil, apperr.NotFound("vehicle not found")
 		}
-		return nil, fmt.Errorf("failed to fetch vehicle: %w", err)
+		return nil, dbError(err, "failed to fetch vehicle")
 	}
 
 	return &vehicle, nil
 }
 
-// GetVehicleByVRM retrieves a single vehicle by VRM (Vehicle Registration Mark)
-func (r *VehicleRepository) GetVehicleByVRM(vrm string) (*models.Vehicle, error) {
+// GetVehicleBySlug retrieves a single vehicle by its listing slug
+func (r *VehicleRepository) GetVehicleBySlug(slug string) (*models.Vehicle, error) {
 	var vehicle models.Vehicle
 
-	if err := r.db.Where("LOWER(vrm) = ?", strings.ToLower(vrm)).First(&vehicle).Error; err != nil {
+	if err := r.db.Where("slug = ?", strings.ToLower(slug)).First(&vehicle).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
-			return nil, fmt.Errorf("vehicle not found")
+			return nil, apperr.NotFound("vehicle not found")
 		}
-		return nil, fmt.Errorf("failed to fetch vehicle: %w", err)
+		return nil, dbError(err, "failed to fetch vehicle")
 	}
 
 	return &vehicle, nil
@@ -155,7 +388,7 @@ func (r *VehicleRepository) GetAvailableMakes() ([]string, error) {
 		Distinct("make").
 		Order("make ASC").
 		Pluck("make", &makes).Error; err != nil {
-		return nil, fmt.Errorf("failed to fetch makes: %w", err)
+		return nil, dbError(err, "failed to fetch makes")
 	}
 
 	return makes, nil
@@ -172,8 +405,151 @@ func (r *VehicleRepository) GetAvailableModels(make string) ([]string, error) {
 	}
 
 	if err := query.Pluck("model", &modelList).Error; err != nil {
-		return nil, fmt.Errorf("failed to fetch models: %w", err)
+		return nil, dbError(err, "failed to fetch models")
 	}
 
 	return modelList, nil
 }
+
+// CreateVehicle inserts a new vehicle, rejecting clashes on vehicle ID, VRM, stock ID
+// or a chosen slug. Missing slugs are generated.
+func (r *VehicleRepository) CreateVehicle(vehicle *models.Vehicle) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := checkVehicleConflict(tx, vehicle, nil); err != nil {
+			return err
+		}
+
+		if err := assignSlug(vehicle, true, slugTaken(tx, vehicle.VehicleID)); err != nil {
+			return err
+		}
+
+		if err := linkSite(tx, vehicle); err != nil {
+			return err
+		}
+
+		// Omit("") forces GORM to include the caller supplied primary key
+		if err := tx.Omit("").Create(vehicle).Error; err != nil {
+			if errors.Is(err, gorm.ErrDuplicatedKey) {
+				return errVehicleExists
+			}
+			return dbError(err, "failed to create vehicle")
+		}
+
+		return recordEvents(tx, vehicleEvent(models.EventVehicleCreated, *vehicle))
+	})
+}
+
+// UpdateVehicle replaces every field of an existing vehicle. The slug is kept
+// unless a new one is given; the site only changes through TransferVehicle.
+func (r *VehicleRepository) UpdateVehicle(id int, vehicle *models.Vehicle) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		var existing models.Vehicle
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&existing, id).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return apperr.NotFound("vehicle not found")
+			}
+			return dbError(err, "failed to fetch vehicle")
+		}
+
+		vehicle.VehicleID = id
+		if err := checkVehicleConflict(tx, vehicle, &id); err != nil {
+			return err
+		}
+
+		if vehicle.Slug == "" {
+			vehicle.Slug = existing.Slug
+		}
+		if err := assignSlug(vehicle, true, slugTaken(tx, id)); err != nil {
+			return err
+		}
+
+		// Select("*") makes GORM write zero values so the update is a full replacement
+		if err := tx.Model(&models.Vehicle{}).
+			Where("vehicle_id = ?", id).
+			Select("*").
+			Omit("vehicle_id", "created_at", "source", "stock_status", "site_id", "site", "site_slug").
+			Updates(vehicle).Error; err != nil {
+			if errors.Is(err, gorm.ErrDuplicatedKey) {
+				return errVehicleExists
+			}
+			return dbError(err, "failed to update vehicle")
+		}
+
+		if err := recordPriceChange(tx, id, existing.Price, vehicle.Price, models.PriceSourceAPI); err != nil {
+			return err
+		}
+
+		if err := tx.First(vehicle, id).Error; err != nil {
+			return dbError(err, "failed to fetch vehicle")
+		}
+		return recordEvents(tx, updateEvents(existing, *vehicle)...)
+	})
+}
+
+// DeleteVehicle removes a vehicle by ID
+func (r *VehicleRepository) DeleteVehicle(id int) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Delete(&models.Vehicle{}, id)
+		if result.Error != nil {
+			return dbError(result.Error, "failed to delete vehicle")
+		}
+
+		if result.RowsAffected == 0 {
+			return apperr.NotFound("vehicle not found")
+		}
+
+		return recordEvents(tx, deletedEvent(id))
+	})
+}
+
+// checkVehicleConflict reports whether another vehicle already uses the same ID, VRM or
+// stock ID. The unique indexes catch two writes racing past it; checking first keeps
+// clashes from reaching the database as failed inserts.
+func checkVehicleConflict(tx *gorm.DB, vehicle *models.Vehicle, excludeID *int) error {
+	query := tx.Model(&models.Vehicle{})
+
+	if excludeID != nil {
+		query = query.Where("vehicle_id <> ?", *excludeID).
+			Where("LOWER(vrm) = ? OR stock_id = ?", strings.ToLower(vehicle.VRM), vehicle.StockID)
+	} else {
+		query = query.Where("vehicle_id = ? OR LOWER(vrm) = ? OR stock_id = ?",
+			vehicle.VehicleID, strings.ToLower(vehicle.VRM), vehicle.StockID)
+	}
+
+	var count int64
+	if err := query.Count(&count).Error; err != nil {
+		return dbError(err, "failed to check for existing vehicle")
+	}
+
+	if count > 0 {
+		return errVehicleExists
+	}
+
+	return nil
+}
+
+// findVehicle fetches a vehicle by ID
+func findVehicle(db *gorm.DB, id int) (*models.Vehicle, error) {
+	var vehicle models.Vehicle
+
+	if err := db.First(&vehicle, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, apperr.NotFound("vehicle not found")
+		}
+		return nil, dbError(err, "failed to fetch vehicle")
+	}
+
+	return &vehicle, nil
+}
+
+// lockVehicle fetches a vehicle and locks its row until the transaction ends
+func lockVehicle(tx *gorm.DB, id int) (*models.Vehicle, error) {
+	var vehicle models.Vehicle
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&vehicle, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, apperr.NotFound("vehicle not found")
+		}
+		return nil, dbError(err, "failed to fetch vehicle")
+	}
+	return &vehicle, nil
+}
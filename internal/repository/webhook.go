@@ -0,0 +1,326 @@
+package repository
+
+import (
+	"errors"
+	"time"
+
+	"github.com/Candoo/vehicles-api/internal/apperr"
+	"github.com/Candoo/vehicles-api/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// WebhookStore is the storage of webhook endpoints, their deliveries and dead
+// letters. WebhookRepository implements it on Postgres and MemoryWebhookStore in memory.
+type WebhookStore interface {
+	CreateWebhookEndpoint(endpoint *models.WebhookEndpoint) error
+	ListWebhookEndpoints() ([]models.WebhookEndpoint, error)
+	GetWebhookEndpoint(id uint) (*models.WebhookEndpoint, error)
+	DeleteWebhookEndpoint(id uint) error
+
+	EnqueueWebhookDeliveries(event models.VehicleEvent, payload string, at time.Time) ([]models.WebhookDelivery, error)
+	ClaimWebhookDeliveries(now time.Time, lease time.Duration, limit int) ([]models.WebhookDelivery, error)
+	RecordWebhookAttempt(delivery *models.WebhookDelivery) error
+	ListWebhookDeliveries(filters models.WebhookDeliveryFilters) ([]models.WebhookDelivery, *models.ResponseMetadata, error)
+
+	ListWebhookDeadLetters(endpointID uint) ([]models.WebhookDeadLetter, error)
+	RetryWebhookDeadLetter(id uint, at time.Time) (*models.WebhookDelivery, error)
+}
+
+var (
+	_ WebhookStore = (*WebhookRepository)(nil)
+	_ WebhookStore = (*MemoryWebhookStore)(nil)
+)
+
+// WebhookRepository handles database operations for webhooks
+type WebhookRepository struct {
+	db *gorm.DB
+}
+
+// NewWebhookRepository creates a new webhook repository
+func NewWebhookRepository(db *gorm.DB) *WebhookRepository {
+	return &WebhookRepository{db: db}
+}
+
+// CreateWebhookEndpoint registers a webhook endpoint
+func (r *WebhookRepository) CreateWebhookEndpoint(endpoint *models.WebhookEndpoint) error {
+	if err := r.db.Create(endpoint).Error; err != nil {
+		return dbError(err, "failed to create webhook endpoint")
+	}
+	return nil
+}
+
+// ListWebhookEndpoints retrieves every webhook endpoint, oldest first
+func (r *WebhookRepository) ListWebhookEndpoints() ([]models.WebhookEndpoint, error) {
+	endpoints := []models.WebhookEndpoint{}
+	if err := r.db.Order("id ASC").Find(&endpoints).Error; err != nil {
+		return nil, dbError(err, "failed to fetch webhook endpoints")
+	}
+	return endpoints, nil
+}
+
+// GetWebhookEndpoint retrieves a webhook endpoint by ID
+func (r *WebhookRepository) GetWebhookEndpoint(id uint) (*models.WebhookEndpoint, error) {
+	var endpoint models.WebhookEndpoint
+	if err := r.db.First(&endpoint, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errWebhookEndpointNotFound
+		}
+		return nil, dbError(err, "failed to fetch webhook endpoint")
+	}
+	return &endpoint, nil
+}
+
+// DeleteWebhookEndpoint removes a webhook endpoint with its deliveries and dead letters
+func (r *WebhookRepository) DeleteWebhookEndpoint(id uint) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("endpoint_id = ?", id).Delete(&models.WebhookDeadLetter{}).Error; err != nil {
+			return dbError(err, "failed to delete webhook dead letters")
+		}
+		if err := tx.Where("endpoint_id = ?", id).Delete(&models.WebhookDelivery{}).Error; err != nil {
+			return dbError(err, "failed to delete webhook deliveries")
+		}
+
+		result := tx.Delete(&models.WebhookEndpoint{}, id)
+		if result.Error != nil {
+			return dbError(result.Error, "failed to delete webhook endpoint")
+		}
+		if result.RowsAffected == 0 {
+			return errWebhookEndpointNotFound
+		}
+		return nil
+	})
+}
+
+// EnqueueWebhookDeliveries queues an event for every endpoint subscribed to it,
+// due at once. An event already queued for an endpoint is not queued again, so an
+// event published twice is delivered once.
+func (r *WebhookRepository) EnqueueWebhookDeliveries(event models.VehicleEvent, payload string, at time.Time) ([]models.WebhookDelivery, error) {
+	endpoints, err := r.ListWebhookEndpoints()
+	if err != nil {
+		return nil, err
+	}
+
+	deliveries := newWebhookDeliveries(endpoints, event, payload, at)
+	if len(deliveries) == 0 {
+		return deliveries, nil
+	}
+	if err := r.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&deliveries).Error; err != nil {
+		return nil, dbError(err, "failed to queue webhook deliveries")
+	}
+	return deliveries, nil
+}
+
+// ClaimWebhookDeliveries returns up to limit pending deliveries that are due, with
+// their endpoints, and pushes their next attempt back by lease so another worker
+// does not send them at the same time. Rows other workers have locked are skipped.
+func (r *WebhookRepository) ClaimWebhookDeliveries(now time.Time, lease time.Duration, limit int) ([]models.WebhookDelivery, error) {
+	deliveries := []models.WebhookDelivery{}
+
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status = ? AND next_attempt_at <= ?", models.WebhookDeliveryPending, now).
+			Order("next_attempt_at ASC, id ASC").
+			Limit(limit).
+			Find(&deliveries).Error; err != nil {
+			return dbError(err, "failed to fetch due webhook deliveries")
+		}
+		if len(deliveries) == 0 {
+			return nil
+		}
+
+		ids := make([]uint, len(deliveries))
+		endpointIDs := make([]uint, len(deliveries))
+		leaseEnd := now.Add(lease)
+		for i := range deliveries {
+			ids[i] = deliveries[i].ID
+			endpointIDs[i] = deliveries[i].EndpointID
+			deliveries[i].NextAttemptAt = &leaseEnd
+		}
+		if err := tx.Model(&models.WebhookDelivery{}).
+			Where("id IN ?", ids).
+			Update("next_attempt_at", leaseEnd).Error; err != nil {
+			return dbError(err, "failed to claim webhook deliveries")
+		}
+
+		var endpoints []models.WebhookEndpoint
+		if err := tx.Where("id IN ?", endpointIDs).Find(&endpoints).Error; err != nil {
+			return dbError(err, "failed to fetch webhook endpoints")
+		}
+		attachEndpoints(deliveries, endpoints)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return deliveries, nil
+}
+
+// RecordWebhookAttempt stores the outcome of a delivery attempt. A delivery that is
+// dead is copied to the dead-letter table.
+func (r *WebhookRepository) RecordWebhookAttempt(delivery *models.WebhookDelivery) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.WebhookDelivery{ID: delivery.ID}).Updates(map[string]interface{}{
+			"status":          delivery.Status,
+			"attempts":        delivery.Attempts,
+			"next_attempt_at": delivery.NextAttemptAt,
+			"last_attempt_at": delivery.LastAttemptAt,
+			"response_status": delivery.ResponseStatus,
+			"last_error":      delivery.LastError,
+			"delivered_at":    delivery.DeliveredAt,
+		}).Error; err != nil {
+			return dbError(err, "failed to record webhook attempt")
+		}
+
+		if delivery.Status != models.WebhookDeliveryDead {
+			return nil
+		}
+		deadLetter := newDeadLetter(delivery)
+		if err := tx.Create(&deadLetter).Error; err != nil {
+			return dbError(err, "failed to record webhook dead letter")
+		}
+		return nil
+	})
+}
+
+// ListWebhookDeliveries retrieves a page of the delivery log, newest first
+func (r *WebhookRepository) ListWebhookDeliveries(filters models.WebhookDeliveryFilters) ([]models.WebhookDelivery, *models.ResponseMetadata, error) {
+	pageDefaults(&filters.Page, &filters.ResultsPerPage, 20)
+
+	query := r.db.Model(&models.WebhookDelivery{})
+	if filters.EndpointID > 0 {
+		query = query.Where("endpoint_id = ?", filters.EndpointID)
+	}
+	if len(filters.Statuses) > 0 {
+		query = query.Where("status IN ?", filters.Statuses)
+	}
+	if len(filters.EventTypes) > 0 {
+		query = query.Where("event_type IN ?", filters.EventTypes)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, nil, dbError(err, "failed to count webhook deliveries")
+	}
+
+	deliveries := []models.WebhookDelivery{}
+	if err := query.Order("created_at DESC, id DESC").
+		Offset((filters.Page - 1) * filters.ResultsPerPage).
+		Limit(filters.ResultsPerPage).
+		Find(&deliveries).Error; err != nil {
+		return nil, nil, dbError(err, "failed to fetch webhook deliveries")
+	}
+
+	return deliveries, pageMetadata(filters.Page, filters.ResultsPerPage, total), nil
+}
+
+// ListWebhookDeadLetters retrieves the dead letters of an endpoint, or of every
+// endpoint when endpointID is 0, newest first
+func (r *WebhookRepository) ListWebhookDeadLetters(endpointID uint) ([]models.WebhookDeadLetter, error) {
+	query := r.db.Model(&models.WebhookDeadLetter{})
+	if endpointID > 0 {
+		query = query.Where("endpoint_id = ?", endpointID)
+	}
+
+	deadLetters := []models.WebhookDeadLetter{}
+	if err := query.Order("created_at DESC, id DESC").Find(&deadLetters).Error; err != nil {
+		return nil, dbError(err, "failed to fetch webhook dead letters")
+	}
+	return deadLetters, nil
+}
+
+// RetryWebhookDeadLetter puts a dead delivery back in the queue with a fresh set of
+// attempts, due at at, and removes its dead letter
+func (r *WebhookRepository) RetryWebhookDeadLetter(id uint, at time.Time) (*models.WebhookDelivery, error) {
+	var delivery models.WebhookDelivery
+
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		var deadLetter models.WebhookDeadLetter
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&deadLetter, id).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return errDeadLetterNotFound
+			}
+			return dbError(err, "failed to fetch webhook dead letter")
+		}
+		if err := tx.First(&delivery, deadLetter.DeliveryID).Error; err != nil {
+			return dbError(err, "failed to fetch webhook delivery")
+		}
+
+		requeueDelivery(&delivery, at)
+		if err := tx.Model(&delivery).Updates(map[string]interface{}{
+			"status":          delivery.Status,
+			"attempts":        delivery.Attempts,
+			"next_attempt_at": delivery.NextAttemptAt,
+		}).Error; err != nil {
+			return dbError(err, "failed to requeue webhook delivery")
+		}
+		if err := tx.Delete(&deadLetter).Error; err != nil {
+			return dbError(err, "failed to delete webhook dead letter")
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &delivery, nil
+}
+
+var (
+	errWebhookEndpointNotFound = apperr.NotFound("webhook endpoint not found")
+	errDeadLetterNotFound      = apperr.NotFound("dead letter not found")
+)
+
+// newWebhookDeliveries builds a pending delivery of an event for each endpoint
+// subscribed to it
+func newWebhookDeliveries(endpoints []models.WebhookEndpoint, event models.VehicleEvent, payload string, at time.Time) []models.WebhookDelivery {
+	deliveries := []models.WebhookDelivery{}
+	for i := range endpoints {
+		if !endpoints[i].Subscribes(event.Type) {
+			continue
+		}
+		due := at
+		deliveries = append(deliveries, models.WebhookDelivery{
+			EndpointID:    endpoints[i].ID,
+			EventID:       event.ID,
+			EventType:     event.Type,
+			Payload:       payload,
+			Status:        models.WebhookDeliveryPending,
+			NextAttemptAt: &due,
+		})
+	}
+	return deliveries
+}
+
+// attachEndpoints sets the endpoint of each delivery
+func attachEndpoints(deliveries []models.WebhookDelivery, endpoints []models.WebhookEndpoint) {
+	byID := make(map[uint]*models.WebhookEndpoint, len(endpoints))
+	for i := range endpoints {
+		byID[endpoints[i].ID] = &endpoints[i]
+	}
+	for i := range deliveries {
+		deliveries[i].Endpoint = byID[deliveries[i].EndpointID]
+	}
+}
+
+// newDeadLetter copies a dead delivery into a dead letter
+func newDeadLetter(delivery *models.WebhookDelivery) models.WebhookDeadLetter {
+	return models.WebhookDeadLetter{
+		DeliveryID:     delivery.ID,
+		EndpointID:     delivery.EndpointID,
+		EventID:        delivery.EventID,
+		EventType:      delivery.EventType,
+		Payload:        delivery.Payload,
+		Attempts:       delivery.Attempts,
+		ResponseStatus: delivery.ResponseStatus,
+		LastError:      delivery.LastError,
+	}
+}
+
+// requeueDelivery makes a dead delivery pending again with no attempts used
+func requeueDelivery(delivery *models.WebhookDelivery, at time.Time) {
+	delivery.Status = models.WebhookDeliveryPending
+	delivery.Attempts = 0
+	delivery.NextAttemptAt = &at
+}
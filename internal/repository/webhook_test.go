@@ -0,0 +1,274 @@
+package repository
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Candoo/vehicles-api/internal/apperr"
+	"github.com/Candoo/vehicles-api/internal/models"
+)
+
+// TestMemoryWebhookStore runs the shared webhook suite against the in-memory store
+func TestMemoryWebhookStore(t *testing.T) {
+	runWebhookStoreSuite(t, func(t *testing.T) WebhookStore {
+		return NewMemoryWebhookStore()
+	})
+}
+
+// TestWebhookRepository runs the shared webhook suite against Postgres. It is skipped
+// unless TEST_DATABASE_URL points at a database the tests may wipe.
+func TestWebhookRepository(t *testing.T) {
+	db := openTestDB(t)
+
+	runWebhookStoreSuite(t, func(t *testing.T) WebhookStore {
+		if err := db.Exec("TRUNCATE webhook_endpoints, webhook_deliveries, webhook_dead_letters RESTART IDENTITY").Error; err != nil {
+			t.Fatalf("failed to reset database: %v", err)
+		}
+		return NewWebhookRepository(db)
+	})
+}
+
+// runWebhookStoreSuite checks the behaviour every WebhookStore must share.
+// newStore returns an empty store for each subtest.
+func runWebhookStoreSuite(t *testing.T, newStore func(t *testing.T) WebhookStore) {
+	tests := []struct {
+		name string
+		run  func(t *testing.T, store WebhookStore)
+	}{
+		{"endpoints", testWebhookEndpoints},
+		{"enqueue and claim", testWebhookClaims},
+		{"delivery log", testWebhookDeliveryLog},
+		{"dead letters", testWebhookDeadLetters},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.run(t, newStore(t))
+		})
+	}
+}
+
+// mustCreateEndpoint registers an endpoint subscribed to events or fails the test
+func mustCreateEndpoint(t *testing.T, store WebhookStore, events ...string) models.WebhookEndpoint {
+	t.Helper()
+	endpoint := models.WebhookEndpoint{
+		URL:    "https://example.com/hooks",
+		Events: events,
+		Secret: "whsec_test",
+	}
+	if err := store.CreateWebhookEndpoint(&endpoint); err != nil {
+		t.Fatalf("CreateWebhookEndpoint: %v", err)
+	}
+	return endpoint
+}
+
+// mustEnqueue queues an event or fails the test
+func mustEnqueue(t *testing.T, store WebhookStore, id string, eventType models.EventType, at time.Time) []models.WebhookDelivery {
+	t.Helper()
+	deliveries, err := store.EnqueueWebhookDeliveries(models.VehicleEvent{ID: id, Type: eventType, VehicleID: 1}, `{"id":"`+id+`"}`, at)
+	if err != nil {
+		t.Fatalf("EnqueueWebhookDeliveries(%s): %v", id, err)
+	}
+	return deliveries
+}
+
+func testWebhookEndpoints(t *testing.T, store WebhookStore) {
+	first := mustCreateEndpoint(t, store, "*")
+	second := mustCreateEndpoint(t, store, string(models.EventVehicleSold))
+
+	got, err := store.GetWebhookEndpoint(second.ID)
+	if err != nil {
+		t.Fatalf("GetWebhookEndpoint: %v", err)
+	}
+	if got.Secret != "whsec_test" || len(got.Events) != 1 || got.Events[0] != "vehicle.sold" {
+		t.Errorf("endpoint = %+v", got)
+	}
+
+	endpoints, err := store.ListWebhookEndpoints()
+	if err != nil {
+		t.Fatalf("ListWebhookEndpoints: %v", err)
+	}
+	if len(endpoints) != 2 || endpoints[0].ID != first.ID {
+		t.Errorf("endpoints = %+v, want oldest first", endpoints)
+	}
+
+	mustEnqueue(t, store, "evt_1", models.EventVehicleSold, time.Now())
+	if err := store.DeleteWebhookEndpoint(second.ID); err != nil {
+		t.Fatalf("DeleteWebhookEndpoint: %v", err)
+	}
+	_, err = store.GetWebhookEndpoint(second.ID)
+	expectError(t, err, apperr.ErrNotFound)
+	expectError(t, store.DeleteWebhookEndpoint(second.ID), apperr.ErrNotFound)
+
+	deliveries, _, err := store.ListWebhookDeliveries(models.WebhookDeliveryFilters{})
+	if err != nil {
+		t.Fatalf("ListWebhookDeliveries: %v", err)
+	}
+	if len(deliveries) != 1 || deliveries[0].EndpointID != first.ID {
+		t.Errorf("deliveries = %+v, want only those of the remaining endpoint", deliveries)
+	}
+}
+
+func testWebhookClaims(t *testing.T, store WebhookStore) {
+	all := mustCreateEndpoint(t, store, "*")
+	mustCreateEndpoint(t, store, string(models.EventVehicleSold))
+	at := time.Now().Truncate(time.Second)
+
+	if queued := mustEnqueue(t, store, "evt_1", models.EventVehiclePriceChanged, at); len(queued) != 1 || queued[0].EndpointID != all.ID {
+		t.Fatalf("queued = %+v, want one delivery to the endpoint subscribed to everything", queued)
+	}
+	if queued := mustEnqueue(t, store, "evt_2", models.EventVehicleSold, at.Add(time.Second)); len(queued) != 2 {
+		t.Fatalf("queued %d deliveries, want 2", len(queued))
+	}
+
+	claimed, err := store.ClaimWebhookDeliveries(at, time.Minute, 10)
+	if err != nil {
+		t.Fatalf("ClaimWebhookDeliveries: %v", err)
+	}
+	if len(claimed) != 1 || claimed[0].EventID != "evt_1" {
+		t.Fatalf("claimed = %+v, want only the delivery already due", claimed)
+	}
+	if claimed[0].Endpoint == nil || claimed[0].Endpoint.Secret != "whsec_test" {
+		t.Errorf("claimed endpoint = %+v, want it loaded", claimed[0].Endpoint)
+	}
+	if claimed[0].Payload != `{"id":"evt_1"}` {
+		t.Errorf("payload = %q", claimed[0].Payload)
+	}
+
+	claimed, err = store.ClaimWebhookDeliveries(at.Add(time.Second), time.Minute, 1)
+	if err != nil {
+		t.Fatalf("ClaimWebhookDeliveries: %v", err)
+	}
+	if len(claimed) != 1 || claimed[0].EventID != "evt_2" {
+		t.Fatalf("claimed = %+v, want one of evt_2 under the limit, leased evt_1 skipped", claimed)
+	}
+
+	// Once the lease runs out an unrecorded delivery is claimed again
+	claimed, err = store.ClaimWebhookDeliveries(at.Add(2*time.Minute), time.Minute, 10)
+	if err != nil {
+		t.Fatalf("ClaimWebhookDeliveries: %v", err)
+	}
+	if len(claimed) != 3 {
+		t.Fatalf("claimed %d deliveries after the lease, want 3", len(claimed))
+	}
+
+	delivered := claimed[0]
+	deliveredAt := at.Add(2 * time.Minute)
+	delivered.Status = models.WebhookDeliveryDelivered
+	delivered.Attempts = 1
+	delivered.LastAttemptAt = &deliveredAt
+	delivered.DeliveredAt = &deliveredAt
+	delivered.ResponseStatus = 204
+	delivered.NextAttemptAt = nil
+	if err := store.RecordWebhookAttempt(&delivered); err != nil {
+		t.Fatalf("RecordWebhookAttempt: %v", err)
+	}
+
+	claimed, err = store.ClaimWebhookDeliveries(at.Add(time.Hour), time.Minute, 10)
+	if err != nil {
+		t.Fatalf("ClaimWebhookDeliveries: %v", err)
+	}
+	if len(claimed) != 2 {
+		t.Errorf("claimed %d deliveries, want 2 once one was delivered", len(claimed))
+	}
+}
+
+func testWebhookDeliveryLog(t *testing.T, store WebhookStore) {
+	first := mustCreateEndpoint(t, store, "*")
+	second := mustCreateEndpoint(t, store, "*")
+	at := time.Now()
+	for _, id := range []string{"evt_1", "evt_2", "evt_3"} {
+		mustEnqueue(t, store, id, models.EventVehicleUpdated, at)
+	}
+	mustEnqueue(t, store, "evt_4", models.EventVehicleDeleted, at)
+
+	deliveries, meta, err := store.ListWebhookDeliveries(models.WebhookDeliveryFilters{EndpointID: first.ID, ResultsPerPage: 3})
+	if err != nil {
+		t.Fatalf("ListWebhookDeliveries: %v", err)
+	}
+	if meta.Total != 4 || meta.LastPage != 2 || len(deliveries) != 3 {
+		t.Fatalf("meta = %+v with %d deliveries, want 4 over 2 pages", meta, len(deliveries))
+	}
+	if deliveries[0].EventID != "evt_4" || deliveries[2].EventID != "evt_2" {
+		t.Errorf("deliveries = %s, %s, %s, want newest first", deliveries[0].EventID, deliveries[1].EventID, deliveries[2].EventID)
+	}
+
+	deliveries, _, err = store.ListWebhookDeliveries(models.WebhookDeliveryFilters{
+		EndpointID: second.ID,
+		EventTypes: []models.EventType{models.EventVehicleDeleted},
+	})
+	if err != nil {
+		t.Fatalf("ListWebhookDeliveries: %v", err)
+	}
+	if len(deliveries) != 1 || deliveries[0].EndpointID != second.ID || deliveries[0].EventID != "evt_4" {
+		t.Errorf("deliveries = %+v, want evt_4 to the second endpoint", deliveries)
+	}
+
+	deliveries, meta, err = store.ListWebhookDeliveries(models.WebhookDeliveryFilters{
+		Statuses: []models.WebhookDeliveryStatus{models.WebhookDeliveryDead},
+	})
+	if err != nil {
+		t.Fatalf("ListWebhookDeliveries: %v", err)
+	}
+	if len(deliveries) != 0 || meta.Total != 0 {
+		t.Errorf("dead deliveries = %d, want none", len(deliveries))
+	}
+}
+
+func testWebhookDeadLetters(t *testing.T, store WebhookStore) {
+	endpoint := mustCreateEndpoint(t, store, "*")
+	at := time.Now().Truncate(time.Second)
+	mustEnqueue(t, store, "evt_1", models.EventVehicleSold, at)
+
+	claimed, err := store.ClaimWebhookDeliveries(at, time.Minute, 10)
+	if err != nil || len(claimed) != 1 {
+		t.Fatalf("ClaimWebhookDeliveries = %d deliveries, %v", len(claimed), err)
+	}
+	dead := claimed[0]
+	dead.Status = models.WebhookDeliveryDead
+	dead.Attempts = 8
+	dead.LastAttemptAt = &at
+	dead.NextAttemptAt = nil
+	dead.ResponseStatus = 500
+	dead.LastError = "receiver responded 500 Internal Server Error"
+	if err := store.RecordWebhookAttempt(&dead); err != nil {
+		t.Fatalf("RecordWebhookAttempt: %v", err)
+	}
+
+	deadLetters, err := store.ListWebhookDeadLetters(endpoint.ID)
+	if err != nil {
+		t.Fatalf("ListWebhookDeadLetters: %v", err)
+	}
+	if len(deadLetters) != 1 {
+		t.Fatalf("dead letters = %d, want 1", len(deadLetters))
+	}
+	deadLetter := deadLetters[0]
+	if deadLetter.DeliveryID != dead.ID || deadLetter.EventID != "evt_1" || deadLetter.Attempts != 8 || deadLetter.ResponseStatus != 500 || deadLetter.Payload != `{"id":"evt_1"}` {
+		t.Errorf("dead letter = %+v", deadLetter)
+	}
+	if others, _ := store.ListWebhookDeadLetters(endpoint.ID + 1); len(others) != 0 {
+		t.Errorf("dead letters of another endpoint = %d, want 0", len(others))
+	}
+
+	retryAt := at.Add(time.Hour)
+	retried, err := store.RetryWebhookDeadLetter(deadLetter.ID, retryAt)
+	if err != nil {
+		t.Fatalf("RetryWebhookDeadLetter: %v", err)
+	}
+	if retried.ID != dead.ID || retried.Status != models.WebhookDeliveryPending || retried.Attempts != 0 {
+		t.Errorf("retried = %+v, want the delivery pending with no attempts", retried)
+	}
+	_, err = store.RetryWebhookDeadLetter(deadLetter.ID, retryAt)
+	expectError(t, err, apperr.ErrNotFound)
+
+	if deadLetters, _ := store.ListWebhookDeadLetters(0); len(deadLetters) != 0 {
+		t.Errorf("dead letters = %d after retry, want 0", len(deadLetters))
+	}
+	claimed, err = store.ClaimWebhookDeliveries(retryAt, time.Minute, 10)
+	if err != nil {
+		t.Fatalf("ClaimWebhookDeliveries: %v", err)
+	}
+	if len(claimed) != 1 || claimed[0].ID != dead.ID {
+		t.Errorf("claimed = %+v, want the retried delivery", claimed)
+	}
+}
@@ -0,0 +1,70 @@
+package reservation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/Candoo/vehicles-api/internal/models"
+	"github.com/Candoo/vehicles-api/internal/payment"
+)
+
+// Store is the persistence the expirer needs
+type Store interface {
+	// ExpireReservations ends the held reservations that ran out by now, returning
+	// their vehicles to stock, and returns the reservations it expired
+	ExpireReservations(now time.Time) ([]models.Reservation, error)
+}
+
+// Expirer expires reservations once their hold time is up
+type Expirer struct {
+	store    Store
+	payments payment.Provider
+	// Now returns the current time; tests replace it
+	Now func() time.Time
+}
+
+// NewExpirer creates a reservation expirer releasing deposits through payments
+func NewExpirer(store Store, payments payment.Provider) *Expirer {
+	return &Expirer{store: store, payments: payments, Now: time.Now}
+}
+
+// Run expires the reservations that have run out and releases their deposit holds,
+// returning the reservations expired. A hold that cannot be released does not stop
+// the others; the provider lets it lapse in time.
+func (e *Expirer) Run(ctx context.Context) ([]models.Reservation, error) {
+	expired, err := e.store.ExpireReservations(e.Now())
+
+	var releaseErrs []error
+	for _, reservation := range expired {
+		if releaseErr := e.payments.Release(ctx, reservation.PaymentHoldID); releaseErr != nil {
+			releaseErrs = append(releaseErrs, fmt.Errorf("failed to release deposit of reservation %s: %w", reservation.Reference, releaseErr))
+		}
+	}
+
+	return expired, errors.Join(append([]error{err}, releaseErrs...)...)
+}
+
+// Start runs the expirer immediately and then on every interval until the context is cancelled
+func (e *Expirer) Start(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		expired, err := e.Run(ctx)
+		if err != nil {
+			log.Printf("Reservation expiry failed: %v", err)
+		}
+		for _, reservation := range expired {
+			log.Printf("Reservation %s of vehicle %d expired", reservation.Reference, reservation.VehicleID)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package reservation
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Candoo/vehicles-api/internal/models"
+	"github.com/Candoo/vehicles-api/internal/payment"
+	"github.com/Candoo/vehicles-api/internal/repository"
+)
+
+func TestExpirerReleasesExpiredReservations(t *testing.T) {
+	ctx := context.Background()
+	vehicles := repository.NewMemoryVehicleStore()
+	store := repository.NewMemoryReservationStore(vehicles)
+	payments := payment.NewFake()
+	start := time.Date(2026, time.October, 16, 12, 0, 0, 0, time.UTC)
+
+	for id, hours := range map[int]int{1: 1, 2: 48} {
+		if err := vehicles.CreateVehicle(&models.Vehicle{VehicleID: id, Name: "Skoda Fabia", Make: "Skoda", Model: "Fabia", VRM: fmt.Sprintf("AB%02dCDE", id), StockID: fmt.Sprintf("STK%d", id)}); err != nil {
+			t.Fatalf("CreateVehicle: %v", err)
+		}
+		holdID, err := payments.Hold(ctx, payment.HoldRequest{Amount: models.MoneyFromPounds(99), Token: "tok_visa"})
+		if err != nil {
+			t.Fatalf("Hold: %v", err)
+		}
+		if err := store.CreateReservation(&models.Reservation{
+			Reference:       fmt.Sprintf("rs_%d", id),
+			VehicleID:       id,
+			Name:            "Sam Taylor",
+			Deposit:         models.MoneyFromPounds(99),
+			PaymentProvider: payments.Name(),
+			PaymentHoldID:   holdID,
+			ExpiresAt:       start.Add(time.Duration(hours) * time.Hour),
+		}); err != nil {
+			t.Fatalf("CreateReservation: %v", err)
+		}
+	}
+
+	expirer := NewExpirer(store, payments)
+	expirer.Now = func() time.Time { return start.Add(2 * time.Hour) }
+	expired, err := expirer.Run(ctx)
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if len(expired) != 1 || expired[0].VehicleID != 1 {
+		t.Fatalf("expired = %+v", expired)
+	}
+
+	if hold, _ := payments.Get(expired[0].PaymentHoldID); hold.State != payment.HoldStateReleased {
+		t.Errorf("expired hold = %+v", hold)
+	}
+	for id, want := range map[int]models.StockStatus{1: models.StockStatusInStock, 2: models.StockStatusReserved} {
+		vehicle, err := vehicles.GetVehicleByID(id)
+		if err != nil {
+			t.Fatalf("GetVehicleByID: %v", err)
+		}
+		if vehicle.StockStatus != want {
+			t.Errorf("vehicle %d stock_status = %q, want %q", id, vehicle.StockStatus, want)
+		}
+	}
+
+	// Nothing is left to expire, and a hold the provider has lost is reported
+	if expired, err := expirer.Run(ctx); err != nil || len(expired) != 0 {
+		t.Errorf("second run = %+v, %v", expired, err)
+	}
+	expirer.payments = payment.NewFake()
+	expirer.Now = func() time.Time { return start.Add(72 * time.Hour) }
+	expired, err = expirer.Run(ctx)
+	if len(expired) != 1 || err == nil || !strings.Contains(err.Error(), "rs_2") {
+		t.Errorf("lost hold: expired %+v, err %v", expired, err)
+	}
+}
@@ -0,0 +1,11 @@
+// Package reservation holds the parts of online reservations outside the request
+// cycle: booking references and the worker that expires reservations that run out,
+// releasing their deposit holds.
+package reservation
+
+import "github.com/Candoo/vehicles-api/internal/ids"
+
+// NewReference returns an unguessable reservation reference
+func NewReference() (string, error) {
+	return ids.New("rs")
+}
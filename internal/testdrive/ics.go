@@ -0,0 +1,97 @@
+package testdrive
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Candoo/vehicles-api/internal/models"
+)
+
+// icsTime is the UTC date-time format of iCalendar
+const icsTime = "20060102T150405Z"
+
+// Calendar renders a booking as an iCalendar (RFC 5545) file holding one event.
+// The event keeps the booking reference as its UID and the booking's sequence, so
+// importing a rescheduled or cancelled booking updates the copy already imported.
+// site may be nil for a vehicle that is not at a known site.
+func Calendar(drive *models.TestDrive, vehicle *models.Vehicle, site *models.Site, now time.Time) []byte {
+	status := "CONFIRMED"
+	if drive.Status == models.TestDriveStatusCancelled {
+		status = "CANCELLED"
+	}
+
+	description := fmt.Sprintf("Test drive of %s (%s).\nBooking reference %s.", vehicle.Name, vehicle.VRM, drive.Reference)
+
+	lines := []string{
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"PRODID:-//Candoo//Vehicles API//EN",
+		"CALSCALE:GREGORIAN",
+		"METHOD:PUBLISH",
+		"BEGIN:VEVENT",
+		"UID:" + drive.Reference + "@vehicles-api",
+		"SEQUENCE:" + fmt.Sprint(drive.Sequence),
+		"DTSTAMP:" + now.UTC().Format(icsTime),
+		"DTSTART:" + drive.StartsAt.UTC().Format(icsTime),
+		"DTEND:" + drive.EndsAt.UTC().Format(icsTime),
+		"SUMMARY:" + escapeText("Test drive: "+vehicle.Name),
+		"DESCRIPTION:" + escapeText(description),
+		"STATUS:" + status,
+	}
+	if site != nil {
+		lines = append(lines, "LOCATION:"+escapeText(siteAddress(site)))
+		if site.Latitude != nil && site.Longitude != nil {
+			lines = append(lines, fmt.Sprintf("GEO:%.6f;%.6f", *site.Latitude, *site.Longitude))
+		}
+	}
+	lines = append(lines, "END:VEVENT", "END:VCALENDAR")
+
+	var b strings.Builder
+	for _, line := range lines {
+		b.WriteString(fold(line))
+		b.WriteString("\r\n")
+	}
+	return []byte(b.String())
+}
+
+// siteAddress joins the non-empty parts of a site's name and address
+func siteAddress(site *models.Site) string {
+	var parts []string
+	for _, part := range []string{site.Name, site.AddressLine1, site.AddressLine2, site.Town, site.County, site.Postcode} {
+		if part = strings.TrimSpace(part); part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// escapeText escapes an iCalendar TEXT value
+func escapeText(s string) string {
+	return strings.NewReplacer(
+		`\`, `\\`,
+		";", `\;`,
+		",", `\,`,
+		"\r\n", `\n`,
+		"\n", `\n`,
+	).Replace(s)
+}
+
+// fold splits a content line into lines of at most 75 octets, each continuation
+// starting with a space, without splitting a UTF-8 character
+func fold(line string) string {
+	const limit = 75
+
+	var b strings.Builder
+	width := 0
+	for _, r := range line {
+		size := len(string(r))
+		if width+size > limit {
+			b.WriteString("\r\n ")
+			width = 1
+		}
+		b.WriteRune(r)
+		width += size
+	}
+	return b.String()
+}
@@ -0,0 +1,156 @@
+// Package testdrive works out the test drive slots a site offers from its opening
+// hours, and renders bookings as iCalendar files.
+package testdrive
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	_ "time/tzdata" // opening hours are UK local times wherever the API runs
+
+	"github.com/Candoo/vehicles-api/internal/ids"
+	"github.com/Candoo/vehicles-api/internal/models"
+)
+
+// Schedule turns a site's opening hours into test drive slots. Slots start at
+// opening time and follow one another until the last that ends by closing time.
+type Schedule struct {
+	// Location is the time zone of opening hours
+	Location *time.Location
+	// SlotLength is the length of a test drive
+	SlotLength time.Duration
+	// MinNotice is how long before a slot it can still be booked
+	MinNotice time.Duration
+	// MaxDaysAhead is how many days ahead slots can be booked, counting today
+	MaxDaysAhead int
+}
+
+// DefaultSchedule books hour-long test drives, UK time, from two hours to 30 days ahead
+func DefaultSchedule() Schedule {
+	london, err := time.LoadLocation("Europe/London")
+	if err != nil {
+		// The embedded time zone database always has Europe/London
+		panic(err)
+	}
+
+	return Schedule{
+		Location:     london,
+		SlotLength:   time.Hour,
+		MinNotice:    2 * time.Hour,
+		MaxDaysAhead: 30,
+	}
+}
+
+// Slots lists the slots on days consecutive days from the day from falls on, within
+// the booking window that starts at now. Slots taken by a booked test drive are
+// marked unavailable.
+func (s Schedule) Slots(hours models.OpeningHoursList, from time.Time, days int, booked []models.TestDrive, now time.Time) []models.TestDriveSlot {
+	slots := []models.TestDriveSlot{}
+	earliest, latest := s.window(now)
+
+	day := midnight(from.In(s.Location))
+	for i := 0; i < days; i++ {
+		for _, start := range s.starts(hours, day) {
+			end := start.Add(s.SlotLength)
+			if start.Before(earliest) || !start.Before(latest) {
+				continue
+			}
+
+			available := true
+			for j := range booked {
+				if booked[j].Overlaps(start, end) {
+					available = false
+					break
+				}
+			}
+
+			slots = append(slots, models.TestDriveSlot{StartsAt: start, EndsAt: end, Available: available})
+		}
+		day = time.Date(day.Year(), day.Month(), day.Day()+1, 0, 0, 0, 0, s.Location)
+	}
+
+	return slots
+}
+
+// Check reports whether start is the start of a slot the site offers that can be
+// booked now, returning the slot's end
+func (s Schedule) Check(hours models.OpeningHoursList, start, now time.Time) (time.Time, error) {
+	earliest, latest := s.window(now)
+	if start.Before(earliest) {
+		return time.Time{}, fmt.Errorf("starts_at must be at least %s from now", formatNotice(s.MinNotice))
+	}
+	if !start.Before(latest) {
+		return time.Time{}, fmt.Errorf("starts_at must be within %d days", s.MaxDaysAhead)
+	}
+
+	local := start.In(s.Location)
+	for _, slot := range s.starts(hours, midnight(local)) {
+		if slot.Equal(start) {
+			return start.Add(s.SlotLength), nil
+		}
+	}
+	return time.Time{}, errors.New("starts_at must be the start of one of the site's test drive slots")
+}
+
+// window returns the earliest time a slot may start and the time slots must start before
+func (s Schedule) window(now time.Time) (earliest, latest time.Time) {
+	today := midnight(now.In(s.Location))
+	return now.Add(s.MinNotice), time.Date(today.Year(), today.Month(), today.Day()+s.MaxDaysAhead, 0, 0, 0, 0, s.Location)
+}
+
+// starts lists the slot start times on a day, given as local midnight
+func (s Schedule) starts(hours models.OpeningHoursList, day time.Time) []time.Time {
+	weekday := strings.ToLower(day.Weekday().String())
+
+	var starts []time.Time
+	for _, open := range hours {
+		if open.Day != weekday {
+			continue
+		}
+
+		opens, err := clock(day, open.Opens)
+		if err != nil {
+			continue
+		}
+		closes, err := clock(day, open.Closes)
+		if err != nil {
+			continue
+		}
+
+		for start := opens; !start.Add(s.SlotLength).After(closes); start = start.Add(s.SlotLength) {
+			starts = append(starts, start)
+		}
+	}
+	return starts
+}
+
+// clock returns the time of an HH:MM opening time on a day, given as local midnight
+func clock(day time.Time, hhmm string) (time.Time, error) {
+	t, err := time.Parse("15:04", hhmm)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Date(day.Year(), day.Month(), day.Day(), t.Hour(), t.Minute(), 0, 0, day.Location()), nil
+}
+
+// midnight returns the start of the day t falls on, in t's location
+func midnight(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+// formatNotice describes a notice period in whole hours or minutes
+func formatNotice(d time.Duration) string {
+	if d%time.Hour == 0 {
+		if d == time.Hour {
+			return "1 hour"
+		}
+		return fmt.Sprintf("%d hours", d/time.Hour)
+	}
+	return fmt.Sprintf("%d minutes", d/time.Minute)
+}
+
+// NewReference returns an unguessable booking reference
+func NewReference() (string, error) {
+	return ids.New("td")
+}
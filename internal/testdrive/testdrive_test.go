@@ -0,0 +1,154 @@
+package testdrive
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Candoo/vehicles-api/internal/models"
+)
+
+var openingHours = models.OpeningHoursList{
+	{Day: "monday", Opens: "09:00", Closes: "12:30"},
+	{Day: "sunday", Opens: "10:00", Closes: "12:00"},
+}
+
+func london(year int, month time.Month, day, hour, minute int) time.Time {
+	return time.Date(year, month, day, hour, minute, 0, 0, DefaultSchedule().Location)
+}
+
+func TestSlots(t *testing.T) {
+	schedule := DefaultSchedule()
+	now := london(2026, time.October, 12, 8, 0)
+	booked := []models.TestDrive{
+		{StartsAt: london(2026, time.October, 12, 10, 0), EndsAt: london(2026, time.October, 12, 11, 0), Status: models.TestDriveStatusBooked},
+		{StartsAt: london(2026, time.October, 12, 11, 0), EndsAt: london(2026, time.October, 12, 12, 0), Status: models.TestDriveStatusCancelled},
+	}
+
+	// Monday's 09:00 slot is inside the notice period and Tuesday to Saturday are closed
+	slots := schedule.Slots(openingHours, now, 7, booked, now)
+	want := []struct {
+		start     time.Time
+		available bool
+	}{
+		{london(2026, time.October, 12, 10, 0), false},
+		{london(2026, time.October, 12, 11, 0), true},
+		{london(2026, time.October, 18, 10, 0), true},
+		{london(2026, time.October, 18, 11, 0), true},
+	}
+	if len(slots) != len(want) {
+		t.Fatalf("slots = %+v, want %d", slots, len(want))
+	}
+	for i, w := range want {
+		if !slots[i].StartsAt.Equal(w.start) || !slots[i].EndsAt.Equal(w.start.Add(time.Hour)) || slots[i].Available != w.available {
+			t.Errorf("slot %d = %+v, want start %s available %v", i, slots[i], w.start, w.available)
+		}
+	}
+
+	// Nothing is offered beyond the booking window
+	if slots := schedule.Slots(openingHours, now.AddDate(0, 0, 40), 7, nil, now); len(slots) != 0 {
+		t.Errorf("slots beyond window = %+v", slots)
+	}
+}
+
+func TestSlotsFollowLocalTimeAcrossClockChange(t *testing.T) {
+	schedule := DefaultSchedule()
+	now := london(2026, time.March, 20, 12, 0)
+
+	// The clocks go forward on Sunday 29 March, so the 10:00 opening is 09:00 UTC
+	slots := schedule.Slots(openingHours, london(2026, time.March, 29, 0, 0), 1, nil, now)
+	if len(slots) != 2 {
+		t.Fatalf("slots = %+v", slots)
+	}
+	if got := slots[0].StartsAt.UTC(); !got.Equal(time.Date(2026, time.March, 29, 9, 0, 0, 0, time.UTC)) {
+		t.Errorf("first slot starts %s", got)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	schedule := DefaultSchedule()
+	now := london(2026, time.October, 12, 8, 0)
+
+	start := london(2026, time.October, 12, 11, 0)
+	end, err := schedule.Check(openingHours, start.UTC(), now)
+	if err != nil {
+		t.Fatalf("Check: %v", err)
+	}
+	if !end.Equal(start.Add(time.Hour)) {
+		t.Errorf("end = %s", end)
+	}
+
+	tests := []struct {
+		name  string
+		start time.Time
+		want  string
+	}{
+		{"inside notice", london(2026, time.October, 12, 9, 0), "at least 2 hours"},
+		{"beyond window", london(2026, time.November, 16, 10, 0), "within 30 days"},
+		{"between slots", london(2026, time.October, 12, 10, 30), "start of one of the site's test drive slots"},
+		{"closed day", london(2026, time.October, 13, 10, 0), "start of one of the site's test drive slots"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := schedule.Check(openingHours, tt.start, now)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("err = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestCalendar(t *testing.T) {
+	lat, lng := 53.1905, -2.5196
+	drive := &models.TestDrive{
+		Reference: "td_0123456789abcdef01234567",
+		StartsAt:  time.Date(2026, time.October, 19, 9, 0, 0, 0, time.UTC),
+		EndsAt:    time.Date(2026, time.October, 19, 10, 0, 0, 0, time.UTC),
+		Status:    models.TestDriveStatusCancelled,
+		Sequence:  2,
+	}
+	vehicle := &models.Vehicle{Name: "Skoda Citigo 1.0 MPI GreenTech SE 5dr, Low Mileage; Full History", VRM: "BX63NSJ"}
+	site := &models.Site{Name: "Winsford", AddressLine1: "1 Road Street", Postcode: "CW7 3QP", Latitude: &lat, Longitude: &lng}
+
+	ics := string(Calendar(drive, vehicle, site, time.Date(2026, time.October, 16, 12, 0, 0, 0, time.UTC)))
+
+	for _, want := range []string{
+		"BEGIN:VCALENDAR\r\n",
+		"UID:td_0123456789abcdef01234567@vehicles-api\r\n",
+		"SEQUENCE:2\r\n",
+		"DTSTART:20261019T090000Z\r\n",
+		"DTEND:20261019T100000Z\r\n",
+		"STATUS:CANCELLED\r\n",
+		"LOCATION:Winsford\\, 1 Road Street\\, CW7 3QP\r\n",
+		"GEO:53.190500;-2.519600\r\n",
+		"END:VCALENDAR\r\n",
+	} {
+		if !strings.Contains(ics, want) {
+			t.Errorf("calendar missing %q:\n%s", want, ics)
+		}
+	}
+
+	// Long lines are folded and unfold back to the escaped summary
+	for _, line := range strings.Split(strings.TrimSuffix(ics, "\r\n"), "\r\n") {
+		if len(line) > 75 {
+			t.Errorf("line longer than 75 octets: %q", line)
+		}
+	}
+	unfolded := strings.ReplaceAll(ics, "\r\n ", "")
+	if !strings.Contains(unfolded, `SUMMARY:Test drive: Skoda Citigo 1.0 MPI GreenTech SE 5dr\, Low Mileage\; Full History`+"\r\n") {
+		t.Errorf("summary not escaped:\n%s", unfolded)
+	}
+}
+
+func TestFoldKeepsMultiByteCharacters(t *testing.T) {
+	line := "SUMMARY:" + strings.Repeat("é", 40)
+	folded := fold(line)
+	for _, part := range strings.Split(folded, "\r\n") {
+		if len(part) > 75 {
+			t.Errorf("part longer than 75 octets: %q", part)
+		}
+	}
+	if strings.ReplaceAll(folded, "\r\n ", "") != line {
+		t.Errorf("fold(%q) = %q", line, folded)
+	}
+}
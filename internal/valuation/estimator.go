@@ -0,0 +1,313 @@
+package valuation
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Candoo/vehicles-api/internal/models"
+)
+
+// Assumptions used by the Estimator where our stock says nothing better
+const (
+	// defaultFirstYearRetention and defaultAnnualRetention make up the fallback
+	// depreciation curve: a car keeps 80% of its new price in its first year and
+	// 85% of the rest in each year after
+	defaultFirstYearRetention = 0.80
+	defaultAnnualRetention    = 0.85
+	// defaultMilesPerYear is the expected mileage when stock gives no average
+	defaultMilesPerYear = 8000
+	// mileageAdjustment is the share of value gained or lost for every 1,000 miles
+	// below or above the expected mileage, within minMileageFactor and maxMileageFactor
+	mileageAdjustment = 0.01
+	minMileageFactor  = 0.60
+	maxMileageFactor  = 1.15
+	// tradeMargin is taken off the retail value we would sell the car for
+	tradeMargin = 0.15
+	// roundTo is the step values are rounded down to, £10
+	roundTo = 1000
+)
+
+// conditionFactors scale a value by the customer's description of the car
+var conditionFactors = map[models.VehicleCondition]float64{
+	models.ConditionExcellent: 1.05,
+	models.ConditionGood:      1.00,
+	models.ConditionFair:      0.90,
+	models.ConditionPoor:      0.75,
+}
+
+// Samples supplies the priced stock the Estimator learns from
+type Samples interface {
+	// GetValuationSamples returns vehicles with both a price and a price when new,
+	// whatever their stock status
+	GetValuationSamples() ([]models.Vehicle, error)
+}
+
+// Estimator is the default Provider. It values a car as its price when new, taken
+// from the average of our stock of the same make and model, times the share of the
+// new price our stock of the same age is priced at. That is adjusted for mileage
+// against our stock's average miles a year and for condition, and the trade margin
+// is taken off. The figures are rebuilt from stock once they are older than TTL.
+type Estimator struct {
+	samples Samples
+	// TTL is how long figures built from stock are reused
+	TTL time.Duration
+	// Now returns the current time; tests replace it
+	Now func() time.Time
+
+	mu      sync.Mutex
+	figures *stockFigures
+	builtAt time.Time
+}
+
+// NewEstimator creates an estimator learning from the given stock
+func NewEstimator(samples Samples) *Estimator {
+	return &Estimator{samples: samples, TTL: time.Hour, Now: time.Now}
+}
+
+// Name describes the estimator for logs and stored part-exchange requests
+func (e *Estimator) Name() string {
+	return "stock-estimator"
+}
+
+// Value works out an indicative part-exchange value for a car
+func (e *Estimator) Value(ctx context.Context, request Request) (models.Money, error) {
+	figures, err := e.stockFigures()
+	if err != nil {
+		return 0, err
+	}
+
+	// A car we sold ourselves tells us its make, model, year and new price
+	var newPrice models.Money
+	if known, ok := figures.byVRM[models.NormaliseVRM(request.VRM)]; ok {
+		if request.Make == "" {
+			request.Make, request.Model = known.make, known.model
+		}
+		if request.Year == 0 {
+			request.Year = known.year
+		}
+		newPrice = known.newPrice
+	}
+
+	if request.Year == 0 {
+		year, ok := YearFromVRM(models.NormaliseVRM(request.VRM))
+		if !ok {
+			return 0, ErrNoValuation
+		}
+		request.Year = year
+	}
+
+	if newPrice == 0 {
+		newPrice = figures.newPrice(request.Make, request.Model)
+	}
+	if newPrice == 0 {
+		return 0, ErrNoValuation
+	}
+
+	age := e.Now().Year() - request.Year
+	if age < 0 {
+		age = 0
+	}
+
+	condition, ok := conditionFactors[request.Condition]
+	if !ok {
+		condition = conditionFactors[models.ConditionGood]
+	}
+
+	value := float64(newPrice.Pence()) *
+		figures.retention(age) *
+		figures.mileageFactor(age, request.Mileage) *
+		condition *
+		(1 - tradeMargin)
+
+	pence := int64(value) / roundTo * roundTo
+	if pence <= 0 {
+		return 0, ErrNoValuation
+	}
+	return models.Money(pence), nil
+}
+
+// stockFigures returns the figures built from stock, rebuilding them when stale
+func (e *Estimator) stockFigures() (*stockFigures, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	now := e.Now()
+	if e.figures != nil && now.Sub(e.builtAt) < e.TTL {
+		return e.figures, nil
+	}
+
+	vehicles, err := e.samples.GetValuationSamples()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load valuation samples: %w", err)
+	}
+
+	e.figures = buildStockFigures(vehicles, now)
+	e.builtAt = now
+	return e.figures, nil
+}
+
+// knownVehicle is what our stock records about a car by its VRM
+type knownVehicle struct {
+	make     string
+	model    string
+	year     int
+	newPrice models.Money
+}
+
+// stockFigures are the averages the Estimator takes from our stock
+type stockFigures struct {
+	// ages and retentions are the median share of the new price our stock is
+	// priced at, by age in years, in age order
+	ages       []int
+	retentions []float64
+	// newPrices are the average prices when new by make and by make and model
+	newPrices    map[string]models.Money
+	milesPerYear float64
+	byVRM        map[string]knownVehicle
+}
+
+// buildStockFigures works out the figures from stock. A vehicle's age is taken at
+// the time it was last updated, when its price was set.
+func buildStockFigures(vehicles []models.Vehicle, now time.Time) *stockFigures {
+	figures := &stockFigures{
+		newPrices:    make(map[string]models.Money),
+		milesPerYear: defaultMilesPerYear,
+		byVRM:        make(map[string]knownVehicle),
+	}
+
+	ratios := make(map[int][]float64)
+	newPriceTotals := make(map[string][2]int64)
+	var miles, years int64
+
+	for _, vehicle := range vehicles {
+		if vehicle.Price <= 0 || vehicle.PriceWhenNew <= 0 {
+			continue
+		}
+		year, err := strconv.Atoi(vehicle.Year)
+		if err != nil || year <= 0 {
+			continue
+		}
+
+		pricedAt := vehicle.UpdatedAt
+		if pricedAt.IsZero() {
+			pricedAt = now
+		}
+		age := pricedAt.Year() - year
+		if age < 0 {
+			age = 0
+		}
+
+		// Prices far above the new price are feed mistakes
+		ratio := float64(vehicle.Price) / float64(vehicle.PriceWhenNew)
+		if ratio <= 1.5 {
+			ratios[age] = append(ratios[age], ratio)
+		}
+
+		for _, key := range []string{newPriceKey(vehicle.Make, ""), newPriceKey(vehicle.Make, vehicle.Model)} {
+			totals := newPriceTotals[key]
+			newPriceTotals[key] = [2]int64{totals[0] + vehicle.PriceWhenNew.Pence(), totals[1] + 1}
+		}
+
+		if age > 0 && vehicle.OdometerValue > 0 && !strings.EqualFold(vehicle.OdometerUnits, "kilometers") {
+			miles += int64(vehicle.OdometerValue)
+			years += int64(age)
+		}
+
+		if vehicle.VRM != "" {
+			figures.byVRM[models.NormaliseVRM(vehicle.VRM)] = knownVehicle{
+				make:     vehicle.Make,
+				model:    vehicle.Model,
+				year:     year,
+				newPrice: vehicle.PriceWhenNew,
+			}
+		}
+	}
+
+	for age := range ratios {
+		figures.ages = append(figures.ages, age)
+	}
+	sort.Ints(figures.ages)
+	for _, age := range figures.ages {
+		figures.retentions = append(figures.retentions, median(ratios[age]))
+	}
+
+	for key, totals := range newPriceTotals {
+		figures.newPrices[key] = models.Money(totals[0] / totals[1])
+	}
+
+	if years > 0 {
+		figures.milesPerYear = float64(miles) / float64(years)
+	}
+
+	return figures
+}
+
+// newPrice returns the average price when new of the make and model, falling back
+// to the make, or zero when we have never stocked the make
+func (f *stockFigures) newPrice(make, model string) models.Money {
+	if price, ok := f.newPrices[newPriceKey(make, model)]; ok && model != "" {
+		return price
+	}
+	return f.newPrices[newPriceKey(make, "")]
+}
+
+// retention returns the share of its new price a car of the given age is worth at
+// retail. Ages between those in stock are interpolated; ages beyond them follow
+// the default curve from the nearest age we have.
+func (f *stockFigures) retention(age int) float64 {
+	if len(f.ages) == 0 {
+		return defaultRetention(age)
+	}
+
+	upper := sort.SearchInts(f.ages, age)
+	switch {
+	case upper < len(f.ages) && f.ages[upper] == age:
+		return f.retentions[upper]
+	case upper == 0:
+		scaled := f.retentions[0] * defaultRetention(age) / defaultRetention(f.ages[0])
+		return math.Min(scaled, 1)
+	case upper == len(f.ages):
+		last := len(f.ages) - 1
+		return f.retentions[last] * defaultRetention(age) / defaultRetention(f.ages[last])
+	default:
+		lower := upper - 1
+		share := float64(age-f.ages[lower]) / float64(f.ages[upper]-f.ages[lower])
+		return f.retentions[lower] + share*(f.retentions[upper]-f.retentions[lower])
+	}
+}
+
+// mileageFactor scales a value for a mileage above or below what stock of the
+// same age has covered on average
+func (f *stockFigures) mileageFactor(age, mileage int) float64 {
+	expected := f.milesPerYear * math.Max(float64(age), 1)
+	factor := 1 - mileageAdjustment*(float64(mileage)-expected)/1000
+	return math.Max(minMileageFactor, math.Min(maxMileageFactor, factor))
+}
+
+// defaultRetention is the fallback depreciation curve
+func defaultRetention(age int) float64 {
+	return defaultFirstYearRetention * math.Pow(defaultAnnualRetention, float64(age))
+}
+
+// newPriceKey keys average new prices by make, or by make and model
+func newPriceKey(make, model string) string {
+	return strings.ToLower(strings.TrimSpace(make)) + "|" + strings.ToLower(strings.TrimSpace(model))
+}
+
+// median returns the middle of a set of values
+func median(values []float64) float64 {
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+
+	middle := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[middle-1] + sorted[middle]) / 2
+	}
+	return sorted[middle]
+}
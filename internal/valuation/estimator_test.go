@@ -0,0 +1,173 @@
+package valuation
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Candoo/vehicles-api/internal/models"
+)
+
+// stockSamples is a fixed set of valuation samples counting how often it is read
+type stockSamples struct {
+	vehicles []models.Vehicle
+	reads    int
+}
+
+func (s *stockSamples) GetValuationSamples() ([]models.Vehicle, error) {
+	s.reads++
+	return s.vehicles, nil
+}
+
+// sample builds a priced stock vehicle
+func sample(vrm, make, model, year string, pounds, newPence int64, miles int) models.Vehicle {
+	return models.Vehicle{
+		VRM:           vrm,
+		Make:          make,
+		Model:         model,
+		Year:          year,
+		Price:         models.MoneyFromPounds(pounds),
+		PriceWhenNew:  models.Money(newPence),
+		OdometerValue: miles,
+		OdometerUnits: "Miles",
+	}
+}
+
+func newTestEstimator() (*Estimator, *stockSamples) {
+	samples := &stockSamples{vehicles: []models.Vehicle{
+		sample("BX63NSJ", "Skoda", "Citigo", "2013", 4799, 743750, 60000),
+		sample("BX63ABC", "Skoda", "Citigo", "2013", 5200, 750000, 40000),
+		sample("MA18XYZ", "Ford", "Fiesta", "2018", 9000, 1500000, 40000),
+	}}
+	estimator := NewEstimator(samples)
+	estimator.Now = func() time.Time { return time.Date(2026, time.June, 1, 0, 0, 0, 0, time.UTC) }
+	return estimator, samples
+}
+
+func TestYearFromVRM(t *testing.T) {
+	tests := []struct {
+		vrm  string
+		year int
+		ok   bool
+	}{
+		{"BX63NSJ", 2013, true},
+		{"MA18XYZ", 2018, true},
+		{"LB51ABC", 2001, true},
+		{"AB02CDE", 2002, true},
+		{"YY25ABC", 2025, true},
+		{"AB01CDE", 0, false},
+		{"A123BCD", 0, false},
+		{"BX63 NSJ", 0, false},
+	}
+
+	for _, tt := range tests {
+		year, ok := YearFromVRM(tt.vrm)
+		if year != tt.year || ok != tt.ok {
+			t.Errorf("YearFromVRM(%q) = %d, %v, want %d, %v", tt.vrm, year, ok, tt.year, tt.ok)
+		}
+	}
+}
+
+func TestEstimatorValue(t *testing.T) {
+	estimator, _ := newTestEstimator()
+	ctx := context.Background()
+
+	tests := []struct {
+		name    string
+		request Request
+		want    string
+	}{
+		// Average new price of our Citigos at the median retention of 13 year old
+		// stock, at the expected mileage, less the trade margin
+		{"same age as stock", Request{Make: "Skoda", Model: "Citigo", Year: 2013, Mileage: 53529, Condition: models.ConditionGood}, "4240.00"},
+		{"higher mileage", Request{Make: "Skoda", Model: "Citigo", Year: 2013, Mileage: 73529, Condition: models.ConditionGood}, "3390.00"},
+		{"poor condition", Request{Make: "Skoda", Model: "Citigo", Year: 2013, Mileage: 53529, Condition: models.ConditionPoor}, "3180.00"},
+		// Interpolated between the 8 and 13 year old retentions
+		{"between stock ages", Request{Make: "Skoda", Model: "Citigo", Year: 2016, Mileage: 41176, Condition: models.ConditionGood}, "3980.00"},
+		// No Octavias in stock, so the average new price of every Skoda
+		{"make only", Request{Make: "skoda", Model: "Octavia", Year: 2013, Mileage: 53529, Condition: models.ConditionGood}, "4240.00"},
+		// A car we sold before is recognised by its VRM
+		{"known vrm", Request{VRM: "bx63 nsj", Mileage: 53529, Condition: models.ConditionGood}, "4230.00"},
+		// The year is read from the plate
+		{"year from vrm", Request{VRM: "AB18CDE", Make: "Ford", Model: "Fiesta", Mileage: 32941, Condition: models.ConditionGood}, "7650.00"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			value, err := estimator.Value(ctx, tt.request)
+			if err != nil {
+				t.Fatalf("Value: %v", err)
+			}
+			if value.String() != tt.want {
+				t.Errorf("value = %s, want %s", value, tt.want)
+			}
+		})
+	}
+
+	for name, request := range map[string]Request{
+		"unknown make": {Make: "Lada", Model: "Riva", Year: 2010, Mileage: 50000, Condition: models.ConditionGood},
+		"no year":      {VRM: "A123BCD", Make: "Skoda", Mileage: 50000, Condition: models.ConditionGood},
+	} {
+		if _, err := estimator.Value(ctx, request); !errors.Is(err, ErrNoValuation) {
+			t.Errorf("%s: err = %v, want ErrNoValuation", name, err)
+		}
+	}
+}
+
+func TestEstimatorRetentionCurve(t *testing.T) {
+	estimator, _ := newTestEstimator()
+	figures, err := estimator.stockFigures()
+	if err != nil {
+		t.Fatalf("stockFigures: %v", err)
+	}
+
+	// Newer than any stock follows the default curve up from the youngest age,
+	// older follows it down from the oldest
+	if got, want := figures.retention(7), 0.6/defaultAnnualRetention; !closeTo(got, want) {
+		t.Errorf("retention(7) = %f, want %f", got, want)
+	}
+	if got := figures.retention(0); got > 1 {
+		t.Errorf("retention(0) = %f, want at most 1", got)
+	}
+	if got, want := figures.retention(14), figures.retention(13)*defaultAnnualRetention; !closeTo(got, want) {
+		t.Errorf("retention(14) = %f, want %f", got, want)
+	}
+
+	empty := buildStockFigures(nil, time.Now())
+	if got := empty.retention(3); !closeTo(got, defaultRetention(3)) {
+		t.Errorf("default retention(3) = %f, want %f", got, defaultRetention(3))
+	}
+	if empty.milesPerYear != defaultMilesPerYear {
+		t.Errorf("default miles per year = %f", empty.milesPerYear)
+	}
+}
+
+func TestEstimatorCachesFigures(t *testing.T) {
+	estimator, samples := newTestEstimator()
+	now := estimator.Now()
+	estimator.Now = func() time.Time { return now }
+	request := Request{Make: "Ford", Model: "Fiesta", Year: 2018, Mileage: 30000, Condition: models.ConditionGood}
+
+	for i := 0; i < 3; i++ {
+		if _, err := estimator.Value(context.Background(), request); err != nil {
+			t.Fatalf("Value: %v", err)
+		}
+	}
+	if samples.reads != 1 {
+		t.Errorf("samples read %d times within the TTL, want 1", samples.reads)
+	}
+
+	now = now.Add(estimator.TTL)
+	if _, err := estimator.Value(context.Background(), request); err != nil {
+		t.Fatalf("Value: %v", err)
+	}
+	if samples.reads != 2 {
+		t.Errorf("samples read %d times after the TTL, want 2", samples.reads)
+	}
+}
+
+// closeTo compares ratios to six decimal places
+func closeTo(a, b float64) bool {
+	return a-b < 1e-6 && b-a < 1e-6
+}
@@ -0,0 +1,59 @@
+// Package valuation gives indicative part-exchange values for customers' cars.
+// Values come from a Provider; the default Estimator works them out from the
+// prices and new prices of our own stock.
+package valuation
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"strconv"
+
+	"github.com/Candoo/vehicles-api/internal/models"
+)
+
+// ErrNoValuation is returned by a provider that cannot value a car, e.g. a make it
+// knows nothing about. The part-exchange request is still worth keeping.
+var ErrNoValuation = errors.New("vehicle cannot be valued")
+
+// Request describes the car a customer wants to part-exchange
+type Request struct {
+	VRM       string
+	Make      string
+	Model     string
+	Year      int
+	Mileage   int
+	Condition models.VehicleCondition
+}
+
+// Provider values part-exchange cars
+type Provider interface {
+	// Value returns an indicative part-exchange value, or ErrNoValuation
+	Value(ctx context.Context, request Request) (models.Money, error)
+	// Name describes the provider for logs and stored part-exchange requests
+	Name() string
+}
+
+// currentPlate matches the registration marks issued since September 2001: two
+// letters for the area, a two digit age identifier and three random letters
+var currentPlate = regexp.MustCompile(`^[A-Z]{2}([0-9]{2})[A-Z]{3}$`)
+
+// YearFromVRM reads the year of first registration from a current-format
+// registration mark with the spaces removed. Identifiers 02 to 50 are issued from
+// March of 2002 to 2050 and 51 to 99 from September of 2001 to 2049.
+func YearFromVRM(vrm string) (int, bool) {
+	match := currentPlate.FindStringSubmatch(vrm)
+	if match == nil {
+		return 0, false
+	}
+
+	identifier, _ := strconv.Atoi(match[1])
+	switch {
+	case identifier >= 2 && identifier <= 50:
+		return 2000 + identifier, true
+	case identifier >= 51:
+		return 1950 + identifier, true
+	default:
+		return 0, false
+	}
+}
@@ -0,0 +1,45 @@
+package webhook
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/Candoo/vehicles-api/internal/models"
+)
+
+// Queue is the persistence the dispatcher needs
+type Queue interface {
+	// EnqueueWebhookDeliveries queues an event's payload for every endpoint
+	// subscribed to it, due at at
+	EnqueueWebhookDeliveries(event models.VehicleEvent, payload string, at time.Time) ([]models.WebhookDelivery, error)
+}
+
+// Dispatcher queues a delivery of each event it handles for the endpoints
+// subscribed to it. Deliveries are sent later by the Worker so a slow or failing
+// endpoint never holds up the change that caused the event.
+type Dispatcher struct {
+	queue Queue
+	// Now returns the current time; tests replace it
+	Now func() time.Time
+}
+
+// NewDispatcher creates a dispatcher queueing deliveries on queue
+func NewDispatcher(queue Queue) *Dispatcher {
+	return &Dispatcher{queue: queue, Now: time.Now}
+}
+
+// Handle queues the deliveries of an event. It is subscribed to the event bus, so
+// an error leaves the event in the outbox for the relay to publish again; queueing
+// an event twice queues its deliveries once.
+func (d *Dispatcher) Handle(event models.VehicleEvent) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to encode webhook event %s: %w", event.ID, err)
+	}
+
+	if _, err := d.queue.EnqueueWebhookDeliveries(event, string(payload), d.Now()); err != nil {
+		return fmt.Errorf("failed to queue webhook deliveries of event %s: %w", event.ID, err)
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+// Package webhook delivers vehicle events to registered endpoints. The Dispatcher
+// queues a delivery of each event for every endpoint subscribed to it and the
+// Worker sends them, signed with the endpoint's secret, retrying failures with
+// exponential backoff until they are delivered or run out of attempts.
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Headers sent with every delivery
+const (
+	// SignatureHeader carries the signature, see Sign
+	SignatureHeader = "X-Webhook-Signature"
+	// EventHeader carries the event type
+	EventHeader = "X-Webhook-Event"
+	// IDHeader carries the event ID, which receivers can use to drop duplicates
+	IDHeader = "X-Webhook-ID"
+)
+
+// SecretPrefix starts every signing secret
+const SecretPrefix = "whsec_"
+
+// Errors returned by Verify
+var (
+	ErrMalformedSignature = errors.New("malformed webhook signature")
+	ErrSignatureMismatch  = errors.New("webhook signature does not match")
+	ErrSignatureExpired   = errors.New("webhook signature timestamp outside tolerance")
+)
+
+// NewSecret returns a new random signing secret
+func NewSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return SecretPrefix + hex.EncodeToString(b), nil
+}
+
+// Sign returns the signature header of a body sent at timestamp:
+// t=<unix seconds>,v1=<hex HMAC-SHA256 of "<unix seconds>.<body>" keyed by secret>.
+// Signing the timestamp with the body lets receivers reject replayed deliveries.
+func Sign(secret string, timestamp time.Time, body []byte) string {
+	t := strconv.FormatInt(timestamp.Unix(), 10)
+	return "t=" + t + ",v1=" + signature(secret, t, body)
+}
+
+// Verify checks a signature header against a body, rejecting signatures made more
+// than tolerance away from now. A tolerance of 0 skips the timestamp check.
+func Verify(secret, header string, body []byte, tolerance time.Duration, now time.Time) error {
+	var t string
+	var signatures []string
+	for _, part := range strings.Split(header, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			return ErrMalformedSignature
+		}
+		switch key {
+		case "t":
+			t = value
+		case "v1":
+			signatures = append(signatures, value)
+		}
+	}
+
+	unix, err := strconv.ParseInt(t, 10, 64)
+	if err != nil || len(signatures) == 0 {
+		return ErrMalformedSignature
+	}
+	if tolerance > 0 {
+		age := now.Sub(time.Unix(unix, 0))
+		if age > tolerance || age < -tolerance {
+			return ErrSignatureExpired
+		}
+	}
+
+	expected := signature(secret, t, body)
+	for _, candidate := range signatures {
+		if hmac.Equal([]byte(candidate), []byte(expected)) {
+			return nil
+		}
+	}
+	return ErrSignatureMismatch
+}
+
+// signature returns the hex HMAC-SHA256 of "<t>.<body>"
+func signature(secret, t string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(t))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,382 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Candoo/vehicles-api/internal/events"
+	"github.com/Candoo/vehicles-api/internal/models"
+	"github.com/Candoo/vehicles-api/internal/repository"
+)
+
+// receiver is a local webhook endpoint that verifies signatures and answers with
+// the statuses it is given, then 204
+type receiver struct {
+	t        *testing.T
+	secret   string
+	mu       sync.Mutex
+	statuses []int
+	received []receivedDelivery
+}
+
+type receivedDelivery struct {
+	header http.Header
+	event  models.VehicleEvent
+}
+
+func newReceiver(t *testing.T, secret string, statuses ...int) (*receiver, *httptest.Server) {
+	rec := &receiver{t: t, secret: secret, statuses: statuses}
+	server := httptest.NewServer(rec)
+	t.Cleanup(server.Close)
+	return rec, server
+}
+
+func (r *receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := io.ReadAll(req.Body)
+	// The worker signs with its test clock, so the timestamp is not checked here
+	if err := Verify(r.secret, req.Header.Get(SignatureHeader), body, 0, time.Now()); err != nil {
+		r.t.Errorf("receiver: %v", err)
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	var event models.VehicleEvent
+	if err := json.Unmarshal(body, &event); err != nil {
+		r.t.Errorf("receiver: %v", err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.received = append(r.received, receivedDelivery{header: req.Header.Clone(), event: event})
+
+	status := http.StatusNoContent
+	if len(r.statuses) > 0 {
+		status, r.statuses = r.statuses[0], r.statuses[1:]
+	}
+	if status >= 300 {
+		http.Error(w, "try again later", status)
+		return
+	}
+	w.WriteHeader(status)
+}
+
+func (r *receiver) count() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.received)
+}
+
+// clock is a settable time source
+type clock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *clock) advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func TestSignAndVerify(t *testing.T) {
+	body := []byte(`{"id":"evt_1"}`)
+	at := time.Unix(1767225600, 0)
+	header := Sign("whsec_test", at, body)
+
+	if !strings.HasPrefix(header, "t=1767225600,v1=") {
+		t.Fatalf("header = %q", header)
+	}
+
+	tests := []struct {
+		name   string
+		secret string
+		header string
+		body   string
+		now    time.Time
+		want   error
+	}{
+		{"valid", "whsec_test", header, string(body), at.Add(time.Minute), nil},
+		{"other secret", "whsec_other", header, string(body), at, ErrSignatureMismatch},
+		{"tampered body", "whsec_test", header, `{"id":"evt_2"}`, at, ErrSignatureMismatch},
+		{"replayed", "whsec_test", header, string(body), at.Add(10 * time.Minute), ErrSignatureExpired},
+		{"rotated secrets", "whsec_test", "t=1767225600,v1=00," + strings.SplitN(header, ",", 2)[1], string(body), at, nil},
+		{"no signature", "whsec_test", "t=1767225600", string(body), at, ErrMalformedSignature},
+		{"garbage", "whsec_test", "nonsense", string(body), at, ErrMalformedSignature},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Verify(tt.secret, tt.header, []byte(tt.body), 5*time.Minute, tt.now)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("Verify = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewSecret(t *testing.T) {
+	first, err := NewSecret()
+	if err != nil {
+		t.Fatalf("NewSecret: %v", err)
+	}
+	second, _ := NewSecret()
+	if !strings.HasPrefix(first, SecretPrefix) || len(first) != len(SecretPrefix)+64 || first == second {
+		t.Errorf("secrets = %q, %q", first, second)
+	}
+}
+
+func TestBackoffDelay(t *testing.T) {
+	backoff := Backoff{Initial: 30 * time.Second, Max: 10 * time.Minute}
+	want := []time.Duration{30 * time.Second, time.Minute, 2 * time.Minute, 4 * time.Minute, 8 * time.Minute, 10 * time.Minute, 10 * time.Minute}
+	for i, delay := range want {
+		if got := backoff.Delay(i + 1); got != delay {
+			t.Errorf("Delay(%d) = %v, want %v", i+1, got, delay)
+		}
+	}
+	if got := backoff.Delay(200); got != 10*time.Minute {
+		t.Errorf("Delay(200) = %v, want the maximum", got)
+	}
+}
+
+// newTestWorker registers an endpoint at url on a memory store and returns a worker
+// and dispatcher for it running on a settable clock
+func newTestWorker(t *testing.T, url string, maxAttempts int) (*Worker, *Dispatcher, *repository.MemoryWebhookStore, *clock) {
+	t.Helper()
+	store := repository.NewMemoryWebhookStore()
+	endpoint := models.WebhookEndpoint{URL: url, Events: models.StringArray{models.WebhookAllEvents}, Secret: "whsec_test"}
+	if err := store.CreateWebhookEndpoint(&endpoint); err != nil {
+		t.Fatalf("CreateWebhookEndpoint: %v", err)
+	}
+
+	clk := &clock{now: time.Now()}
+	worker := NewWorker(store, maxAttempts, time.Second)
+	worker.Backoff = Backoff{Initial: time.Minute, Max: time.Hour}
+	worker.Now = clk.Now
+	dispatcher := NewDispatcher(store)
+	dispatcher.Now = clk.Now
+	return worker, dispatcher, store, clk
+}
+
+func TestDispatcherQueuesEventOnce(t *testing.T) {
+	rec, server := newReceiver(t, "whsec_test")
+	worker, dispatcher, _, _ := newTestWorker(t, server.URL, 5)
+
+	// The relay publishes an event again when it could not mark it published
+	event := models.VehicleEvent{ID: "evt_1", Type: models.EventVehicleSold, VehicleID: 7}
+	for i := 0; i < 2; i++ {
+		if err := dispatcher.Handle(event); err != nil {
+			t.Fatalf("Handle: %v", err)
+		}
+	}
+
+	if _, err := worker.Run(context.Background()); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if rec.count() != 1 {
+		t.Errorf("receiver got %d deliveries, want 1", rec.count())
+	}
+}
+
+func TestWorkerRetriesWithBackoff(t *testing.T) {
+	rec, server := newReceiver(t, "whsec_test", http.StatusServiceUnavailable, http.StatusInternalServerError)
+	worker, dispatcher, _, clk := newTestWorker(t, server.URL, 5)
+	if err := dispatcher.Handle(models.VehicleEvent{ID: "evt_1", Type: models.EventVehicleSold, VehicleID: 7}); err != nil {
+		t.Fatalf("Handle: %v", err)
+	}
+
+	run := func() []models.WebhookDelivery {
+		t.Helper()
+		deliveries, err := worker.Run(context.Background())
+		if err != nil {
+			t.Fatalf("Run: %v", err)
+		}
+		return deliveries
+	}
+
+	deliveries := run()
+	if len(deliveries) != 1 || deliveries[0].Status != models.WebhookDeliveryPending || deliveries[0].ResponseStatus != 503 {
+		t.Fatalf("first attempt = %+v, want pending after a 503", deliveries)
+	}
+	if !strings.Contains(deliveries[0].LastError, "503 Service Unavailable: try again later") {
+		t.Errorf("last error = %q", deliveries[0].LastError)
+	}
+	if want := clk.Now().Add(time.Minute); !deliveries[0].NextAttemptAt.Equal(want) {
+		t.Errorf("next attempt = %v, want %v", deliveries[0].NextAttemptAt, want)
+	}
+
+	// Not due again until the backoff has passed
+	clk.advance(59 * time.Second)
+	if deliveries := run(); len(deliveries) != 0 {
+		t.Fatalf("retried %d deliveries before the backoff passed", len(deliveries))
+	}
+
+	clk.advance(time.Second)
+	deliveries = run()
+	if len(deliveries) != 1 || deliveries[0].Attempts != 2 || deliveries[0].ResponseStatus != 500 {
+		t.Fatalf("second attempt = %+v", deliveries)
+	}
+	if want := clk.Now().Add(2 * time.Minute); !deliveries[0].NextAttemptAt.Equal(want) {
+		t.Errorf("next attempt = %v, want %v after doubling", deliveries[0].NextAttemptAt, want)
+	}
+
+	clk.advance(2 * time.Minute)
+	deliveries = run()
+	if len(deliveries) != 1 || deliveries[0].Status != models.WebhookDeliveryDelivered || deliveries[0].Attempts != 3 || deliveries[0].LastError != "" {
+		t.Fatalf("third attempt = %+v, want delivered", deliveries)
+	}
+
+	if rec.count() != 3 {
+		t.Fatalf("receiver got %d requests, want 3", rec.count())
+	}
+	header := rec.received[2].header
+	if header.Get(EventHeader) != "vehicle.sold" || header.Get(IDHeader) != "evt_1" || header.Get("Content-Type") != "application/json" {
+		t.Errorf("headers = %v", header)
+	}
+	if rec.received[2].event.VehicleID != 7 {
+		t.Errorf("payload = %+v", rec.received[2].event)
+	}
+
+	clk.advance(time.Hour)
+	if deliveries := run(); len(deliveries) != 0 {
+		t.Errorf("sent %d deliveries after delivery", len(deliveries))
+	}
+}
+
+func TestWorkerDeadLetters(t *testing.T) {
+	rec, server := newReceiver(t, "whsec_test", http.StatusBadGateway, http.StatusBadGateway, http.StatusBadGateway)
+	worker, dispatcher, store, clk := newTestWorker(t, server.URL, 3)
+	if err := dispatcher.Handle(models.VehicleEvent{ID: "evt_1", Type: models.EventVehicleDeleted, VehicleID: 7}); err != nil {
+		t.Fatalf("Handle: %v", err)
+	}
+
+	for attempt := 1; attempt <= 3; attempt++ {
+		if _, err := worker.Run(context.Background()); err != nil {
+			t.Fatalf("Run: %v", err)
+		}
+		clk.advance(time.Hour)
+	}
+
+	deadLetters, err := store.ListWebhookDeadLetters(0)
+	if err != nil {
+		t.Fatalf("ListWebhookDeadLetters: %v", err)
+	}
+	if len(deadLetters) != 1 || deadLetters[0].Attempts != 3 || deadLetters[0].ResponseStatus != 502 || deadLetters[0].EventID != "evt_1" {
+		t.Fatalf("dead letters = %+v", deadLetters)
+	}
+
+	deliveries, _, _ := store.ListWebhookDeliveries(models.WebhookDeliveryFilters{})
+	if len(deliveries) != 1 || deliveries[0].Status != models.WebhookDeliveryDead || deliveries[0].NextAttemptAt != nil {
+		t.Errorf("delivery = %+v, want dead", deliveries)
+	}
+
+	if _, err := store.RetryWebhookDeadLetter(deadLetters[0].ID, clk.Now()); err != nil {
+		t.Fatalf("RetryWebhookDeadLetter: %v", err)
+	}
+	retried, err := worker.Run(context.Background())
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if len(retried) != 1 || retried[0].Status != models.WebhookDeliveryDelivered || rec.count() != 4 {
+		t.Errorf("retried = %+v, want delivered on the fourth request", retried)
+	}
+}
+
+func TestWorkerUnreachableEndpoint(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	url := server.URL
+	server.Close()
+
+	worker, dispatcher, _, _ := newTestWorker(t, url, 1)
+	if err := dispatcher.Handle(models.VehicleEvent{ID: "evt_1", Type: models.EventVehicleCreated, VehicleID: 7}); err != nil {
+		t.Fatalf("Handle: %v", err)
+	}
+
+	deliveries, err := worker.Run(context.Background())
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if len(deliveries) != 1 || deliveries[0].Status != models.WebhookDeliveryDead || deliveries[0].ResponseStatus != 0 || deliveries[0].LastError == "" {
+		t.Errorf("deliveries = %+v, want dead with the connection error", deliveries)
+	}
+}
+
+// TestEndToEnd changes a vehicle, relays the events it recorded and checks the
+// receivers subscribed to the change get it
+func TestEndToEnd(t *testing.T) {
+	priceRec, priceServer := newReceiver(t, "whsec_prices")
+	allRec, allServer := newReceiver(t, "whsec_all")
+
+	webhooks := repository.NewMemoryWebhookStore()
+	for _, endpoint := range []models.WebhookEndpoint{
+		{URL: priceServer.URL, Events: models.StringArray{string(models.EventVehiclePriceChanged)}, Secret: "whsec_prices"},
+		{URL: allServer.URL, Events: models.StringArray{models.WebhookAllEvents}, Secret: "whsec_all"},
+	} {
+		if err := webhooks.CreateWebhookEndpoint(&endpoint); err != nil {
+			t.Fatalf("CreateWebhookEndpoint: %v", err)
+		}
+	}
+
+	bus := events.NewBus()
+	bus.Subscribe(NewDispatcher(webhooks).Handle)
+	store := repository.NewMemoryVehicleStore()
+	relay := events.NewRelay(store, bus)
+
+	vehicle := models.Vehicle{
+		VehicleID:            1,
+		Name:                 "Skoda Fabia",
+		Make:                 "Skoda",
+		Model:                "Fabia",
+		AdvertClassification: "Used",
+		FuelType:             "Petrol",
+		Transmission:         "Manual",
+		BodyType:             "Hatchback",
+		Year:                 "2018",
+		VRM:                  "AB18CDE",
+		StockID:              "STK1",
+		Price:                models.MoneyFromPounds(5000),
+		Source:               models.VehicleSourceAPI,
+	}
+	if err := store.CreateVehicle(&vehicle); err != nil {
+		t.Fatalf("CreateVehicle: %v", err)
+	}
+	vehicle.Price = models.MoneyFromPounds(4750)
+	if err := store.UpdateVehicle(1, &vehicle); err != nil {
+		t.Fatalf("UpdateVehicle: %v", err)
+	}
+	if _, err := relay.Run(); err != nil {
+		t.Fatalf("relay: %v", err)
+	}
+
+	deliveries, err := NewWorker(webhooks, 3, time.Second).Run(context.Background())
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if len(deliveries) != 4 {
+		t.Fatalf("sent %d deliveries, want 4", len(deliveries))
+	}
+
+	if priceRec.count() != 1 {
+		t.Fatalf("price receiver got %d deliveries, want 1", priceRec.count())
+	}
+	change := priceRec.received[0].event
+	if change.Type != models.EventVehiclePriceChanged || change.OldPrice.Pounds() != 5000 || change.NewPrice.Pounds() != 4750 || change.Vehicle == nil {
+		t.Errorf("price change = %+v", change)
+	}
+	if allRec.count() != 3 {
+		t.Errorf("catch-all receiver got %d deliveries, want 3", allRec.count())
+	}
+}
@@ -0,0 +1,201 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Candoo/vehicles-api/internal/models"
+)
+
+// Store is the persistence the worker needs
+type Store interface {
+	// ClaimWebhookDeliveries returns up to limit pending deliveries due by now, with
+	// their endpoints, and holds them back from other claims for lease
+	ClaimWebhookDeliveries(now time.Time, lease time.Duration, limit int) ([]models.WebhookDelivery, error)
+	// RecordWebhookAttempt stores the outcome of an attempt, dead-lettering a dead delivery
+	RecordWebhookAttempt(delivery *models.WebhookDelivery) error
+}
+
+// Backoff spaces out the retries of a failed delivery: the nth retry waits
+// Initial doubled n-1 times, up to Max
+type Backoff struct {
+	Initial time.Duration
+	Max     time.Duration
+}
+
+// DefaultBackoff retries after 30s, 1m, 2m, 4m and so on, waiting at most 6h
+var DefaultBackoff = Backoff{Initial: 30 * time.Second, Max: 6 * time.Hour}
+
+// Delay returns how long to wait after the given number of failed attempts
+func (b Backoff) Delay(attempts int) time.Duration {
+	delay := b.Initial
+	for i := 1; i < attempts && delay < b.Max; i++ {
+		delay *= 2
+	}
+	if delay > b.Max {
+		return b.Max
+	}
+	return delay
+}
+
+const (
+	// batchSize is the most deliveries sent at once
+	batchSize = 20
+	// maxErrorBody is how much of a failed response's body is kept
+	maxErrorBody = 200
+	userAgent    = "vehicles-api-webhooks/1.0"
+)
+
+// Worker sends due webhook deliveries. A 2xx response delivers a delivery; anything
+// else is retried after Backoff until MaxAttempts attempts have failed, when the
+// delivery is dead-lettered.
+type Worker struct {
+	store       Store
+	client      *http.Client
+	Backoff     Backoff
+	MaxAttempts int
+	// Now returns the current time; tests replace it
+	Now func() time.Time
+}
+
+// NewWorker creates a worker whose requests time out after timeout. Redirects are
+// not followed: a receiver that moved must be registered again.
+func NewWorker(store Store, maxAttempts int, timeout time.Duration) *Worker {
+	client := &http.Client{
+		Timeout: timeout,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	return &Worker{
+		store:       store,
+		client:      client,
+		Backoff:     DefaultBackoff,
+		MaxAttempts: maxAttempts,
+		Now:         time.Now,
+	}
+}
+
+// Run sends the deliveries that are due, all at once, and returns them with the
+// outcome of their attempts. A delivery whose outcome cannot be recorded is claimed
+// again once its lease runs out, so receivers may see an event more than once.
+func (w *Worker) Run(ctx context.Context) ([]models.WebhookDelivery, error) {
+	// The lease outlasts every request in the batch, which are sent in parallel
+	lease := 2*w.client.Timeout + time.Minute
+	deliveries, err := w.store.ClaimWebhookDeliveries(w.Now(), lease, batchSize)
+	if err != nil {
+		return nil, err
+	}
+
+	errs := make([]error, len(deliveries))
+	var wg sync.WaitGroup
+	for i := range deliveries {
+		wg.Add(1)
+		go func(delivery *models.WebhookDelivery) {
+			defer wg.Done()
+			w.attempt(ctx, delivery)
+			if recordErr := w.store.RecordWebhookAttempt(delivery); recordErr != nil {
+				errs[i] = fmt.Errorf("failed to record attempt of webhook delivery %d: %w", delivery.ID, recordErr)
+			}
+		}(&deliveries[i])
+	}
+	wg.Wait()
+
+	return deliveries, errors.Join(errs...)
+}
+
+// Start runs the worker immediately and then on every interval until the context is cancelled
+func (w *Worker) Start(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		deliveries, err := w.Run(ctx)
+		if err != nil {
+			log.Printf("Webhook delivery failed: %v", err)
+		}
+		for _, delivery := range deliveries {
+			if delivery.Status == models.WebhookDeliveryDead {
+				log.Printf("Webhook delivery %d of event %s to endpoint %d dead after %d attempts: %s",
+					delivery.ID, delivery.EventID, delivery.EndpointID, delivery.Attempts, delivery.LastError)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// attempt sends a delivery once and records the outcome on it
+func (w *Worker) attempt(ctx context.Context, delivery *models.WebhookDelivery) {
+	status, err := w.send(ctx, delivery)
+
+	at := w.Now()
+	delivery.Attempts++
+	delivery.LastAttemptAt = &at
+	delivery.ResponseStatus = status
+
+	if err == nil {
+		delivery.Status = models.WebhookDeliveryDelivered
+		delivery.DeliveredAt = &at
+		delivery.NextAttemptAt = nil
+		delivery.LastError = ""
+		return
+	}
+
+	delivery.LastError = err.Error()
+	if delivery.Attempts >= w.MaxAttempts {
+		delivery.Status = models.WebhookDeliveryDead
+		delivery.NextAttemptAt = nil
+		return
+	}
+	next := at.Add(w.Backoff.Delay(delivery.Attempts))
+	delivery.NextAttemptAt = &next
+}
+
+// send posts a delivery's payload to its endpoint, returning the response status
+// and an error unless it was a 2xx
+func (w *Worker) send(ctx context.Context, delivery *models.WebhookDelivery) (int, error) {
+	if delivery.Endpoint == nil {
+		return 0, errors.New("webhook endpoint no longer exists")
+	}
+
+	body := []byte(delivery.Payload)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.Endpoint.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", userAgent)
+	req.Header.Set(EventHeader, string(delivery.EventType))
+	req.Header.Set(IDHeader, delivery.EventID)
+	req.Header.Set(SignatureHeader, Sign(delivery.Endpoint.Secret, w.Now(), body))
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return resp.StatusCode, nil
+	}
+
+	snippet, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+	message := "receiver responded " + resp.Status
+	if text := strings.TrimSpace(string(snippet)); text != "" {
+		message += ": " + text
+	}
+	return resp.StatusCode, errors.New(message)
+}